@@ -6,10 +6,19 @@ import (
 	"cozy-insight-backend/internal/middleware"
 	"cozy-insight-backend/internal/repository"
 	"cozy-insight-backend/internal/service"
+	"cozy-insight-backend/pkg/cache"
+	"cozy-insight-backend/pkg/config"
+	"cozy-insight-backend/pkg/logger"
+	"cozy-insight-backend/pkg/secret"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
 )
 
+// fieldValuesCacheEntries 字段去重值缓存的最大条目数
+const fieldValuesCacheEntries = 1000
+
 func RegisterRoutes(r *gin.Engine, jwtSecret string) {
 	api := r.Group("/api/v1")
 
@@ -32,27 +41,42 @@ func RegisterRoutes(r *gin.Engine, jwtSecret string) {
 		authenticated.GET("/auth/me", authHandler.Me)
 
 		// 初始化 Calcite Client（SQL 引擎）
-		// TODO: 从配置文件读取这些参数
-		calciteClient, err := engine.NewCalciteClient(&engine.CalciteConfig{
-			AvaticaURL:      "http://localhost:8765/",
-			MaxOpenConns:    100,
-			MaxIdleConns:    20,
-			ConnMaxLifetime: 1 * 3600 * 1e9, // 1小时（纳秒）
-		}, nil) // 暂时不使用缓存
+		calciteClient, err := engine.NewCalciteClient(calciteConfig(), nil) // 暂时不使用缓存
+		if err != nil {
+			// Calcite 不可用时,单数据源查询仍可直连执行
+			logger.Log.Warn("calcite client initialization failed, using native execution only", zap.Error(err))
+		}
+
+		// 查询路由: 关系库优先直连,文档库下推为原生聚合,Calcite 作为备用并负责联邦查询
+		connManager := engine.NewConnectionManager(poolConfig())
+		documentStores := engine.NewDocumentStores()
+		queryRouter := engine.NewQueryRouter(
+			engine.NewNativeExecutor(connManager),
+			engine.NewDocumentExecutor(documentStores),
+			engine.NewCalciteExecutor(calciteClient),
+		)
+
+		// 抽取库: 上传文件等数据物化后的本地存储
+		extractStore, err := engine.NewExtractStore(extractPath())
 		if err != nil {
-			// 在生产环境应该 panic 或返回错误
-			// 这里暂时允许继续，但 SQL 功能不可用
-			r.GET("/health", func(c *gin.Context) {
-				c.JSON(500, gin.H{"error": "Calcite client initialization failed"})
-			})
+			logger.Log.Warn("extract store initialization failed, uploaded datasets unavailable", zap.Error(err))
+		}
+
+		// SQLite 数据源限制在数据目录内,且不能打开抽取库
+		if err := engine.SetSQLiteDataDir(sqliteDataDir(), extractPath()); err != nil {
+			logger.Log.Fatal("failed to initialize sqlite data directory", zap.Error(err))
 		}
 
 		// 创建数据源连接器
-		dsConnector := engine.NewDatasourceConnector(calciteClient)
+		dsConnector := engine.NewDatasourceConnector(connManager, documentStores)
+
+		// 管理员角色检查,用于全局运维类接口
+		roleRepo := repository.NewRoleRepository()
+		requireAdmin := middleware.RoleMiddleware(service.NewPermissionService(repository.NewPermissionRepository(), roleRepo), service.AdminRoleName)
 
 		// Datasource
 		dsRepo := repository.NewDatasourceRepository()
-		dsSvc := service.NewDatasourceService(dsRepo, dsConnector)
+		dsSvc := service.NewDatasourceService(dsRepo, dsConnector, credentialKeyring())
 		dsHandler := handler.NewDatasourceHandler(dsSvc)
 
 		dsGroup := authenticated.Group("/datasource")
@@ -62,6 +86,10 @@ func RegisterRoutes(r *gin.Engine, jwtSecret string) {
 			dsGroup.DELETE("/:id", dsHandler.Delete)
 			dsGroup.GET("/:id", dsHandler.Get)
 			dsGroup.GET("", dsHandler.List)
+			// 连接池状态,仅管理员
+			dsGroup.GET("/pools", requireAdmin, dsHandler.PoolStats)
+			// 凭据密钥轮换,仅管理员
+			dsGroup.POST("/credentials/rotate", requireAdmin, dsHandler.RotateCredentials)
 			// 连接测试
 			dsGroup.POST("/:id/test", dsHandler.TestConnection)
 			dsGroup.POST("/test", dsHandler.TestConnectionByConfig)
@@ -71,9 +99,22 @@ func RegisterRoutes(r *gin.Engine, jwtSecret string) {
 			dsGroup.GET("/:id/schema", dsHandler.GetTableSchema)
 		}
 
-		// Dataset
+		// 元数据目录: 快照、变更检测及影响分析
 		datasetRepo := repository.NewDatasetRepository()
-		datasetSvc := service.NewDatasetService(datasetRepo, calciteClient)
+		chartRepo := repository.NewChartRepository()
+		catalogSvc := service.NewMetadataCatalogService(repository.NewMetadataRepository(), dsRepo, datasetRepo, chartRepo, dsConnector)
+		catalogHandler := handler.NewMetadataCatalogHandler(catalogSvc)
+
+		catalogGroup := dsGroup.Group("/:id/catalog")
+		{
+			catalogGroup.GET("", catalogHandler.Get)
+			catalogGroup.POST("/refresh", catalogHandler.Refresh)
+			catalogGroup.GET("/snapshots", catalogHandler.ListSnapshots)
+			catalogGroup.GET("/snapshots/:snapshotId/changes", catalogHandler.GetChanges)
+		}
+
+		// Dataset
+		datasetSvc := service.NewDatasetService(datasetRepo, dsRepo, queryRouter, extractStore, engine.NewAPIConnector(nil))
 		datasetHandler := handler.NewDatasetHandler(datasetSvc)
 
 		datasetGroup := authenticated.Group("/dataset")
@@ -82,18 +123,68 @@ func RegisterRoutes(r *gin.Engine, jwtSecret string) {
 			datasetGroup.GET("/group", datasetHandler.ListGroups)
 			datasetGroup.POST("/table", datasetHandler.CreateTable)
 			datasetGroup.GET("/table", datasetHandler.ListTables)
+			// 文件上传 (CSV/Excel)
+			datasetGroup.POST("/table/upload", datasetHandler.Upload)
+			datasetGroup.POST("/table/:id/upload", datasetHandler.ReUpload)
+			// API 数据集重新抽取
+			datasetGroup.POST("/table/:id/extract", datasetHandler.Extract)
+			datasetGroup.POST("/table/:id/sync", datasetHandler.Sync)
+			datasetGroup.DELETE("/table/:id/sync", datasetHandler.DisableSync)
+			datasetGroup.GET("/table/:id/tasks", datasetHandler.ListSyncTasks)
 			// 数据预览
 			datasetGroup.GET("/table/:id/preview", datasetHandler.Preview)
 			// 字段管理
 			datasetGroup.GET("/table/:id/fields", datasetHandler.GetFields)
 			datasetGroup.POST("/table/:id/fields/sync", datasetHandler.SyncFields)
+			// 关联数据集
+			datasetGroup.GET("/table/:id/unions", datasetHandler.GetUnions)
+			datasetGroup.PUT("/table/:id/unions", datasetHandler.SaveUnions)
+		}
+
+		// 定时任务: 数据集同步和元数据目录刷新
+		scheduleSvc := service.NewScheduleService(repository.NewScheduleRepository())
+		scheduleSvc.RegisterHandler(service.TaskTypeDataSync, service.NewDataSyncHandler(datasetSvc))
+		scheduleSvc.RegisterHandler(service.TaskTypeMetadataRefresh, service.NewMetadataRefreshHandler(catalogSvc))
+		if err := scheduleSvc.Start(); err != nil {
+			logger.Log.Warn("schedule service start failed, scheduled tasks disabled", zap.Error(err))
+		}
+		scheduleHandler := handler.NewScheduleHandler(scheduleSvc)
+
+		scheduleGroup := authenticated.Group("/schedule")
+		{
+			scheduleGroup.POST("", scheduleHandler.Create)
+			scheduleGroup.PUT("/:id", scheduleHandler.Update)
+			scheduleGroup.DELETE("/:id", scheduleHandler.Delete)
+			scheduleGroup.GET("/:id", scheduleHandler.Get)
+			scheduleGroup.GET("", scheduleHandler.List)
+			scheduleGroup.POST("/:id/enable", scheduleHandler.Enable)
+			scheduleGroup.POST("/:id/disable", scheduleHandler.Disable)
+			scheduleGroup.POST("/:id/execute", scheduleHandler.Execute)
+		}
+
+		// 计算字段
+		calculatedFieldRepo := repository.NewCalculatedFieldRepository()
+		calculatedFieldHandler := handler.NewCalculatedFieldHandler(service.NewCalculatedFieldService(calculatedFieldRepo, datasetRepo))
+
+		// 字段去重值,供过滤组件的下拉选项使用,按调用者的行权限过滤
+		rowPermissionSvc := service.NewRowPermissionService(repository.NewRowPermissionRepository(), roleRepo)
+		fieldValuesSvc := service.NewFieldValuesService(datasetRepo, dsRepo, calculatedFieldRepo, rowPermissionSvc, queryRouter, extractStore, cache.NewMemoryCache(fieldValuesCacheEntries))
+		datasetGroup.GET("/:id/fields/:fieldId/values", handler.NewFieldValuesHandler(fieldValuesSvc).Values)
+
+		calculatedGroup := authenticated.Group("/dataset/calculated-field")
+		{
+			calculatedGroup.POST("", calculatedFieldHandler.Create)
+			// 表达式校验,返回带位置的语法和类型错误
+			calculatedGroup.POST("/validate", calculatedFieldHandler.Validate)
+			calculatedGroup.PUT("/:id", calculatedFieldHandler.Update)
+			calculatedGroup.GET("/table/:tableId", calculatedFieldHandler.List)
+			calculatedGroup.DELETE("/:id", calculatedFieldHandler.Delete)
 		}
 
 		// Chart
-		chartRepo := repository.NewChartRepository()
-		datasetRepo = repository.NewDatasetRepository()
 		chartSvc := service.NewChartService(chartRepo)
-		chartDataSvc := service.NewChartDataService(chartRepo, datasetRepo, calciteClient)
+		chartDrillRepo := repository.NewChartDrillRepository()
+		chartDataSvc := service.NewChartDataService(chartRepo, datasetRepo, dsRepo, calculatedFieldRepo, chartDrillRepo, queryRouter, extractStore)
 		chartHandler := handler.NewChartHandler(chartSvc, chartDataSvc)
 
 		chartGroup := authenticated.Group("/chart")
@@ -103,13 +194,21 @@ func RegisterRoutes(r *gin.Engine, jwtSecret string) {
 			chartGroup.DELETE("/:id", chartHandler.Delete)
 			chartGroup.GET("/:id", chartHandler.Get)
 			chartGroup.GET("/:id/data", chartHandler.GetData) // 获取图表数据
+			chartGroup.POST("/:id/data", chartHandler.QueryData)
 			chartGroup.GET("", chartHandler.List)
 		}
 
 		// Dashboard
 		dashboardRepo := repository.NewDashboardRepository()
-		dashboardSvc := service.NewDashboardService(dashboardRepo)
+		dashboardComponentRepo := repository.NewDashboardComponentRepository()
+		dashboardSvc := service.NewDashboardService(dashboardRepo, dashboardComponentRepo)
 		dashboardHandler := handler.NewDashboardHandler(dashboardSvc)
+		linkageSvc := service.NewDashboardLinkageService(dashboardRepo, dashboardComponentRepo, repository.NewLinkageRepository(), chartRepo, datasetRepo, calculatedFieldRepo, chartDataSvc)
+		linkageHandler := handler.NewDashboardLinkageHandler(linkageSvc)
+		dashboardParamRepo := repository.NewDashboardParameterRepository()
+		dashboardParamHandler := handler.NewDashboardParameterHandler(service.NewDashboardParameterService(dashboardParamRepo, dashboardRepo, dashboardComponentRepo, chartRepo, datasetRepo, calculatedFieldRepo, chartDataSvc))
+		workers, timeout := dashboardQueryConfig()
+		dashboardDataHandler := handler.NewDashboardDataHandler(service.NewDashboardDataService(dashboardRepo, dashboardComponentRepo, dashboardParamRepo, chartRepo, datasetRepo, chartDataSvc, workers, timeout))
 
 		dashboards := authenticated.Group("/dashboard")
 		{
@@ -122,9 +221,123 @@ func RegisterRoutes(r *gin.Engine, jwtSecret string) {
 			// 发布相关
 			dashboards.POST("/:id/publish", dashboardHandler.Publish)
 			dashboards.POST("/:id/unpublish", dashboardHandler.Unpublish)
+
+			// 仪表板参数,按字段映射作为各组件的过滤条件
+			dashboards.GET("/:id/parameters", dashboardParamHandler.List)
+			dashboards.POST("/:id/parameters", dashboardParamHandler.Create)
+			dashboards.PUT("/:id/parameters/:paramId", dashboardParamHandler.Update)
+			dashboards.DELETE("/:id/parameters/:paramId", dashboardParamHandler.Delete)
+			dashboards.GET("/:id/parameters/:paramId/options", dashboardParamHandler.Options)
+
+			// 批量获取所有图表组件的数据
+			dashboards.GET("/:id/data", dashboardDataHandler.GetData)
+
+			// 组件联动,返回受影响组件刷新后的数据
+			dashboards.POST("/:id/linkage", linkageHandler.Trigger)
 		}
 
 		// 公开访问（无需认证，但仍在注册函数内）
 		r.GET("/api/v1/dashboard/:id/view", dashboardHandler.View)
+
+		shareDataHandler := handler.NewShareDataHandler(service.NewShareService(repository.NewShareRepository()), chartDataSvc)
+		r.GET("/api/v1/share/:token/data", shareDataHandler.ChartData)
+	}
+}
+
+// calciteConfig 读取 Calcite 配置,未加载配置文件时使用默认值
+func calciteConfig() *engine.CalciteConfig {
+	cfg := &engine.CalciteConfig{
+		AvaticaURL:      "http://localhost:8765/",
+		MaxOpenConns:    100,
+		MaxIdleConns:    20,
+		ConnMaxLifetime: time.Hour,
+	}
+	if config.GlobalConfig == nil {
+		return cfg
+	}
+
+	c := config.GlobalConfig.Calcite
+	if c.AvaticaURL != "" {
+		cfg.AvaticaURL = c.AvaticaURL
+	}
+	if c.MaxOpenConns > 0 {
+		cfg.MaxOpenConns = c.MaxOpenConns
+	}
+	if c.MaxIdleConns > 0 {
+		cfg.MaxIdleConns = c.MaxIdleConns
+	}
+	if c.ConnMaxLifetime > 0 {
+		cfg.ConnMaxLifetime = c.ConnMaxLifetime
+	}
+	return cfg
+}
+
+// poolConfig 读取数据源连接池配置,未加载配置文件时使用默认值
+func poolConfig() *engine.PoolConfig {
+	cfg := &engine.PoolConfig{
+		MaxOpenConns:    20,
+		MaxIdleConns:    5,
+		ConnMaxLifetime: 30 * time.Minute,
+		IdleTimeout:     10 * time.Minute,
+	}
+	if config.GlobalConfig == nil {
+		return cfg
+	}
+
+	c := config.GlobalConfig.Pool
+	if c.MaxOpenConns > 0 {
+		cfg.MaxOpenConns = c.MaxOpenConns
+	}
+	if c.MaxIdleConns > 0 {
+		cfg.MaxIdleConns = c.MaxIdleConns
+	}
+	if c.ConnMaxLifetime > 0 {
+		cfg.ConnMaxLifetime = c.ConnMaxLifetime
+	}
+	if c.IdleTimeout > 0 {
+		cfg.IdleTimeout = c.IdleTimeout
+	}
+	return cfg
+}
+
+// extractPath 抽取库文件路径
+func extractPath() string {
+	if config.GlobalConfig != nil && config.GlobalConfig.Extract.Path != "" {
+		return config.GlobalConfig.Extract.Path
+	}
+	return "data/extract.db"
+}
+
+// sqliteDataDir SQLite 数据源文件目录
+func sqliteDataDir() string {
+	if config.GlobalConfig != nil && config.GlobalConfig.SQLite.DataDir != "" {
+		return config.GlobalConfig.SQLite.DataDir
+	}
+	return "data/sqlite"
+}
+
+// dashboardQueryConfig 仪表板批量查询的并发数和超时,未配置时由服务使用默认值
+func dashboardQueryConfig() (int, time.Duration) {
+	if config.GlobalConfig == nil {
+		return 0, 0
+	}
+	c := config.GlobalConfig.Dashboard
+	return c.QueryWorkers, c.QueryTimeout
+}
+
+// credentialKeyring 根据配置创建凭据密钥环并注册为连接解密器,未配置主密钥时凭据不加密
+func credentialKeyring() *secret.Keyring {
+	if config.GlobalConfig == nil || len(config.GlobalConfig.Security.MasterKeys) == 0 {
+		logger.Log.Warn("no master key configured, datasource credentials are stored unencrypted")
+		return nil
+	}
+
+	c := config.GlobalConfig.Security
+	keyring, err := secret.NewKeyring(c.MasterKeys, c.ActiveKey)
+	if err != nil {
+		logger.Log.Warn("invalid master key configuration, datasource credentials are stored unencrypted", zap.Error(err))
+		return nil
 	}
+	engine.SetCredentialDecrypter(keyring)
+	return keyring
 }
@@ -68,7 +68,7 @@ func main() {
 	scheduleService := service.NewScheduleService(scheduleRepo)
 	operLogService := service.NewOperLogService(operLogRepo)
 	systemSettingService := service.NewSystemSettingService(systemSettingRepo)
-	calculatedFieldService := service.NewCalculatedFieldService(calculatedFieldRepo)
+	calculatedFieldService := service.NewCalculatedFieldService(calculatedFieldRepo, datasetRepo)
 	datasetGroupService := service.NewDatasetGroupService(datasetRepo)
 	rowPermissionService := service.NewRowPermissionService(rowPermissionRepo, roleRepo)
 
@@ -238,6 +238,8 @@ func main() {
 			calculatedField := authenticated.Group("/dataset/calculated-field")
 			{
 				calculatedField.POST("", calculatedFieldHandler.Create)
+				calculatedField.POST("/validate", calculatedFieldHandler.Validate)
+				calculatedField.PUT("/:id", calculatedFieldHandler.Update)
 				calculatedField.GET("/table/:tableId", calculatedFieldHandler.List)
 				calculatedField.DELETE("/:id", calculatedFieldHandler.Delete)
 			}
@@ -147,10 +147,39 @@ CREATE TABLE IF NOT EXISTS `dataset_table_field` (
   `de_extra_type` INT DEFAULT 0,
   `checked` TINYINT DEFAULT 1,
   `column_index` INT DEFAULT 0,
+  `missing` TINYINT DEFAULT 0 COMMENT '源中已不存在的列',
   INDEX idx_table (dataset_table_id),
   INDEX idx_name (name)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='数据集字段';
 
+-- 数据集关联
+CREATE TABLE IF NOT EXISTS `dataset_table_union` (
+  `id` VARCHAR(50) PRIMARY KEY,
+  `dataset_table_id` VARCHAR(50) NOT NULL COMMENT '关联数据集',
+  `parent_table_id` VARCHAR(50),
+  `parent_field_id` VARCHAR(50),
+  `current_table_id` VARCHAR(50),
+  `current_field_id` VARCHAR(50),
+  `union_type` VARCHAR(50) COMMENT 'left, right, inner, full',
+  `create_time` BIGINT,
+  INDEX idx_table (dataset_table_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='数据集关联';
+
+-- 数据集抽取任务
+CREATE TABLE IF NOT EXISTS `dataset_table_task` (
+  `id` VARCHAR(50) PRIMARY KEY,
+  `table_id` VARCHAR(50) NOT NULL,
+  `type` VARCHAR(50) COMMENT 'all_scope, incremental',
+  `status` VARCHAR(50) COMMENT 'pending, running, success, failed',
+  `start_time` BIGINT DEFAULT 0,
+  `end_time` BIGINT DEFAULT 0,
+  `info` TEXT COMMENT 'JSON: 增量配置、行数、水位、错误信息',
+  `last_exec_status` VARCHAR(50),
+  `create_time` BIGINT,
+  `update_time` BIGINT,
+  INDEX idx_table (table_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='数据集抽取任务';
+
 -- ============================================
 -- 图表表
 -- ============================================
@@ -243,7 +272,7 @@ CREATE TABLE IF NOT EXISTS `sys_share` (
 CREATE TABLE IF NOT EXISTS `sys_schedule_task` (
   `id` VARCHAR(50) PRIMARY KEY,
   `name` VARCHAR(200) NOT NULL,
-  `type` VARCHAR(50) COMMENT 'email_report, snapshot, data_sync',
+  `type` VARCHAR(50) COMMENT 'email_report, snapshot, data_sync, metadata_refresh',
   `cron_expr` VARCHAR(100),
   `enabled` TINYINT DEFAULT 0,
   `status` VARCHAR(20) COMMENT 'active, inactive, running',
@@ -348,6 +377,7 @@ CREATE TABLE IF NOT EXISTS `dashboard_parameter` (
   `param_type` VARCHAR(50) COMMENT 'text, date, select, multiselect',
   `default_value` VARCHAR(500),
   `options` TEXT COMMENT 'JSON数组',
+  `field_mapping` TEXT COMMENT 'JSON对象,组件ID -> 字段',
   `required` TINYINT DEFAULT 0,
   `enable` TINYINT DEFAULT 1,
   `create_time` BIGINT,
@@ -426,5 +456,34 @@ CREATE TABLE IF NOT EXISTS `chart_template` (
   `create_by` VARCHAR(50)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='图表模板';
 
+-- 元数据快照表
+CREATE TABLE IF NOT EXISTS `core_metadata_snapshot` (
+  `id` VARCHAR(50) PRIMARY KEY,
+  `datasource_id` VARCHAR(50),
+  `status` VARCHAR(20) COMMENT 'success, failed',
+  `error` TEXT,
+  `table_count` INT,
+  `column_count` INT,
+  `change_count` INT,
+  `catalog` LONGTEXT COMMENT '数据库、表和字段JSON',
+  `create_time` BIGINT,
+  INDEX idx_datasource (datasource_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='元数据快照';
+
+-- 元数据变更表
+CREATE TABLE IF NOT EXISTS `core_metadata_change` (
+  `id` VARCHAR(50) PRIMARY KEY,
+  `snapshot_id` VARCHAR(50),
+  `datasource_id` VARCHAR(50),
+  `change_type` VARCHAR(50) COMMENT 'table_added, table_removed, column_added, column_removed, column_type_changed',
+  `table_name` VARCHAR(255),
+  `column_name` VARCHAR(255),
+  `old_type` VARCHAR(100),
+  `new_type` VARCHAR(100),
+  `create_time` BIGINT,
+  INDEX idx_snapshot (snapshot_id),
+  INDEX idx_datasource (datasource_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='元数据变更';
+
 COMMIT;
 
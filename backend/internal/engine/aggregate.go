@@ -0,0 +1,89 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+)
+
+// 聚合函数
+const (
+	AggregateSum                 = "SUM"
+	AggregateAvg                 = "AVG"
+	AggregateCount               = "COUNT"
+	AggregateMax                 = "MAX"
+	AggregateMin                 = "MIN"
+	AggregateCountDistinct       = "COUNT_DISTINCT"
+	AggregateApproxCountDistinct = "APPROX_COUNT_DISTINCT"
+	AggregateMedian              = "MEDIAN"
+	AggregateP90                 = "P90"
+	AggregateP95                 = "P95"
+	AggregateP99                 = "P99"
+	AggregateStddev              = "STDDEV"
+	AggregateVariance            = "VARIANCE"
+	AggregateFirst               = "FIRST"
+	AggregateLast                = "LAST"
+)
+
+// supportedAggregates 各数据源通用的基础聚合函数
+var supportedAggregates = map[string]bool{
+	AggregateSum:   true,
+	AggregateAvg:   true,
+	AggregateCount: true,
+	AggregateMax:   true,
+	AggregateMin:   true,
+}
+
+// extendedAggregates 由方言编译的扩展聚合函数
+var extendedAggregates = map[string]bool{
+	AggregateCountDistinct:       true,
+	AggregateApproxCountDistinct: true,
+	AggregateMedian:              true,
+	AggregateP90:                 true,
+	AggregateP95:                 true,
+	AggregateP99:                 true,
+	AggregateStddev:              true,
+	AggregateVariance:            true,
+	AggregateFirst:               true,
+	AggregateLast:                true,
+}
+
+// aggregatePercentiles 百分位类聚合对应的分位数
+var aggregatePercentiles = map[string]float64{
+	AggregateMedian: 0.5,
+	AggregateP90:    0.9,
+	AggregateP95:    0.95,
+	AggregateP99:    0.99,
+}
+
+// IsAggregate 是否为支持的聚合函数(不区分大小写)
+func IsAggregate(name string) bool {
+	name = strings.ToUpper(name)
+	return supportedAggregates[name] || extendedAggregates[name]
+}
+
+// AggregateNeedsOrder 聚合函数是否需要排序字段(FIRST、LAST)
+func AggregateNeedsOrder(name string) bool {
+	name = strings.ToUpper(name)
+	return name == AggregateFirst || name == AggregateLast
+}
+
+// buildAggregate 编译聚合表达式,基础聚合直接生成,扩展聚合交给方言
+func buildAggregate(d Dialect, name, expr, orderExpr string) (string, error) {
+	agg := strings.ToUpper(name)
+	switch {
+	case supportedAggregates[agg]:
+		return fmt.Sprintf("%s(%s)", agg, expr), nil
+	case extendedAggregates[agg]:
+		if AggregateNeedsOrder(agg) && orderExpr == "" {
+			return "", fmt.Errorf("%s requires an order field", agg)
+		}
+		return d.AggregateFunc(agg, expr, orderExpr)
+	default:
+		return "", fmt.Errorf("unsupported aggregate: %s", name)
+	}
+}
+
+// unsupportedAggregate 方言不支持的扩展聚合
+func unsupportedAggregate(dialect, name string) error {
+	return fmt.Errorf("aggregate %s is not supported by %s", name, dialect)
+}
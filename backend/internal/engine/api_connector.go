@@ -0,0 +1,465 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"cozy-insight-backend/internal/model"
+)
+
+// API 分页方式
+const (
+	PaginationNone   = "none"
+	PaginationPage   = "page"
+	PaginationOffset = "offset"
+	PaginationCursor = "cursor"
+)
+
+// 分页默认值
+const (
+	defaultAPIPageSize = 100
+	defaultAPIMaxPages = 100
+	maxAPIResponseSize = 32 << 20
+)
+
+// APIConnector REST/JSON 接口连接器: 请求接口、按路径提取数据行、展开嵌套对象并处理分页
+type APIConnector struct {
+	client *http.Client
+}
+
+// APIFetchResult 接口数据抽取结果
+type APIFetchResult struct {
+	Columns []ExtractColumn
+	Rows    [][]interface{}
+	Pages   int
+}
+
+// NewAPIConnector 创建接口连接器, client 为 nil 时使用 30 秒超时的默认客户端
+func NewAPIConnector(client *http.Client) *APIConnector {
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	return &APIConnector{client: client}
+}
+
+// ParseAPIConfig 解析接口数据源配置
+func ParseAPIConfig(configJSON string) (*model.APIDatasourceConfig, error) {
+	configJSON, err := DecryptConfig(configJSON)
+	if err != nil {
+		return nil, err
+	}
+	var cfg model.APIDatasourceConfig
+	if err := json.Unmarshal([]byte(configJSON), &cfg); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("api url is required")
+	}
+	if cfg.ResponseType != "" && cfg.ResponseType != "json" {
+		return nil, fmt.Errorf("unsupported response type: %s", cfg.ResponseType)
+	}
+	return &cfg, nil
+}
+
+// TestConnection 请求第一页数据验证接口可用并能提取数据行
+func (c *APIConnector) TestConnection(ctx context.Context, cfg *model.APIDatasourceConfig) *ConnectionTestResult {
+	start := time.Now()
+	result := &ConnectionTestResult{}
+
+	body, err := c.request(ctx, cfg, nil)
+	if err == nil {
+		var rows []interface{}
+		rows, err = extractRows(body, cfg.RowsPath)
+		if err == nil {
+			result.Success = true
+			result.Message = fmt.Sprintf("Connection successful, %d rows in first page", len(rows))
+		}
+	}
+	if err != nil {
+		result.Message = fmt.Sprintf("Connection failed: %v", err)
+	}
+	result.Time = time.Since(start).Milliseconds()
+	return result
+}
+
+// Fetch 按分页配置读取全部数据行,展开为列并推断列类型
+func (c *APIConnector) Fetch(ctx context.Context, cfg *model.APIDatasourceConfig) (*APIFetchResult, error) {
+	p := cfg.Pagination
+	if p == nil {
+		p = &model.APIPagination{Type: PaginationNone}
+	}
+	pageSize := p.PageSize
+	if pageSize <= 0 {
+		pageSize = defaultAPIPageSize
+	}
+	maxPages := p.MaxPages
+	if maxPages <= 0 {
+		maxPages = defaultAPIMaxPages
+	}
+
+	var (
+		records []map[string]interface{}
+		pages   int
+		cursor  string
+	)
+	for pages < maxPages {
+		params, err := pageParams(p, pages, pageSize, cursor)
+		if err != nil {
+			return nil, err
+		}
+
+		body, err := c.request(ctx, cfg, params)
+		if err != nil {
+			return nil, err
+		}
+		rows, err := extractRows(body, cfg.RowsPath)
+		if err != nil {
+			return nil, err
+		}
+		pages++
+
+		for _, row := range rows {
+			flat := make(map[string]interface{})
+			flattenValue("", row, flat)
+			records = append(records, flat)
+		}
+
+		switch p.Type {
+		case PaginationPage, PaginationOffset:
+			if len(rows) < pageSize {
+				return buildFetchResult(records, pages), nil
+			}
+		case PaginationCursor:
+			next, err := lookupPath(body, p.CursorPath)
+			if err != nil || next == nil || fmt.Sprint(next) == "" {
+				return buildFetchResult(records, pages), nil
+			}
+			cursor = fmt.Sprint(next)
+		default:
+			return buildFetchResult(records, pages), nil
+		}
+	}
+
+	return buildFetchResult(records, pages), nil
+}
+
+// request 发送一次请求并解析 JSON 响应
+func (c *APIConnector) request(ctx context.Context, cfg *model.APIDatasourceConfig, params url.Values) (interface{}, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid api url: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported url scheme: %s", u.Scheme)
+	}
+	if len(params) > 0 {
+		query := u.Query()
+		for k, v := range params {
+			query[k] = v
+		}
+		u.RawQuery = query.Encode()
+	}
+
+	method := strings.ToUpper(cfg.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+	if method != http.MethodGet && method != http.MethodPost {
+		return nil, fmt.Errorf("unsupported method: %s", cfg.Method)
+	}
+
+	var body io.Reader
+	if method == http.MethodPost && cfg.Body != "" {
+		body = strings.NewReader(cfg.Body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for k, v := range cfg.Headers {
+		req.Header.Set(k, v)
+	}
+
+	switch cfg.AuthType {
+	case "", "none":
+	case "bearer":
+		req.Header.Set("Authorization", "Bearer "+cfg.AuthToken)
+	case "basic":
+		user, pass, _ := strings.Cut(cfg.AuthToken, ":")
+		req.SetBasicAuth(user, pass)
+	default:
+		return nil, fmt.Errorf("unsupported auth type: %s", cfg.AuthType)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	decoder := json.NewDecoder(io.LimitReader(resp.Body, maxAPIResponseSize))
+	decoder.UseNumber()
+	var result interface{}
+	if err := decoder.Decode(&result); err != nil {
+		return nil, fmt.Errorf("invalid json response: %w", err)
+	}
+	return result, nil
+}
+
+// pageParams 第 page 次请求(从0开始)的分页参数
+func pageParams(p *model.APIPagination, page, pageSize int, cursor string) (url.Values, error) {
+	params := url.Values{}
+	switch p.Type {
+	case "", PaginationNone:
+	case PaginationPage:
+		start := p.StartPage
+		if p.StartPage == 0 {
+			start = 1
+		}
+		params.Set(paramName(p.PageParam, "page"), strconv.Itoa(start+page))
+		params.Set(paramName(p.SizeParam, "pageSize"), strconv.Itoa(pageSize))
+	case PaginationOffset:
+		params.Set(paramName(p.OffsetParam, "offset"), strconv.Itoa(page*pageSize))
+		params.Set(paramName(p.SizeParam, "limit"), strconv.Itoa(pageSize))
+	case PaginationCursor:
+		if p.CursorPath == "" {
+			return nil, fmt.Errorf("cursor pagination requires cursorPath")
+		}
+		if cursor != "" {
+			params.Set(paramName(p.CursorParam, "cursor"), cursor)
+		}
+		if p.SizeParam != "" {
+			params.Set(p.SizeParam, strconv.Itoa(pageSize))
+		}
+	default:
+		return nil, fmt.Errorf("unsupported pagination type: %s", p.Type)
+	}
+	return params, nil
+}
+
+func paramName(name, fallback string) string {
+	if name == "" {
+		return fallback
+	}
+	return name
+}
+
+// extractRows 按路径取出数据行数组
+func extractRows(body interface{}, path string) ([]interface{}, error) {
+	value, err := lookupPath(body, path)
+	if err != nil {
+		return nil, err
+	}
+	switch v := value.(type) {
+	case []interface{}:
+		return v, nil
+	case map[string]interface{}:
+		// 单个对象视为一行
+		return []interface{}{v}, nil
+	case nil:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("value at %q is not an array", path)
+	}
+}
+
+// lookupPath 按 JSONPath 风格的路径取值,支持 $.a.b、a.b[0].c 形式
+func lookupPath(body interface{}, path string) (interface{}, error) {
+	path = strings.TrimPrefix(strings.TrimSpace(path), "$")
+	path = strings.TrimPrefix(path, ".")
+	if path == "" {
+		return body, nil
+	}
+
+	current := body
+	for _, segment := range strings.Split(path, ".") {
+		name := segment
+		var indexes []int
+		if i := strings.Index(segment, "["); i >= 0 {
+			name = segment[:i]
+			rest := segment[i:]
+			for rest != "" {
+				end := strings.Index(rest, "]")
+				if !strings.HasPrefix(rest, "[") || end < 0 {
+					return nil, fmt.Errorf("invalid path segment: %s", segment)
+				}
+				idx, err := strconv.Atoi(rest[1:end])
+				if err != nil {
+					return nil, fmt.Errorf("invalid index in path segment: %s", segment)
+				}
+				indexes = append(indexes, idx)
+				rest = rest[end+1:]
+			}
+		}
+
+		if name != "" {
+			obj, ok := current.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("path %q: %s is not an object", path, name)
+			}
+			current = obj[name]
+		}
+		for _, idx := range indexes {
+			arr, ok := current.([]interface{})
+			if !ok || idx < 0 || idx >= len(arr) {
+				return nil, fmt.Errorf("path %q: index %d out of range", path, idx)
+			}
+			current = arr[idx]
+		}
+	}
+	return current, nil
+}
+
+// flattenValue 将嵌套对象展开为以点号连接的列,数组序列化为 JSON 字符串
+func flattenValue(prefix string, value interface{}, out map[string]interface{}) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if len(v) == 0 && prefix != "" {
+			out[prefix] = nil
+			return
+		}
+		for key, child := range v {
+			name := key
+			if prefix != "" {
+				name = prefix + "." + key
+			}
+			flattenValue(name, child, out)
+		}
+	case []interface{}:
+		data, _ := json.Marshal(v)
+		out[prefixOrValue(prefix)] = string(data)
+	default:
+		out[prefixOrValue(prefix)] = v
+	}
+}
+
+func prefixOrValue(prefix string) string {
+	if prefix == "" {
+		return "value"
+	}
+	return prefix
+}
+
+// buildFetchResult 汇总列名并按列推断类型
+func buildFetchResult(records []map[string]interface{}, pages int) *APIFetchResult {
+	seen := make(map[string]bool)
+	var names []string
+	for _, record := range records {
+		var keys []string
+		for key := range record {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+		// 同一行内按名称排序,保证列顺序稳定
+		sort.Strings(keys)
+		names = append(names, keys...)
+	}
+
+	columns := make([]ExtractColumn, len(names))
+	for i, name := range names {
+		columns[i] = ExtractColumn{Name: name, Type: inferColumnType(records, name)}
+	}
+
+	rows := make([][]interface{}, len(records))
+	for r, record := range records {
+		row := make([]interface{}, len(columns))
+		for i, col := range columns {
+			row[i] = convertJSONValue(record[col.Name], col.Type)
+		}
+		rows[r] = row
+	}
+
+	return &APIFetchResult{Columns: columns, Rows: rows, Pages: pages}
+}
+
+// inferColumnType 根据 JSON 或文档值推断列类型: 全为整数时 INTEGER,全为数值时 REAL,
+// 全为时间时 TIMESTAMP,否则 TEXT
+func inferColumnType(records []map[string]interface{}, name string) string {
+	colType := ""
+	for _, record := range records {
+		var t string
+		switch v := record[name].(type) {
+		case nil:
+			continue
+		case json.Number:
+			if _, err := v.Int64(); err == nil {
+				t = ExtractTypeInteger
+			} else if f, err := v.Float64(); err == nil && !math.IsInf(f, 0) {
+				t = ExtractTypeReal
+			} else {
+				t = ExtractTypeText
+			}
+		case bool, int, int32, int64:
+			t = ExtractTypeInteger
+		case float32, float64:
+			t = ExtractTypeReal
+		case time.Time:
+			t = ExtractTypeTimestamp
+		default:
+			t = ExtractTypeText
+		}
+
+		switch {
+		case colType == "":
+			colType = t
+		case colType == t:
+		case (colType == ExtractTypeInteger && t == ExtractTypeReal) || (colType == ExtractTypeReal && t == ExtractTypeInteger):
+			colType = ExtractTypeReal
+		default:
+			return ExtractTypeText
+		}
+	}
+	if colType == "" {
+		return ExtractTypeText
+	}
+	return colType
+}
+
+// convertJSONValue 按列类型转换 JSON 值
+func convertJSONValue(value interface{}, colType string) interface{} {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case json.Number:
+		switch colType {
+		case ExtractTypeInteger:
+			n, _ := v.Int64()
+			return n
+		case ExtractTypeReal:
+			f, _ := v.Float64()
+			return f
+		}
+		return v.String()
+	case bool:
+		if colType == ExtractTypeText {
+			return strconv.FormatBool(v)
+		}
+		if v {
+			return int64(1)
+		}
+		return int64(0)
+	case string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,160 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"cozy-insight-backend/internal/model"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIConnector_FetchFlattensNestedRows(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		assert.Equal(t, "v1", r.Header.Get("X-Version"))
+		fmt.Fprint(w, `{"data":{"items":[
+			{"id":1,"price":1.5,"user":{"name":"a","tags":["x","y"]},"active":true},
+			{"id":2,"price":2,"user":{"name":"b"},"active":false,"note":"n"}
+		]}}`)
+	}))
+	defer server.Close()
+
+	result, err := NewAPIConnector(nil).Fetch(context.Background(), &model.APIDatasourceConfig{
+		URL:       server.URL,
+		Headers:   map[string]string{"X-Version": "v1"},
+		AuthType:  "bearer",
+		AuthToken: "secret",
+		RowsPath:  "$.data.items",
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, result.Pages)
+	assert.Equal(t, []ExtractColumn{
+		{Name: "active", Type: ExtractTypeInteger},
+		{Name: "id", Type: ExtractTypeInteger},
+		{Name: "price", Type: ExtractTypeReal},
+		{Name: "user.name", Type: ExtractTypeText},
+		{Name: "user.tags", Type: ExtractTypeText},
+		{Name: "note", Type: ExtractTypeText},
+	}, result.Columns)
+	assert.Equal(t, []interface{}{int64(1), int64(1), 1.5, "a", `["x","y"]`, nil}, result.Rows[0])
+	assert.Equal(t, []interface{}{int64(0), int64(2), 2.0, "b", nil, "n"}, result.Rows[1])
+}
+
+func TestAPIConnector_PagePagination(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, _ := strconv.Atoi(r.URL.Query().Get("p"))
+		assert.Equal(t, "2", r.URL.Query().Get("size"))
+		switch page {
+		case 1:
+			fmt.Fprint(w, `[{"v":1},{"v":2}]`)
+		case 2:
+			fmt.Fprint(w, `[{"v":3}]`)
+		default:
+			t.Errorf("unexpected page %d", page)
+		}
+	}))
+	defer server.Close()
+
+	result, err := NewAPIConnector(nil).Fetch(context.Background(), &model.APIDatasourceConfig{
+		URL:        server.URL,
+		Pagination: &model.APIPagination{Type: PaginationPage, PageParam: "p", SizeParam: "size", PageSize: 2},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Pages)
+	assert.Len(t, result.Rows, 3)
+}
+
+func TestAPIConnector_OffsetPagination(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		var rows []string
+		for i := offset; i < offset+limit && i < 5; i++ {
+			rows = append(rows, fmt.Sprintf(`{"v":%d}`, i))
+		}
+		fmt.Fprintf(w, `{"rows":[%s]}`, strings.Join(rows, ","))
+	}))
+	defer server.Close()
+
+	result, err := NewAPIConnector(nil).Fetch(context.Background(), &model.APIDatasourceConfig{
+		URL:        server.URL,
+		RowsPath:   "rows",
+		Pagination: &model.APIPagination{Type: PaginationOffset, PageSize: 2},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 3, result.Pages)
+	require.Len(t, result.Rows, 5)
+	assert.Equal(t, int64(4), result.Rows[4][0])
+}
+
+func TestAPIConnector_CursorPagination(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("after") {
+		case "":
+			fmt.Fprint(w, `{"items":[{"v":1}],"meta":{"next":"c1"}}`)
+		case "c1":
+			fmt.Fprint(w, `{"items":[{"v":2}],"meta":{"next":null}}`)
+		default:
+			t.Errorf("unexpected cursor %s", r.URL.Query().Get("after"))
+		}
+	}))
+	defer server.Close()
+
+	result, err := NewAPIConnector(nil).Fetch(context.Background(), &model.APIDatasourceConfig{
+		URL:        server.URL,
+		RowsPath:   "$.items",
+		Pagination: &model.APIPagination{Type: PaginationCursor, CursorParam: "after", CursorPath: "$.meta.next"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Pages)
+	assert.Equal(t, [][]interface{}{{int64(1)}, {int64(2)}}, result.Rows)
+}
+
+func TestAPIConnector_Errors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			http.Error(w, "boom", http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprint(w, `{"data":"not-an-array"}`)
+	}))
+	defer server.Close()
+
+	connector := NewAPIConnector(nil)
+	_, err := connector.Fetch(context.Background(), &model.APIDatasourceConfig{URL: server.URL + "/fail"})
+	assert.ErrorContains(t, err, "500")
+
+	_, err = connector.Fetch(context.Background(), &model.APIDatasourceConfig{URL: server.URL, RowsPath: "$.data"})
+	assert.ErrorContains(t, err, "not an array")
+
+	result := connector.TestConnection(context.Background(), &model.APIDatasourceConfig{URL: server.URL + "/fail"})
+	assert.False(t, result.Success)
+
+	_, err = connector.Fetch(context.Background(), &model.APIDatasourceConfig{URL: "file:///etc/passwd"})
+	assert.ErrorContains(t, err, "unsupported url scheme")
+}
+
+func TestLookupPath(t *testing.T) {
+	body := map[string]interface{}{
+		"a": []interface{}{map[string]interface{}{"b": "x"}},
+	}
+
+	v, err := lookupPath(body, "$.a[0].b")
+	require.NoError(t, err)
+	assert.Equal(t, "x", v)
+
+	v, err = lookupPath(body, "$")
+	require.NoError(t, err)
+	assert.Equal(t, body, v)
+
+	_, err = lookupPath(body, "a[3]")
+	assert.Error(t, err)
+}
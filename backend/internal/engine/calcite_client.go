@@ -98,6 +98,46 @@ func (c *CalciteClient) ExecuteQuery(ctx context.Context, sql string, params ...
 	return result, nil
 }
 
+// calciteResult 带列元数据的缓存结果
+type calciteResult struct {
+	Rows    []map[string]interface{}
+	Columns []ResultColumn
+}
+
+// ExecuteQueryColumns 执行查询并返回结果列元数据（带缓存）
+func (c *CalciteClient) ExecuteQueryColumns(ctx context.Context, sql string, params ...interface{}) ([]map[string]interface{}, []ResultColumn, error) {
+	cacheKey := "columns:" + c.generateCacheKey(sql, params...)
+
+	if c.cache != nil {
+		if cached, err := c.cache.Get(ctx, cacheKey); err == nil {
+			if result, ok := cached.(*calciteResult); ok {
+				return result.Rows, result.Columns, nil
+			}
+		}
+	}
+
+	rows, err := c.db.QueryContext(ctx, sql, params...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("query execution failed: %w", err)
+	}
+	defer rows.Close()
+
+	columns, err := resultColumns(rows)
+	if err != nil {
+		return nil, nil, err
+	}
+	result, err := scanRows(rows)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if c.cache != nil {
+		_ = c.cache.Set(ctx, cacheKey, &calciteResult{Rows: result, Columns: columns}, 5*time.Minute)
+	}
+
+	return result, columns, nil
+}
+
 // ExecuteQueryNoCache 执行查询（不使用缓存）
 func (c *CalciteClient) ExecuteQueryNoCache(ctx context.Context, sql string, params ...interface{}) ([]map[string]interface{}, error) {
 	return c.executeQueryNoCache(ctx, sql, params...)
@@ -116,46 +156,7 @@ func (c *CalciteClient) executeQueryNoCache(ctx context.Context, sql string, par
 
 // parseRows 解析SQL结果为map数组
 func (c *CalciteClient) parseRows(rows *sql.Rows) ([]map[string]interface{}, error) {
-	columns, err := rows.Columns()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get columns: %w", err)
-	}
-
-	var result []map[string]interface{}
-
-	for rows.Next() {
-		// 创建扫描目标
-		values := make([]interface{}, len(columns))
-		valuePtrs := make([]interface{}, len(columns))
-		for i := range values {
-			valuePtrs[i] = &values[i]
-		}
-
-		// 扫描行
-		if err := rows.Scan(valuePtrs...); err != nil {
-			return nil, fmt.Errorf("failed to scan row: %w", err)
-		}
-
-		// 构建结果Map
-		row := make(map[string]interface{})
-		for i, col := range columns {
-			val := values[i]
-			// 处理字节数组
-			if b, ok := val.([]byte); ok {
-				row[col] = string(b)
-			} else {
-				row[col] = val
-			}
-		}
-
-		result = append(result, row)
-	}
-
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("rows iteration error: %w", err)
-	}
-
-	return result, nil
+	return scanRows(rows)
 }
 
 // generateCacheKey 生成缓存键
@@ -0,0 +1,410 @@
+package engine
+
+import (
+	"context"
+	"crypto/md5"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// PoolConfig 数据源连接池配置
+type PoolConfig struct {
+	MaxOpenConns    int           `mapstructure:"max_open_conns"`
+	MaxIdleConns    int           `mapstructure:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `mapstructure:"conn_max_lifetime"`
+	IdleTimeout     time.Duration `mapstructure:"idle_timeout"` // 连接池空闲超过该时间后关闭, 0 表示不回收
+}
+
+// PoolStats 连接池状态
+type PoolStats struct {
+	DatasourceID string      `json:"datasourceId"`
+	Database     string      `json:"database"`
+	Type         string      `json:"type"`
+	Healthy      bool        `json:"healthy"`
+	Error        string      `json:"error,omitempty"`
+	CreateTime   int64       `json:"createTime"`
+	LastUsed     int64       `json:"lastUsed"`
+	DBStats      sql.DBStats `json:"dbStats"`
+}
+
+// maxDatabasePools 每个数据源按请求指定数据库建立的连接池上限,超出时回收最久未使用的
+const maxDatabasePools = 8
+
+// statsPingTimeout Stats 探测单个连接池的超时时间
+const statsPingTimeout = 3 * time.Second
+
+// ConnectionManager 数据源连接池管理,按数据源ID复用 *sql.DB
+// 配置变化时重建连接池,长时间未使用的连接池由后台任务回收
+// 移出管理器的连接池在最后一个使用方释放后才关闭
+type ConnectionManager struct {
+	cfg     PoolConfig
+	mu      sync.Mutex
+	pools   map[poolKey]*pooledDB
+	opening map[poolKey]*poolOpen // 正在建立的连接池,同一键只建立一次
+	closed  bool
+	stop    chan struct{}
+	once    sync.Once
+}
+
+// poolKey 连接池键: 同一数据源访问非默认数据库时使用独立的连接池,数量受 maxDatabasePools 限制
+type poolKey struct {
+	datasourceID string
+	database     string
+}
+
+// pooledDB 数据源连接池及其配置摘要
+type pooledDB struct {
+	db         *sql.DB
+	closer     func() error // 关闭连接池及其 SSH 隧道
+	config     *DatasourceConfig
+	configHash string
+	createTime time.Time
+	lastUsed   time.Time
+	refs       int  // Get 返回后尚未释放的使用方数量
+	retired    bool // 已移出管理器,使用方全部释放后关闭
+}
+
+// poolOpen 进行中的连接池建立,完成后关闭 done
+type poolOpen struct {
+	configHash string
+	done       chan struct{}
+	err        error
+}
+
+// NewConnectionManager 创建连接池管理器,cfg 为 nil 时使用 database/sql 默认值
+func NewConnectionManager(cfg *PoolConfig) *ConnectionManager {
+	m := &ConnectionManager{
+		pools:   make(map[poolKey]*pooledDB),
+		opening: make(map[poolKey]*poolOpen),
+		stop:    make(chan struct{}),
+	}
+	if cfg != nil {
+		m.cfg = *cfg
+	}
+	if m.cfg.IdleTimeout > 0 {
+		go m.evictLoop()
+	}
+	return m
+}
+
+// Get 获取数据源的连接池,配置变化时重建
+// dsType 为数据源记录上的类型,配置JSON中未填写 type 时使用; database 非空时覆盖配置中的默认数据库
+// 建立连接(SSH 隧道、TLS)不持有锁,同一连接池的并发请求等待同一次建立的结果
+// 使用完毕后须调用返回的 release,在此之前连接池不会被回收或关闭
+func (m *ConnectionManager) Get(dsID, dsType, configJSON, database string) (*sql.DB, *DatasourceConfig, func(), error) {
+	if dsID == "" {
+		return nil, nil, nil, fmt.Errorf("datasource id is required")
+	}
+
+	key := poolKey{datasourceID: dsID, database: database}
+	hash := configHash(dsType, configJSON)
+
+	m.mu.Lock()
+	for {
+		if m.closed {
+			m.mu.Unlock()
+			return nil, nil, nil, fmt.Errorf("connection manager is closed")
+		}
+		if p, ok := m.pools[key]; ok && p.configHash == hash {
+			release := m.acquire(p)
+			m.mu.Unlock()
+			return p.db, p.config, release, nil
+		}
+		pending, ok := m.opening[key]
+		if !ok {
+			break
+		}
+		m.mu.Unlock()
+		<-pending.done
+		if pending.configHash == hash && pending.err != nil {
+			return nil, nil, nil, pending.err
+		}
+		m.mu.Lock()
+	}
+
+	// 配置已变更,移除旧连接池
+	if stale, ok := m.pools[key]; ok {
+		_ = m.retire(key, stale)
+	}
+	pending := &poolOpen{configHash: hash, done: make(chan struct{})}
+	m.opening[key] = pending
+	m.mu.Unlock()
+
+	db, closer, config, err := m.openConfig(dsID, dsType, configJSON, database)
+
+	m.mu.Lock()
+	defer func() {
+		delete(m.opening, key)
+		pending.err = err
+		close(pending.done)
+		m.mu.Unlock()
+	}()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if m.closed {
+		_ = closer()
+		err = fmt.Errorf("connection manager is closed")
+		return nil, nil, nil, err
+	}
+	if p, ok := m.pools[key]; ok && p.configHash == hash {
+		// 已有其他调用方建立了相同配置的连接池
+		_ = closer()
+		return p.db, p.config, m.acquire(p), nil
+	}
+	if p, ok := m.pools[key]; ok {
+		_ = m.retire(key, p)
+	}
+	now := time.Now()
+	p := &pooledDB{db: db, closer: closer, config: config, configHash: hash, createTime: now, lastUsed: now}
+	m.pools[key] = p
+	if database != "" {
+		m.limitDatabasePools(dsID)
+	}
+	return db, config, m.acquire(p), nil
+}
+
+// acquire 增加连接池引用,返回的 release 只生效一次,调用方持有 m.mu
+func (m *ConnectionManager) acquire(p *pooledDB) func() {
+	p.refs++
+	p.lastUsed = time.Now()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			p.refs--
+			p.lastUsed = time.Now()
+			if p.retired && p.refs == 0 {
+				_ = p.closer()
+			}
+		})
+	}
+}
+
+// retire 将连接池移出管理器,没有使用方时立即关闭,否则由最后一个使用方释放时关闭
+// 调用方持有 m.mu
+func (m *ConnectionManager) retire(key poolKey, p *pooledDB) error {
+	if m.pools[key] == p {
+		delete(m.pools, key)
+	}
+	p.retired = true
+	if p.refs == 0 {
+		return p.closer()
+	}
+	return nil
+}
+
+// limitDatabasePools 数据源的非默认数据库连接池超过上限时回收最久未使用的,调用方持有 m.mu
+func (m *ConnectionManager) limitDatabasePools(dsID string) {
+	for {
+		var oldestKey poolKey
+		var oldest *pooledDB
+		count := 0
+		for key, p := range m.pools {
+			if key.datasourceID != dsID || key.database == "" {
+				continue
+			}
+			count++
+			if oldest == nil || p.lastUsed.Before(oldest.lastUsed) {
+				oldestKey, oldest = key, p
+			}
+		}
+		if count <= maxDatabasePools {
+			return
+		}
+		_ = m.retire(oldestKey, oldest)
+	}
+}
+
+// openConfig 解析配置并建立连接池
+// 抽取库由 ExtractStore.Target 以保留ID访问,用户数据源的ID由服务端生成,不会与之冲突
+func (m *ConnectionManager) openConfig(dsID, dsType, configJSON, database string) (*sql.DB, func() error, *DatasourceConfig, error) {
+	config, err := parseDatasourceConfig(dsType, configJSON)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	config.extract = dsID == ExtractDatasourceID
+	if database != "" {
+		config.Database = database
+	}
+	db, closer, err := m.open(config)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return db, closer, config, nil
+}
+
+// Invalidate 关闭数据源的全部连接池,下次使用时按最新配置重建
+func (m *ConnectionManager) Invalidate(dsID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key, p := range m.pools {
+		if key.datasourceID == dsID {
+			_ = m.retire(key, p)
+		}
+	}
+}
+
+// Stats 获取全部连接池的健康状态和统计信息,各连接池并发探测
+func (m *ConnectionManager) Stats(ctx context.Context) []PoolStats {
+	type entry struct {
+		db      *sql.DB
+		release func()
+	}
+
+	m.mu.Lock()
+	stats := make([]PoolStats, 0, len(m.pools))
+	entries := make([]entry, 0, len(m.pools))
+	for key, p := range m.pools {
+		stats = append(stats, PoolStats{
+			DatasourceID: key.datasourceID,
+			Database:     p.config.Database,
+			Type:         p.config.Type,
+			CreateTime:   p.createTime.UnixMilli(),
+			LastUsed:     p.lastUsed.UnixMilli(),
+			DBStats:      p.db.Stats(),
+		})
+		// 探测期间持有引用,避免连接池被并发关闭;不更新最近使用时间
+		lastUsed := p.lastUsed
+		release := m.acquire(p)
+		p.lastUsed = lastUsed
+		entries = append(entries, entry{db: p.db, release: release})
+	}
+	m.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for i, e := range entries {
+		wg.Add(1)
+		go func(s *PoolStats, e entry) {
+			defer wg.Done()
+			defer e.release()
+			pingCtx, cancel := context.WithTimeout(ctx, statsPingTimeout)
+			defer cancel()
+			if err := e.db.PingContext(pingCtx); err != nil {
+				s.Error = err.Error()
+			} else {
+				s.Healthy = true
+			}
+		}(&stats[i], e)
+	}
+	wg.Wait()
+
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].DatasourceID != stats[j].DatasourceID {
+			return stats[i].DatasourceID < stats[j].DatasourceID
+		}
+		return stats[i].Database < stats[j].Database
+	})
+	return stats
+}
+
+// Close 停止回收任务并关闭全部连接池
+func (m *ConnectionManager) Close() error {
+	m.once.Do(func() { close(m.stop) })
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.closed = true
+	var firstErr error
+	for key, p := range m.pools {
+		if err := m.retire(key, p); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// open 按配置创建连接池,数据源配置中的连接数优先于全局配置
+func (m *ConnectionManager) open(config *DatasourceConfig) (*sql.DB, func() error, error) {
+	db, closer, err := openDatabase(config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	maxOpen, maxIdle := m.cfg.MaxOpenConns, m.cfg.MaxIdleConns
+	if config.MaxOpenConns > 0 {
+		maxOpen = config.MaxOpenConns
+	}
+	if config.MaxIdleConns > 0 {
+		maxIdle = config.MaxIdleConns
+	}
+	if maxOpen > 0 {
+		db.SetMaxOpenConns(maxOpen)
+	}
+	if maxIdle > 0 {
+		db.SetMaxIdleConns(maxIdle)
+	}
+	if m.cfg.ConnMaxLifetime > 0 {
+		db.SetConnMaxLifetime(m.cfg.ConnMaxLifetime)
+	}
+	return db, closer, nil
+}
+
+// evictLoop 定期回收空闲连接池
+func (m *ConnectionManager) evictLoop() {
+	interval := m.cfg.IdleTimeout / 2
+	if interval < time.Second {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.stop:
+			return
+		case now := <-ticker.C:
+			m.evictIdle(now)
+		}
+	}
+}
+
+// evictIdle 关闭空闲超时且没有使用方的连接池,返回回收数量
+func (m *ConnectionManager) evictIdle(now time.Time) int {
+	if m.cfg.IdleTimeout <= 0 {
+		return 0
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	evicted := 0
+	for key, p := range m.pools {
+		if now.Sub(p.lastUsed) < m.cfg.IdleTimeout || p.refs > 0 || p.db.Stats().InUse > 0 {
+			continue
+		}
+		_ = m.retire(key, p)
+		evicted++
+	}
+	return evicted
+}
+
+// parseDatasourceConfig 解析数据源配置JSON
+func parseDatasourceConfig(dsType, configJSON string) (*DatasourceConfig, error) {
+	configJSON, err := DecryptConfig(configJSON)
+	if err != nil {
+		return nil, err
+	}
+	var config DatasourceConfig
+	if err := json.Unmarshal([]byte(configJSON), &config); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	if config.Type == "" {
+		config.Type = dsType
+	}
+	return &config, nil
+}
+
+// configHash 数据源配置摘要,用于判断连接池是否需要重建
+func configHash(dsType, configJSON string) string {
+	sum := md5.Sum([]byte(dsType + "\x00" + configJSON))
+	return hex.EncodeToString(sum[:])
+}
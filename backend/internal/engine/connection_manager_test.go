@@ -0,0 +1,273 @@
+package engine
+
+import (
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testMySQLConfig = `{"host":"127.0.0.1","port":1,"username":"root","database":"shop"}`
+
+func TestConnectionManager_Get(t *testing.T) {
+	m := NewConnectionManager(nil)
+	defer m.Close()
+
+	configJSON := testMySQLConfig
+	db1, config, _, err := m.Get("ds1", "mysql", configJSON, "")
+	assert.NoError(t, err)
+	assert.Equal(t, "mysql", config.Type)
+
+	db2, _, _, err := m.Get("ds1", "mysql", configJSON, "")
+	assert.NoError(t, err)
+	assert.Same(t, db1, db2)
+
+	// 配置变更后重建连接池
+	db3, _, _, err := m.Get("ds1", "mysql", `{"host":"10.0.0.1","port":3306,"username":"root","database":"shop"}`, "")
+	assert.NoError(t, err)
+	assert.NotSame(t, db1, db3)
+
+	_, _, _, err = m.Get("", "mysql", configJSON, "")
+	assert.Error(t, err)
+}
+
+func TestConnectionManager_PerDatabasePools(t *testing.T) {
+	m := NewConnectionManager(nil)
+	defer m.Close()
+
+	db1, config, _, err := m.Get("ds1", "mysql", testMySQLConfig, "")
+	assert.NoError(t, err)
+	assert.Equal(t, "shop", config.Database)
+
+	db2, config, _, err := m.Get("ds1", "mysql", testMySQLConfig, "crm")
+	assert.NoError(t, err)
+	assert.Equal(t, "crm", config.Database)
+	assert.NotSame(t, db1, db2)
+}
+
+func TestConnectionManager_Invalidate(t *testing.T) {
+	m := NewConnectionManager(nil)
+	defer m.Close()
+
+	db1, _, _, _ := m.Get("ds1", "mysql", testMySQLConfig, "")
+	_, _, _, _ = m.Get("ds1", "mysql", testMySQLConfig, "crm")
+	_, _, _, _ = m.Get("ds2", "mysql", testMySQLConfig, "")
+
+	m.Invalidate("ds1")
+
+	stats := m.Stats(context.Background())
+	assert.Len(t, stats, 1)
+	assert.Equal(t, "ds2", stats[0].DatasourceID)
+
+	db2, _, _, err := m.Get("ds1", "mysql", testMySQLConfig, "")
+	assert.NoError(t, err)
+	assert.NotSame(t, db1, db2)
+}
+
+func TestConnectionManager_EvictIdle(t *testing.T) {
+	m := NewConnectionManager(&PoolConfig{IdleTimeout: time.Hour})
+	defer m.Close()
+
+	_, _, release, err := m.Get("ds1", "mysql", testMySQLConfig, "")
+	require.NoError(t, err)
+
+	assert.Equal(t, 0, m.evictIdle(time.Now()))
+	// 未释放的连接池不回收
+	assert.Equal(t, 0, m.evictIdle(time.Now().Add(2*time.Hour)))
+	release()
+	assert.Equal(t, 1, m.evictIdle(time.Now().Add(2*time.Hour)))
+	assert.Empty(t, m.Stats(context.Background()))
+}
+
+func TestConnectionManager_DatabasePoolLimit(t *testing.T) {
+	m := NewConnectionManager(nil)
+	defer m.Close()
+
+	_, _, release, err := m.Get("ds1", "mysql", testMySQLConfig, "")
+	require.NoError(t, err)
+	release()
+	for i := 0; i < maxDatabasePools+3; i++ {
+		_, _, release, err := m.Get("ds1", "mysql", testMySQLConfig, "db"+strconv.Itoa(i))
+		require.NoError(t, err)
+		release()
+		// 保证最近使用时间有先后
+		time.Sleep(time.Millisecond)
+	}
+	_, _, release, err = m.Get("ds1", "mysql", testMySQLConfig, "db0")
+	require.NoError(t, err)
+	release()
+
+	// 请求指定的数据库按最近使用回收,默认连接池不计入上限
+	databases := map[string]bool{}
+	for _, s := range m.Stats(context.Background()) {
+		databases[s.Database] = true
+	}
+	assert.Len(t, databases, maxDatabasePools+1)
+	assert.True(t, databases["shop"])
+	assert.True(t, databases["db0"])
+	assert.False(t, databases["db3"])
+	assert.True(t, databases["db"+strconv.Itoa(maxDatabasePools+2)])
+}
+
+func TestConnectionManager_CloseAfterRelease(t *testing.T) {
+	m := NewConnectionManager(&PoolConfig{IdleTimeout: time.Hour})
+	defer m.Close()
+	configJSON := newSQLiteFixture(t)
+
+	db, _, release, err := m.Get("ds1", "sqlite", configJSON, "")
+	require.NoError(t, err)
+
+	// 失效和回收不关闭使用中的连接池
+	m.Invalidate("ds1")
+	m.evictIdle(time.Now().Add(2 * time.Hour))
+	var count int
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM orders`).Scan(&count))
+	assert.Equal(t, 3, count)
+
+	// 最后一个使用方释放后关闭,重复释放无影响
+	release()
+	release()
+	assert.Error(t, db.Ping())
+
+	rebuilt, _, release, err := m.Get("ds1", "sqlite", configJSON, "")
+	require.NoError(t, err)
+	defer release()
+	assert.NotSame(t, db, rebuilt)
+	assert.NoError(t, rebuilt.Ping())
+}
+
+func TestConnectionManager_PoolSizes(t *testing.T) {
+	m := NewConnectionManager(&PoolConfig{MaxOpenConns: 8})
+	defer m.Close()
+
+	db, _, _, err := m.Get("ds1", "mysql", testMySQLConfig, "")
+	assert.NoError(t, err)
+	assert.Equal(t, 8, db.Stats().MaxOpenConnections)
+
+	// 数据源配置中的连接数优先
+	db, _, _, err = m.Get("ds2", "mysql", `{"host":"127.0.0.1","port":1,"maxOpenConns":3}`, "")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, db.Stats().MaxOpenConnections)
+}
+
+func TestConnectionManager_StatsReportsUnhealthy(t *testing.T) {
+	m := NewConnectionManager(nil)
+	defer m.Close()
+
+	_, _, _, _ = m.Get("ds1", "mysql", testMySQLConfig, "")
+
+	stats := m.Stats(context.Background())
+	assert.Len(t, stats, 1)
+	assert.Equal(t, "mysql", stats[0].Type)
+	assert.False(t, stats[0].Healthy)
+	assert.NotEmpty(t, stats[0].Error)
+}
+
+func TestConnectionManager_StatsPingsConcurrently(t *testing.T) {
+	// 只接受连接不发送握手包的服务器,探测直到超时
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				io.Copy(io.Discard, conn)
+				conn.Close()
+			}()
+		}
+	}()
+	hangConfig := `{"host":"127.0.0.1","port":` + strconv.Itoa(listener.Addr().(*net.TCPAddr).Port) + `}`
+
+	m := NewConnectionManager(nil)
+	defer m.Close()
+	for i := 0; i < 3; i++ {
+		_, _, release, err := m.Get("ds"+strconv.Itoa(i), "mysql", hangConfig, "")
+		require.NoError(t, err)
+		release()
+	}
+
+	start := time.Now()
+	stats := m.Stats(context.Background())
+	assert.Less(t, time.Since(start), 2*statsPingTimeout)
+	require.Len(t, stats, 3)
+	for _, s := range stats {
+		assert.False(t, s.Healthy)
+	}
+}
+
+func TestConnectionManager_SlowDialDoesNotBlock(t *testing.T) {
+	// 只接受连接不响应的 SSH 服务器,隧道握手一直阻塞
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	var accepted atomic.Int32
+	var conns []net.Conn
+	var connMu sync.Mutex
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			accepted.Add(1)
+			connMu.Lock()
+			conns = append(conns, conn)
+			connMu.Unlock()
+		}
+	}()
+	port := listener.Addr().(*net.TCPAddr).Port
+	slowConfig := `{"type":"mysql","host":"db","port":3306,"ssh":{"enabled":true,"host":"127.0.0.1","port":` +
+		strconv.Itoa(port) + `,"username":"tunnel","password":"pw","insecureSkipHostKey":true}}`
+
+	m := NewConnectionManager(nil)
+	defer m.Close()
+
+	// 同一连接池的并发请求只建立一次连接
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, _, _, errs[i] = m.Get("slow", "mysql", slowConfig, "")
+		}(i)
+	}
+	require.Eventually(t, func() bool { return accepted.Load() == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	// 建立中的连接不阻塞其他数据源和管理操作
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _, _, err := m.Get("fast", "mysql", testMySQLConfig, "")
+		assert.NoError(t, err)
+		m.Invalidate("other")
+		m.evictIdle(time.Now())
+		assert.Len(t, m.Stats(context.Background()), 1)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("slow dial blocked the connection manager")
+	}
+
+	connMu.Lock()
+	for _, conn := range conns {
+		conn.Close()
+	}
+	connMu.Unlock()
+	wg.Wait()
+	assert.Error(t, errs[0])
+	assert.Error(t, errs[1])
+	assert.Equal(t, int32(1), accepted.Load())
+}
@@ -0,0 +1,97 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"cozy-insight-backend/pkg/secret"
+)
+
+// CredentialDecrypter 解密数据源配置中的加密凭据
+type CredentialDecrypter interface {
+	Decrypt(value string) (string, error)
+}
+
+var (
+	decrypterMu sync.RWMutex
+	decrypter   CredentialDecrypter
+)
+
+// SetCredentialDecrypter 设置凭据解密器,建立连接前透明解密配置
+func SetCredentialDecrypter(d CredentialDecrypter) {
+	decrypterMu.Lock()
+	defer decrypterMu.Unlock()
+	decrypter = d
+}
+
+// DecryptConfig 解密配置 JSON 中所有加密的字符串值,不含加密值的配置原样返回
+func DecryptConfig(configJSON string) (string, error) {
+	if !strings.Contains(configJSON, secret.EncryptedPrefix) {
+		return configJSON, nil
+	}
+
+	decrypterMu.RLock()
+	d := decrypter
+	decrypterMu.RUnlock()
+	if d == nil {
+		return "", fmt.Errorf("datasource credentials are encrypted but no master key is configured")
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(configJSON))
+	decoder.UseNumber()
+	var config interface{}
+	if err := decoder.Decode(&config); err != nil {
+		return "", fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	config, err := decryptValue(d, config)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(config); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+// decryptValue 递归解密加密的字符串值
+func decryptValue(d CredentialDecrypter, value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		if !secret.IsEncrypted(v) {
+			return v, nil
+		}
+		plain, err := d.Decrypt(v)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt datasource credential: %w", err)
+		}
+		return plain, nil
+	case map[string]interface{}:
+		for key, child := range v {
+			plain, err := decryptValue(d, child)
+			if err != nil {
+				return nil, err
+			}
+			v[key] = plain
+		}
+		return v, nil
+	case []interface{}:
+		for i, child := range v {
+			plain, err := decryptValue(d, child)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = plain
+		}
+		return v, nil
+	default:
+		return v, nil
+	}
+}
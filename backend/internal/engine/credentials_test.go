@@ -0,0 +1,42 @@
+package engine
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"cozy-insight-backend/pkg/secret"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecryptConfig(t *testing.T) {
+	keyring, err := secret.NewKeyring(map[string]string{
+		"k1": base64.StdEncoding.EncodeToString([]byte(strings.Repeat("k", 32))),
+	}, "k1")
+	require.NoError(t, err)
+	encrypted, err := keyring.Encrypt("p&ss<word>")
+	require.NoError(t, err)
+	configJSON := `{"host":"db","port":3306,"password":"` + encrypted + `","hosts":["a"]}`
+
+	// 明文配置原样返回
+	plain, err := DecryptConfig(`{"password":"x"}`)
+	require.NoError(t, err)
+	assert.Equal(t, `{"password":"x"}`, plain)
+
+	// 未设置解密器时无法解密
+	SetCredentialDecrypter(nil)
+	_, err = DecryptConfig(configJSON)
+	assert.Error(t, err)
+
+	SetCredentialDecrypter(keyring)
+	defer SetCredentialDecrypter(nil)
+	plain, err = DecryptConfig(configJSON)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"host":"db","port":3306,"password":"p&ss<word>","hosts":["a"]}`, plain)
+
+	config, err := parseDatasourceConfig("mysql", configJSON)
+	require.NoError(t, err)
+	assert.Equal(t, "p&ss<word>", config.Password)
+}
@@ -3,15 +3,25 @@ package engine
 import (
 	"context"
 	"database/sql"
-	"encoding/json"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
+	"cozy-insight-backend/internal/model"
+
 	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
 )
 
 // DatasourceConnector 数据源连接器,用于测试连接和获取元数据
-type DatasourceConnector struct{}
+// 已保存的数据源复用连接池,未保存的配置使用临时连接
+type DatasourceConnector struct {
+	pools *ConnectionManager
+	docs  *DocumentStores
+	api   *APIConnector
+}
 
 // ConnectionTestResult 连接测试结果
 type ConnectionTestResult struct {
@@ -22,50 +32,72 @@ type ConnectionTestResult struct {
 
 // DatasourceConfig 数据源配置
 type DatasourceConfig struct {
-	Type     string `json:"type"`     // mysql, postgresql, clickhouse, etc.
-	Host     string `json:"host"`
-	Port     int    `json:"port"`
-	Username string `json:"username"`
-	Password string `json:"password"`
-	Database string `json:"database"`
-	Charset  string `json:"charset"`
+	Type         string `json:"type"` // mysql, postgresql, clickhouse, etc.
+	Host         string `json:"host"`
+	Port         int    `json:"port"`
+	Username     string `json:"username"`
+	Password     string `json:"password"`
+	Database     string `json:"database"`
+	Charset      string `json:"charset"`
+	Path         string `json:"path"`         // 嵌入式数据库文件路径(sqlite)
+	MaxOpenConns int    `json:"maxOpenConns"` // 连接池最大连接数,覆盖全局配置
+	MaxIdleConns int    `json:"maxIdleConns"` // 连接池最大空闲连接数,覆盖全局配置
+
+	SSH *SSHTunnelConfig     `json:"ssh,omitempty"` // 经 SSH 隧道连接
+	TLS *DatasourceTLSConfig `json:"tls,omitempty"` // TLS 及客户端证书
+
+	extract bool // 内部抽取库,不受 SQLite 数据目录限制
 }
 
-func NewDatasourceConnector() *DatasourceConnector {
-	return &DatasourceConnector{}
+func NewDatasourceConnector(pools *ConnectionManager, docs *DocumentStores) *DatasourceConnector {
+	if docs == nil {
+		docs = NewDocumentStores()
+	}
+	return &DatasourceConnector{pools: pools, docs: docs, api: NewAPIConnector(nil)}
 }
 
-// TestConnection 测试数据源连接
-func (c *DatasourceConnector) TestConnection(ctx context.Context, configJSON string) (*ConnectionTestResult, error) {
+// TestConnection 测试数据源连接, target 未指定数据源ID时使用临时连接
+func (c *DatasourceConnector) TestConnection(ctx context.Context, target *QueryTarget) (*ConnectionTestResult, error) {
 	start := time.Now()
 	result := &ConnectionTestResult{
 		Success: false,
 	}
 
-	// 解析配置
-	var config DatasourceConfig
-	if err := json.Unmarshal([]byte(configJSON), &config); err != nil {
-		result.Message = fmt.Sprintf("Invalid configuration: %v", err)
-		result.Time = time.Since(start).Milliseconds()
-		return result, nil
-	}
-
-	// 构建连接字符串
-	dsn, err := c.buildDSN(&config)
-	if err != nil {
-		result.Message = fmt.Sprintf("Failed to build DSN: %v", err)
+	// API 数据源没有数据库连接,直接请求接口
+	switch c.sourceType(target) {
+	case model.DatasourceTypeAPI:
+		apiConfig, err := ParseAPIConfig(target.Configuration)
+		if err != nil {
+			result.Message = err.Error()
+			result.Time = time.Since(start).Milliseconds()
+			return result, nil
+		}
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+		return c.api.TestConnection(ctx, apiConfig), nil
+	case model.DatasourceTypeMongoDB, model.DatasourceTypeElasticsearch:
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+		err := c.withDocumentStore(ctx, target, func(store DocumentStore) error {
+			return store.Ping(ctx)
+		})
 		result.Time = time.Since(start).Milliseconds()
+		if err != nil {
+			result.Message = fmt.Sprintf("Connection failed: %v", err)
+			return result, nil
+		}
+		result.Success = true
+		result.Message = "Connection successful"
 		return result, nil
 	}
 
-	// 尝试连接
-	db, err := sql.Open(c.getDriverName(config.Type), dsn)
+	db, release, err := c.open(target, "")
 	if err != nil {
-		result.Message = fmt.Sprintf("Failed to open connection: %v", err)
+		result.Message = err.Error()
 		result.Time = time.Since(start).Milliseconds()
 		return result, nil
 	}
-	defer db.Close()
+	defer release()
 
 	// 设置连接超时
 	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
@@ -84,212 +116,305 @@ func (c *DatasourceConnector) TestConnection(ctx context.Context, configJSON str
 	return result, nil
 }
 
-// GetDatabaseList 获取数据库列表
-func (c *DatasourceConnector) GetDatabaseList(ctx context.Context, configJSON string) ([]string, error) {
-	var config DatasourceConfig
-	if err := json.Unmarshal([]byte(configJSON), &config); err != nil {
-		return nil, fmt.Errorf("invalid configuration: %w", err)
+// GetDatabaseList 获取数据库列表,文档数据源的数据库在配置中指定,返回空列表
+func (c *DatasourceConnector) GetDatabaseList(ctx context.Context, target *QueryTarget) ([]string, error) {
+	if IsDocumentType(c.sourceType(target)) {
+		return []string{}, nil
 	}
 
-	dsn, err := c.buildDSN(&config)
+	db, release, err := c.open(target, "")
 	if err != nil {
 		return nil, err
 	}
+	defer release()
 
-	db, err := sql.Open(c.getDriverName(config.Type), dsn)
+	dialect, err := GetDialect(target.DatasourceType)
 	if err != nil {
 		return nil, err
 	}
-	defer db.Close()
-
-	var query string
-	switch config.Type {
-	case "mysql":
-		query = "SHOW DATABASES"
-	case "postgresql":
-		query = "SELECT datname FROM pg_database WHERE datistemplate = false"
-	default:
-		return nil, fmt.Errorf("unsupported datasource type: %s", config.Type)
-	}
 
-	rows, err := db.QueryContext(ctx, query)
+	rows, err := db.QueryContext(ctx, dialect.DatabaseListQuery())
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var databases []string
-	for rows.Next() {
-		var name string
-		if err := rows.Scan(&name); err != nil {
-			return nil, err
-		}
-		databases = append(databases, name)
-	}
-
-	return databases, rows.Err()
+	return scanNames(rows)
 }
 
-// GetTableList 获取表列表
-func (c *DatasourceConnector) GetTableList(ctx context.Context, configJSON, database string) ([]string, error) {
-	var config DatasourceConfig
-	if err := json.Unmarshal([]byte(configJSON), &config); err != nil {
-		return nil, fmt.Errorf("invalid configuration: %w", err)
+// GetTableList 获取表列表,文档数据源返回集合或索引
+func (c *DatasourceConnector) GetTableList(ctx context.Context, target *QueryTarget, database string) ([]string, error) {
+	if IsDocumentType(c.sourceType(target)) {
+		var names []string
+		err := c.withDocumentStore(ctx, target, func(store DocumentStore) (err error) {
+			names, err = store.ListCollections(ctx)
+			return err
+		})
+		return names, err
 	}
 
-	// 覆盖数据库
-	config.Database = database
-
-	dsn, err := c.buildDSN(&config)
+	db, release, err := c.open(target, database)
 	if err != nil {
 		return nil, err
 	}
+	defer release()
 
-	db, err := sql.Open(c.getDriverName(config.Type), dsn)
+	dialect, err := GetDialect(target.DatasourceType)
 	if err != nil {
 		return nil, err
 	}
-	defer db.Close()
 
-	var query string
-	switch config.Type {
-	case "mysql":
-		query = "SHOW TABLES"
-	case "postgresql":
-		query = "SELECT tablename FROM pg_tables WHERE schemaname = 'public'"
-	default:
-		return nil, fmt.Errorf("unsupported datasource type: %s", config.Type)
-	}
-
-	rows, err := db.QueryContext(ctx, query)
+	query, args := dialect.TableListQuery(database)
+	rows, err := db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var tables []string
-	for rows.Next() {
-		var name string
-		if err := rows.Scan(&name); err != nil {
+	return scanNames(rows)
+}
+
+// GetTableSchema 获取表结构,各数据源统一返回字段、索引等元数据
+// 文档数据源通过采样文档推断字段
+func (c *DatasourceConnector) GetTableSchema(ctx context.Context, target *QueryTarget, database, table string) (*TableInfo, error) {
+	if IsDocumentType(c.sourceType(target)) {
+		var fields []DocumentField
+		err := c.withDocumentStore(ctx, target, func(store DocumentStore) error {
+			docs, err := store.Sample(ctx, table, schemaSampleSize)
+			if err != nil {
+				return err
+			}
+			fields = InferDocumentSchema(docs)
+			return nil
+		})
+		if err != nil {
 			return nil, err
 		}
-		tables = append(tables, name)
+		return documentTableInfo(table, fields), nil
+	}
+
+	db, release, err := c.open(target, database)
+	if err != nil {
+		return nil, err
 	}
+	defer release()
 
-	return tables, rows.Err()
+	dialect, err := GetDialect(target.DatasourceType)
+	if err != nil {
+		return nil, err
+	}
+	return inspectTable(ctx, db, dialect, database, table)
 }
 
-// GetTableSchema 获取表结构
-func (c *DatasourceConnector) GetTableSchema(ctx context.Context, configJSON, database, table string) ([]map[string]interface{}, error) {
-	var config DatasourceConfig
-	if err := json.Unmarshal([]byte(configJSON), &config); err != nil {
-		return nil, fmt.Errorf("invalid configuration: %w", err)
+// Invalidate 数据源配置变更或删除后关闭其连接池
+func (c *DatasourceConnector) Invalidate(dsID string) {
+	if dsID == "" {
+		return
+	}
+	if c.pools != nil {
+		c.pools.Invalidate(dsID)
 	}
+	c.docs.Invalidate(dsID)
+}
 
-	config.Database = database
+// PoolStats 获取连接池状态
+func (c *DatasourceConnector) PoolStats(ctx context.Context) []PoolStats {
+	if c.pools == nil {
+		return nil
+	}
+	return c.pools.Stats(ctx)
+}
 
-	dsn, err := c.buildDSN(&config)
-	if err != nil {
-		return nil, err
+// sourceType 解析目标的数据源类型并回写到 target.DatasourceType
+func (c *DatasourceConnector) sourceType(target *QueryTarget) string {
+	if target == nil {
+		return ""
+	}
+	if config, err := parseDatasourceConfig(target.DatasourceType, target.Configuration); err == nil {
+		target.DatasourceType = config.Type
 	}
+	return target.DatasourceType
+}
 
-	db, err := sql.Open(c.getDriverName(config.Type), dsn)
+// withDocumentStore 获取文档数据源客户端执行 fn
+func (c *DatasourceConnector) withDocumentStore(ctx context.Context, target *QueryTarget, fn func(store DocumentStore) error) error {
+	store, release, err := c.docs.Open(ctx, target)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer db.Close()
+	defer release()
+	return fn(store)
+}
 
-	var query string
-	var args []interface{}
+// open 获取目标数据源的连接,返回的 release 用于释放临时连接
+// 解析出的数据源类型回写到 target.DatasourceType
+func (c *DatasourceConnector) open(target *QueryTarget, database string) (*sql.DB, func(), error) {
+	if target == nil {
+		return nil, nil, fmt.Errorf("datasource is required")
+	}
 
-	switch config.Type {
-	case "mysql":
-		query = "DESCRIBE " + table
-	case "postgresql":
-		query = `SELECT column_name, data_type, is_nullable 
-                 FROM information_schema.columns 
-                 WHERE table_name = $1 
-                 ORDER BY ordinal_position`
-		args = []interface{}{table}
-	default:
-		return nil, fmt.Errorf("unsupported datasource type: %s", config.Type)
+	if target.DatasourceID != "" && c.pools != nil {
+		db, config, release, err := c.pools.Get(target.DatasourceID, target.DatasourceType, target.Configuration, database)
+		if err != nil {
+			return nil, nil, err
+		}
+		target.DatasourceType = config.Type
+		return db, release, nil
 	}
 
-	rows, err := db.QueryContext(ctx, query, args...)
+	config, err := parseDatasourceConfig(target.DatasourceType, target.Configuration)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	defer rows.Close()
+	if database != "" {
+		config.Database = database
+	}
+	target.DatasourceType = config.Type
 
-	columns, err := rows.Columns()
+	db, closer, err := openDatabase(config)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
+	return db, func() { closer() }, nil
+}
 
-	var schema []map[string]interface{}
-	for rows.Next() {
-		values := make([]interface{}, len(columns))
-		valuePtrs := make([]interface{}, len(columns))
-		for i := range values {
-			valuePtrs[i] = &values[i]
+// openDatabase 按配置打开数据库,启用 SSH 隧道时驱动连接隧道的本地地址
+// 返回的 closer 关闭数据库及其隧道
+func openDatabase(config *DatasourceConfig) (*sql.DB, func() error, error) {
+	dialConfig := config
+	var tunnel *sshTunnel
+	if config.SSH != nil && config.SSH.Enabled && config.Type != "sqlite" {
+		var err error
+		if tunnel, err = openSSHTunnel(config.SSH, config.Host, config.Port); err != nil {
+			return nil, nil, err
 		}
 
-		if err := rows.Scan(valuePtrs...); err != nil {
-			return nil, err
+		tunneled := *config
+		tunneled.Host, tunneled.Port = tunnel.LocalAddr()
+		if config.TLS.enabled() {
+			// 证书仍按原主机名校验
+			tlsConfig := *config.TLS
+			if tlsConfig.ServerName == "" {
+				tlsConfig.ServerName = config.Host
+			}
+			tunneled.TLS = &tlsConfig
 		}
+		dialConfig = &tunneled
+	}
 
-		row := make(map[string]interface{})
-		for i, col := range columns {
-			val := values[i]
-			if b, ok := val.([]byte); ok {
-				row[col] = string(b)
-			} else {
-				row[col] = val
-			}
+	closeTunnel := func() {
+		if tunnel != nil {
+			tunnel.Close()
 		}
-		schema = append(schema, row)
 	}
 
-	return schema, rows.Err()
+	dsn, err := buildDSN(dialConfig)
+	if err != nil {
+		closeTunnel()
+		return nil, nil, fmt.Errorf("failed to build DSN: %w", err)
+	}
+
+	db, err := sql.Open(driverName(config.Type), dsn)
+	if err != nil {
+		closeTunnel()
+		return nil, nil, fmt.Errorf("failed to open connection: %w", err)
+	}
+	return db, func() error {
+		err := db.Close()
+		closeTunnel()
+		return err
+	}, nil
+}
+
+// scanNames 读取单列名称列表
+func scanNames(rows *sql.Rows) ([]string, error) {
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
 }
 
 // buildDSN 构建数据源连接字符串
-func (c *DatasourceConnector) buildDSN(config *DatasourceConfig) (string, error) {
+func buildDSN(config *DatasourceConfig) (string, error) {
 	switch config.Type {
 	case "mysql":
 		charset := config.Charset
 		if charset == "" {
 			charset = "utf8mb4"
 		}
-		return fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=%s&parseTime=true&loc=Local",
+		// group_concat_max_len 默认 1024 字节,FIRST/LAST 聚合依赖 GROUP_CONCAT,按会话调到上限
+		dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=%s&parseTime=true&loc=Local&group_concat_max_len=4294967295",
 			config.Username,
 			config.Password,
 			config.Host,
 			config.Port,
 			config.Database,
-			charset), nil
+			charset)
+		if config.TLS.enabled() {
+			name, err := registerMySQLTLS(config.TLS, config.Host)
+			if err != nil {
+				return "", err
+			}
+			dsn += "&tls=" + name
+		}
+		return dsn, nil
 
 	case "postgresql":
-		return fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
-			config.Host,
-			config.Port,
-			config.Username,
-			config.Password,
-			config.Database), nil
+		if config.SSH != nil && config.SSH.Enabled && config.TLS.enabled() &&
+			config.TLS.Mode == TLSModeVerifyFull && config.Host != config.TLS.ServerName {
+			// libpq 按连接地址校验主机名,隧道的本地地址无法通过校验
+			return "", fmt.Errorf("tls mode verify-full is not supported through an ssh tunnel, use verify-ca")
+		}
+		sslParams, err := postgresTLSParams(config.TLS)
+		if err != nil {
+			return "", err
+		}
+		// 所有取值加引号,避免空格或引号改写后续参数
+		return fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s %s",
+			quoteDSNValue(config.Host),
+			quoteDSNValue(strconv.Itoa(config.Port)),
+			quoteDSNValue(config.Username),
+			quoteDSNValue(config.Password),
+			quoteDSNValue(config.Database),
+			sslParams), nil
+
+	case "sqlite":
+		if config.Path == "" {
+			return "", fmt.Errorf("database file path is required")
+		}
+		path := config.Path
+		if !config.extract {
+			var err error
+			if path, err = resolveSQLitePath(config.Path); err != nil {
+				return "", err
+			}
+		}
+		// 以只读方式打开,避免路径错误时创建空库
+		return fmt.Sprintf("file:%s?mode=ro&_busy_timeout=5000", sqlitePathEscaper.Replace(path)), nil
 
 	default:
 		return "", fmt.Errorf("unsupported datasource type: %s", config.Type)
 	}
 }
 
-// getDriverName 获取驱动名称
-func (c *DatasourceConnector) getDriverName(dsType string) string {
+// driverName 获取数据源类型对应的 database/sql 驱动名称
+func driverName(dsType string) string {
 	switch dsType {
 	case "mysql":
 		return "mysql"
 	case "postgresql":
 		return "postgres"
+	case "sqlite":
+		return "sqlite3"
 	default:
 		return dsType
 	}
 }
+
+// sqlitePathEscaper 转义文件路径中与 URI 参数冲突的字符
+var sqlitePathEscaper = strings.NewReplacer("%", "%25", "?", "%3f", "#", "%23")
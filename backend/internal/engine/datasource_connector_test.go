@@ -0,0 +1,127 @@
+package engine
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"cozy-insight-backend/pkg/logger"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newSQLiteFixture 创建包含 orders 表的 SQLite 数据库文件,返回数据源配置JSON
+func newSQLiteFixture(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), "sales.db")
+	db, err := sql.Open("sqlite3", path)
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.Exec(`CREATE TABLE orders (id INTEGER PRIMARY KEY, region TEXT NOT NULL, amount REAL)`)
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO orders (region, amount) VALUES ('east', 10), ('east', 20), ('west', 5)`)
+	require.NoError(t, err)
+
+	return fmt.Sprintf(`{"type":"sqlite","path":%q}`, path)
+}
+
+func TestDatasourceConnector_SQLite(t *testing.T) {
+	configJSON := newSQLiteFixture(t)
+	connector := NewDatasourceConnector(NewConnectionManager(nil), nil)
+	target := &QueryTarget{DatasourceID: "ds-sqlite", DatasourceType: DialectSQLite, Configuration: configJSON}
+	ctx := context.Background()
+
+	result, err := connector.TestConnection(ctx, target)
+	require.NoError(t, err)
+	assert.True(t, result.Success, result.Message)
+
+	databases, err := connector.GetDatabaseList(ctx, target)
+	require.NoError(t, err)
+	assert.Contains(t, databases, "main")
+
+	tables, err := connector.GetTableList(ctx, target, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"orders"}, tables)
+
+	schema, err := connector.GetTableSchema(ctx, target, "", "orders")
+	require.NoError(t, err)
+	require.Len(t, schema.Columns, 3)
+	assert.Equal(t, "region", schema.Columns[1].Name)
+	assert.Equal(t, "TEXT", schema.Columns[1].NativeType)
+}
+
+func TestDatasourceConnector_SQLiteMissingFile(t *testing.T) {
+	connector := NewDatasourceConnector(nil, nil)
+	configJSON := fmt.Sprintf(`{"type":"sqlite","path":%q}`, filepath.Join(t.TempDir(), "missing.db"))
+
+	result, err := connector.TestConnection(context.Background(), &QueryTarget{Configuration: configJSON})
+	require.NoError(t, err)
+	assert.False(t, result.Success)
+
+	_, err = buildDSN(&DatasourceConfig{Type: "sqlite"})
+	assert.Error(t, err)
+}
+
+func TestBuildDSN_SQLiteDataDir(t *testing.T) {
+	dir := t.TempDir()
+	inside := filepath.Join(dir, "sales.db")
+	extract := filepath.Join(dir, "extract.db")
+	outside := filepath.Join(t.TempDir(), "app.db")
+	for _, path := range []string{inside, extract, outside} {
+		require.NoError(t, os.WriteFile(path, nil, 0o600))
+	}
+	require.NoError(t, os.Symlink(outside, filepath.Join(dir, "link.db")))
+
+	require.NoError(t, SetSQLiteDataDir(dir, extract))
+	defer func() {
+		sqlitePathMu.Lock()
+		sqliteDir, sqliteDenied = "", nil
+		sqlitePathMu.Unlock()
+	}()
+	resolvedDir, err := filepath.EvalSymlinks(dir)
+	require.NoError(t, err)
+
+	// 相对路径按数据目录解析
+	dsn, err := buildDSN(&DatasourceConfig{Type: "sqlite", Path: "sales.db"})
+	require.NoError(t, err)
+	assert.Equal(t, "file:"+filepath.Join(resolvedDir, "sales.db")+"?mode=ro&_busy_timeout=5000", dsn)
+	_, err = buildDSN(&DatasourceConfig{Type: "sqlite", Path: inside})
+	assert.NoError(t, err)
+
+	// 目录外的文件、经符号链接或 .. 指向目录外的文件、抽取库均被拒绝
+	for _, path := range []string{outside, "link.db", "../" + filepath.Base(filepath.Dir(outside)) + "/app.db", extract, "extract.db", "missing.db"} {
+		_, err = buildDSN(&DatasourceConfig{Type: "sqlite", Path: path})
+		assert.Error(t, err, path)
+	}
+}
+
+func TestQueryRouter_SQLiteNative(t *testing.T) {
+	logger.InitLogger("error")
+	configJSON := newSQLiteFixture(t)
+	router := NewQueryRouter(NewNativeExecutor(NewConnectionManager(nil)), NewCalciteExecutor(nil))
+	target := &QueryTarget{DatasourceID: "ds-sqlite", DatasourceType: DialectSQLite, Configuration: configJSON}
+
+	query := &Query{
+		Source: QuerySource{Table: "orders"},
+		Selects: []SelectItem{
+			{Field: "region", Alias: "region"},
+			{Field: "amount", Aggregate: "SUM", Alias: "total"},
+		},
+		Filters: []Filter{{Field: "amount", Operator: ">", Value: 1}},
+		GroupBy: []string{"region"},
+		OrderBy: []OrderItem{{Field: "total", Desc: true}},
+		Limit:   10,
+	}
+
+	result, err := router.Execute(context.Background(), target, query)
+	require.NoError(t, err)
+	assert.Equal(t, ExecPathNative, result.Path)
+	assert.False(t, result.Fallback)
+	require.Len(t, result.Rows, 2)
+	assert.Equal(t, "east", result.Rows[0]["region"])
+	assert.Equal(t, 30.0, result.Rows[0]["total"])
+}
@@ -0,0 +1,303 @@
+package engine
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"cozy-insight-backend/pkg/logger"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+// testPKI 测试用 CA 及其签发的服务端、客户端证书(PEM)
+type testPKI struct {
+	caPEM      string
+	serverCert tls.Certificate
+	clientCert string
+	clientKey  string
+	pool       *x509.CertPool
+}
+
+func newTestPKI(t *testing.T) *testPKI {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+	ca, err := x509.ParseCertificate(caDER)
+	require.NoError(t, err)
+
+	issue := func(serial int64, name string, usage x509.ExtKeyUsage) (string, string) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+		tmpl := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: name},
+			DNSNames:     []string{name},
+			IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, &key.PublicKey, caKey)
+		require.NoError(t, err)
+		keyDER, err := x509.MarshalECPrivateKey(key)
+		require.NoError(t, err)
+		return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+			string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+	}
+
+	p := &testPKI{
+		caPEM: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER})),
+		pool:  x509.NewCertPool(),
+	}
+	p.pool.AddCert(ca)
+	serverCert, serverKey := issue(2, "db.internal", x509.ExtKeyUsageServerAuth)
+	p.serverCert, err = tls.X509KeyPair([]byte(serverCert), []byte(serverKey))
+	require.NoError(t, err)
+	p.clientCert, p.clientKey = issue(3, "client", x509.ExtKeyUsageClientAuth)
+	return p
+}
+
+// fakePostgres 只实现启动、明文密码认证和空查询的 PostgreSQL 服务端
+type fakePostgres struct {
+	tls *tls.Config // 为空时拒绝 SSLRequest
+
+	mu       sync.Mutex
+	startups []map[string]string
+	password string
+	tlsConns int
+}
+
+func startFakePostgres(t *testing.T, server *fakePostgres) (string, int) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+	addr := listener.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port
+}
+
+func (s *fakePostgres) serve(conn net.Conn) {
+	defer conn.Close()
+	var rw io.ReadWriter = conn
+	r := bufio.NewReader(rw)
+
+	readStartup := func() ([]byte, error) {
+		var size int32
+		if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+			return nil, err
+		}
+		body := make([]byte, size-4)
+		_, err := io.ReadFull(r, body)
+		return body, err
+	}
+
+	body, err := readStartup()
+	if err != nil {
+		return
+	}
+	// SSLRequest: 协议号 80877103
+	if binary.BigEndian.Uint32(body) == 80877103 {
+		if s.tls == nil {
+			conn.Write([]byte("N"))
+		} else {
+			conn.Write([]byte("S"))
+			tlsConn := tls.Server(conn, s.tls)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.tlsConns++
+			s.mu.Unlock()
+			rw = tlsConn
+			r = bufio.NewReader(rw)
+		}
+		if body, err = readStartup(); err != nil {
+			return
+		}
+	}
+
+	params := map[string]string{}
+	fields := strings.Split(string(body[4:]), "\x00")
+	for i := 0; i+1 < len(fields); i += 2 {
+		if fields[i] != "" {
+			params[fields[i]] = fields[i+1]
+		}
+	}
+
+	message := func(typ byte, payload []byte) []byte {
+		buf := []byte{typ, 0, 0, 0, 0}
+		binary.BigEndian.PutUint32(buf[1:], uint32(len(payload)+4))
+		return append(buf, payload...)
+	}
+	readMessage := func() (byte, []byte, error) {
+		typ, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		var size int32
+		if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+			return 0, nil, err
+		}
+		payload := make([]byte, size-4)
+		_, err = io.ReadFull(r, payload)
+		return typ, payload, err
+	}
+
+	// AuthenticationCleartextPassword
+	rw.Write(message('R', []byte{0, 0, 0, 3}))
+	typ, payload, err := readMessage()
+	if err != nil || typ != 'p' {
+		return
+	}
+	password := strings.TrimSuffix(string(payload), "\x00")
+	s.mu.Lock()
+	s.startups = append(s.startups, params)
+	ok := password == s.password
+	s.mu.Unlock()
+	if !ok {
+		rw.Write(message('E', []byte("SFATAL\x00C28P01\x00Mpassword authentication failed\x00\x00")))
+		return
+	}
+	rw.Write(append(message('R', []byte{0, 0, 0, 0}), message('Z', []byte("I"))...))
+
+	for {
+		typ, _, err := readMessage()
+		if err != nil || typ == 'X' {
+			return
+		}
+		if typ == 'Q' {
+			// 只用于 Ping 的空查询
+			rw.Write(append(message('I', nil), message('Z', []byte("I"))...))
+		}
+	}
+}
+
+func (s *fakePostgres) lastStartup() map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.startups) == 0 {
+		return nil
+	}
+	return s.startups[len(s.startups)-1]
+}
+
+func postgresConfigJSON(t *testing.T, config *DatasourceConfig) string {
+	config.Type = "postgresql"
+	data, err := json.Marshal(config)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestConnectionManager_PostgresQuotedParams(t *testing.T) {
+	logger.InitLogger("error")
+	password := `p w' sslmode=require \x`
+	server := &fakePostgres{password: password}
+	host, port := startFakePostgres(t, server)
+
+	m := NewConnectionManager(nil)
+	defer m.Close()
+	db, _, _, err := m.Get("ds1", "postgresql", postgresConfigJSON(t, &DatasourceConfig{
+		Host: host, Port: port, Username: "report user", Password: password, Database: "sales db",
+	}), "")
+	require.NoError(t, err)
+	require.NoError(t, db.Ping())
+
+	// 密码中的空格和引号不会改写 sslmode 等参数
+	startup := server.lastStartup()
+	assert.Equal(t, "report user", startup["user"])
+	assert.Equal(t, "sales db", startup["database"])
+	assert.Zero(t, server.tlsConns)
+}
+
+func TestConnectionManager_PostgresTLS(t *testing.T) {
+	logger.InitLogger("error")
+	pki := newTestPKI(t)
+	server := &fakePostgres{password: "pw", tls: &tls.Config{
+		Certificates: []tls.Certificate{pki.serverCert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pki.pool,
+	}}
+	host, port := startFakePostgres(t, server)
+	sshAddr, hostKey := startTestSSHServer(t, "sshpw")
+	sshHost, sshPortStr, _ := net.SplitHostPort(sshAddr)
+	sshPort, _ := strconv.Atoi(sshPortStr)
+
+	withTLS := func(tlsConfig *DatasourceTLSConfig, tunnel bool) string {
+		config := &DatasourceConfig{Host: host, Port: port, Username: "u", Password: "pw", Database: "d", TLS: tlsConfig}
+		if tunnel {
+			config.SSH = &SSHTunnelConfig{Enabled: true, Host: sshHost, Port: sshPort, Username: "tunnel",
+				Password: "sshpw", HostKey: ssh.FingerprintSHA256(hostKey)}
+		}
+		return postgresConfigJSON(t, config)
+	}
+	verifyCA := &DatasourceTLSConfig{Mode: TLSModeVerifyCA, CACert: pki.caPEM, ClientCert: pki.clientCert, ClientKey: pki.clientKey}
+
+	tests := []struct {
+		name    string
+		config  string
+		wantErr bool
+	}{
+		// 证书内容经 sslinline 传给驱动,服务端校验客户端证书
+		{"verify-ca", withTLS(verifyCA, false), false},
+		{"verify-ca through ssh", withTLS(verifyCA, true), false},
+		{"verify-full", withTLS(&DatasourceTLSConfig{Mode: TLSModeVerifyFull, CACert: pki.caPEM,
+			ClientCert: pki.clientCert, ClientKey: pki.clientKey}, false), false},
+		{"missing client cert", withTLS(&DatasourceTLSConfig{Mode: TLSModeRequire}, false), true},
+		{"untrusted ca", withTLS(&DatasourceTLSConfig{Mode: TLSModeVerifyCA, CACert: newTestPKI(t).caPEM,
+			ClientCert: pki.clientCert, ClientKey: pki.clientKey}, false), true},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewConnectionManager(nil)
+			defer m.Close()
+			db, _, _, err := m.Get("ds"+strconv.Itoa(i), "postgresql", tt.config, "")
+			if err == nil {
+				err = db.Ping()
+			}
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "u", server.lastStartup()["user"])
+		})
+	}
+	assert.Equal(t, 3, server.tlsConns)
+}
@@ -0,0 +1,150 @@
+package engine
+
+import (
+	"crypto/md5"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// TLS 校验模式,与 libpq 的 sslmode 取值一致
+const (
+	TLSModeDisable    = "disable"     // 不使用 TLS
+	TLSModeRequire    = "require"     // 使用 TLS,不校验服务端证书
+	TLSModeVerifyCA   = "verify-ca"   // 校验服务端证书链,不校验主机名
+	TLSModeVerifyFull = "verify-full" // 校验证书链和主机名
+)
+
+// DatasourceTLSConfig 数据源 TLS 配置,证书和私钥均为 PEM 内容
+type DatasourceTLSConfig struct {
+	Mode       string `json:"mode"`
+	CACert     string `json:"caCert"`     // CA 证书,为空时使用系统根证书
+	ClientCert string `json:"clientCert"` // 双向 TLS 客户端证书
+	ClientKey  string `json:"clientKey"`  // 双向 TLS 客户端私钥
+	ServerName string `json:"serverName"` // 校验的服务端主机名,默认为数据源主机
+}
+
+// enabled 是否启用 TLS
+func (c *DatasourceTLSConfig) enabled() bool {
+	return c != nil && c.Mode != "" && c.Mode != TLSModeDisable
+}
+
+// buildTLSConfig 根据数据源 TLS 配置创建 *tls.Config
+func buildTLSConfig(c *DatasourceTLSConfig, host string) (*tls.Config, error) {
+	var roots *x509.CertPool
+	if c.CACert != "" {
+		roots = x509.NewCertPool()
+		if !roots.AppendCertsFromPEM([]byte(c.CACert)) {
+			return nil, fmt.Errorf("invalid CA certificate")
+		}
+	}
+
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if c.ClientCert != "" || c.ClientKey != "" {
+		pair, err := tls.X509KeyPair([]byte(c.ClientCert), []byte(c.ClientKey))
+		if err != nil {
+			return nil, fmt.Errorf("invalid client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{pair}
+	}
+
+	switch c.Mode {
+	case TLSModeRequire:
+		cfg.InsecureSkipVerify = true
+	case TLSModeVerifyCA:
+		// 跳过默认校验(含主机名),只校验证书链
+		cfg.InsecureSkipVerify = true
+		cfg.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			return verifyCertificateChain(rawCerts, roots)
+		}
+	case TLSModeVerifyFull:
+		cfg.RootCAs = roots
+		cfg.ServerName = c.ServerName
+		if cfg.ServerName == "" {
+			cfg.ServerName = host
+		}
+	default:
+		return nil, fmt.Errorf("unsupported tls mode: %s", c.Mode)
+	}
+	return cfg, nil
+}
+
+// verifyCertificateChain 校验服务端证书链,roots 为空时使用系统根证书
+func verifyCertificateChain(rawCerts [][]byte, roots *x509.CertPool) error {
+	if len(rawCerts) == 0 {
+		return fmt.Errorf("server did not present a certificate")
+	}
+	certs := make([]*x509.Certificate, len(rawCerts))
+	for i, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return fmt.Errorf("invalid server certificate: %w", err)
+		}
+		certs[i] = cert
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := certs[0].Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates})
+	return err
+}
+
+// tlsConfigKey TLS 配置摘要,用于驱动注册名
+func tlsConfigKey(c *DatasourceTLSConfig, host string) string {
+	data, _ := json.Marshal(c)
+	sum := md5.Sum(append(data, host...))
+	return hex.EncodeToString(sum[:])
+}
+
+// registerMySQLTLS 向 MySQL 驱动注册 TLS 配置,返回 DSN 中 tls 参数使用的名称
+func registerMySQLTLS(c *DatasourceTLSConfig, host string) (string, error) {
+	cfg, err := buildTLSConfig(c, host)
+	if err != nil {
+		return "", err
+	}
+	name := "ds-" + tlsConfigKey(c, host)
+	if err := mysql.RegisterTLSConfig(name, cfg); err != nil {
+		return "", fmt.Errorf("failed to register tls config: %w", err)
+	}
+	return name, nil
+}
+
+// postgresTLSParams 生成 PostgreSQL 连接串的 ssl 参数
+// 证书和私钥以 sslinline 方式直接放入连接串,只保存在内存中,不落盘
+func postgresTLSParams(c *DatasourceTLSConfig) (string, error) {
+	if !c.enabled() {
+		return "sslmode=disable", nil
+	}
+	switch c.Mode {
+	case TLSModeRequire, TLSModeVerifyCA, TLSModeVerifyFull:
+	default:
+		return "", fmt.Errorf("unsupported tls mode: %s", c.Mode)
+	}
+	if (c.ClientCert == "") != (c.ClientKey == "") {
+		return "", fmt.Errorf("client certificate and client key must be set together")
+	}
+
+	params := []string{"sslmode=" + c.Mode, "sslinline=true"}
+	for _, p := range []struct{ param, content string }{
+		{"sslrootcert", c.CACert},
+		{"sslcert", c.ClientCert},
+		{"sslkey", c.ClientKey},
+	} {
+		if p.content != "" {
+			params = append(params, p.param+"="+quoteDSNValue(p.content))
+		}
+	}
+	return strings.Join(params, " "), nil
+}
+
+// quoteDSNValue 按 libpq 连接串规则引用参数值
+func quoteDSNValue(value string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
+}
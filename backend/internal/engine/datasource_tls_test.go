@@ -0,0 +1,90 @@
+package engine
+
+import (
+	"crypto/tls"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildTLSConfig_VerifyModes(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	caPEM := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}))
+	addr := strings.TrimPrefix(server.URL, "https://")
+
+	dial := func(c *DatasourceTLSConfig, host string) error {
+		cfg, err := buildTLSConfig(c, host)
+		require.NoError(t, err)
+		conn, err := tls.Dial("tcp", addr, cfg)
+		if err == nil {
+			conn.Close()
+		}
+		return err
+	}
+
+	// verify-ca 只校验证书链,主机名不同也可连接
+	assert.NoError(t, dial(&DatasourceTLSConfig{Mode: TLSModeVerifyCA, CACert: caPEM}, "db.internal"))
+	// verify-full 校验主机名
+	assert.NoError(t, dial(&DatasourceTLSConfig{Mode: TLSModeVerifyFull, CACert: caPEM}, "127.0.0.1"))
+	assert.Error(t, dial(&DatasourceTLSConfig{Mode: TLSModeVerifyFull, CACert: caPEM}, "db.internal"))
+	assert.NoError(t, dial(&DatasourceTLSConfig{Mode: TLSModeVerifyFull, CACert: caPEM, ServerName: "example.com"}, "db.internal"))
+	// 未提供 CA 时使用系统根证书,自签名证书校验失败
+	assert.Error(t, dial(&DatasourceTLSConfig{Mode: TLSModeVerifyCA}, "127.0.0.1"))
+	// require 不校验证书
+	assert.NoError(t, dial(&DatasourceTLSConfig{Mode: TLSModeRequire}, "db.internal"))
+
+	_, err := buildTLSConfig(&DatasourceTLSConfig{Mode: TLSModeVerifyCA, CACert: "bad"}, "db")
+	assert.Error(t, err)
+	_, err = buildTLSConfig(&DatasourceTLSConfig{Mode: TLSModeRequire, ClientCert: caPEM}, "db")
+	assert.Error(t, err)
+	_, err = buildTLSConfig(&DatasourceTLSConfig{Mode: "prefer"}, "db")
+	assert.Error(t, err)
+}
+
+func TestBuildDSN_TLS(t *testing.T) {
+	dsn, err := buildDSN(&DatasourceConfig{Type: "mysql", Host: "db", Port: 3306, TLS: &DatasourceTLSConfig{Mode: TLSModeRequire}})
+	require.NoError(t, err)
+	assert.Contains(t, dsn, "&tls=ds-")
+
+	dsn, err = buildDSN(&DatasourceConfig{Type: "mysql", Host: "db", Port: 3306, TLS: &DatasourceTLSConfig{Mode: TLSModeDisable}})
+	require.NoError(t, err)
+	assert.NotContains(t, dsn, "tls=")
+
+	dsn, err = buildDSN(&DatasourceConfig{Type: "postgresql", Host: "db", Port: 5432})
+	require.NoError(t, err)
+	assert.True(t, strings.HasSuffix(dsn, "sslmode=disable"))
+
+	dsn, err = buildDSN(&DatasourceConfig{Type: "postgresql", Host: "db", Port: 5432, TLS: &DatasourceTLSConfig{
+		Mode:       TLSModeVerifyCA,
+		CACert:     "CA",
+		ClientCert: "CERT",
+		ClientKey:  "KEY",
+	}})
+	require.NoError(t, err)
+	// 证书内容直接放入连接串,不写临时文件
+	assert.Contains(t, dsn, "sslmode=verify-ca sslinline=true sslrootcert='CA' sslcert='CERT' sslkey='KEY'")
+
+	dsn, err = buildDSN(&DatasourceConfig{Type: "postgresql", Host: "db", Port: 5432, TLS: &DatasourceTLSConfig{
+		Mode:   TLSModeVerifyFull,
+		CACert: "-----BEGIN CERTIFICATE-----\nit's\n-----END CERTIFICATE-----\n",
+	}})
+	require.NoError(t, err)
+	assert.Contains(t, dsn, `sslrootcert='-----BEGIN CERTIFICATE-----`+"\n"+`it\'s`)
+
+	_, err = buildDSN(&DatasourceConfig{Type: "postgresql", Host: "db", TLS: &DatasourceTLSConfig{Mode: TLSModeRequire, ClientCert: "CERT"}})
+	assert.Error(t, err)
+
+	// 经隧道连接时 libpq 无法按原主机名校验
+	_, err = buildDSN(&DatasourceConfig{
+		Type: "postgresql", Host: "127.0.0.1", Port: 40000,
+		SSH: &SSHTunnelConfig{Enabled: true},
+		TLS: &DatasourceTLSConfig{Mode: TLSModeVerifyFull, ServerName: "db.internal"},
+	})
+	assert.Error(t, err)
+}
@@ -0,0 +1,191 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 方言名称,与数据源类型一致
+const (
+	DialectMySQL      = "mysql"
+	DialectPostgreSQL = "postgresql"
+	DialectClickHouse = "clickhouse"
+	DialectSQLite     = "sqlite"
+	DialectCalcite    = "calcite"
+)
+
+// 时间截断粒度
+const (
+	TimeUnitYear    = "year"
+	TimeUnitQuarter = "quarter"
+	TimeUnitMonth   = "month"
+	TimeUnitWeek    = "week"
+	TimeUnitDay     = "day"
+	TimeUnitHour    = "hour"
+	TimeUnitMinute  = "minute"
+)
+
+// 字符串函数
+const (
+	StringFuncConcat    = "concat"
+	StringFuncLower     = "lower"
+	StringFuncUpper     = "upper"
+	StringFuncLength    = "length"
+	StringFuncSubstring = "substring"
+	StringFuncTrim      = "trim"
+)
+
+// Dialect SQL方言,屏蔽不同数据库之间的语法差异
+type Dialect interface {
+	// Name 方言名称
+	Name() string
+	// QuoteIdentifier 为标识符加引号
+	QuoteIdentifier(name string) string
+	// Placeholder 第 n 个(从1开始)绑定参数的占位符
+	Placeholder(n int) string
+	// LimitOffset 分页子句(含前导空格),limit<=0 表示不限制行数
+	LimitOffset(limit, offset int) string
+	// DateTrunc 将时间表达式截断到指定粒度
+	DateTrunc(expr, unit string) (string, error)
+	// WeekTrunc 将时间表达式截断到所在周的第一天,firstDay 为每周的第一天
+	WeekTrunc(expr string, firstDay time.Weekday) string
+	// ConvertTimeZone 将按 UTC 存储的时间表达式换算为指定时区的本地时间
+	// 不支持时区名称的方言只接受固定偏移的时区,有夏令时的时区返回错误
+	ConvertTimeZone(expr string, loc *time.Location) (string, error)
+	// DatePart 提取时间表达式的年、季度、月、日、时、分,结果为整数
+	DatePart(expr, unit string) (string, error)
+	// DateDiff 两个时间表达式相差的天数(end - start)
+	DateDiff(start, end string) string
+	// CurrentTimestamp 当前时间
+	CurrentTimestamp() string
+	// StringFunc 字符串函数表达式,参数为已编译的SQL表达式
+	StringFunc(name string, args ...string) (string, error)
+	// AggregateFunc 扩展聚合函数表达式(去重计数、中位数、百分位、标准差、方差、首末值)
+	// FIRST、LAST 按 orderExpr 排序取首末值,其余函数忽略 orderExpr
+	AggregateFunc(name, expr, orderExpr string) (string, error)
+	// BooleanLiteral 布尔字面量
+	BooleanLiteral(v bool) string
+	// DatabaseListQuery 数据库列表查询
+	DatabaseListQuery() string
+	// TableListQuery 表列表查询
+	TableListQuery(database string) (string, []interface{})
+	// TableSchemaQuery 表结构查询
+	TableSchemaQuery(database, table string) (string, []interface{})
+}
+
+var (
+	dialectsMu sync.RWMutex
+	dialects   = make(map[string]Dialect)
+)
+
+// RegisterDialect 注册数据源类型对应的方言,重复注册会覆盖
+func RegisterDialect(dsType string, d Dialect) {
+	dialectsMu.Lock()
+	defer dialectsMu.Unlock()
+	dialects[dsType] = d
+}
+
+// GetDialect 获取数据源类型对应的方言
+func GetDialect(dsType string) (Dialect, error) {
+	dialectsMu.RLock()
+	defer dialectsMu.RUnlock()
+	d, ok := dialects[dsType]
+	if !ok {
+		return nil, fmt.Errorf("no dialect registered for datasource type: %s", dsType)
+	}
+	return d, nil
+}
+
+// quoteWith 使用指定引号字符包裹标识符,内部引号加倍转义
+func quoteWith(name, quote string) string {
+	return quote + strings.ReplaceAll(name, quote, quote+quote) + quote
+}
+
+// quoteTableName 为表名加引号,支持 schema.table 形式
+func quoteTableName(d Dialect, name string) string {
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		parts[i] = d.QuoteIdentifier(part)
+	}
+	return strings.Join(parts, ".")
+}
+
+// quoteLiteral 单引号字符串字面量,仅用于方言内部的格式串等常量
+func quoteLiteral(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// standardLimitOffset LIMIT n OFFSET m 形式的分页
+func standardLimitOffset(limit, offset int, unlimited string) string {
+	switch {
+	case limit > 0 && offset > 0:
+		return fmt.Sprintf(" LIMIT %d OFFSET %d", limit, offset)
+	case limit > 0:
+		return fmt.Sprintf(" LIMIT %d", limit)
+	case offset > 0:
+		return fmt.Sprintf(" LIMIT %s OFFSET %d", unlimited, offset)
+	default:
+		return ""
+	}
+}
+
+// fixedOffsetMinutes 固定偏移时区相对 UTC 的偏移分钟数,用于不支持时区名称的方言
+// 2000 年以来实行过夏令时或调整过偏移的时区无法用单一偏移换算,返回错误
+func fixedOffsetMinutes(dialect string, loc *time.Location) (int, error) {
+	_, offset := time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC).In(loc).Zone()
+	for year := 2000; year <= 2037; year++ {
+		for month := time.January; month <= time.December; month++ {
+			if _, o := time.Date(year, month, 1, 0, 0, 0, 0, time.UTC).In(loc).Zone(); o != offset {
+				return 0, fmt.Errorf("time zone %s has daylight saving or offset changes, %s only supports fixed offset time zones", loc, dialect)
+			}
+		}
+	}
+	return offset / 60, nil
+}
+
+// checkStringFuncArgs 校验字符串函数参数个数
+func checkStringFuncArgs(name string, args []string) error {
+	switch name {
+	case StringFuncConcat:
+		if len(args) == 0 {
+			return fmt.Errorf("%s requires at least one argument", name)
+		}
+	case StringFuncLower, StringFuncUpper, StringFuncLength, StringFuncTrim:
+		if len(args) != 1 {
+			return fmt.Errorf("%s requires exactly one argument", name)
+		}
+	case StringFuncSubstring:
+		if len(args) != 2 && len(args) != 3 {
+			return fmt.Errorf("%s requires two or three arguments", name)
+		}
+	default:
+		return fmt.Errorf("unsupported string function: %s", name)
+	}
+	return nil
+}
+
+// ansiStringFunc 标准SQL的字符串函数写法
+func ansiStringFunc(name string, args []string, lengthFunc string) (string, error) {
+	if err := checkStringFuncArgs(name, args); err != nil {
+		return "", err
+	}
+	switch name {
+	case StringFuncConcat:
+		return "(" + strings.Join(args, " || ") + ")", nil
+	case StringFuncLower:
+		return fmt.Sprintf("LOWER(%s)", args[0]), nil
+	case StringFuncUpper:
+		return fmt.Sprintf("UPPER(%s)", args[0]), nil
+	case StringFuncLength:
+		return fmt.Sprintf("%s(%s)", lengthFunc, args[0]), nil
+	case StringFuncTrim:
+		return fmt.Sprintf("TRIM(%s)", args[0]), nil
+	default: // substring
+		if len(args) == 3 {
+			return fmt.Sprintf("SUBSTRING(%s FROM %s FOR %s)", args[0], args[1], args[2]), nil
+		}
+		return fmt.Sprintf("SUBSTRING(%s FROM %s)", args[0], args[1]), nil
+	}
+}
@@ -0,0 +1,115 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// calciteDialect Calcite(Avatica)方言,用于联邦查询
+type calciteDialect struct{}
+
+func init() {
+	RegisterDialect(DialectCalcite, &calciteDialect{})
+}
+
+func (d *calciteDialect) Name() string { return DialectCalcite }
+
+func (d *calciteDialect) QuoteIdentifier(name string) string { return quoteWith(name, `"`) }
+
+func (d *calciteDialect) Placeholder(n int) string { return "?" }
+
+func (d *calciteDialect) LimitOffset(limit, offset int) string {
+	switch {
+	case limit > 0 && offset > 0:
+		return fmt.Sprintf(" LIMIT %d OFFSET %d", limit, offset)
+	case limit > 0:
+		return fmt.Sprintf(" LIMIT %d", limit)
+	case offset > 0:
+		return fmt.Sprintf(" OFFSET %d ROWS", offset)
+	default:
+		return ""
+	}
+}
+
+func (d *calciteDialect) DateTrunc(expr, unit string) (string, error) {
+	switch unit {
+	case TimeUnitYear, TimeUnitQuarter, TimeUnitMonth, TimeUnitWeek, TimeUnitDay, TimeUnitHour, TimeUnitMinute:
+		return fmt.Sprintf("FLOOR(%s TO %s)", expr, strings.ToUpper(unit)), nil
+	default:
+		return "", fmt.Errorf("unsupported time unit: %s", unit)
+	}
+}
+
+func (d *calciteDialect) WeekTrunc(expr string, firstDay time.Weekday) string {
+	return fmt.Sprintf("TIMESTAMPADD(DAY, -MOD(DAYOFWEEK(%s) + %d, 7), FLOOR(%s TO DAY))", expr, 6-int(firstDay), expr)
+}
+
+// ConvertTimeZone Calcite 没有按时区名称换算的函数,只支持固定偏移的时区
+func (d *calciteDialect) ConvertTimeZone(expr string, loc *time.Location) (string, error) {
+	offset, err := fixedOffsetMinutes(d.Name(), loc)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("TIMESTAMPADD(MINUTE, %d, %s)", offset, expr), nil
+}
+
+func (d *calciteDialect) DatePart(expr, unit string) (string, error) {
+	switch unit {
+	case TimeUnitYear, TimeUnitQuarter, TimeUnitMonth, TimeUnitDay, TimeUnitHour, TimeUnitMinute:
+		return fmt.Sprintf("EXTRACT(%s FROM %s)", strings.ToUpper(unit), expr), nil
+	default:
+		return "", fmt.Errorf("unsupported date part: %s", unit)
+	}
+}
+
+func (d *calciteDialect) DateDiff(start, end string) string {
+	return fmt.Sprintf("TIMESTAMPDIFF(DAY, %s, %s)", start, end)
+}
+
+func (d *calciteDialect) CurrentTimestamp() string { return "CURRENT_TIMESTAMP" }
+
+func (d *calciteDialect) StringFunc(name string, args ...string) (string, error) {
+	return ansiStringFunc(name, args, "CHAR_LENGTH")
+}
+
+func (d *calciteDialect) AggregateFunc(name, expr, orderExpr string) (string, error) {
+	switch name {
+	case AggregateCountDistinct:
+		return fmt.Sprintf("COUNT(DISTINCT %s)", expr), nil
+	case AggregateApproxCountDistinct:
+		return fmt.Sprintf("APPROX_COUNT_DISTINCT(%s)", expr), nil
+	case AggregateStddev:
+		return fmt.Sprintf("STDDEV_SAMP(%s)", expr), nil
+	case AggregateVariance:
+		return fmt.Sprintf("VAR_SAMP(%s)", expr), nil
+	case AggregateFirst:
+		return fmt.Sprintf("ARG_MIN(%s, %s)", expr, orderExpr), nil
+	case AggregateLast:
+		return fmt.Sprintf("ARG_MAX(%s, %s)", expr, orderExpr), nil
+	}
+	if p, ok := aggregatePercentiles[name]; ok {
+		return fmt.Sprintf("PERCENTILE_DISC(%g) WITHIN GROUP (ORDER BY %s)", p, expr), nil
+	}
+	return "", unsupportedAggregate(d.Name(), name)
+}
+
+func (d *calciteDialect) BooleanLiteral(v bool) string {
+	if v {
+		return "TRUE"
+	}
+	return "FALSE"
+}
+
+func (d *calciteDialect) DatabaseListQuery() string {
+	return `SELECT DISTINCT "tableSchem" FROM "metadata"."TABLES"`
+}
+
+func (d *calciteDialect) TableListQuery(database string) (string, []interface{}) {
+	return `SELECT "tableName" FROM "metadata"."TABLES" WHERE "tableSchem" = ?`, []interface{}{database}
+}
+
+func (d *calciteDialect) TableSchemaQuery(database, table string) (string, []interface{}) {
+	return `SELECT "columnName", "typeName", "isNullable" FROM "metadata"."COLUMNS" WHERE "tableSchem" = ? AND "tableName" = ? ORDER BY "ordinalPosition"`,
+		[]interface{}{database, table}
+}
@@ -0,0 +1,139 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// clickhouseDialect ClickHouse方言
+type clickhouseDialect struct{}
+
+func init() {
+	RegisterDialect(DialectClickHouse, &clickhouseDialect{})
+}
+
+func (d *clickhouseDialect) Name() string { return DialectClickHouse }
+
+func (d *clickhouseDialect) QuoteIdentifier(name string) string { return quoteWith(name, "`") }
+
+func (d *clickhouseDialect) Placeholder(n int) string { return "?" }
+
+func (d *clickhouseDialect) LimitOffset(limit, offset int) string {
+	return standardLimitOffset(limit, offset, "18446744073709551615")
+}
+
+func (d *clickhouseDialect) DateTrunc(expr, unit string) (string, error) {
+	functions := map[string]string{
+		TimeUnitYear:    "toStartOfYear",
+		TimeUnitQuarter: "toStartOfQuarter",
+		TimeUnitMonth:   "toStartOfMonth",
+		TimeUnitWeek:    "toMonday",
+		TimeUnitDay:     "toStartOfDay",
+		TimeUnitHour:    "toStartOfHour",
+		TimeUnitMinute:  "toStartOfMinute",
+	}
+	fn, ok := functions[unit]
+	if !ok {
+		return "", fmt.Errorf("unsupported time unit: %s", unit)
+	}
+	return fmt.Sprintf("%s(%s)", fn, expr), nil
+}
+
+func (d *clickhouseDialect) WeekTrunc(expr string, firstDay time.Weekday) string {
+	return fmt.Sprintf("subtractDays(toDate(%s), (toDayOfWeek(%s) + %d) %% 7)", expr, expr, 7-int(firstDay))
+}
+
+func (d *clickhouseDialect) ConvertTimeZone(expr string, loc *time.Location) (string, error) {
+	return fmt.Sprintf("toTimeZone(%s, %s)", expr, quoteLiteral(loc.String())), nil
+}
+
+func (d *clickhouseDialect) DatePart(expr, unit string) (string, error) {
+	functions := map[string]string{
+		TimeUnitYear:    "toYear",
+		TimeUnitQuarter: "toQuarter",
+		TimeUnitMonth:   "toMonth",
+		TimeUnitDay:     "toDayOfMonth",
+		TimeUnitHour:    "toHour",
+		TimeUnitMinute:  "toMinute",
+	}
+	fn, ok := functions[unit]
+	if !ok {
+		return "", fmt.Errorf("unsupported date part: %s", unit)
+	}
+	return fmt.Sprintf("%s(%s)", fn, expr), nil
+}
+
+func (d *clickhouseDialect) DateDiff(start, end string) string {
+	return fmt.Sprintf("dateDiff('day', toDate(%s), toDate(%s))", start, end)
+}
+
+func (d *clickhouseDialect) CurrentTimestamp() string { return "now()" }
+
+func (d *clickhouseDialect) StringFunc(name string, args ...string) (string, error) {
+	if err := checkStringFuncArgs(name, args); err != nil {
+		return "", err
+	}
+	switch name {
+	case StringFuncConcat:
+		return fmt.Sprintf("concat(%s)", strings.Join(args, ", ")), nil
+	case StringFuncLower:
+		return fmt.Sprintf("lowerUTF8(%s)", args[0]), nil
+	case StringFuncUpper:
+		return fmt.Sprintf("upperUTF8(%s)", args[0]), nil
+	case StringFuncLength:
+		return fmt.Sprintf("lengthUTF8(%s)", args[0]), nil
+	case StringFuncSubstring:
+		return fmt.Sprintf("substringUTF8(%s)", strings.Join(args, ", ")), nil
+	default:
+		return fmt.Sprintf("trimBoth(%s)", args[0]), nil
+	}
+}
+
+func (d *clickhouseDialect) AggregateFunc(name, expr, orderExpr string) (string, error) {
+	switch name {
+	case AggregateCountDistinct:
+		return fmt.Sprintf("uniqExact(%s)", expr), nil
+	case AggregateApproxCountDistinct:
+		return fmt.Sprintf("uniq(%s)", expr), nil
+	case AggregateStddev:
+		return fmt.Sprintf("stddevSamp(%s)", expr), nil
+	case AggregateVariance:
+		return fmt.Sprintf("varSamp(%s)", expr), nil
+	case AggregateFirst:
+		return fmt.Sprintf("argMin(%s, %s)", expr, orderExpr), nil
+	case AggregateLast:
+		return fmt.Sprintf("argMax(%s, %s)", expr, orderExpr), nil
+	}
+	if p, ok := aggregatePercentiles[name]; ok {
+		return fmt.Sprintf("quantileExactLow(%g)(%s)", p, expr), nil
+	}
+	return "", unsupportedAggregate(d.Name(), name)
+}
+
+func (d *clickhouseDialect) BooleanLiteral(v bool) string {
+	if v {
+		return "true"
+	}
+	return "false"
+}
+
+func (d *clickhouseDialect) DatabaseListQuery() string {
+	return "SHOW DATABASES"
+}
+
+func (d *clickhouseDialect) TableListQuery(database string) (string, []interface{}) {
+	return "SELECT name FROM system.tables WHERE database = ?", []interface{}{database}
+}
+
+func (d *clickhouseDialect) TableSchemaQuery(database, table string) (string, []interface{}) {
+	return "DESCRIBE TABLE " + quoteTableName(d, joinQualifiedName(database, table)), nil
+}
+
+// joinQualifiedName 拼接 database.table 形式的限定名
+func joinQualifiedName(database, table string) string {
+	if database == "" {
+		return table
+	}
+	return database + "." + table
+}
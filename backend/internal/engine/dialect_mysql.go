@@ -0,0 +1,147 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// mysqlDialect MySQL方言
+type mysqlDialect struct{}
+
+func init() {
+	RegisterDialect(DialectMySQL, &mysqlDialect{})
+}
+
+func (d *mysqlDialect) Name() string { return DialectMySQL }
+
+func (d *mysqlDialect) QuoteIdentifier(name string) string { return quoteWith(name, "`") }
+
+func (d *mysqlDialect) Placeholder(n int) string { return "?" }
+
+func (d *mysqlDialect) LimitOffset(limit, offset int) string {
+	return standardLimitOffset(limit, offset, "18446744073709551615")
+}
+
+func (d *mysqlDialect) DateTrunc(expr, unit string) (string, error) {
+	switch unit {
+	case TimeUnitYear:
+		return fmt.Sprintf("DATE_FORMAT(%s, '%%Y-01-01')", expr), nil
+	case TimeUnitQuarter:
+		return fmt.Sprintf("MAKEDATE(YEAR(%s), 1) + INTERVAL (QUARTER(%s) - 1) QUARTER", expr, expr), nil
+	case TimeUnitMonth:
+		return fmt.Sprintf("DATE_FORMAT(%s, '%%Y-%%m-01')", expr), nil
+	case TimeUnitWeek:
+		return fmt.Sprintf("DATE_SUB(DATE(%s), INTERVAL WEEKDAY(%s) DAY)", expr, expr), nil
+	case TimeUnitDay:
+		return fmt.Sprintf("DATE(%s)", expr), nil
+	case TimeUnitHour:
+		return fmt.Sprintf("DATE_FORMAT(%s, '%%Y-%%m-%%d %%H:00:00')", expr), nil
+	case TimeUnitMinute:
+		return fmt.Sprintf("DATE_FORMAT(%s, '%%Y-%%m-%%d %%H:%%i:00')", expr), nil
+	default:
+		return "", fmt.Errorf("unsupported time unit: %s", unit)
+	}
+}
+
+func (d *mysqlDialect) WeekTrunc(expr string, firstDay time.Weekday) string {
+	return fmt.Sprintf("DATE_SUB(DATE(%s), INTERVAL ((DAYOFWEEK(%s) + %d) %% 7) DAY)", expr, expr, 6-int(firstDay))
+}
+
+// ConvertTimeZone 固定偏移的时区按偏移换算,无需加载时区表;
+// 有夏令时的时区按名称换算,需要 MySQL 已加载时区表,否则 CONVERT_TZ 返回 NULL(执行前由 QueryRouter 检查)
+func (d *mysqlDialect) ConvertTimeZone(expr string, loc *time.Location) (string, error) {
+	offset, err := fixedOffsetMinutes(d.Name(), loc)
+	if err != nil {
+		return fmt.Sprintf("CONVERT_TZ(%s, '+00:00', %s)", expr, quoteLiteral(loc.String())), nil
+	}
+	sign := "+"
+	if offset < 0 {
+		offset, sign = -offset, "-"
+	}
+	return fmt.Sprintf("CONVERT_TZ(%s, '+00:00', '%s%02d:%02d')", expr, sign, offset/60, offset%60), nil
+}
+
+func (d *mysqlDialect) DatePart(expr, unit string) (string, error) {
+	switch unit {
+	case TimeUnitYear, TimeUnitQuarter, TimeUnitMonth, TimeUnitDay, TimeUnitHour, TimeUnitMinute:
+		return fmt.Sprintf("%s(%s)", strings.ToUpper(unit), expr), nil
+	default:
+		return "", fmt.Errorf("unsupported date part: %s", unit)
+	}
+}
+
+func (d *mysqlDialect) DateDiff(start, end string) string {
+	return fmt.Sprintf("DATEDIFF(%s, %s)", end, start)
+}
+
+func (d *mysqlDialect) CurrentTimestamp() string { return "NOW()" }
+
+func (d *mysqlDialect) StringFunc(name string, args ...string) (string, error) {
+	if err := checkStringFuncArgs(name, args); err != nil {
+		return "", err
+	}
+	switch name {
+	case StringFuncConcat:
+		return fmt.Sprintf("CONCAT(%s)", strings.Join(args, ", ")), nil
+	case StringFuncLength:
+		return fmt.Sprintf("CHAR_LENGTH(%s)", args[0]), nil
+	case StringFuncSubstring:
+		return fmt.Sprintf("SUBSTRING(%s)", strings.Join(args, ", ")), nil
+	default:
+		return ansiStringFunc(name, args, "CHAR_LENGTH")
+	}
+}
+
+// mysqlListSeparator 有序 GROUP_CONCAT 的分隔符,使用不会出现在数据中的控制字符
+const mysqlListSeparator = "'\x1f'"
+
+// AggregateFunc 百分位和首末值没有原生函数,用有序 GROUP_CONCAT 取列表中的元素模拟,
+// 连接时会调大会话的 group_concat_max_len(见 buildDSN),避免长列表被截断
+func (d *mysqlDialect) AggregateFunc(name, expr, orderExpr string) (string, error) {
+	switch name {
+	case AggregateCountDistinct, AggregateApproxCountDistinct:
+		return fmt.Sprintf("COUNT(DISTINCT %s)", expr), nil
+	case AggregateStddev:
+		return fmt.Sprintf("STDDEV_SAMP(%s)", expr), nil
+	case AggregateVariance:
+		return fmt.Sprintf("VAR_SAMP(%s)", expr), nil
+	case AggregateFirst, AggregateLast:
+		direction := "ASC"
+		if name == AggregateLast {
+			direction = "DESC"
+		}
+		// GROUP_CONCAT 会跳过 NULL,值加前缀 'v'、NULL 记为 'n',使排序首行的值为 NULL 时结果也为 NULL;
+		// 排序列为空的行不参与。结果为文本
+		item := fmt.Sprintf("CASE WHEN %s IS NOT NULL THEN IF(%s IS NULL, 'n', CONCAT('v', %s)) END", orderExpr, expr, expr)
+		return fmt.Sprintf("SUBSTRING(NULLIF(SUBSTRING_INDEX(GROUP_CONCAT(%s ORDER BY %s %s SEPARATOR %s), %s, 1), 'n'), 2)",
+			item, orderExpr, direction, mysqlListSeparator, mysqlListSeparator), nil
+	}
+	if p, ok := aggregatePercentiles[name]; ok {
+		// 最近秩法: 取升序排列的非空值中第 ceil(p * n) 个,与 SQLite 一致;没有值时为 NULL
+		list := fmt.Sprintf("GROUP_CONCAT(%s ORDER BY %s SEPARATOR %s)", expr, expr, mysqlListSeparator)
+		rank := fmt.Sprintf("CEIL(%g * COUNT(%s))", p, expr)
+		return fmt.Sprintf("(SUBSTRING_INDEX(SUBSTRING_INDEX(%s, %s, %s), %s, -1) + 0)",
+			list, mysqlListSeparator, rank, mysqlListSeparator), nil
+	}
+	return "", unsupportedAggregate(d.Name(), name)
+}
+
+func (d *mysqlDialect) BooleanLiteral(v bool) string {
+	if v {
+		return "TRUE"
+	}
+	return "FALSE"
+}
+
+func (d *mysqlDialect) DatabaseListQuery() string {
+	return "SHOW DATABASES"
+}
+
+func (d *mysqlDialect) TableListQuery(database string) (string, []interface{}) {
+	return "SHOW TABLES", nil
+}
+
+func (d *mysqlDialect) TableSchemaQuery(database, table string) (string, []interface{}) {
+	return "DESCRIBE " + quoteTableName(d, table), nil
+}
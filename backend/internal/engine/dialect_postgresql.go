@@ -0,0 +1,101 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// postgresDialect PostgreSQL方言
+type postgresDialect struct{}
+
+func init() {
+	RegisterDialect(DialectPostgreSQL, &postgresDialect{})
+}
+
+func (d *postgresDialect) Name() string { return DialectPostgreSQL }
+
+func (d *postgresDialect) QuoteIdentifier(name string) string { return quoteWith(name, `"`) }
+
+func (d *postgresDialect) Placeholder(n int) string { return fmt.Sprintf("$%d", n) }
+
+func (d *postgresDialect) LimitOffset(limit, offset int) string {
+	return standardLimitOffset(limit, offset, "ALL")
+}
+
+func (d *postgresDialect) DateTrunc(expr, unit string) (string, error) {
+	switch unit {
+	case TimeUnitYear, TimeUnitQuarter, TimeUnitMonth, TimeUnitWeek, TimeUnitDay, TimeUnitHour, TimeUnitMinute:
+		return fmt.Sprintf("DATE_TRUNC(%s, %s)", quoteLiteral(unit), expr), nil
+	default:
+		return "", fmt.Errorf("unsupported time unit: %s", unit)
+	}
+}
+
+func (d *postgresDialect) WeekTrunc(expr string, firstDay time.Weekday) string {
+	return fmt.Sprintf("(CAST(%s AS DATE) - (CAST(EXTRACT(DOW FROM %s) AS INTEGER) + %d) %% 7)", expr, expr, 7-int(firstDay))
+}
+
+func (d *postgresDialect) ConvertTimeZone(expr string, loc *time.Location) (string, error) {
+	return fmt.Sprintf("((%s) AT TIME ZONE 'UTC' AT TIME ZONE %s)", expr, quoteLiteral(loc.String())), nil
+}
+
+func (d *postgresDialect) DatePart(expr, unit string) (string, error) {
+	switch unit {
+	case TimeUnitYear, TimeUnitQuarter, TimeUnitMonth, TimeUnitDay, TimeUnitHour, TimeUnitMinute:
+		return fmt.Sprintf("CAST(EXTRACT(%s FROM %s) AS INTEGER)", strings.ToUpper(unit), expr), nil
+	default:
+		return "", fmt.Errorf("unsupported date part: %s", unit)
+	}
+}
+
+func (d *postgresDialect) DateDiff(start, end string) string {
+	return fmt.Sprintf("(CAST(%s AS DATE) - CAST(%s AS DATE))", end, start)
+}
+
+func (d *postgresDialect) CurrentTimestamp() string { return "NOW()" }
+
+func (d *postgresDialect) StringFunc(name string, args ...string) (string, error) {
+	return ansiStringFunc(name, args, "LENGTH")
+}
+
+func (d *postgresDialect) AggregateFunc(name, expr, orderExpr string) (string, error) {
+	switch name {
+	case AggregateCountDistinct, AggregateApproxCountDistinct:
+		return fmt.Sprintf("COUNT(DISTINCT %s)", expr), nil
+	case AggregateStddev:
+		return fmt.Sprintf("STDDEV_SAMP(%s)", expr), nil
+	case AggregateVariance:
+		return fmt.Sprintf("VAR_SAMP(%s)", expr), nil
+	case AggregateFirst:
+		return fmt.Sprintf("(ARRAY_AGG(%s ORDER BY %s ASC) FILTER (WHERE %s IS NOT NULL))[1]", expr, orderExpr, orderExpr), nil
+	case AggregateLast:
+		return fmt.Sprintf("(ARRAY_AGG(%s ORDER BY %s DESC) FILTER (WHERE %s IS NOT NULL))[1]", expr, orderExpr, orderExpr), nil
+	}
+	if p, ok := aggregatePercentiles[name]; ok {
+		return fmt.Sprintf("PERCENTILE_DISC(%g) WITHIN GROUP (ORDER BY %s)", p, expr), nil
+	}
+	return "", unsupportedAggregate(d.Name(), name)
+}
+
+func (d *postgresDialect) BooleanLiteral(v bool) string {
+	if v {
+		return "TRUE"
+	}
+	return "FALSE"
+}
+
+func (d *postgresDialect) DatabaseListQuery() string {
+	return "SELECT datname FROM pg_database WHERE datistemplate = false"
+}
+
+func (d *postgresDialect) TableListQuery(database string) (string, []interface{}) {
+	return "SELECT tablename FROM pg_tables WHERE schemaname = 'public'", nil
+}
+
+func (d *postgresDialect) TableSchemaQuery(database, table string) (string, []interface{}) {
+	return `SELECT column_name, data_type, is_nullable 
+                 FROM information_schema.columns 
+                 WHERE table_name = $1 
+                 ORDER BY ordinal_position`, []interface{}{table}
+}
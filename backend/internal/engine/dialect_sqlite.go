@@ -0,0 +1,141 @@
+package engine
+
+import (
+	"fmt"
+	"time"
+)
+
+// sqliteDialect SQLite方言
+type sqliteDialect struct{}
+
+func init() {
+	RegisterDialect(DialectSQLite, &sqliteDialect{})
+}
+
+func (d *sqliteDialect) Name() string { return DialectSQLite }
+
+func (d *sqliteDialect) QuoteIdentifier(name string) string { return quoteWith(name, `"`) }
+
+func (d *sqliteDialect) Placeholder(n int) string { return "?" }
+
+func (d *sqliteDialect) LimitOffset(limit, offset int) string {
+	return standardLimitOffset(limit, offset, "-1")
+}
+
+func (d *sqliteDialect) DateTrunc(expr, unit string) (string, error) {
+	switch unit {
+	case TimeUnitYear:
+		return fmt.Sprintf("strftime('%%Y-01-01', %s)", expr), nil
+	case TimeUnitQuarter:
+		return fmt.Sprintf("printf('%%s-%%02d-01', strftime('%%Y', %s), ((CAST(strftime('%%m', %s) AS INTEGER) - 1) / 3) * 3 + 1)", expr, expr), nil
+	case TimeUnitMonth:
+		return fmt.Sprintf("strftime('%%Y-%%m-01', %s)", expr), nil
+	case TimeUnitWeek:
+		return fmt.Sprintf("date(%s, 'weekday 0', '-6 days')", expr), nil
+	case TimeUnitDay:
+		return fmt.Sprintf("date(%s)", expr), nil
+	case TimeUnitHour:
+		return fmt.Sprintf("strftime('%%Y-%%m-%%d %%H:00:00', %s)", expr), nil
+	case TimeUnitMinute:
+		return fmt.Sprintf("strftime('%%Y-%%m-%%d %%H:%%M:00', %s)", expr), nil
+	default:
+		return "", fmt.Errorf("unsupported time unit: %s", unit)
+	}
+}
+
+func (d *sqliteDialect) WeekTrunc(expr string, firstDay time.Weekday) string {
+	// 先回退6天再前进到指定星期,得到不晚于当天的最近一个 firstDay
+	return fmt.Sprintf("date(%s, '-6 days', 'weekday %d')", expr, int(firstDay))
+}
+
+// ConvertTimeZone SQLite 没有时区数据库,只支持固定偏移的时区
+func (d *sqliteDialect) ConvertTimeZone(expr string, loc *time.Location) (string, error) {
+	offset, err := fixedOffsetMinutes(d.Name(), loc)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("datetime(%s, '%+d minutes')", expr, offset), nil
+}
+
+func (d *sqliteDialect) DatePart(expr, unit string) (string, error) {
+	formats := map[string]string{
+		TimeUnitYear:   "%Y",
+		TimeUnitMonth:  "%m",
+		TimeUnitDay:    "%d",
+		TimeUnitHour:   "%H",
+		TimeUnitMinute: "%M",
+	}
+	if unit == TimeUnitQuarter {
+		return fmt.Sprintf("((CAST(strftime('%%m', %s) AS INTEGER) + 2) / 3)", expr), nil
+	}
+	format, ok := formats[unit]
+	if !ok {
+		return "", fmt.Errorf("unsupported date part: %s", unit)
+	}
+	return fmt.Sprintf("CAST(strftime(%s, %s) AS INTEGER)", quoteLiteral(format), expr), nil
+}
+
+func (d *sqliteDialect) DateDiff(start, end string) string {
+	return fmt.Sprintf("CAST(julianday(date(%s)) - julianday(date(%s)) AS INTEGER)", end, start)
+}
+
+func (d *sqliteDialect) CurrentTimestamp() string { return "datetime('now', 'localtime')" }
+
+func (d *sqliteDialect) StringFunc(name string, args ...string) (string, error) {
+	if err := checkStringFuncArgs(name, args); err != nil {
+		return "", err
+	}
+	if name == StringFuncSubstring {
+		if len(args) == 3 {
+			return fmt.Sprintf("substr(%s, %s, %s)", args[0], args[1], args[2]), nil
+		}
+		return fmt.Sprintf("substr(%s, %s)", args[0], args[1]), nil
+	}
+	return ansiStringFunc(name, args, "LENGTH")
+}
+
+// AggregateFunc 百分位和首末值用有序 json_group_array 模拟(需要 SQLite 3.44+),
+// 方差按定义计算;内置的 SQLite 没有 sqrt,不支持标准差
+func (d *sqliteDialect) AggregateFunc(name, expr, orderExpr string) (string, error) {
+	switch name {
+	case AggregateCountDistinct, AggregateApproxCountDistinct:
+		return fmt.Sprintf("COUNT(DISTINCT %s)", expr), nil
+	case AggregateVariance:
+		return fmt.Sprintf("((SUM(%s * %s) * 1.0 - SUM(%s) * 1.0 * SUM(%s) / COUNT(%s)) / NULLIF(COUNT(%s) - 1, 0))",
+			expr, expr, expr, expr, expr, expr), nil
+	case AggregateFirst, AggregateLast:
+		direction := "ASC"
+		if name == AggregateLast {
+			direction = "DESC"
+		}
+		return fmt.Sprintf("json_extract(json_group_array(%s ORDER BY %s %s) FILTER (WHERE %s IS NOT NULL), '$[0]')",
+			expr, orderExpr, direction, orderExpr), nil
+	}
+	if p, ok := aggregatePercentiles[name]; ok {
+		// 最近秩法: rank = ceil(p * n),没有 ceil 时用截断加是否有小数部分代替
+		n := fmt.Sprintf("%g * COUNT(%s)", p, expr)
+		rank := fmt.Sprintf("(CAST(%s AS INTEGER) + (%s > CAST(%s AS INTEGER)))", n, n, n)
+		return fmt.Sprintf("json_extract(json_group_array(%s ORDER BY %s) FILTER (WHERE %s IS NOT NULL), '$[' || (%s - 1) || ']')",
+			expr, expr, expr, rank), nil
+	}
+	return "", unsupportedAggregate(d.Name(), name)
+}
+
+func (d *sqliteDialect) BooleanLiteral(v bool) string {
+	if v {
+		return "1"
+	}
+	return "0"
+}
+
+func (d *sqliteDialect) DatabaseListQuery() string {
+	return "SELECT name FROM pragma_database_list"
+}
+
+func (d *sqliteDialect) TableListQuery(database string) (string, []interface{}) {
+	return "SELECT name FROM sqlite_master WHERE type IN ('table', 'view') AND name NOT LIKE 'sqlite_%' ORDER BY name", nil
+}
+
+func (d *sqliteDialect) TableSchemaQuery(database, table string) (string, []interface{}) {
+	return "SELECT * FROM pragma_table_info(?)", []interface{}{table}
+}
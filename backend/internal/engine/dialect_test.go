@@ -0,0 +1,237 @@
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetDialect(t *testing.T) {
+	for _, name := range []string{DialectMySQL, DialectPostgreSQL, DialectClickHouse, DialectSQLite, DialectCalcite} {
+		d, err := GetDialect(name)
+		assert.NoError(t, err)
+		assert.Equal(t, name, d.Name())
+	}
+
+	_, err := GetDialect("oracle")
+	assert.Error(t, err)
+}
+
+func TestDialect_QuoteIdentifier(t *testing.T) {
+	tests := []struct {
+		dialect string
+		input   string
+		want    string
+	}{
+		{DialectCalcite, "name", `"name"`},
+		{DialectCalcite, `a"; DROP TABLE x; --`, `"a""; DROP TABLE x; --"`},
+		{DialectPostgreSQL, "name", `"name"`},
+		{DialectSQLite, "name", `"name"`},
+		{DialectMySQL, "name", "`name`"},
+		{DialectMySQL, "a`b", "`a``b`"},
+		{DialectClickHouse, "name", "`name`"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.dialect+"/"+tt.input, func(t *testing.T) {
+			d, _ := GetDialect(tt.dialect)
+			assert.Equal(t, tt.want, d.QuoteIdentifier(tt.input))
+		})
+	}
+}
+
+func TestDialect_LimitOffset(t *testing.T) {
+	tests := []struct {
+		dialect       string
+		limit, offset int
+		want          string
+	}{
+		{DialectMySQL, 10, 0, " LIMIT 10"},
+		{DialectMySQL, 10, 20, " LIMIT 10 OFFSET 20"},
+		{DialectMySQL, 0, 0, ""},
+		{DialectPostgreSQL, 0, 5, " LIMIT ALL OFFSET 5"},
+		{DialectSQLite, 0, 5, " LIMIT -1 OFFSET 5"},
+		{DialectCalcite, 0, 5, " OFFSET 5 ROWS"},
+	}
+
+	for _, tt := range tests {
+		d, _ := GetDialect(tt.dialect)
+		assert.Equal(t, tt.want, d.LimitOffset(tt.limit, tt.offset), tt.dialect)
+	}
+}
+
+func TestDialect_DateTrunc(t *testing.T) {
+	tests := []struct {
+		dialect string
+		unit    string
+		want    string
+	}{
+		{DialectMySQL, TimeUnitMonth, "DATE_FORMAT(`d`, '%Y-%m-01')"},
+		{DialectPostgreSQL, TimeUnitMonth, `DATE_TRUNC('month', "d")`},
+		{DialectClickHouse, TimeUnitMonth, "toStartOfMonth(`d`)"},
+		{DialectSQLite, TimeUnitDay, `date("d")`},
+		{DialectCalcite, TimeUnitYear, `FLOOR("d" TO YEAR)`},
+	}
+
+	for _, tt := range tests {
+		d, _ := GetDialect(tt.dialect)
+		got, err := d.DateTrunc(d.QuoteIdentifier("d"), tt.unit)
+		assert.NoError(t, err)
+		assert.Equal(t, tt.want, got, tt.dialect)
+
+		_, err = d.DateTrunc("d", "fortnight")
+		assert.Error(t, err, tt.dialect)
+	}
+}
+
+func TestDialect_DatePart(t *testing.T) {
+	tests := []struct {
+		dialect string
+		want    string
+	}{
+		{DialectMySQL, "MONTH(`d`)"},
+		{DialectPostgreSQL, `CAST(EXTRACT(MONTH FROM "d") AS INTEGER)`},
+		{DialectClickHouse, "toMonth(`d`)"},
+		{DialectSQLite, `CAST(strftime('%m', "d") AS INTEGER)`},
+		{DialectCalcite, `EXTRACT(MONTH FROM "d")`},
+	}
+	for _, tt := range tests {
+		d, _ := GetDialect(tt.dialect)
+		got, err := d.DatePart(d.QuoteIdentifier("d"), TimeUnitMonth)
+		assert.NoError(t, err)
+		assert.Equal(t, tt.want, got, tt.dialect)
+
+		_, err = d.DatePart("d", TimeUnitWeek)
+		assert.Error(t, err, tt.dialect)
+	}
+}
+
+func TestDialect_WeekTruncAndTimeZone(t *testing.T) {
+	shanghai, err := time.LoadLocation("Asia/Shanghai")
+	require.NoError(t, err)
+
+	tests := []struct {
+		dialect string
+		week    string
+		zone    string
+	}{
+		{DialectMySQL, "DATE_SUB(DATE(`d`), INTERVAL ((DAYOFWEEK(`d`) + 5) % 7) DAY)", "CONVERT_TZ(`d`, '+00:00', '+08:00')"},
+		{DialectPostgreSQL, `(CAST("d" AS DATE) - (CAST(EXTRACT(DOW FROM "d") AS INTEGER) + 6) % 7)`, `(("d") AT TIME ZONE 'UTC' AT TIME ZONE 'Asia/Shanghai')`},
+		{DialectClickHouse, "subtractDays(toDate(`d`), (toDayOfWeek(`d`) + 6) % 7)", "toTimeZone(`d`, 'Asia/Shanghai')"},
+		{DialectSQLite, `date("d", '-6 days', 'weekday 1')`, `datetime("d", '+480 minutes')`},
+		{DialectCalcite, `TIMESTAMPADD(DAY, -MOD(DAYOFWEEK("d") + 5, 7), FLOOR("d" TO DAY))`, `TIMESTAMPADD(MINUTE, 480, "d")`},
+	}
+	for _, tt := range tests {
+		d, _ := GetDialect(tt.dialect)
+		assert.Equal(t, tt.week, d.WeekTrunc(d.QuoteIdentifier("d"), time.Monday), tt.dialect)
+		zone, err := d.ConvertTimeZone(d.QuoteIdentifier("d"), shanghai)
+		assert.NoError(t, err)
+		assert.Equal(t, tt.zone, zone, tt.dialect)
+	}
+}
+
+func TestDialect_ConvertTimeZoneDaylightSaving(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+
+	// 支持时区名称的方言按名称换算,夏令时前后的数据各自使用当时的偏移
+	tests := map[string]string{
+		DialectMySQL:      "CONVERT_TZ(`d`, '+00:00', 'Europe/Berlin')",
+		DialectPostgreSQL: `(("d") AT TIME ZONE 'UTC' AT TIME ZONE 'Europe/Berlin')`,
+		DialectClickHouse: "toTimeZone(`d`, 'Europe/Berlin')",
+	}
+	for name, want := range tests {
+		d, _ := GetDialect(name)
+		got, err := d.ConvertTimeZone(d.QuoteIdentifier("d"), berlin)
+		assert.NoError(t, err)
+		assert.Equal(t, want, got, name)
+	}
+
+	// 只能按固定偏移换算的方言拒绝有夏令时的时区
+	for _, name := range []string{DialectSQLite, DialectCalcite} {
+		d, _ := GetDialect(name)
+		_, err := d.ConvertTimeZone(d.QuoteIdentifier("d"), berlin)
+		assert.ErrorContains(t, err, "daylight saving", name)
+	}
+
+	// 固定偏移时区
+	sqlite, _ := GetDialect(DialectSQLite)
+	got, err := sqlite.ConvertTimeZone("d", time.FixedZone("UTC-3:30", -210*60))
+	assert.NoError(t, err)
+	assert.Equal(t, "datetime(d, '-210 minutes')", got)
+}
+
+func TestDialect_AggregateFunc(t *testing.T) {
+	tests := []struct {
+		dialect string
+		median  string
+		first   string
+	}{
+		{DialectMySQL, "(SUBSTRING_INDEX(SUBSTRING_INDEX(GROUP_CONCAT(`v` ORDER BY `v` SEPARATOR '\x1f'), '\x1f', CEIL(0.5 * COUNT(`v`))), '\x1f', -1) + 0)",
+			"SUBSTRING(NULLIF(SUBSTRING_INDEX(GROUP_CONCAT(CASE WHEN `t` IS NOT NULL THEN IF(`v` IS NULL, 'n', CONCAT('v', `v`)) END ORDER BY `t` ASC SEPARATOR '\x1f'), '\x1f', 1), 'n'), 2)"},
+		{DialectPostgreSQL, `PERCENTILE_DISC(0.5) WITHIN GROUP (ORDER BY "v")`, `(ARRAY_AGG("v" ORDER BY "t" ASC) FILTER (WHERE "t" IS NOT NULL))[1]`},
+		{DialectClickHouse, "quantileExactLow(0.5)(`v`)", "argMin(`v`, `t`)"},
+		{DialectCalcite, `PERCENTILE_DISC(0.5) WITHIN GROUP (ORDER BY "v")`, `ARG_MIN("v", "t")`},
+	}
+	for _, tt := range tests {
+		d, _ := GetDialect(tt.dialect)
+		v, ts := d.QuoteIdentifier("v"), d.QuoteIdentifier("t")
+		got, err := d.AggregateFunc(AggregateMedian, v, "")
+		if tt.median == "" {
+			assert.Error(t, err, tt.dialect)
+		} else {
+			assert.NoError(t, err)
+			assert.Equal(t, tt.median, got, tt.dialect)
+		}
+		got, err = d.AggregateFunc(AggregateFirst, v, ts)
+		assert.NoError(t, err)
+		assert.Equal(t, tt.first, got, tt.dialect)
+		_, err = d.AggregateFunc(AggregateSum, v, "")
+		assert.Error(t, err, "basic aggregates are built without the dialect")
+	}
+}
+
+func TestDialect_StringFunc(t *testing.T) {
+	mysql, _ := GetDialect(DialectMySQL)
+	got, err := mysql.StringFunc(StringFuncConcat, "a", "b")
+	assert.NoError(t, err)
+	assert.Equal(t, "CONCAT(a, b)", got)
+
+	pg, _ := GetDialect(DialectPostgreSQL)
+	got, err = pg.StringFunc(StringFuncConcat, "a", "b")
+	assert.NoError(t, err)
+	assert.Equal(t, "(a || b)", got)
+
+	sqlite, _ := GetDialect(DialectSQLite)
+	got, err = sqlite.StringFunc(StringFuncSubstring, "a", "1", "2")
+	assert.NoError(t, err)
+	assert.Equal(t, "substr(a, 1, 2)", got)
+
+	_, err = pg.StringFunc(StringFuncUpper)
+	assert.Error(t, err)
+	_, err = pg.StringFunc("reverse", "a")
+	assert.Error(t, err)
+}
+
+func TestDialect_BooleanLiteral(t *testing.T) {
+	pg, _ := GetDialect(DialectPostgreSQL)
+	assert.Equal(t, "TRUE", pg.BooleanLiteral(true))
+
+	sqlite, _ := GetDialect(DialectSQLite)
+	assert.Equal(t, "1", sqlite.BooleanLiteral(true))
+	assert.Equal(t, "0", sqlite.BooleanLiteral(false))
+}
+
+func TestDialect_TableSchemaQuery(t *testing.T) {
+	mysql, _ := GetDialect(DialectMySQL)
+	query, args := mysql.TableSchemaQuery("shop", "orders`; DROP TABLE x")
+	assert.Equal(t, "DESCRIBE `orders``; DROP TABLE x`", query)
+	assert.Empty(t, args)
+
+	pg, _ := GetDialect(DialectPostgreSQL)
+	query, args = pg.TableSchemaQuery("shop", "orders")
+	assert.Contains(t, query, "$1")
+	assert.Equal(t, []interface{}{"orders"}, args)
+}
@@ -0,0 +1,542 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"cozy-insight-backend/internal/model"
+)
+
+// Elasticsearch 查询限制
+const (
+	esCompositePageSize = 1000
+	esMaxBuckets        = 10000
+	esMaxHits           = 10000
+	esDefaultHits       = 1000
+)
+
+// elasticsearchStore Elasticsearch 文档数据源,通过 REST API 访问
+// 分组查询下推为 composite 聚合,明细查询使用 _search
+type elasticsearchStore struct {
+	client   *http.Client
+	hosts    []string
+	username string
+	password string
+	apiKey   string
+}
+
+// newElasticsearchStore 根据 ElasticsearchDatasourceConfig 创建客户端
+func newElasticsearchStore(configJSON string) (*elasticsearchStore, error) {
+	var config model.ElasticsearchDatasourceConfig
+	if err := json.Unmarshal([]byte(configJSON), &config); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	if len(config.Hosts) == 0 {
+		return nil, fmt.Errorf("at least one host is required")
+	}
+
+	hosts := make([]string, 0, len(config.Hosts))
+	for _, host := range config.Hosts {
+		host = strings.TrimRight(strings.TrimSpace(host), "/")
+		if host == "" {
+			continue
+		}
+		if !strings.Contains(host, "://") {
+			if config.SSL {
+				host = "https://" + host
+			} else {
+				host = "http://" + host
+			}
+		}
+		hosts = append(hosts, host)
+	}
+	if len(hosts) == 0 {
+		return nil, fmt.Errorf("at least one host is required")
+	}
+
+	return &elasticsearchStore{
+		client:   &http.Client{Timeout: 30 * time.Second},
+		hosts:    hosts,
+		username: config.Username,
+		password: config.Password,
+		apiKey:   config.APIKey,
+	}, nil
+}
+
+func (s *elasticsearchStore) Ping(ctx context.Context) error {
+	return s.do(ctx, http.MethodGet, "/", nil, nil)
+}
+
+func (s *elasticsearchStore) ListCollections(ctx context.Context) ([]string, error) {
+	var indices []struct {
+		Index string `json:"index"`
+	}
+	if err := s.do(ctx, http.MethodGet, "/_cat/indices?format=json&h=index", nil, &indices); err != nil {
+		return nil, fmt.Errorf("failed to list indices: %w", err)
+	}
+
+	names := make([]string, 0, len(indices))
+	for _, idx := range indices {
+		// 跳过系统索引
+		if !strings.HasPrefix(idx.Index, ".") {
+			names = append(names, idx.Index)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (s *elasticsearchStore) Sample(ctx context.Context, collection string, size int) ([]map[string]interface{}, error) {
+	resp, err := s.search(ctx, collection, map[string]interface{}{"size": size})
+	if err != nil {
+		return nil, err
+	}
+
+	docs := make([]map[string]interface{}, 0, len(resp.Hits.Hits))
+	for _, hit := range resp.Hits.Hits {
+		docs = append(docs, plainJSONValue(hit.Source).(map[string]interface{}))
+	}
+	return docs, nil
+}
+
+func (s *elasticsearchStore) Query(ctx context.Context, q *Query) ([]map[string]interface{}, error) {
+	outputs, aggregated, err := planDocumentQuery(q)
+	if err != nil {
+		return nil, err
+	}
+
+	keywords, err := s.keywordFields(ctx, q.Source.Table)
+	if err != nil {
+		return nil, err
+	}
+
+	filter, err := esFilter(q.Filters, keywords)
+	if err != nil {
+		return nil, err
+	}
+
+	if aggregated {
+		return s.aggregate(ctx, q, outputs, filter, keywords)
+	}
+	return s.hits(ctx, q, outputs, filter, keywords)
+}
+
+func (s *elasticsearchStore) Close(ctx context.Context) error {
+	s.client.CloseIdleConnections()
+	return nil
+}
+
+// aggregate 分组查询: 有分组字段时分页读取 composite 聚合,排序和分页在内存中完成
+func (s *elasticsearchStore) aggregate(ctx context.Context, q *Query, outputs []documentOutput, filter map[string]interface{}, keywords map[string]string) ([]map[string]interface{}, error) {
+	metrics := make(map[string]interface{})
+	for _, out := range outputs {
+		if agg := esMetric(out, keywords); agg != nil {
+			metrics[out.Key] = agg
+		}
+	}
+
+	var rows []map[string]interface{}
+	if len(q.GroupBy) == 0 {
+		body := map[string]interface{}{"size": 0, "query": filter, "track_total_hits": true}
+		if len(metrics) > 0 {
+			body["aggs"] = metrics
+		}
+		resp, err := s.search(ctx, q.Source.Table, body)
+		if err != nil {
+			return nil, err
+		}
+		bucket := map[string]interface{}{"doc_count": resp.Hits.Total.Value}
+		for key, value := range resp.Aggregations {
+			bucket[key] = value
+		}
+		rows = append(rows, esBucketRow(bucket, outputs))
+	} else {
+		sources := make([]interface{}, len(q.GroupBy))
+		for i, field := range q.GroupBy {
+			sources[i] = map[string]interface{}{
+				fmt.Sprintf("g%d", i): map[string]interface{}{
+					"terms": map[string]interface{}{"field": esKeyword(field, keywords), "missing_bucket": true},
+				},
+			}
+		}
+
+		var after interface{}
+		for len(rows) < esMaxBuckets {
+			composite := map[string]interface{}{"size": esCompositePageSize, "sources": sources}
+			if after != nil {
+				composite["after"] = after
+			}
+			groups := map[string]interface{}{"composite": composite}
+			if len(metrics) > 0 {
+				groups["aggs"] = metrics
+			}
+			body := map[string]interface{}{
+				"size":  0,
+				"query": filter,
+				"aggs":  map[string]interface{}{"groups": groups},
+			}
+
+			resp, err := s.search(ctx, q.Source.Table, body)
+			if err != nil {
+				return nil, err
+			}
+			var result struct {
+				AfterKey interface{}              `json:"after_key"`
+				Buckets  []map[string]interface{} `json:"buckets"`
+			}
+			if err := decodeJSON(resp.Aggregations["groups"], &result); err != nil {
+				return nil, fmt.Errorf("invalid aggregation response: %w", err)
+			}
+			for _, bucket := range result.Buckets {
+				rows = append(rows, esBucketRow(bucket, outputs))
+			}
+			if result.AfterKey == nil || len(result.Buckets) < esCompositePageSize {
+				break
+			}
+			after = result.AfterKey
+		}
+	}
+
+	sortRows(rows, q.OrderBy)
+	return pageRows(rows, q.Limit, q.Offset), nil
+}
+
+// hits 明细查询
+func (s *elasticsearchStore) hits(ctx context.Context, q *Query, outputs []documentOutput, filter map[string]interface{}, keywords map[string]string) ([]map[string]interface{}, error) {
+	size := q.Limit
+	if size <= 0 {
+		size = esDefaultHits
+	}
+	if q.Offset+size > esMaxHits {
+		return nil, fmt.Errorf("elasticsearch can page at most %d hits", esMaxHits)
+	}
+
+	body := map[string]interface{}{"size": size, "from": q.Offset, "query": filter}
+	if len(outputs) > 0 {
+		includes := make([]string, len(outputs))
+		for i, out := range outputs {
+			includes[i] = out.Field
+		}
+		body["_source"] = includes
+	}
+	if len(q.OrderBy) > 0 {
+		sortSpec := make([]interface{}, 0, len(q.OrderBy))
+		for _, item := range q.OrderBy {
+			field := item.Field
+			if out, ok := outputByName(outputs, item.Field); ok {
+				field = out.Field
+			} else if len(outputs) > 0 {
+				return nil, fmt.Errorf("unknown order field: %s", item.Field)
+			}
+			order := "asc"
+			if item.Desc {
+				order = "desc"
+			}
+			sortSpec = append(sortSpec, map[string]interface{}{esKeyword(field, keywords): order})
+		}
+		body["sort"] = sortSpec
+	}
+
+	resp, err := s.search(ctx, q.Source.Table, body)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := make([]map[string]interface{}, 0, len(resp.Hits.Hits))
+	for _, hit := range resp.Hits.Hits {
+		flat := make(map[string]interface{})
+		flattenValue("", plainJSONValue(hit.Source), flat)
+		if len(outputs) == 0 {
+			rows = append(rows, flat)
+			continue
+		}
+		row := make(map[string]interface{}, len(outputs))
+		for _, out := range outputs {
+			row[out.Name] = flat[out.Field]
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// esSearchResponse _search 响应
+type esSearchResponse struct {
+	Hits struct {
+		Total struct {
+			Value int64 `json:"value"`
+		} `json:"total"`
+		Hits []struct {
+			Source map[string]interface{} `json:"_source"`
+		} `json:"hits"`
+	} `json:"hits"`
+	Aggregations map[string]json.RawMessage `json:"aggregations"`
+}
+
+func (s *elasticsearchStore) search(ctx context.Context, index string, body interface{}) (*esSearchResponse, error) {
+	var resp esSearchResponse
+	if err := s.do(ctx, http.MethodPost, "/"+url.PathEscape(index)+"/_search", body, &resp); err != nil {
+		return nil, fmt.Errorf("query execution failed: %w", err)
+	}
+	return &resp, nil
+}
+
+// keywordFields 读取索引映射,返回 text 字段对应的 keyword 子字段,用于精确匹配和分组
+func (s *elasticsearchStore) keywordFields(ctx context.Context, index string) (map[string]string, error) {
+	var mappings map[string]struct {
+		Mappings struct {
+			Properties map[string]esProperty `json:"properties"`
+		} `json:"mappings"`
+	}
+	if err := s.do(ctx, http.MethodGet, "/"+url.PathEscape(index)+"/_mapping", nil, &mappings); err != nil {
+		return nil, fmt.Errorf("failed to read index mapping: %w", err)
+	}
+
+	keywords := make(map[string]string)
+	for _, m := range mappings {
+		collectKeywordFields("", m.Mappings.Properties, keywords)
+	}
+	return keywords, nil
+}
+
+// esProperty 索引映射中的字段定义
+type esProperty struct {
+	Type       string                `json:"type"`
+	Properties map[string]esProperty `json:"properties"`
+	Fields     map[string]esProperty `json:"fields"`
+}
+
+func collectKeywordFields(prefix string, properties map[string]esProperty, keywords map[string]string) {
+	for name, prop := range properties {
+		path := name
+		if prefix != "" {
+			path = prefix + "." + name
+		}
+		if len(prop.Properties) > 0 {
+			collectKeywordFields(path, prop.Properties, keywords)
+			continue
+		}
+		if prop.Type != "text" {
+			continue
+		}
+		for sub, subProp := range prop.Fields {
+			if subProp.Type == "keyword" {
+				keywords[path] = path + "." + sub
+				break
+			}
+		}
+	}
+}
+
+// esKeyword 精确匹配、分组和排序时使用的字段
+func esKeyword(field string, keywords map[string]string) string {
+	if kw, ok := keywords[field]; ok {
+		return kw
+	}
+	return field
+}
+
+// esFilter 过滤条件转换为 bool 查询
+func esFilter(filters []Filter, keywords map[string]string) (map[string]interface{}, error) {
+	var must, mustNot []interface{}
+	for _, f := range filters {
+		field := esKeyword(f.Field, keywords)
+		switch op := strings.ToUpper(strings.TrimSpace(f.Operator)); op {
+		case "=":
+			must = append(must, map[string]interface{}{"term": map[string]interface{}{field: f.Value}})
+		case "!=":
+			mustNot = append(mustNot, map[string]interface{}{"term": map[string]interface{}{field: f.Value}})
+		case ">", "<", ">=", "<=":
+			rangeOps := map[string]string{">": "gt", "<": "lt", ">=": "gte", "<=": "lte"}
+			must = append(must, map[string]interface{}{
+				"range": map[string]interface{}{f.Field: map[string]interface{}{rangeOps[op]: f.Value}},
+			})
+		case "LIKE":
+			// 与 SQL 编译一致,LIKE 为包含匹配
+			pattern := "*" + esWildcardEscaper.Replace(fmt.Sprint(f.Value)) + "*"
+			must = append(must, map[string]interface{}{"wildcard": map[string]interface{}{field: map[string]interface{}{"value": pattern}}})
+		case "PREFIX":
+			must = append(must, map[string]interface{}{"prefix": map[string]interface{}{field: map[string]interface{}{"value": fmt.Sprint(f.Value), "case_insensitive": true}}})
+		case "IN":
+			values := toValueList(f.Value)
+			if len(values) == 0 {
+				return nil, fmt.Errorf("IN filter on %s requires at least one value", f.Field)
+			}
+			must = append(must, map[string]interface{}{"terms": map[string]interface{}{field: values}})
+		default:
+			return nil, fmt.Errorf("unsupported filter operator: %s", f.Operator)
+		}
+	}
+
+	if len(must) == 0 && len(mustNot) == 0 {
+		return map[string]interface{}{"match_all": map[string]interface{}{}}, nil
+	}
+	boolQuery := map[string]interface{}{}
+	if len(must) > 0 {
+		boolQuery["filter"] = must
+	}
+	if len(mustNot) > 0 {
+		boolQuery["must_not"] = mustNot
+	}
+	return map[string]interface{}{"bool": boolQuery}, nil
+}
+
+// esWildcardEscaper 转义通配符查询中的特殊字符
+var esWildcardEscaper = strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`)
+
+// esMetric 指标对应的聚合, COUNT(*) 使用桶的 doc_count
+func esMetric(out documentOutput, keywords map[string]string) map[string]interface{} {
+	switch out.Aggregate {
+	case "":
+		return nil
+	case "COUNT":
+		if out.Field == "*" {
+			return nil
+		}
+		return map[string]interface{}{"value_count": map[string]interface{}{"field": esKeyword(out.Field, keywords)}}
+	default:
+		return map[string]interface{}{strings.ToLower(out.Aggregate): map[string]interface{}{"field": out.Field}}
+	}
+}
+
+// esBucketRow 聚合桶转换为结果行
+func esBucketRow(bucket map[string]interface{}, outputs []documentOutput) map[string]interface{} {
+	key, _ := bucket["key"].(map[string]interface{})
+	row := make(map[string]interface{}, len(outputs))
+	for _, out := range outputs {
+		switch {
+		case out.Aggregate == "":
+			row[out.Name] = plainJSONValue(key[out.Key])
+		case out.Aggregate == "COUNT" && out.Field == "*":
+			row[out.Name] = plainJSONValue(bucket["doc_count"])
+		default:
+			var value interface{}
+			switch metric := bucket[out.Key].(type) {
+			case map[string]interface{}:
+				value = metric["value"]
+			case json.RawMessage:
+				var parsed struct {
+					Value interface{} `json:"value"`
+				}
+				if err := decodeJSON(metric, &parsed); err == nil {
+					value = parsed.Value
+				}
+			}
+			row[out.Name] = plainJSONValue(value)
+		}
+	}
+	return row
+}
+
+// do 依次尝试各节点发送请求,直到某个节点返回响应
+func (s *elasticsearchStore) do(ctx context.Context, method, path string, body, out interface{}) error {
+	var payload []byte
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		payload = data
+	}
+
+	var lastErr error
+	for _, host := range s.hosts {
+		var reader io.Reader
+		if payload != nil {
+			reader = bytes.NewReader(payload)
+		}
+		req, err := http.NewRequestWithContext(ctx, method, host+path, reader)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Accept", "application/json")
+		if payload != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		switch {
+		case s.apiKey != "":
+			req.Header.Set("Authorization", "ApiKey "+s.apiKey)
+		case s.username != "":
+			req.SetBasicAuth(s.username, s.password)
+		}
+
+		resp, err := s.client.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		err = readESResponse(resp, out)
+		resp.Body.Close()
+		return err
+	}
+	return fmt.Errorf("no elasticsearch node available: %w", lastErr)
+}
+
+// readESResponse 校验状态码并解析响应
+func readESResponse(resp *http.Response, out interface{}) error {
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxAPIResponseSize))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var esErr struct {
+			Error struct {
+				Type   string `json:"type"`
+				Reason string `json:"reason"`
+			} `json:"error"`
+		}
+		if json.Unmarshal(data, &esErr) == nil && esErr.Error.Reason != "" {
+			return fmt.Errorf("%s: %s: %s", resp.Status, esErr.Error.Type, esErr.Error.Reason)
+		}
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	if out == nil {
+		return nil
+	}
+	return decodeJSON(data, out)
+}
+
+// decodeJSON 解析 JSON,数值保留为 json.Number
+func decodeJSON(data []byte, out interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(out); err != nil {
+		return fmt.Errorf("invalid json response: %w", err)
+	}
+	return nil
+}
+
+// plainJSONValue 将 json.Number 转换为 int64 或 float64
+func plainJSONValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		if f, err := v.Float64(); err == nil {
+			return f
+		}
+		return v.String()
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[k] = plainJSONValue(e)
+		}
+		return m
+	case []interface{}:
+		arr := make([]interface{}, len(v))
+		for i, e := range v {
+			arr[i] = plainJSONValue(e)
+		}
+		return arr
+	default:
+		return v
+	}
+}
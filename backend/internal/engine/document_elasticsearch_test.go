@@ -0,0 +1,145 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"cozy-insight-backend/pkg/logger"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeElasticsearch 模拟 Elasticsearch 的 _mapping、_search 接口,记录最后一次查询
+func fakeElasticsearch(t *testing.T, lastBody *map[string]interface{}) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "ApiKey k1", r.Header.Get("Authorization"))
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, `{"version":{"number":"8.13.0"}}`)
+		case "/_cat/indices":
+			fmt.Fprint(w, `[{"index":"orders"},{"index":".kibana"},{"index":"logs"}]`)
+		case "/orders/_mapping":
+			fmt.Fprint(w, `{"orders":{"mappings":{"properties":{
+				"region":{"type":"text","fields":{"keyword":{"type":"keyword"}}},
+				"amount":{"type":"double"},
+				"customer":{"properties":{"name":{"type":"text","fields":{"raw":{"type":"keyword"}}}}}
+			}}}}`)
+		case "/orders/_search":
+			var body map[string]interface{}
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			*lastBody = body
+			if _, ok := body["aggs"]; ok {
+				fmt.Fprint(w, `{"hits":{"total":{"value":5},"hits":[]},"aggregations":{"groups":{"buckets":[
+					{"key":{"g0":"east"},"doc_count":2,"m1":{"value":30.5}},
+					{"key":{"g0":"west"},"doc_count":3,"m1":{"value":90}}
+				]}}}`)
+				return
+			}
+			fmt.Fprint(w, `{"hits":{"total":{"value":1},"hits":[{"_source":{"region":"east","amount":12,"customer":{"name":"a"}}}]}}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func newTestElasticsearchStore(t *testing.T, server *httptest.Server) DocumentStore {
+	store, err := openDocumentStore(context.Background(), "elasticsearch", fmt.Sprintf(`{"hosts":[%q],"apiKey":"k1"}`, server.URL))
+	require.NoError(t, err)
+	return store
+}
+
+func TestElasticsearchStore_Aggregate(t *testing.T) {
+	var body map[string]interface{}
+	server := fakeElasticsearch(t, &body)
+	defer server.Close()
+	store := newTestElasticsearchStore(t, server)
+
+	rows, err := store.Query(context.Background(), &Query{
+		Source: QuerySource{Table: "orders"},
+		Selects: []SelectItem{
+			{Field: "region", Alias: "region"},
+			{Field: "amount", Aggregate: "SUM", Alias: "total"},
+			{Field: "*", Aggregate: "COUNT", Alias: "count"},
+		},
+		Filters: []Filter{{Field: "region", Operator: "IN", Value: []string{"east", "west"}}},
+		GroupBy: []string{"region"},
+		OrderBy: []OrderItem{{Field: "total", Desc: true}},
+		Limit:   1,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []map[string]interface{}{{"region": "west", "total": int64(90), "count": int64(3)}}, rows)
+
+	groups := body["aggs"].(map[string]interface{})["groups"].(map[string]interface{})
+	sources := groups["composite"].(map[string]interface{})["sources"].([]interface{})
+	assert.Equal(t, "region.keyword", sources[0].(map[string]interface{})["g0"].(map[string]interface{})["terms"].(map[string]interface{})["field"])
+	assert.Equal(t, map[string]interface{}{"m1": map[string]interface{}{"sum": map[string]interface{}{"field": "amount"}}}, groups["aggs"])
+	assert.Equal(t, map[string]interface{}{"bool": map[string]interface{}{"filter": []interface{}{
+		map[string]interface{}{"terms": map[string]interface{}{"region.keyword": []interface{}{"east", "west"}}},
+	}}}, body["query"])
+}
+
+func TestElasticsearchStore_HitsAndMetadata(t *testing.T) {
+	var body map[string]interface{}
+	server := fakeElasticsearch(t, &body)
+	defer server.Close()
+	store := newTestElasticsearchStore(t, server)
+	ctx := context.Background()
+
+	require.NoError(t, store.Ping(ctx))
+
+	names, err := store.ListCollections(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"logs", "orders"}, names)
+
+	rows, err := store.Query(ctx, &Query{
+		Source:  QuerySource{Table: "orders"},
+		Filters: []Filter{{Field: "customer.name", Operator: "LIKE", Value: "a*"}},
+		OrderBy: []OrderItem{{Field: "customer.name"}},
+		Limit:   10,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []map[string]interface{}{{"region": "east", "amount": int64(12), "customer.name": "a"}}, rows)
+	assert.Equal(t, []interface{}{map[string]interface{}{"customer.name.raw": "asc"}}, body["sort"])
+	assert.Equal(t, float64(10), body["size"])
+	wildcard := body["query"].(map[string]interface{})["bool"].(map[string]interface{})["filter"].([]interface{})[0]
+	assert.Equal(t, map[string]interface{}{"wildcard": map[string]interface{}{"customer.name.raw": map[string]interface{}{"value": `*a\**`}}}, wildcard)
+
+	docs, err := store.Sample(ctx, "orders", 10)
+	require.NoError(t, err)
+	assert.Equal(t, []DocumentField{
+		{Name: "amount", Type: ExtractTypeInteger, Count: 1},
+		{Name: "customer.name", Type: ExtractTypeText, Count: 1},
+		{Name: "region", Type: ExtractTypeText, Count: 1},
+	}, InferDocumentSchema(docs))
+}
+
+func TestDocumentExecutor_RoutesQueryPlan(t *testing.T) {
+	logger.InitLogger("error")
+	var body map[string]interface{}
+	server := fakeElasticsearch(t, &body)
+	defer server.Close()
+
+	stores := NewDocumentStores()
+	defer stores.Close()
+	executor := NewDocumentExecutor(stores)
+	target := &QueryTarget{
+		DatasourceID:   "es1",
+		DatasourceType: "elasticsearch",
+		Configuration:  fmt.Sprintf(`{"hosts":[%q],"apiKey":"k1"}`, server.URL),
+	}
+	assert.True(t, executor.Supports(target))
+	assert.False(t, executor.Supports(&QueryTarget{DatasourceID: "db1", DatasourceType: "mysql"}))
+
+	result, err := NewQueryRouter(NewNativeExecutor(NewConnectionManager(nil)), executor).
+		Execute(context.Background(), target, &Query{Source: QuerySource{Table: "orders"}, Limit: 5})
+	require.NoError(t, err)
+	assert.Equal(t, ExecPathDocument, result.Path)
+	assert.False(t, result.Fallback)
+	assert.Len(t, result.Rows, 1)
+	assert.Len(t, result.Columns, len(result.Rows[0]))
+}
@@ -0,0 +1,324 @@
+package engine
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"cozy-insight-backend/internal/model"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// mongoStore MongoDB 文档数据源,查询下推为聚合管道
+type mongoStore struct {
+	client   *mongo.Client
+	database string
+}
+
+// newMongoStore 根据 MongoDBDatasourceConfig 创建客户端,连接在首次使用时建立
+func newMongoStore(ctx context.Context, configJSON string) (*mongoStore, error) {
+	var config model.MongoDBDatasourceConfig
+	if err := json.Unmarshal([]byte(configJSON), &config); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	if config.Host == "" {
+		return nil, fmt.Errorf("host is required")
+	}
+	if config.Database == "" {
+		return nil, fmt.Errorf("database is required")
+	}
+	port := config.Port
+	if port == 0 {
+		port = 27017
+	}
+
+	opts := options.Client().
+		SetHosts([]string{net.JoinHostPort(config.Host, strconv.Itoa(port))}).
+		SetConnectTimeout(10 * time.Second).
+		SetServerSelectionTimeout(10 * time.Second)
+	if config.Username != "" {
+		authSource := config.AuthDatabase
+		if authSource == "" {
+			authSource = "admin"
+		}
+		opts.SetAuth(options.Credential{
+			Username:   config.Username,
+			Password:   config.Password,
+			AuthSource: authSource,
+		})
+	}
+	if config.SSL {
+		opts.SetTLSConfig(&tls.Config{ServerName: config.Host})
+	}
+
+	client, err := mongo.Connect(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create mongodb client: %w", err)
+	}
+	return &mongoStore{client: client, database: config.Database}, nil
+}
+
+func (s *mongoStore) Ping(ctx context.Context) error {
+	return s.client.Database(s.database).RunCommand(ctx, bson.D{{Key: "ping", Value: 1}}).Err()
+}
+
+func (s *mongoStore) ListCollections(ctx context.Context) ([]string, error) {
+	names, err := s.client.Database(s.database).ListCollectionNames(ctx, bson.D{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list collections: %w", err)
+	}
+	return names, nil
+}
+
+func (s *mongoStore) Sample(ctx context.Context, collection string, size int) ([]map[string]interface{}, error) {
+	pipeline := mongo.Pipeline{{{Key: "$sample", Value: bson.D{{Key: "size", Value: size}}}}}
+	cursor, err := s.client.Database(s.database).Collection(collection).Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sample collection: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var docs []map[string]interface{}
+	for cursor.Next(ctx) {
+		var doc bson.D
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, err
+		}
+		docs = append(docs, plainMongoValue(doc).(map[string]interface{}))
+	}
+	return docs, cursor.Err()
+}
+
+func (s *mongoStore) Query(ctx context.Context, q *Query) ([]map[string]interface{}, error) {
+	pipeline, outputs, err := buildMongoPipeline(q)
+	if err != nil {
+		return nil, err
+	}
+
+	cursor, err := s.client.Database(s.database).Collection(q.Source.Table).Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("query execution failed: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var rows []map[string]interface{}
+	for cursor.Next(ctx) {
+		var doc bson.D
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, fmt.Errorf("failed to decode document: %w", err)
+		}
+		rows = append(rows, mongoRow(plainMongoValue(doc).(map[string]interface{}), outputs))
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("cursor iteration error: %w", err)
+	}
+	return rows, nil
+}
+
+func (s *mongoStore) Close(ctx context.Context) error {
+	return s.client.Disconnect(ctx)
+}
+
+// buildMongoPipeline 将结构化查询编译为聚合管道: $match → $group → $project → $sort → $skip → $limit
+// 输出列使用内部键(g0/m0/c0),由 mongoRow 映射回列名
+func buildMongoPipeline(q *Query) (mongo.Pipeline, []documentOutput, error) {
+	outputs, aggregated, err := planDocumentQuery(q)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var pipeline mongo.Pipeline
+
+	if len(q.Filters) > 0 {
+		conditions := make(bson.A, 0, len(q.Filters))
+		for _, f := range q.Filters {
+			cond, err := mongoFilter(f)
+			if err != nil {
+				return nil, nil, err
+			}
+			conditions = append(conditions, cond)
+		}
+		var match bson.D
+		if len(conditions) == 1 {
+			match = conditions[0].(bson.D)
+		} else {
+			match = bson.D{{Key: "$and", Value: conditions}}
+		}
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: match}})
+	}
+
+	if aggregated {
+		var id interface{}
+		if len(q.GroupBy) > 0 {
+			keys := make(bson.D, len(q.GroupBy))
+			for i, field := range q.GroupBy {
+				keys[i] = bson.E{Key: fmt.Sprintf("g%d", i), Value: "$" + field}
+			}
+			id = keys
+		}
+		group := bson.D{{Key: "_id", Value: id}}
+		project := bson.D{{Key: "_id", Value: 0}}
+		for _, out := range outputs {
+			if out.Aggregate == "" {
+				project = append(project, bson.E{Key: out.Key, Value: "$_id." + out.Key})
+				continue
+			}
+			group = append(group, bson.E{Key: out.Key, Value: mongoAccumulator(out)})
+			project = append(project, bson.E{Key: out.Key, Value: 1})
+		}
+		pipeline = append(pipeline,
+			bson.D{{Key: "$group", Value: group}},
+			bson.D{{Key: "$project", Value: project}})
+	} else if len(outputs) > 0 {
+		project := bson.D{{Key: "_id", Value: 0}}
+		for _, out := range outputs {
+			project = append(project, bson.E{Key: out.Key, Value: "$" + out.Field})
+		}
+		pipeline = append(pipeline, bson.D{{Key: "$project", Value: project}})
+	}
+
+	if len(q.OrderBy) > 0 {
+		sortSpec := make(bson.D, 0, len(q.OrderBy))
+		for _, item := range q.OrderBy {
+			key := item.Field
+			if out, ok := outputByName(outputs, item.Field); ok {
+				key = out.Key
+			} else if aggregated || len(outputs) > 0 {
+				return nil, nil, fmt.Errorf("unknown order field: %s", item.Field)
+			} else if err := checkDocumentField(item.Field); err != nil {
+				return nil, nil, err
+			}
+			direction := 1
+			if item.Desc {
+				direction = -1
+			}
+			sortSpec = append(sortSpec, bson.E{Key: key, Value: direction})
+		}
+		pipeline = append(pipeline, bson.D{{Key: "$sort", Value: sortSpec}})
+	}
+
+	if q.Offset > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$skip", Value: int64(q.Offset)}})
+	}
+	if q.Limit > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$limit", Value: int64(q.Limit)}})
+	}
+
+	return pipeline, outputs, nil
+}
+
+// mongoFilter 过滤条件转换为 $match 表达式
+func mongoFilter(f Filter) (bson.D, error) {
+	var cond interface{}
+	switch op := strings.ToUpper(strings.TrimSpace(f.Operator)); op {
+	case "=":
+		cond = bson.D{{Key: "$eq", Value: f.Value}}
+	case "!=":
+		cond = bson.D{{Key: "$ne", Value: f.Value}}
+	case ">":
+		cond = bson.D{{Key: "$gt", Value: f.Value}}
+	case "<":
+		cond = bson.D{{Key: "$lt", Value: f.Value}}
+	case ">=":
+		cond = bson.D{{Key: "$gte", Value: f.Value}}
+	case "<=":
+		cond = bson.D{{Key: "$lte", Value: f.Value}}
+	case "LIKE":
+		// 与 SQL 编译一致,LIKE 为包含匹配
+		cond = primitive.Regex{Pattern: regexp.QuoteMeta(fmt.Sprint(f.Value))}
+	case "PREFIX":
+		cond = primitive.Regex{Pattern: "^" + regexp.QuoteMeta(fmt.Sprint(f.Value)), Options: "i"}
+	case "IN":
+		values := toValueList(f.Value)
+		if len(values) == 0 {
+			return nil, fmt.Errorf("IN filter on %s requires at least one value", f.Field)
+		}
+		cond = bson.D{{Key: "$in", Value: bson.A(values)}}
+	default:
+		return nil, fmt.Errorf("unsupported filter operator: %s", f.Operator)
+	}
+	return bson.D{{Key: f.Field, Value: cond}}, nil
+}
+
+// mongoAccumulator 聚合函数对应的 $group 累加器
+func mongoAccumulator(out documentOutput) bson.D {
+	if out.Aggregate == "COUNT" {
+		if out.Field == "*" {
+			return bson.D{{Key: "$sum", Value: 1}}
+		}
+		// 只计数非空值
+		return bson.D{{Key: "$sum", Value: bson.D{{Key: "$cond", Value: bson.A{
+			bson.D{{Key: "$gt", Value: bson.A{"$" + out.Field, nil}}}, 1, 0,
+		}}}}}
+	}
+	return bson.D{{Key: "$" + strings.ToLower(out.Aggregate), Value: "$" + out.Field}}
+}
+
+// mongoRow 将管道输出映射为结果行,未指定输出列时展开整个文档
+func mongoRow(doc map[string]interface{}, outputs []documentOutput) map[string]interface{} {
+	row := make(map[string]interface{})
+	if len(outputs) == 0 {
+		flattenValue("", doc, row)
+		return row
+	}
+	for _, out := range outputs {
+		value := doc[out.Key]
+		if nested, ok := value.(map[string]interface{}); ok {
+			data, _ := json.Marshal(nested)
+			value = string(data)
+		}
+		row[out.Name] = value
+	}
+	return row
+}
+
+// plainMongoValue 将 BSON 值转换为普通 Go 值: 文档转为 map,ObjectID 转为十六进制字符串,日期转为 time.Time
+func plainMongoValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case bson.D:
+		m := make(map[string]interface{}, len(v))
+		for _, e := range v {
+			m[e.Key] = plainMongoValue(e.Value)
+		}
+		return m
+	case bson.M:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[k] = plainMongoValue(e)
+		}
+		return m
+	case bson.A:
+		arr := make([]interface{}, len(v))
+		for i, e := range v {
+			arr[i] = plainMongoValue(e)
+		}
+		return arr
+	case primitive.ObjectID:
+		return v.Hex()
+	case primitive.DateTime:
+		return v.Time().UTC()
+	case primitive.Timestamp:
+		return time.Unix(int64(v.T), 0).UTC()
+	case primitive.Decimal128:
+		if f, err := strconv.ParseFloat(v.String(), 64); err == nil {
+			return f
+		}
+		return v.String()
+	case primitive.Binary, primitive.Regex, primitive.JavaScript, primitive.Symbol:
+		return fmt.Sprint(v)
+	case primitive.Null, primitive.Undefined:
+		return nil
+	default:
+		return v
+	}
+}
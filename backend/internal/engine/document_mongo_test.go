@@ -0,0 +1,107 @@
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestBuildMongoPipeline_GroupAndMeasures(t *testing.T) {
+	q := &Query{
+		Source: QuerySource{Table: "orders"},
+		Selects: []SelectItem{
+			{Field: "customer.region", Alias: "region"},
+			{Field: "amount", Aggregate: "SUM", Alias: "total"},
+			{Field: "*", Aggregate: "COUNT", Alias: "count"},
+		},
+		Filters: []Filter{
+			{Field: "status", Operator: "=", Value: "paid"},
+			{Field: "amount", Operator: ">", Value: 10},
+		},
+		GroupBy: []string{"customer.region"},
+		OrderBy: []OrderItem{{Field: "total", Desc: true}},
+		Limit:   5,
+	}
+
+	pipeline, outputs, err := buildMongoPipeline(q)
+	require.NoError(t, err)
+
+	assert.Equal(t, mongo.Pipeline{
+		{{Key: "$match", Value: bson.D{{Key: "$and", Value: bson.A{
+			bson.D{{Key: "status", Value: bson.D{{Key: "$eq", Value: "paid"}}}},
+			bson.D{{Key: "amount", Value: bson.D{{Key: "$gt", Value: 10}}}},
+		}}}}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: bson.D{{Key: "g0", Value: "$customer.region"}}},
+			{Key: "m1", Value: bson.D{{Key: "$sum", Value: "$amount"}}},
+			{Key: "m2", Value: bson.D{{Key: "$sum", Value: 1}}},
+		}}},
+		{{Key: "$project", Value: bson.D{
+			{Key: "_id", Value: 0},
+			{Key: "g0", Value: "$_id.g0"},
+			{Key: "m1", Value: 1},
+			{Key: "m2", Value: 1},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "m1", Value: -1}}}},
+		{{Key: "$limit", Value: int64(5)}},
+	}, pipeline)
+
+	row := mongoRow(map[string]interface{}{"g0": "east", "m1": 12.5, "m2": int32(3)}, outputs)
+	assert.Equal(t, map[string]interface{}{"region": "east", "total": 12.5, "count": int32(3)}, row)
+}
+
+func TestBuildMongoPipeline_Detail(t *testing.T) {
+	pipeline, outputs, err := buildMongoPipeline(&Query{
+		Source:  QuerySource{Table: "orders"},
+		Filters: []Filter{{Field: "name", Operator: "LIKE", Value: "a.b"}},
+		Offset:  10,
+		Limit:   20,
+	})
+	require.NoError(t, err)
+	assert.Empty(t, outputs)
+	assert.Equal(t, mongo.Pipeline{
+		{{Key: "$match", Value: bson.D{{Key: "name", Value: primitive.Regex{Pattern: `a\.b`}}}}},
+		{{Key: "$skip", Value: int64(10)}},
+		{{Key: "$limit", Value: int64(20)}},
+	}, pipeline)
+
+	oid := primitive.NewObjectID()
+	at := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	doc := plainMongoValue(bson.D{
+		{Key: "_id", Value: oid},
+		{Key: "created", Value: primitive.NewDateTimeFromTime(at)},
+		{Key: "user", Value: bson.D{{Key: "name", Value: "a"}}},
+		{Key: "tags", Value: bson.A{"x"}},
+	}).(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{
+		"_id":       oid.Hex(),
+		"created":   at,
+		"user.name": "a",
+		"tags":      `["x"]`,
+	}, mongoRow(doc, outputs))
+}
+
+func TestBuildMongoPipeline_Errors(t *testing.T) {
+	_, _, err := buildMongoPipeline(&Query{Source: QuerySource{SQL: "SELECT 1"}})
+	assert.Error(t, err)
+
+	_, _, err = buildMongoPipeline(&Query{
+		Source:  QuerySource{Table: "orders"},
+		Selects: []SelectItem{{Field: "region"}, {Field: "amount", Aggregate: "SUM"}},
+	})
+	assert.ErrorContains(t, err, "must be grouped")
+
+	_, _, err = buildMongoPipeline(&Query{
+		Source:  QuerySource{Table: "orders"},
+		Filters: []Filter{{Field: "$where", Operator: "=", Value: 1}},
+	})
+	assert.ErrorContains(t, err, "invalid field")
+
+	_, _, err = buildMongoPipeline(&Query{Source: QuerySource{Table: "orders", Where: "region = 'east'"}})
+	assert.ErrorContains(t, err, "row conditions are not supported")
+}
@@ -0,0 +1,410 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"cozy-insight-backend/internal/model"
+)
+
+// ExecPathDocument 文档数据源执行路径,结构化查询直接下推为数据源原生聚合
+const ExecPathDocument = "document"
+
+// schemaSampleSize 推断文档结构时采样的文档数
+const schemaSampleSize = 100
+
+// DocumentStore 文档型数据源(MongoDB、Elasticsearch)的统一访问接口
+type DocumentStore interface {
+	// Ping 测试连接
+	Ping(ctx context.Context) error
+	// ListCollections 列出集合或索引
+	ListCollections(ctx context.Context) ([]string, error)
+	// Sample 采样原始文档,用于推断字段
+	Sample(ctx context.Context, collection string, size int) ([]map[string]interface{}, error)
+	// Query 将结构化查询下推为原生查询/聚合并返回展开后的结果行
+	Query(ctx context.Context, q *Query) ([]map[string]interface{}, error)
+	// Close 释放连接
+	Close(ctx context.Context) error
+}
+
+// DocumentField 采样推断出的文档字段
+type DocumentField struct {
+	Name  string `json:"name"`
+	Type  string `json:"type"`  // TEXT, INTEGER, REAL, TIMESTAMP
+	Count int    `json:"count"` // 包含该字段的采样文档数
+}
+
+// IsDocumentType 是否为文档型数据源
+func IsDocumentType(dsType string) bool {
+	return dsType == model.DatasourceTypeMongoDB || dsType == model.DatasourceTypeElasticsearch
+}
+
+// openDocumentStore 按数据源类型创建文档数据源客户端
+func openDocumentStore(ctx context.Context, dsType, configJSON string) (DocumentStore, error) {
+	configJSON, err := DecryptConfig(configJSON)
+	if err != nil {
+		return nil, err
+	}
+	switch dsType {
+	case model.DatasourceTypeMongoDB:
+		return newMongoStore(ctx, configJSON)
+	case model.DatasourceTypeElasticsearch:
+		return newElasticsearchStore(configJSON)
+	default:
+		return nil, fmt.Errorf("unsupported document datasource type: %s", dsType)
+	}
+}
+
+// documentEntry 缓存的文档数据源客户端
+type documentEntry struct {
+	store DocumentStore
+	hash  string
+}
+
+// DocumentStores 按数据源缓存文档数据源客户端,配置变更时重建
+type DocumentStores struct {
+	mu      sync.Mutex
+	entries map[string]*documentEntry
+}
+
+// NewDocumentStores 创建文档数据源客户端缓存
+func NewDocumentStores() *DocumentStores {
+	return &DocumentStores{entries: make(map[string]*documentEntry)}
+}
+
+// Open 获取目标数据源的客户端,未指定数据源ID时创建临时客户端,返回的 release 用于释放
+func (m *DocumentStores) Open(ctx context.Context, target *QueryTarget) (DocumentStore, func(), error) {
+	if target.DatasourceID == "" {
+		store, err := openDocumentStore(ctx, target.DatasourceType, target.Configuration)
+		if err != nil {
+			return nil, nil, err
+		}
+		return store, func() { store.Close(context.Background()) }, nil
+	}
+
+	hash := configHash(target.DatasourceType, target.Configuration)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if entry, ok := m.entries[target.DatasourceID]; ok {
+		if entry.hash == hash {
+			return entry.store, func() {}, nil
+		}
+		entry.store.Close(context.Background())
+		delete(m.entries, target.DatasourceID)
+	}
+
+	store, err := openDocumentStore(ctx, target.DatasourceType, target.Configuration)
+	if err != nil {
+		return nil, nil, err
+	}
+	m.entries[target.DatasourceID] = &documentEntry{store: store, hash: hash}
+	return store, func() {}, nil
+}
+
+// Invalidate 关闭数据源的缓存客户端
+func (m *DocumentStores) Invalidate(dsID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if entry, ok := m.entries[dsID]; ok {
+		entry.store.Close(context.Background())
+		delete(m.entries, dsID)
+	}
+}
+
+// Close 关闭全部客户端
+func (m *DocumentStores) Close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, entry := range m.entries {
+		entry.store.Close(context.Background())
+		delete(m.entries, id)
+	}
+}
+
+// PlanExecutor 直接执行结构化查询的执行器,路由器不再将查询编译为 SQL
+// 返回的结果列按查询输出顺序排列
+type PlanExecutor interface {
+	ExecuteQuery(ctx context.Context, target *QueryTarget, q *Query) ([]map[string]interface{}, []ResultColumn, error)
+}
+
+// documentExecutor 将结构化查询下推到文档数据源执行
+type documentExecutor struct {
+	stores *DocumentStores
+}
+
+// NewDocumentExecutor 创建文档数据源执行器
+func NewDocumentExecutor(stores *DocumentStores) QueryExecutor {
+	return &documentExecutor{stores: stores}
+}
+
+func (e *documentExecutor) Name() string { return ExecPathDocument }
+
+func (e *documentExecutor) Supports(target *QueryTarget) bool {
+	return e.stores != nil && !target.Federated && target.DatasourceID != "" && IsDocumentType(target.DatasourceType)
+}
+
+func (e *documentExecutor) Dialect(target *QueryTarget) (Dialect, error) {
+	return nil, fmt.Errorf("document datasource %s does not use a SQL dialect", target.DatasourceType)
+}
+
+func (e *documentExecutor) Execute(ctx context.Context, target *QueryTarget, sql string, args ...interface{}) ([]map[string]interface{}, error) {
+	return nil, fmt.Errorf("raw SQL is not supported on document datasource %s", target.DatasourceType)
+}
+
+func (e *documentExecutor) ExecuteQuery(ctx context.Context, target *QueryTarget, q *Query) ([]map[string]interface{}, []ResultColumn, error) {
+	outputs, _, err := planDocumentQuery(q)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	store, release, err := e.stores.Open(ctx, target)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer release()
+
+	rows, err := store.Query(ctx, q)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// 文档没有列类型,只提供列顺序; 未指定输出列时按字段出现次数排列
+	var columns []ResultColumn
+	if len(outputs) == 0 {
+		for _, field := range InferDocumentSchema(rows) {
+			columns = append(columns, ResultColumn{Name: field.Name, Nullable: true})
+		}
+	}
+	for _, out := range outputs {
+		columns = append(columns, ResultColumn{Name: out.Name, Nullable: true})
+	}
+	return rows, columns, nil
+}
+
+// InferDocumentSchema 展开采样文档的嵌套字段并推断字段类型,按出现次数降序排列
+func InferDocumentSchema(docs []map[string]interface{}) []DocumentField {
+	records := make([]map[string]interface{}, len(docs))
+	counts := make(map[string]int)
+	for i, doc := range docs {
+		flat := make(map[string]interface{})
+		flattenValue("", doc, flat)
+		for name := range flat {
+			counts[name]++
+		}
+		records[i] = flat
+	}
+
+	fields := make([]DocumentField, 0, len(counts))
+	for name, count := range counts {
+		fields = append(fields, DocumentField{Name: name, Type: inferColumnType(records, name), Count: count})
+	}
+	sort.Slice(fields, func(i, j int) bool {
+		if fields[i].Count != fields[j].Count {
+			return fields[i].Count > fields[j].Count
+		}
+		return fields[i].Name < fields[j].Name
+	})
+	return fields
+}
+
+// documentOutput 结构化查询的一个输出列
+type documentOutput struct {
+	Name      string // 输出列名
+	Key       string // 下推查询中使用的内部键,避免字段名中的点号
+	Field     string // 源字段路径
+	Aggregate string // 聚合函数,维度列为空
+	Group     int    // 维度列在 GroupBy 中的位置,非维度为 -1
+}
+
+// planDocumentQuery 校验结构化查询并规划输出列,aggregated 表示需要分组聚合
+func planDocumentQuery(q *Query) (outputs []documentOutput, aggregated bool, err error) {
+	if q.Source.Table == "" {
+		return nil, false, fmt.Errorf("custom SQL is not supported on document datasources")
+	}
+	if q.hasExpressions() {
+		return nil, false, fmt.Errorf("calculated fields and time buckets are not supported on document datasources")
+	}
+	if q.Source.Where != "" {
+		return nil, false, fmt.Errorf("row conditions are not supported on document datasources")
+	}
+
+	for _, field := range q.GroupBy {
+		if err := checkDocumentField(field); err != nil {
+			return nil, false, err
+		}
+	}
+	for _, f := range q.Filters {
+		if err := checkDocumentField(f.Field); err != nil {
+			return nil, false, err
+		}
+	}
+
+	aggregated = len(q.GroupBy) > 0
+	for _, item := range q.Selects {
+		if item.Aggregate != "" {
+			aggregated = true
+		}
+	}
+
+	for i, item := range q.Selects {
+		out := documentOutput{Name: item.Alias, Field: item.Field, Aggregate: strings.ToUpper(item.Aggregate), Group: -1}
+		if out.Aggregate == "" {
+			if item.Field == "*" {
+				return nil, false, fmt.Errorf("'*' can only be used with COUNT")
+			}
+			if err := checkDocumentField(item.Field); err != nil {
+				return nil, false, err
+			}
+			if out.Name == "" {
+				out.Name = item.Field
+			}
+			if aggregated {
+				out.Group = indexOf(q.GroupBy, item.Field)
+				if out.Group < 0 {
+					return nil, false, fmt.Errorf("field %s must be grouped or aggregated", item.Field)
+				}
+				out.Key = fmt.Sprintf("g%d", out.Group)
+			} else {
+				out.Key = fmt.Sprintf("c%d", i)
+			}
+		} else {
+			if !supportedAggregates[out.Aggregate] {
+				return nil, false, fmt.Errorf("unsupported aggregate: %s", item.Aggregate)
+			}
+			if item.Field == "*" {
+				if out.Aggregate != "COUNT" {
+					return nil, false, fmt.Errorf("'*' can only be used with COUNT")
+				}
+			} else if err := checkDocumentField(item.Field); err != nil {
+				return nil, false, err
+			}
+			if out.Name == "" {
+				out.Name = fmt.Sprintf("%s(%s)", out.Aggregate, item.Field)
+			}
+			out.Key = fmt.Sprintf("m%d", i)
+		}
+		outputs = append(outputs, out)
+	}
+
+	return outputs, aggregated, nil
+}
+
+// checkDocumentField 校验文档字段路径
+func checkDocumentField(field string) error {
+	if field == "" {
+		return fmt.Errorf("field is required")
+	}
+	if strings.HasPrefix(field, "$") || strings.ContainsAny(field, "\x00") {
+		return fmt.Errorf("invalid field: %s", field)
+	}
+	return nil
+}
+
+// outputByName 按输出列名查找
+func outputByName(outputs []documentOutput, name string) (documentOutput, bool) {
+	for _, out := range outputs {
+		if out.Name == name {
+			return out, true
+		}
+	}
+	return documentOutput{}, false
+}
+
+func indexOf(items []string, target string) int {
+	for i, item := range items {
+		if item == target {
+			return i
+		}
+	}
+	return -1
+}
+
+// compareValues 比较两个结果值,nil 最小,数值按大小,其余按字符串
+func compareValues(a, b interface{}) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+
+	af, aok := toFloat(a)
+	bf, bok := toFloat(b)
+	if aok && bok {
+		switch {
+		case af < bf:
+			return -1
+		case af > bf:
+			return 1
+		}
+		return 0
+	}
+
+	if at, ok := a.(time.Time); ok {
+		if bt, ok := b.(time.Time); ok {
+			return at.Compare(bt)
+		}
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+// toFloat 数值转换为 float64
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float32:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+// sortRows 按输出列排序,用于无法在数据源端排序的结果
+func sortRows(rows []map[string]interface{}, orderBy []OrderItem) {
+	if len(orderBy) == 0 {
+		return
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		for _, item := range orderBy {
+			c := compareValues(rows[i][item.Field], rows[j][item.Field])
+			if c == 0 {
+				continue
+			}
+			if item.Desc {
+				return c > 0
+			}
+			return c < 0
+		}
+		return false
+	})
+}
+
+// pageRows 对结果行应用 offset/limit
+func pageRows(rows []map[string]interface{}, limit, offset int) []map[string]interface{} {
+	if offset > 0 {
+		if offset >= len(rows) {
+			return nil
+		}
+		rows = rows[offset:]
+	}
+	if limit > 0 && limit < len(rows) {
+		rows = rows[:limit]
+	}
+	return rows
+}
@@ -48,7 +48,7 @@ func TestCalciteClient_Constructor(t *testing.T) {
 
 func TestDatasourceConnector_Constructor(t *testing.T) {
 	t.Run("Create connector", func(t *testing.T) {
-		connector := engine.NewDatasourceConnector()
+		connector := engine.NewDatasourceConnector(nil, nil)
 		assert.NotNil(t, connector)
 	})
 }
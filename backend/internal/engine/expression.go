@@ -0,0 +1,657 @@
+package engine
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ExprType 表达式值类型
+type ExprType int
+
+const (
+	ExprNull   ExprType = iota // NULL 字面量,可与任意类型匹配
+	ExprNumber                 // 数值
+	ExprText                   // 文本
+	ExprTime                   // 时间
+	ExprBool                   // 布尔
+)
+
+func (t ExprType) String() string {
+	switch t {
+	case ExprNumber:
+		return "number"
+	case ExprText:
+		return "text"
+	case ExprTime:
+		return "time"
+	case ExprBool:
+		return "bool"
+	default:
+		return "null"
+	}
+}
+
+// DeType 表达式类型对应的字段类型
+func (t ExprType) DeType() int {
+	switch t {
+	case ExprNumber:
+		return DeTypeFloat
+	case ExprTime:
+		return DeTypeTime
+	case ExprBool:
+		return DeTypeBool
+	default:
+		return DeTypeText
+	}
+}
+
+// ExprTypeOf 字段类型(DeType)对应的表达式类型
+func ExprTypeOf(deType int) ExprType {
+	switch deType {
+	case DeTypeInt, DeTypeFloat:
+		return ExprNumber
+	case DeTypeTime:
+		return ExprTime
+	case DeTypeBool:
+		return ExprBool
+	default:
+		return ExprText
+	}
+}
+
+// ExprError 表达式错误,Pos 为出错位置(从1开始的字符序号)
+type ExprError struct {
+	Pos     int    `json:"pos"`
+	Message string `json:"message"`
+}
+
+func (e *ExprError) Error() string {
+	return fmt.Sprintf("position %d: %s", e.Pos, e.Message)
+}
+
+// ExprErrors 表达式的全部语法和类型错误
+type ExprErrors []*ExprError
+
+func (e ExprErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// ExprField 表达式中 [name] 引用的字段
+type ExprField struct {
+	Column string      // 查询中的列名
+	Type   ExprType    // 字段值类型
+	Expr   *Expression // 引用其他计算字段时为其表达式,编译时内联展开
+}
+
+// ExprFieldLookup 按名称查找表达式引用的字段
+type ExprFieldLookup func(name string) (*ExprField, error)
+
+// Expression 已通过语法和类型检查的计算字段表达式
+// 语法: [字段] 引用字段,支持 + - * / % 运算、比较、AND/OR/NOT、IS [NOT] NULL、[NOT] IN、
+// CASE WHEN 以及字符串、日期、空值处理和聚合函数
+type Expression struct {
+	Source     string
+	Type       ExprType
+	Aggregated bool // 是否包含聚合函数,聚合表达式只能作为指标使用
+	root       exprNode
+}
+
+// ParseExpression 解析表达式并做类型检查,错误为包含位置信息的 ExprErrors
+func ParseExpression(source string, lookup ExprFieldLookup) (*Expression, error) {
+	tokens, err := tokenizeExpr(source)
+	if err != nil {
+		return nil, ExprErrors{err}
+	}
+	p := &exprParser{tokens: tokens}
+	root, err := p.parse()
+	if err != nil {
+		return nil, ExprErrors{err}
+	}
+
+	c := &exprChecker{lookup: lookup}
+	info := c.check(root)
+	if len(c.errors) > 0 {
+		sort.SliceStable(c.errors, func(i, j int) bool { return c.errors[i].Pos < c.errors[j].Pos })
+		return nil, c.errors
+	}
+	return &Expression{Source: source, Type: info.typ, Aggregated: info.agg, root: root}, nil
+}
+
+// 词法单元类型
+const (
+	tokEOF = iota
+	tokNumber
+	tokString
+	tokField
+	tokIdent
+	tokOperator
+	tokLParen
+	tokRParen
+	tokComma
+)
+
+type exprToken struct {
+	kind int
+	text string
+	pos  int
+}
+
+// tokenizeExpr 词法分析,位置按字符计数以支持中文字段名
+func tokenizeExpr(source string) ([]exprToken, *ExprError) {
+	runes := []rune(source)
+	var tokens []exprToken
+	i := 0
+	for i < len(runes) {
+		r := runes[i]
+		pos := i + 1
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case unicode.IsDigit(r) || (r == '.' && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			start := i
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			if i < len(runes) && (runes[i] == 'e' || runes[i] == 'E') {
+				i++
+				if i < len(runes) && (runes[i] == '+' || runes[i] == '-') {
+					i++
+				}
+				for i < len(runes) && unicode.IsDigit(runes[i]) {
+					i++
+				}
+			}
+			text := string(runes[start:i])
+			if _, err := strconv.ParseFloat(text, 64); err != nil {
+				return nil, &ExprError{Pos: pos, Message: fmt.Sprintf("invalid number %s", text)}
+			}
+			tokens = append(tokens, exprToken{kind: tokNumber, text: text, pos: pos})
+		case r == '\'':
+			var sb strings.Builder
+			i++
+			closed := false
+			for i < len(runes) {
+				if runes[i] == '\'' {
+					if i+1 < len(runes) && runes[i+1] == '\'' {
+						sb.WriteRune('\'')
+						i += 2
+						continue
+					}
+					i++
+					closed = true
+					break
+				}
+				sb.WriteRune(runes[i])
+				i++
+			}
+			if !closed {
+				return nil, &ExprError{Pos: pos, Message: "unterminated string literal"}
+			}
+			tokens = append(tokens, exprToken{kind: tokString, text: sb.String(), pos: pos})
+		case r == '[':
+			var sb strings.Builder
+			i++
+			closed := false
+			for i < len(runes) {
+				if runes[i] == ']' {
+					if i+1 < len(runes) && runes[i+1] == ']' {
+						sb.WriteRune(']')
+						i += 2
+						continue
+					}
+					i++
+					closed = true
+					break
+				}
+				sb.WriteRune(runes[i])
+				i++
+			}
+			if !closed {
+				return nil, &ExprError{Pos: pos, Message: "unterminated field reference"}
+			}
+			name := strings.TrimSpace(sb.String())
+			if name == "" {
+				return nil, &ExprError{Pos: pos, Message: "empty field reference"}
+			}
+			tokens = append(tokens, exprToken{kind: tokField, text: name, pos: pos})
+		case unicode.IsLetter(r) || r == '_':
+			start := i
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_') {
+				i++
+			}
+			tokens = append(tokens, exprToken{kind: tokIdent, text: strings.ToUpper(string(runes[start:i])), pos: pos})
+		case r == '(':
+			tokens = append(tokens, exprToken{kind: tokLParen, text: "(", pos: pos})
+			i++
+		case r == ')':
+			tokens = append(tokens, exprToken{kind: tokRParen, text: ")", pos: pos})
+			i++
+		case r == ',':
+			tokens = append(tokens, exprToken{kind: tokComma, text: ",", pos: pos})
+			i++
+		default:
+			if i+1 < len(runes) {
+				switch two := string(runes[i : i+2]); two {
+				case "!=", "<>", "<=", ">=":
+					tokens = append(tokens, exprToken{kind: tokOperator, text: two, pos: pos})
+					i += 2
+					continue
+				}
+			}
+			if !strings.ContainsRune("+-*/%=<>", r) {
+				return nil, &ExprError{Pos: pos, Message: fmt.Sprintf("unexpected character %q", r)}
+			}
+			tokens = append(tokens, exprToken{kind: tokOperator, text: string(r), pos: pos})
+			i++
+		}
+	}
+	tokens = append(tokens, exprToken{kind: tokEOF, pos: len(runes) + 1})
+	return tokens, nil
+}
+
+// 语法树节点
+type exprNode interface {
+	position() int
+}
+
+type literalNode struct {
+	at    int
+	typ   ExprType
+	value string // 数值原文、字符串内容或 TRUE/FALSE
+}
+
+type fieldNode struct {
+	at    int
+	name  string
+	field *ExprField // 类型检查时解析
+}
+
+type unaryNode struct {
+	at      int
+	op      string // "-" 或 NOT
+	operand exprNode
+}
+
+type binaryNode struct {
+	at          int
+	op          string
+	left, right exprNode
+}
+
+type isNullNode struct {
+	at      int
+	operand exprNode
+	not     bool
+}
+
+type inNode struct {
+	at      int
+	operand exprNode
+	list    []exprNode
+	not     bool
+}
+
+type caseWhen struct {
+	cond, result exprNode
+}
+
+type caseNode struct {
+	at       int
+	operand  exprNode // 简单 CASE 的比较对象,搜索式 CASE 为 nil
+	whens    []caseWhen
+	elseExpr exprNode
+}
+
+type callNode struct {
+	at   int
+	name string
+	args []exprNode
+}
+
+func (n *literalNode) position() int { return n.at }
+func (n *fieldNode) position() int   { return n.at }
+func (n *unaryNode) position() int   { return n.at }
+func (n *binaryNode) position() int  { return n.at }
+func (n *isNullNode) position() int  { return n.at }
+func (n *inNode) position() int      { return n.at }
+func (n *caseNode) position() int    { return n.at }
+func (n *callNode) position() int    { return n.at }
+
+// exprParser 递归下降语法分析,优先级从低到高: OR, AND, NOT, 比较, 加减, 乘除, 一元负号
+type exprParser struct {
+	tokens []exprToken
+	i      int
+}
+
+func (p *exprParser) peek() exprToken { return p.tokens[p.i] }
+
+func (p *exprParser) next() exprToken {
+	tok := p.tokens[p.i]
+	if tok.kind != tokEOF {
+		p.i++
+	}
+	return tok
+}
+
+// isKeyword 当前词法单元是否为指定关键字
+func (p *exprParser) isKeyword(word string) bool {
+	tok := p.peek()
+	return tok.kind == tokIdent && tok.text == word
+}
+
+func (p *exprParser) isOperator(ops ...string) bool {
+	tok := p.peek()
+	if tok.kind != tokOperator {
+		return false
+	}
+	for _, op := range ops {
+		if tok.text == op {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *exprParser) expectKeyword(word string) *ExprError {
+	if !p.isKeyword(word) {
+		return p.unexpected("expected " + word)
+	}
+	p.next()
+	return nil
+}
+
+func (p *exprParser) expect(kind int, text string) *ExprError {
+	if p.peek().kind != kind {
+		return p.unexpected("expected " + text)
+	}
+	p.next()
+	return nil
+}
+
+// unexpected 当前位置的语法错误
+func (p *exprParser) unexpected(message string) *ExprError {
+	tok := p.peek()
+	if tok.kind == tokEOF {
+		return &ExprError{Pos: tok.pos, Message: message + ", got end of expression"}
+	}
+	text := tok.text
+	switch tok.kind {
+	case tokString:
+		text = quoteLiteral(text)
+	case tokField:
+		text = "[" + text + "]"
+	}
+	return &ExprError{Pos: tok.pos, Message: fmt.Sprintf("%s, got %s", message, text)}
+}
+
+func (p *exprParser) parse() (exprNode, *ExprError) {
+	if p.peek().kind == tokEOF {
+		return nil, &ExprError{Pos: 1, Message: "expression is empty"}
+	}
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != tokEOF {
+		return nil, p.unexpected("unexpected token")
+	}
+	return node, nil
+}
+
+func (p *exprParser) parseOr() (exprNode, *ExprError) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("OR") {
+		tok := p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{at: tok.pos, op: "OR", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseAnd() (exprNode, *ExprError) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("AND") {
+		tok := p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{at: tok.pos, op: "AND", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseNot() (exprNode, *ExprError) {
+	if p.isKeyword("NOT") {
+		tok := p.next()
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryNode{at: tok.pos, op: "NOT", operand: operand}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *exprParser) parseComparison() (exprNode, *ExprError) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case p.isOperator("=", "!=", "<>", "<", "<=", ">", ">="):
+		tok := p.next()
+		right, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		op := tok.text
+		if op == "!=" {
+			op = "<>"
+		}
+		return &binaryNode{at: tok.pos, op: op, left: left, right: right}, nil
+	case p.isKeyword("IS"):
+		tok := p.next()
+		not := false
+		if p.isKeyword("NOT") {
+			p.next()
+			not = true
+		}
+		if err := p.expectKeyword("NULL"); err != nil {
+			return nil, err
+		}
+		return &isNullNode{at: tok.pos, operand: left, not: not}, nil
+	case p.isKeyword("IN"), p.isKeyword("NOT") && p.tokens[p.i+1].kind == tokIdent && p.tokens[p.i+1].text == "IN":
+		tok := p.next()
+		not := tok.text == "NOT"
+		if not {
+			p.next()
+		}
+		if err := p.expect(tokLParen, "("); err != nil {
+			return nil, err
+		}
+		list, err := p.parseList()
+		if err != nil {
+			return nil, err
+		}
+		if len(list) == 0 {
+			return nil, &ExprError{Pos: tok.pos, Message: "IN requires at least one value"}
+		}
+		return &inNode{at: tok.pos, operand: left, list: list, not: not}, nil
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseAdditive() (exprNode, *ExprError) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOperator("+", "-") {
+		tok := p.next()
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{at: tok.pos, op: tok.text, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseMultiplicative() (exprNode, *ExprError) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOperator("*", "/", "%") {
+		tok := p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{at: tok.pos, op: tok.text, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseUnary() (exprNode, *ExprError) {
+	if p.isOperator("-") {
+		tok := p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryNode{at: tok.pos, op: "-", operand: operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (exprNode, *ExprError) {
+	tok := p.peek()
+	switch tok.kind {
+	case tokNumber:
+		p.next()
+		return &literalNode{at: tok.pos, typ: ExprNumber, value: tok.text}, nil
+	case tokString:
+		p.next()
+		return &literalNode{at: tok.pos, typ: ExprText, value: tok.text}, nil
+	case tokField:
+		p.next()
+		return &fieldNode{at: tok.pos, name: tok.text}, nil
+	case tokLParen:
+		p.next()
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(tokRParen, ")"); err != nil {
+			return nil, err
+		}
+		return node, nil
+	case tokIdent:
+		switch tok.text {
+		case "TRUE", "FALSE":
+			p.next()
+			return &literalNode{at: tok.pos, typ: ExprBool, value: tok.text}, nil
+		case "NULL":
+			p.next()
+			return &literalNode{at: tok.pos, typ: ExprNull, value: tok.text}, nil
+		case "CASE":
+			return p.parseCase()
+		}
+		p.next()
+		if p.peek().kind != tokLParen {
+			return nil, &ExprError{Pos: tok.pos, Message: fmt.Sprintf("unknown identifier %s, field names must be written as [name]", tok.text)}
+		}
+		p.next()
+		args, err := p.parseList()
+		if err != nil {
+			return nil, err
+		}
+		return &callNode{at: tok.pos, name: tok.text, args: args}, nil
+	}
+	return nil, p.unexpected("expected a value")
+}
+
+// parseList 解析以右括号结束的逗号分隔列表,左括号已被读取
+func (p *exprParser) parseList() ([]exprNode, *ExprError) {
+	var list []exprNode
+	if p.peek().kind == tokRParen {
+		p.next()
+		return list, nil
+	}
+	for {
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, node)
+		if p.peek().kind == tokComma {
+			p.next()
+			continue
+		}
+		if err := p.expect(tokRParen, ", or )"); err != nil {
+			return nil, err
+		}
+		return list, nil
+	}
+}
+
+func (p *exprParser) parseCase() (exprNode, *ExprError) {
+	tok := p.next()
+	node := &caseNode{at: tok.pos}
+	if !p.isKeyword("WHEN") {
+		operand, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		node.operand = operand
+	}
+	for p.isKeyword("WHEN") {
+		p.next()
+		cond, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectKeyword("THEN"); err != nil {
+			return nil, err
+		}
+		result, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		node.whens = append(node.whens, caseWhen{cond: cond, result: result})
+	}
+	if len(node.whens) == 0 {
+		return nil, p.unexpected("expected WHEN")
+	}
+	if p.isKeyword("ELSE") {
+		p.next()
+		elseExpr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		node.elseExpr = elseExpr
+	}
+	if err := p.expectKeyword("END"); err != nil {
+		return nil, err
+	}
+	return node, nil
+}
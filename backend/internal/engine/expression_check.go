@@ -0,0 +1,359 @@
+package engine
+
+import (
+	"fmt"
+)
+
+// exprFunc 表达式函数的参数个数和是否为聚合函数
+type exprFunc struct {
+	minArgs   int
+	maxArgs   int // 小于0表示不限
+	aggregate bool
+}
+
+// exprFunctions 支持的表达式函数
+var exprFunctions = map[string]exprFunc{
+	// 聚合
+	"SUM":            {1, 1, true},
+	"AVG":            {1, 1, true},
+	"MIN":            {1, 1, true},
+	"MAX":            {1, 1, true},
+	"COUNT":          {1, 1, true},
+	"COUNT_DISTINCT": {1, 1, true},
+	// 条件和空值
+	"IF":       {3, 3, false},
+	"IFNULL":   {2, 2, false},
+	"COALESCE": {1, -1, false},
+	"NULLIF":   {2, 2, false},
+	"ISNULL":   {1, 1, false},
+	// 数值
+	"ABS":   {1, 1, false},
+	"ROUND": {1, 2, false},
+	"CEIL":  {1, 1, false},
+	"FLOOR": {1, 1, false},
+	// 字符串
+	"CONCAT":    {1, -1, false},
+	"UPPER":     {1, 1, false},
+	"LOWER":     {1, 1, false},
+	"TRIM":      {1, 1, false},
+	"LENGTH":    {1, 1, false},
+	"SUBSTRING": {2, 3, false},
+	// 日期
+	"YEAR":       {1, 1, false},
+	"QUARTER":    {1, 1, false},
+	"MONTH":      {1, 1, false},
+	"DAY":        {1, 1, false},
+	"HOUR":       {1, 1, false},
+	"MINUTE":     {1, 1, false},
+	"DATEDIFF":   {2, 2, false},
+	"DATE_TRUNC": {2, 2, false},
+	"NOW":        {0, 0, false},
+}
+
+// exprInfo 子表达式的类型检查结果
+type exprInfo struct {
+	typ  ExprType
+	agg  bool // 包含聚合函数
+	bare bool // 包含聚合函数之外的字段引用
+}
+
+// exprChecker 类型检查,收集全部错误而不在第一个错误处停止
+type exprChecker struct {
+	lookup ExprFieldLookup
+	errors ExprErrors
+}
+
+func (c *exprChecker) errorf(pos int, format string, args ...interface{}) {
+	c.errors = append(c.errors, &ExprError{Pos: pos, Message: fmt.Sprintf(format, args...)})
+}
+
+// combine 合并子表达式的聚合状态,聚合值与明细字段不能混用
+func (c *exprChecker) combine(pos int, typ ExprType, infos ...exprInfo) exprInfo {
+	result := exprInfo{typ: typ}
+	for _, info := range infos {
+		result.agg = result.agg || info.agg
+		result.bare = result.bare || info.bare
+	}
+	if result.agg && result.bare {
+		c.errorf(pos, "cannot mix aggregated and non-aggregated fields")
+		result.bare = false
+	}
+	return result
+}
+
+// unify 合并两个分支的类型,NULL 可与任意类型匹配
+func unify(a, b ExprType) (ExprType, bool) {
+	switch {
+	case a == ExprNull:
+		return b, true
+	case b == ExprNull, a == b:
+		return a, true
+	default:
+		return a, false
+	}
+}
+
+// exprComparable 两个类型的值能否比较,时间可与文本形式的日期比较
+func exprComparable(a, b ExprType) bool {
+	if _, ok := unify(a, b); ok {
+		return true
+	}
+	return (a == ExprTime && b == ExprText) || (a == ExprText && b == ExprTime)
+}
+
+// expectType 校验参数类型,NULL 总是允许
+func (c *exprChecker) expectType(node exprNode, got ExprType, what string, want ...ExprType) {
+	if got == ExprNull {
+		return
+	}
+	for _, w := range want {
+		if got == w {
+			return
+		}
+	}
+	c.errorf(node.position(), "%s must be %s, got %s", what, want[0], got)
+}
+
+func (c *exprChecker) check(node exprNode) exprInfo {
+	switch n := node.(type) {
+	case *literalNode:
+		return exprInfo{typ: n.typ}
+	case *fieldNode:
+		return c.checkField(n)
+	case *unaryNode:
+		info := c.check(n.operand)
+		if n.op == "NOT" {
+			c.expectType(n.operand, info.typ, "operand of NOT", ExprBool)
+			info.typ = ExprBool
+		} else {
+			c.expectType(n.operand, info.typ, "operand of unary -", ExprNumber)
+			info.typ = ExprNumber
+		}
+		return info
+	case *binaryNode:
+		return c.checkBinary(n)
+	case *isNullNode:
+		info := c.check(n.operand)
+		info.typ = ExprBool
+		return info
+	case *inNode:
+		operand := c.check(n.operand)
+		infos := []exprInfo{operand}
+		for _, item := range n.list {
+			info := c.check(item)
+			if !exprComparable(operand.typ, info.typ) {
+				c.errorf(item.position(), "cannot compare %s with %s", operand.typ, info.typ)
+			}
+			infos = append(infos, info)
+		}
+		return c.combine(n.at, ExprBool, infos...)
+	case *caseNode:
+		return c.checkCase(n)
+	case *callNode:
+		return c.checkCall(n)
+	default:
+		c.errorf(node.position(), "unsupported expression")
+		return exprInfo{}
+	}
+}
+
+func (c *exprChecker) checkField(n *fieldNode) exprInfo {
+	field, err := c.lookup(n.name)
+	if err != nil {
+		c.errorf(n.at, "%s", err.Error())
+		return exprInfo{}
+	}
+	n.field = field
+	if field.Expr != nil {
+		return exprInfo{typ: field.Expr.Type, agg: field.Expr.Aggregated, bare: !field.Expr.Aggregated}
+	}
+	return exprInfo{typ: field.Type, bare: true}
+}
+
+func (c *exprChecker) checkBinary(n *binaryNode) exprInfo {
+	left := c.check(n.left)
+	right := c.check(n.right)
+
+	var typ ExprType
+	switch n.op {
+	case "+", "-", "*", "/", "%":
+		if n.op == "+" && (left.typ == ExprText || right.typ == ExprText) {
+			c.errorf(n.at, "operator + cannot be applied to text, use CONCAT to join text")
+		} else {
+			c.expectType(n.left, left.typ, "left operand of "+n.op, ExprNumber)
+			c.expectType(n.right, right.typ, "right operand of "+n.op, ExprNumber)
+		}
+		typ = ExprNumber
+	case "AND", "OR":
+		c.expectType(n.left, left.typ, "left operand of "+n.op, ExprBool)
+		c.expectType(n.right, right.typ, "right operand of "+n.op, ExprBool)
+		typ = ExprBool
+	default: // 比较
+		if !exprComparable(left.typ, right.typ) {
+			c.errorf(n.at, "cannot compare %s with %s", left.typ, right.typ)
+		}
+		typ = ExprBool
+	}
+	return c.combine(n.at, typ, left, right)
+}
+
+func (c *exprChecker) checkCase(n *caseNode) exprInfo {
+	var infos []exprInfo
+	var operand exprInfo
+	if n.operand != nil {
+		operand = c.check(n.operand)
+		infos = append(infos, operand)
+	}
+
+	typ := ExprNull
+	addResult := func(node exprNode) {
+		info := c.check(node)
+		infos = append(infos, info)
+		unified, ok := unify(typ, info.typ)
+		if !ok {
+			c.errorf(node.position(), "CASE branches return different types: %s and %s", typ, info.typ)
+			return
+		}
+		typ = unified
+	}
+
+	for _, w := range n.whens {
+		cond := c.check(w.cond)
+		infos = append(infos, cond)
+		if n.operand != nil {
+			if !exprComparable(operand.typ, cond.typ) {
+				c.errorf(w.cond.position(), "cannot compare %s with %s", operand.typ, cond.typ)
+			}
+		} else {
+			c.expectType(w.cond, cond.typ, "WHEN condition", ExprBool)
+		}
+		addResult(w.result)
+	}
+	if n.elseExpr != nil {
+		addResult(n.elseExpr)
+	}
+	return c.combine(n.at, typ, infos...)
+}
+
+func (c *exprChecker) checkCall(n *callNode) exprInfo {
+	fn, ok := exprFunctions[n.name]
+	if !ok {
+		c.errorf(n.at, "unknown function %s", n.name)
+		return exprInfo{}
+	}
+	if len(n.args) < fn.minArgs || (fn.maxArgs >= 0 && len(n.args) > fn.maxArgs) {
+		c.errorf(n.at, "%s expects %s, got %d", n.name, describeArity(fn), len(n.args))
+		return exprInfo{}
+	}
+
+	infos := make([]exprInfo, len(n.args))
+	types := make([]ExprType, len(n.args))
+	for i, arg := range n.args {
+		infos[i] = c.check(arg)
+		types[i] = infos[i].typ
+	}
+	arg := func(i int) string { return fmt.Sprintf("argument %d of %s", i+1, n.name) }
+
+	if fn.aggregate {
+		for i, info := range infos {
+			if info.agg {
+				c.errorf(n.args[i].position(), "aggregate functions cannot be nested")
+			}
+		}
+		typ := ExprNumber
+		switch n.name {
+		case "SUM", "AVG":
+			c.expectType(n.args[0], types[0], arg(0), ExprNumber)
+		case "MIN", "MAX":
+			typ = types[0]
+		}
+		return exprInfo{typ: typ, agg: true}
+	}
+
+	var typ ExprType
+	switch n.name {
+	case "IF":
+		c.expectType(n.args[0], types[0], arg(0), ExprBool)
+		typ = c.unifyArgs(n, types[1:], n.args[1:])
+	case "IFNULL", "COALESCE":
+		typ = c.unifyArgs(n, types, n.args)
+	case "NULLIF":
+		if !exprComparable(types[0], types[1]) {
+			c.errorf(n.args[1].position(), "cannot compare %s with %s", types[0], types[1])
+		}
+		typ = types[0]
+	case "ISNULL":
+		typ = ExprBool
+	case "ABS", "ROUND", "CEIL", "FLOOR":
+		for i := range n.args {
+			c.expectType(n.args[i], types[i], arg(i), ExprNumber)
+		}
+		typ = ExprNumber
+	case "CONCAT":
+		typ = ExprText
+	case "UPPER", "LOWER", "TRIM", "LENGTH":
+		c.expectType(n.args[0], types[0], arg(0), ExprText)
+		typ = ExprText
+		if n.name == "LENGTH" {
+			typ = ExprNumber
+		}
+	case "SUBSTRING":
+		c.expectType(n.args[0], types[0], arg(0), ExprText)
+		for i := 1; i < len(n.args); i++ {
+			c.expectType(n.args[i], types[i], arg(i), ExprNumber)
+		}
+		typ = ExprText
+	case "YEAR", "QUARTER", "MONTH", "DAY", "HOUR", "MINUTE":
+		c.expectType(n.args[0], types[0], arg(0), ExprTime, ExprText)
+		typ = ExprNumber
+	case "DATEDIFF":
+		for i := range n.args {
+			c.expectType(n.args[i], types[i], arg(i), ExprTime, ExprText)
+		}
+		typ = ExprNumber
+	case "DATE_TRUNC":
+		if unit, ok := n.args[0].(*literalNode); !ok || unit.typ != ExprText || !isTimeUnit(unit.value) {
+			c.errorf(n.args[0].position(), "argument 1 of DATE_TRUNC must be one of 'year', 'quarter', 'month', 'week', 'day', 'hour', 'minute'")
+		}
+		c.expectType(n.args[1], types[1], arg(1), ExprTime, ExprText)
+		typ = ExprTime
+	case "NOW":
+		typ = ExprTime
+	}
+	return c.combine(n.at, typ, infos...)
+}
+
+// unifyArgs 多个参数作为候选结果时类型必须一致
+func (c *exprChecker) unifyArgs(n *callNode, types []ExprType, args []exprNode) ExprType {
+	typ := ExprNull
+	for i, t := range types {
+		unified, ok := unify(typ, t)
+		if !ok {
+			c.errorf(args[i].position(), "arguments of %s have different types: %s and %s", n.name, typ, t)
+			continue
+		}
+		typ = unified
+	}
+	return typ
+}
+
+// describeArity 参数个数说明
+func describeArity(fn exprFunc) string {
+	switch {
+	case fn.maxArgs < 0:
+		return fmt.Sprintf("at least %d argument(s)", fn.minArgs)
+	case fn.minArgs == fn.maxArgs:
+		return fmt.Sprintf("%d argument(s)", fn.minArgs)
+	default:
+		return fmt.Sprintf("%d to %d arguments", fn.minArgs, fn.maxArgs)
+	}
+}
+
+// isTimeUnit 是否为支持的时间截断粒度
+func isTimeUnit(unit string) bool {
+	switch unit {
+	case TimeUnitYear, TimeUnitQuarter, TimeUnitMonth, TimeUnitWeek, TimeUnitDay, TimeUnitHour, TimeUnitMinute:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,224 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SQL 按目标方言编译表达式,字符串字面量以绑定参数传递
+func (e *Expression) SQL(d Dialect, args *[]interface{}) (string, error) {
+	if e == nil || e.root == nil {
+		return "", fmt.Errorf("expression is empty")
+	}
+	return renderExpr(d, e.root, args)
+}
+
+func renderExpr(d Dialect, node exprNode, args *[]interface{}) (string, error) {
+	switch n := node.(type) {
+	case *literalNode:
+		switch n.typ {
+		case ExprNumber:
+			return n.value, nil
+		case ExprText:
+			return bindArg(d, args, n.value), nil
+		case ExprBool:
+			return d.BooleanLiteral(n.value == "TRUE"), nil
+		default:
+			return "NULL", nil
+		}
+	case *fieldNode:
+		if n.field == nil {
+			return "", fmt.Errorf("field [%s] is not resolved", n.name)
+		}
+		if n.field.Expr != nil {
+			sql, err := n.field.Expr.SQL(d, args)
+			if err != nil {
+				return "", err
+			}
+			return "(" + sql + ")", nil
+		}
+		return d.QuoteIdentifier(n.field.Column), nil
+	case *unaryNode:
+		operand, err := renderExpr(d, n.operand, args)
+		if err != nil {
+			return "", err
+		}
+		if n.op == "NOT" {
+			return "(NOT " + operand + ")", nil
+		}
+		return "(-" + operand + ")", nil
+	case *binaryNode:
+		return renderBinary(d, n, args)
+	case *isNullNode:
+		operand, err := renderExpr(d, n.operand, args)
+		if err != nil {
+			return "", err
+		}
+		if n.not {
+			return "(" + operand + " IS NOT NULL)", nil
+		}
+		return "(" + operand + " IS NULL)", nil
+	case *inNode:
+		parts, err := renderExprs(d, append([]exprNode{n.operand}, n.list...), args)
+		if err != nil {
+			return "", err
+		}
+		op := " IN "
+		if n.not {
+			op = " NOT IN "
+		}
+		return "(" + parts[0] + op + "(" + strings.Join(parts[1:], ", ") + "))", nil
+	case *caseNode:
+		return renderCase(d, n, args)
+	case *callNode:
+		return renderCall(d, n, args)
+	default:
+		return "", fmt.Errorf("unsupported expression node %T", node)
+	}
+}
+
+// renderExprs 依次编译多个子表达式,保证绑定参数顺序与SQL文本一致
+func renderExprs(d Dialect, nodes []exprNode, args *[]interface{}) ([]string, error) {
+	parts := make([]string, len(nodes))
+	for i, node := range nodes {
+		sql, err := renderExpr(d, node, args)
+		if err != nil {
+			return nil, err
+		}
+		parts[i] = sql
+	}
+	return parts, nil
+}
+
+func renderBinary(d Dialect, n *binaryNode, args *[]interface{}) (string, error) {
+	parts, err := renderExprs(d, []exprNode{n.left, n.right}, args)
+	if err != nil {
+		return "", err
+	}
+	left, right := parts[0], parts[1]
+	switch n.op {
+	case "/":
+		// 除数为0时结果为 NULL,乘以 1.0 避免整数除法
+		return fmt.Sprintf("(%s * 1.0 / NULLIF(%s, 0))", left, right), nil
+	case "%":
+		if d.Name() == DialectCalcite {
+			return fmt.Sprintf("MOD(%s, %s)", left, right), nil
+		}
+	}
+	return fmt.Sprintf("(%s %s %s)", left, n.op, right), nil
+}
+
+func renderCase(d Dialect, n *caseNode, args *[]interface{}) (string, error) {
+	var sb strings.Builder
+	sb.WriteString("CASE")
+	if n.operand != nil {
+		operand, err := renderExpr(d, n.operand, args)
+		if err != nil {
+			return "", err
+		}
+		sb.WriteString(" " + operand)
+	}
+	for _, w := range n.whens {
+		parts, err := renderExprs(d, []exprNode{w.cond, w.result}, args)
+		if err != nil {
+			return "", err
+		}
+		sb.WriteString(" WHEN " + parts[0] + " THEN " + parts[1])
+	}
+	if n.elseExpr != nil {
+		elseSQL, err := renderExpr(d, n.elseExpr, args)
+		if err != nil {
+			return "", err
+		}
+		sb.WriteString(" ELSE " + elseSQL)
+	}
+	sb.WriteString(" END")
+	return sb.String(), nil
+}
+
+// dateParts 日期部分函数对应的时间粒度
+var dateParts = map[string]string{
+	"YEAR":    TimeUnitYear,
+	"QUARTER": TimeUnitQuarter,
+	"MONTH":   TimeUnitMonth,
+	"DAY":     TimeUnitDay,
+	"HOUR":    TimeUnitHour,
+	"MINUTE":  TimeUnitMinute,
+}
+
+// stringFuncs 字符串函数对应的方言函数
+var stringFuncs = map[string]string{
+	"CONCAT":    StringFuncConcat,
+	"UPPER":     StringFuncUpper,
+	"LOWER":     StringFuncLower,
+	"TRIM":      StringFuncTrim,
+	"LENGTH":    StringFuncLength,
+	"SUBSTRING": StringFuncSubstring,
+}
+
+func renderCall(d Dialect, n *callNode, args *[]interface{}) (string, error) {
+	if n.name == "DATE_TRUNC" {
+		unit := n.args[0].(*literalNode).value
+		value, err := renderExpr(d, n.args[1], args)
+		if err != nil {
+			return "", err
+		}
+		return d.DateTrunc(value, unit)
+	}
+	if n.name == "FLOOR" || n.name == "CEIL" {
+		return renderRounding(d, n, args)
+	}
+
+	parts, err := renderExprs(d, n.args, args)
+	if err != nil {
+		return "", err
+	}
+	if name, ok := stringFuncs[n.name]; ok {
+		return d.StringFunc(name, parts...)
+	}
+	if unit, ok := dateParts[n.name]; ok {
+		return d.DatePart(parts[0], unit)
+	}
+
+	switch n.name {
+	case "COUNT_DISTINCT":
+		return fmt.Sprintf("COUNT(DISTINCT %s)", parts[0]), nil
+	case "IF":
+		return fmt.Sprintf("CASE WHEN %s THEN %s ELSE %s END", parts[0], parts[1], parts[2]), nil
+	case "IFNULL":
+		return fmt.Sprintf("COALESCE(%s, %s)", parts[0], parts[1]), nil
+	case "ISNULL":
+		return fmt.Sprintf("(%s IS NULL)", parts[0]), nil
+	case "ROUND":
+		if len(parts) == 2 && d.Name() == DialectPostgreSQL {
+			// PostgreSQL 仅 numeric 支持指定小数位
+			return fmt.Sprintf("ROUND(CAST(%s AS NUMERIC), %s)", parts[0], parts[1]), nil
+		}
+	case "DATEDIFF":
+		return d.DateDiff(parts[1], parts[0]), nil
+	case "NOW":
+		return d.CurrentTimestamp(), nil
+	}
+	return fmt.Sprintf("%s(%s)", n.name, strings.Join(parts, ", ")), nil
+}
+
+// renderRounding FLOOR/CEIL,SQLite 未内置这两个函数时用截断模拟
+func renderRounding(d Dialect, n *callNode, args *[]interface{}) (string, error) {
+	if d.Name() != DialectSQLite {
+		value, err := renderExpr(d, n.args[0], args)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s(%s)", n.name, value), nil
+	}
+
+	// 参数在SQL中出现三次,逐次编译以保持绑定参数顺序
+	parts, err := renderExprs(d, []exprNode{n.args[0], n.args[0], n.args[0]}, args)
+	if err != nil {
+		return "", err
+	}
+	if n.name == "FLOOR" {
+		return fmt.Sprintf("(CAST(%s AS INTEGER) - (%s < CAST(%s AS INTEGER)))", parts[0], parts[1], parts[2]), nil
+	}
+	return fmt.Sprintf("(CAST(%s AS INTEGER) + (%s > CAST(%s AS INTEGER)))", parts[0], parts[1], parts[2]), nil
+}
@@ -0,0 +1,229 @@
+package engine
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testExprFields 测试用字段: amount/qty 数值, region 文本, created 时间
+func testExprFields(calculated map[string]*Expression) ExprFieldLookup {
+	columns := map[string]ExprType{
+		"amount":  ExprNumber,
+		"qty":     ExprNumber,
+		"region":  ExprText,
+		"created": ExprTime,
+		"地区":      ExprText,
+	}
+	return func(name string) (*ExprField, error) {
+		if expr, ok := calculated[name]; ok {
+			return &ExprField{Column: name, Type: expr.Type, Expr: expr}, nil
+		}
+		typ, ok := columns[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown field [%s]", name)
+		}
+		return &ExprField{Column: name, Type: typ}, nil
+	}
+}
+
+func TestParseExpression_SQL(t *testing.T) {
+	sqlite, _ := GetDialect(DialectSQLite)
+	mysql, _ := GetDialect(DialectMySQL)
+
+	tests := []struct {
+		expr     string
+		dialect  Dialect
+		wantSQL  string
+		wantArgs []interface{}
+		wantType ExprType
+		wantAgg  bool
+	}{
+		{"[amount] / [qty] + 1", sqlite, `(("amount" * 1.0 / NULLIF("qty", 0)) + 1)`, nil, ExprNumber, false},
+		{"IF([amount] > 100, 'big', 'small')", mysql, "CASE WHEN (`amount` > 100) THEN ? ELSE ? END", []interface{}{"big", "small"}, ExprText, false},
+		{"CASE [region] WHEN 'east' THEN 1 ELSE 0 END", sqlite, `CASE "region" WHEN ? THEN 1 ELSE 0 END`, []interface{}{"east"}, ExprNumber, false},
+		{"CONCAT(UPPER([地区]), '-', YEAR([created]))", mysql, "CONCAT(UPPER(`地区`), ?, YEAR(`created`))", []interface{}{"-"}, ExprText, false},
+		{"SUM([amount]) / COUNT_DISTINCT([region])", sqlite, `(SUM("amount") * 1.0 / NULLIF(COUNT(DISTINCT "region"), 0))`, nil, ExprNumber, true},
+		{"IFNULL([amount], 0) >= 10 AND [region] NOT IN ('a', 'b')", sqlite, `((COALESCE("amount", 0) >= 10) AND ("region" NOT IN (?, ?)))`, []interface{}{"a", "b"}, ExprBool, false},
+		{"DATE_TRUNC('month', [created])", mysql, "DATE_FORMAT(`created`, '%Y-%m-01')", nil, ExprTime, false},
+		{"DATEDIFF(NOW(), [created])", mysql, "DATEDIFF(NOW(), `created`)", nil, ExprNumber, false},
+		{"[region] IS NOT NULL", sqlite, `("region" IS NOT NULL)`, nil, ExprBool, false},
+	}
+
+	for _, tt := range tests {
+		expr, err := ParseExpression(tt.expr, testExprFields(nil))
+		require.NoError(t, err, tt.expr)
+		assert.Equal(t, tt.wantType, expr.Type, tt.expr)
+		assert.Equal(t, tt.wantAgg, expr.Aggregated, tt.expr)
+
+		var args []interface{}
+		got, err := expr.SQL(tt.dialect, &args)
+		require.NoError(t, err, tt.expr)
+		assert.Equal(t, tt.wantSQL, got, tt.expr)
+		assert.Equal(t, tt.wantArgs, args, tt.expr)
+	}
+}
+
+func TestParseExpression_Errors(t *testing.T) {
+	profit, err := ParseExpression("SUM([amount]) - SUM([qty])", testExprFields(nil))
+	require.NoError(t, err)
+	lookup := testExprFields(map[string]*Expression{"profit": profit})
+
+	tests := []struct {
+		expr    string
+		pos     int
+		message string
+	}{
+		{"", 1, "expression is empty"},
+		{"[amount] +", 11, "expected a value, got end of expression"},
+		{"([amount] + 1", 14, "expected )"},
+		{"'abc", 1, "unterminated string literal"},
+		{"[amount] # 2", 10, "unexpected character"},
+		{"amount + 1", 1, "field names must be written as [name]"},
+		{"[missing] + 1", 1, "unknown field [missing]"},
+		{"[region] + 'x'", 10, "use CONCAT"},
+		{"[amount] * [region]", 12, "right operand of * must be number, got text"},
+		{"FOO([amount])", 1, "unknown function FOO"},
+		{"ROUND()", 1, "ROUND expects 1 to 2 arguments, got 0"},
+		{"SUM(SUM([amount]))", 5, "aggregate functions cannot be nested"},
+		{"SUM([amount]) + [qty]", 15, "cannot mix aggregated and non-aggregated fields"},
+		{"[profit] / [qty]", 10, "cannot mix aggregated and non-aggregated fields"},
+		{"AVG([profit])", 5, "aggregate functions cannot be nested"},
+		{"IF([amount], 1, 0)", 4, "argument 1 of IF must be bool, got number"},
+		{"CASE WHEN [amount] > 1 THEN 'a' ELSE 2 END", 38, "CASE branches return different types: text and number"},
+		{"DATE_TRUNC('fortnight', [created])", 12, "argument 1 of DATE_TRUNC"},
+		{"[地区] = 1", 6, "cannot compare text with number"},
+	}
+
+	for _, tt := range tests {
+		_, err := ParseExpression(tt.expr, lookup)
+		require.Error(t, err, tt.expr)
+		errs, ok := err.(ExprErrors)
+		require.True(t, ok, tt.expr)
+		require.NotEmpty(t, errs, tt.expr)
+		assert.Equal(t, tt.pos, errs[0].Pos, tt.expr)
+		assert.Contains(t, errs[0].Message, tt.message, tt.expr)
+	}
+
+	// 类型错误全部收集并按位置排序
+	_, err = ParseExpression("[region] * 2 + LENGTH([amount])", lookup)
+	errs := err.(ExprErrors)
+	require.Len(t, errs, 2)
+	assert.Equal(t, []int{1, 23}, []int{errs[0].Pos, errs[1].Pos})
+}
+
+func TestParseExpression_NestedCalculatedField(t *testing.T) {
+	unitPrice, err := ParseExpression("[amount] / [qty]", testExprFields(nil))
+	require.NoError(t, err)
+
+	expr, err := ParseExpression("ROUND([unit price], 2)", testExprFields(map[string]*Expression{"unit price": unitPrice}))
+	require.NoError(t, err)
+	pg, _ := GetDialect(DialectPostgreSQL)
+	var args []interface{}
+	got, err := expr.SQL(pg, &args)
+	require.NoError(t, err)
+	assert.Equal(t, `ROUND(CAST((("amount" * 1.0 / NULLIF("qty", 0))) AS NUMERIC), 2)`, got)
+}
+
+func TestQuery_BuildWithExpressions(t *testing.T) {
+	sqlite, _ := GetDialect(DialectSQLite)
+	level, err := ParseExpression("IF([amount] >= 20, 'high', 'low')", testExprFields(nil))
+	require.NoError(t, err)
+	avgPrice, err := ParseExpression("SUM([amount]) / SUM([qty])", testExprFields(nil))
+	require.NoError(t, err)
+
+	q := &Query{
+		Source: QuerySource{
+			SQL:      "SELECT * FROM orders WHERE region <> ?",
+			Args:     []interface{}{"south"},
+			Computed: []ComputedColumn{{Name: "level", Expr: level}},
+		},
+		Selects: []SelectItem{
+			{Field: "level", Alias: "level"},
+			{Expr: avgPrice, Alias: "avg_price"},
+			{Expr: level, Aggregate: "COUNT", Alias: "cnt"},
+		},
+		Filters: []Filter{{Field: "level", Operator: "=", Value: "high"}},
+		GroupBy: []string{"level"},
+		OrderBy: []OrderItem{{Field: "level"}},
+	}
+	query, args, err := q.Build(sqlite)
+	require.NoError(t, err)
+	assert.Equal(t, `SELECT "level", (SUM("amount") * 1.0 / NULLIF(SUM("qty"), 0)) AS "avg_price", `+
+		`COUNT(CASE WHEN ("amount" >= 20) THEN ? ELSE ? END) AS "cnt" `+
+		`FROM (SELECT "src".*, CASE WHEN ("amount" >= 20) THEN ? ELSE ? END AS "level" FROM (SELECT * FROM orders WHERE region <> ?) AS "src") AS "base" `+
+		`WHERE "level" = ? GROUP BY "level" ORDER BY "level" ASC`, query)
+	assert.Equal(t, []interface{}{"high", "low", "high", "low", "south", "high"}, args)
+
+	// 在真实数据库上执行,验证参数顺序
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "expr.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec(`CREATE TABLE orders (region TEXT, amount REAL, qty INTEGER);
+		INSERT INTO orders VALUES ('east', 30, 3), ('west', 10, 1), ('east', 20, 4), ('south', 50, 1)`)
+	require.NoError(t, err)
+	var levelValue string
+	var avg float64
+	var cnt int
+	require.NoError(t, db.QueryRow(query, args...).Scan(&levelValue, &avg, &cnt))
+	assert.Equal(t, "high", levelValue)
+	assert.InDelta(t, 50.0/7, avg, 1e-9)
+	assert.Equal(t, 2, cnt)
+
+	q.Selects[1].Aggregate = "SUM"
+	_, _, err = q.Build(sqlite)
+	assert.ErrorContains(t, err, "already aggregated")
+}
+
+func TestQuery_BuildWithTimeBucket(t *testing.T) {
+	sqlite, _ := GetDialect(DialectSQLite)
+	shanghai, err := time.LoadLocation("Asia/Shanghai")
+	require.NoError(t, err)
+
+	q := &Query{
+		Source: QuerySource{
+			Table: "orders",
+			Computed: []ComputedColumn{{Name: "created_at__week", Bucket: &TimeBucket{
+				Field: "created_at", Unit: TimeUnitWeek, WeekStart: time.Monday, Location: shanghai,
+			}}},
+		},
+		Selects: []SelectItem{
+			{Field: "created_at__week", Alias: "week"},
+			{Field: "amount", Aggregate: "SUM", Alias: "amount"},
+		},
+		GroupBy: []string{"created_at__week"},
+		OrderBy: []OrderItem{{Field: "week"}},
+	}
+	query, args, err := q.Build(sqlite)
+	require.NoError(t, err)
+	assert.Equal(t, `SELECT "created_at__week" AS "week", SUM("amount") AS "amount" `+
+		`FROM (SELECT "src".*, date(datetime("created_at", '+480 minutes'), '-6 days', 'weekday 1') AS "created_at__week" FROM "orders" AS "src") AS "base" `+
+		`GROUP BY "created_at__week" ORDER BY "week" ASC`, query)
+
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "bucket.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	// 2024-01-07 是周日,按 UTC+8 换算后第二笔订单落在下一周
+	_, err = db.Exec(`CREATE TABLE orders (created_at TEXT, amount REAL);
+		INSERT INTO orders VALUES ('2024-01-07 10:00:00', 10), ('2024-01-07 20:00:00', 20), ('2024-01-09 08:00:00', 5)`)
+	require.NoError(t, err)
+	rows, err := db.Query(query, args...)
+	require.NoError(t, err)
+	defer rows.Close()
+	var weeks []string
+	var amounts []float64
+	for rows.Next() {
+		var week string
+		var amount float64
+		require.NoError(t, rows.Scan(&week, &amount))
+		weeks = append(weeks, week)
+		amounts = append(amounts, amount)
+	}
+	assert.Equal(t, []string{"2024-01-01", "2024-01-08"}, weeks)
+	assert.Equal(t, []float64{10, 25}, amounts)
+}
@@ -0,0 +1,303 @@
+package engine
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// ExtractDatasourceID 抽取库在连接池中使用的保留数据源ID
+const ExtractDatasourceID = "__extract__"
+
+// 抽取表列类型
+const (
+	ExtractTypeText      = "TEXT"
+	ExtractTypeInteger   = "INTEGER"
+	ExtractTypeReal      = "REAL"
+	ExtractTypeTimestamp = "TIMESTAMP"
+)
+
+// 写入模式,与 Datasource.EditType 取值一致
+const (
+	WriteModeReplace = 0
+	WriteModeAppend  = 1
+)
+
+// maxInsertVariables 单条语句可绑定的参数上限(SQLite 默认 SQLITE_MAX_VARIABLE_NUMBER)
+const maxInsertVariables = 32766
+
+// ExtractColumn 抽取表列定义
+type ExtractColumn struct {
+	Name string `json:"name"`
+	Type string `json:"type"` // TEXT, INTEGER, REAL, TIMESTAMP
+}
+
+// ExtractStore 内部抽取库,将上传文件、API 等数据物化为本地 SQLite 表
+// 查询时作为 sqlite 数据源经直连执行器读取
+type ExtractStore struct {
+	path string
+	db   *sql.DB
+	mu   sync.Mutex // 串行化写入
+}
+
+// NewExtractStore 打开(不存在时创建)抽取库文件
+func NewExtractStore(path string) (*ExtractStore, error) {
+	if path == "" {
+		return nil, fmt.Errorf("extract store path is required")
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid extract store path: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(absPath), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create extract store directory: %w", err)
+	}
+
+	db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?_busy_timeout=5000&_journal_mode=WAL", sqlitePathEscaper.Replace(absPath)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open extract store: %w", err)
+	}
+	// SQLite 只允许单个写连接
+	db.SetMaxOpenConns(1)
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to open extract store: %w", err)
+	}
+
+	return &ExtractStore{path: absPath, db: db}, nil
+}
+
+// Target 读取抽取表时使用的查询目标
+func (s *ExtractStore) Target() *QueryTarget {
+	config, _ := json.Marshal(map[string]string{"type": DialectSQLite, "path": s.path})
+	return &QueryTarget{
+		DatasourceID:   ExtractDatasourceID,
+		DatasourceType: DialectSQLite,
+		Configuration:  string(config),
+	}
+}
+
+// Write 写入抽取表,替换模式下原子替换整表,追加模式下要求列与已有表一致
+func (s *ExtractStore) Write(ctx context.Context, table string, columns []ExtractColumn, rows [][]interface{}, mode int) error {
+	w, err := s.BeginWrite(ctx, table, columns, mode)
+	if err != nil {
+		return err
+	}
+	defer w.Rollback()
+
+	if err := w.Append(ctx, rows); err != nil {
+		return err
+	}
+	return w.Commit()
+}
+
+// ExtractWriter 分批写入一张抽取表,全部批次在同一事务中提交
+type ExtractWriter struct {
+	store   *ExtractStore
+	tx      *sql.Tx
+	table   string
+	columns []ExtractColumn
+	done    bool
+}
+
+// BeginWrite 开始分批写入抽取表,模式同 Write
+// 结束前须调用 Commit 或 Rollback,期间其他写入等待
+func (s *ExtractStore) BeginWrite(ctx context.Context, table string, columns []ExtractColumn, mode int) (*ExtractWriter, error) {
+	if table == "" {
+		return nil, fmt.Errorf("table name is required")
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("at least one column is required")
+	}
+
+	s.mu.Lock()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		s.mu.Unlock()
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	w := &ExtractWriter{store: s, tx: tx, table: table, columns: columns}
+	if err := w.prepare(ctx, mode); err != nil {
+		w.Rollback()
+		return nil, err
+	}
+	return w, nil
+}
+
+// prepare 替换模式下重建表,追加模式下校验列
+func (w *ExtractWriter) prepare(ctx context.Context, mode int) error {
+	d := &sqliteDialect{}
+	switch mode {
+	case WriteModeReplace:
+		if _, err := w.tx.ExecContext(ctx, "DROP TABLE IF EXISTS "+d.QuoteIdentifier(w.table)); err != nil {
+			return fmt.Errorf("failed to drop table: %w", err)
+		}
+		if _, err := w.tx.ExecContext(ctx, createTableSQL(d, w.table, w.columns)); err != nil {
+			return fmt.Errorf("failed to create table: %w", err)
+		}
+	case WriteModeAppend:
+		existing, err := tableColumns(ctx, w.tx, w.table)
+		if err != nil {
+			return err
+		}
+		if len(existing) == 0 {
+			if _, err := w.tx.ExecContext(ctx, createTableSQL(d, w.table, w.columns)); err != nil {
+				return fmt.Errorf("failed to create table: %w", err)
+			}
+		} else if err := checkAppendColumns(existing, w.columns); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported write mode: %d", mode)
+	}
+	return nil
+}
+
+// Append 写入一批数据行
+func (w *ExtractWriter) Append(ctx context.Context, rows [][]interface{}) error {
+	if w.done {
+		return fmt.Errorf("extract writer is closed")
+	}
+	return insertRows(ctx, w.tx, &sqliteDialect{}, w.table, w.columns, rows)
+}
+
+// Commit 提交全部写入
+func (w *ExtractWriter) Commit() error {
+	if w.done {
+		return fmt.Errorf("extract writer is closed")
+	}
+	w.done = true
+	defer w.store.mu.Unlock()
+	if err := w.tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit: %w", err)
+	}
+	return nil
+}
+
+// Rollback 放弃全部写入,已提交或已回滚时无操作
+func (w *ExtractWriter) Rollback() {
+	if w.done {
+		return
+	}
+	w.done = true
+	defer w.store.mu.Unlock()
+	_ = w.tx.Rollback()
+}
+
+// Columns 获取抽取表的列定义,表不存在时返回空
+func (s *ExtractStore) Columns(ctx context.Context, table string) ([]ExtractColumn, error) {
+	return tableColumns(ctx, s.db, table)
+}
+
+// DropTable 删除抽取表
+func (s *ExtractStore) DropTable(ctx context.Context, table string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d := &sqliteDialect{}
+	if _, err := s.db.ExecContext(ctx, "DROP TABLE IF EXISTS "+d.QuoteIdentifier(table)); err != nil {
+		return fmt.Errorf("failed to drop table: %w", err)
+	}
+	return nil
+}
+
+// Close 关闭抽取库
+func (s *ExtractStore) Close() error {
+	return s.db.Close()
+}
+
+// queryer 可执行查询的连接或事务
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// tableColumns 读取表的列定义
+func tableColumns(ctx context.Context, q queryer, table string) ([]ExtractColumn, error) {
+	rows, err := q.QueryContext(ctx, "SELECT name, type FROM pragma_table_info(?) ORDER BY cid", table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read table columns: %w", err)
+	}
+	defer rows.Close()
+
+	var columns []ExtractColumn
+	for rows.Next() {
+		var col ExtractColumn
+		if err := rows.Scan(&col.Name, &col.Type); err != nil {
+			return nil, err
+		}
+		columns = append(columns, col)
+	}
+	return columns, rows.Err()
+}
+
+// checkAppendColumns 追加写入时校验列名与已有表一致
+func checkAppendColumns(existing, columns []ExtractColumn) error {
+	if len(existing) != len(columns) {
+		return fmt.Errorf("column count mismatch: table has %d columns, got %d", len(existing), len(columns))
+	}
+	for i := range existing {
+		if existing[i].Name != columns[i].Name {
+			return fmt.Errorf("column %d mismatch: table has %q, got %q", i+1, existing[i].Name, columns[i].Name)
+		}
+	}
+	return nil
+}
+
+// createTableSQL 建表语句
+func createTableSQL(d Dialect, table string, columns []ExtractColumn) string {
+	defs := make([]string, len(columns))
+	for i, col := range columns {
+		colType := col.Type
+		switch colType {
+		case ExtractTypeInteger, ExtractTypeReal, ExtractTypeTimestamp:
+		default:
+			colType = ExtractTypeText
+		}
+		defs[i] = d.QuoteIdentifier(col.Name) + " " + colType
+	}
+	return fmt.Sprintf("CREATE TABLE %s (%s)", d.QuoteIdentifier(table), strings.Join(defs, ", "))
+}
+
+// insertBatchSize 单条 INSERT 语句写入的最大行数,按列数保证参数不超过上限
+func insertBatchSize(columns int) int {
+	return max(1, maxInsertVariables/max(1, columns))
+}
+
+// insertRows 分批写入数据行
+func insertRows(ctx context.Context, tx *sql.Tx, d Dialect, table string, columns []ExtractColumn, rows [][]interface{}) error {
+	names := make([]string, len(columns))
+	for i, col := range columns {
+		names[i] = d.QuoteIdentifier(col.Name)
+	}
+	rowPlaceholder := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ") + ")"
+	prefix := fmt.Sprintf("INSERT INTO %s (%s) VALUES ", d.QuoteIdentifier(table), strings.Join(names, ", "))
+
+	batchSize := insertBatchSize(len(columns))
+	for start := 0; start < len(rows); start += batchSize {
+		end := start + batchSize
+		if end > len(rows) {
+			end = len(rows)
+		}
+
+		placeholders := make([]string, 0, end-start)
+		args := make([]interface{}, 0, (end-start)*len(columns))
+		for _, row := range rows[start:end] {
+			if len(row) != len(columns) {
+				return fmt.Errorf("row has %d values, expected %d", len(row), len(columns))
+			}
+			placeholders = append(placeholders, rowPlaceholder)
+			args = append(args, row...)
+		}
+
+		if _, err := tx.ExecContext(ctx, prefix+strings.Join(placeholders, ", "), args...); err != nil {
+			return fmt.Errorf("failed to insert rows: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"cozy-insight-backend/pkg/logger"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestExtractStore(t *testing.T) *ExtractStore {
+	store, err := NewExtractStore(filepath.Join(t.TempDir(), "extract", "extract.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestExtractStore_ReplaceAndAppend(t *testing.T) {
+	store := newTestExtractStore(t)
+	ctx := context.Background()
+	columns := []ExtractColumn{{Name: "region", Type: ExtractTypeText}, {Name: "amount", Type: ExtractTypeReal}}
+
+	err := store.Write(ctx, "sales", columns, [][]interface{}{{"east", 1.5}, {"west", nil}}, WriteModeReplace)
+	require.NoError(t, err)
+
+	err = store.Write(ctx, "sales", columns, [][]interface{}{{"north", 3.0}}, WriteModeAppend)
+	require.NoError(t, err)
+
+	got, err := store.Columns(ctx, "sales")
+	require.NoError(t, err)
+	assert.Equal(t, columns, got)
+
+	var count int
+	require.NoError(t, store.db.QueryRow(`SELECT COUNT(*) FROM "sales"`).Scan(&count))
+	assert.Equal(t, 3, count)
+
+	// 替换模式整表覆盖
+	err = store.Write(ctx, "sales", []ExtractColumn{{Name: "city", Type: ExtractTypeText}}, [][]interface{}{{"a"}}, WriteModeReplace)
+	require.NoError(t, err)
+	require.NoError(t, store.db.QueryRow(`SELECT COUNT(*) FROM "sales"`).Scan(&count))
+	assert.Equal(t, 1, count)
+}
+
+func TestExtractStore_AppendColumnMismatch(t *testing.T) {
+	store := newTestExtractStore(t)
+	ctx := context.Background()
+
+	err := store.Write(ctx, "t", []ExtractColumn{{Name: "a"}}, [][]interface{}{{"x"}}, WriteModeReplace)
+	require.NoError(t, err)
+
+	err = store.Write(ctx, "t", []ExtractColumn{{Name: "b"}}, [][]interface{}{{"y"}}, WriteModeAppend)
+	assert.Error(t, err)
+
+	err = store.Write(ctx, "t", []ExtractColumn{{Name: "a"}, {Name: "b"}}, [][]interface{}{{"x", "y"}}, WriteModeAppend)
+	assert.Error(t, err)
+}
+
+func TestExtractStore_LargeBatchAndRollback(t *testing.T) {
+	store := newTestExtractStore(t)
+	ctx := context.Background()
+	columns := []ExtractColumn{{Name: "n", Type: ExtractTypeInteger}}
+
+	rows := make([][]interface{}, insertBatchSize(len(columns))*2+7)
+	for i := range rows {
+		rows[i] = []interface{}{i}
+	}
+	require.NoError(t, store.Write(ctx, "nums", columns, rows, WriteModeReplace))
+
+	// 行宽不一致时整体回滚,原表保持不变
+	err := store.Write(ctx, "nums", columns, [][]interface{}{{1, 2}}, WriteModeReplace)
+	assert.Error(t, err)
+
+	var count int
+	require.NoError(t, store.db.QueryRow(`SELECT COUNT(*) FROM "nums"`).Scan(&count))
+	assert.Equal(t, len(rows), count)
+}
+
+func TestExtractWriter_Batches(t *testing.T) {
+	store := newTestExtractStore(t)
+	ctx := context.Background()
+	columns := []ExtractColumn{{Name: "n", Type: ExtractTypeInteger}}
+	require.NoError(t, store.Write(ctx, "nums", columns, [][]interface{}{{0}}, WriteModeReplace))
+
+	count := func() int {
+		var n int
+		require.NoError(t, store.db.QueryRow(`SELECT COUNT(*) FROM "nums"`).Scan(&n))
+		return n
+	}
+
+	// 回滚时替换前的表保持不变
+	w, err := store.BeginWrite(ctx, "nums", columns, WriteModeReplace)
+	require.NoError(t, err)
+	require.NoError(t, w.Append(ctx, [][]interface{}{{1}, {2}}))
+	w.Rollback()
+	assert.Equal(t, 1, count())
+
+	w, err = store.BeginWrite(ctx, "nums", columns, WriteModeReplace)
+	require.NoError(t, err)
+	defer w.Rollback()
+	require.NoError(t, w.Append(ctx, [][]interface{}{{1}, {2}}))
+	require.NoError(t, w.Append(ctx, [][]interface{}{{3}}))
+	require.NoError(t, w.Commit())
+	assert.Equal(t, 3, count())
+	assert.Error(t, w.Append(ctx, [][]interface{}{{4}}))
+
+	_, err = store.BeginWrite(ctx, "nums", []ExtractColumn{{Name: "m"}}, WriteModeAppend)
+	assert.Error(t, err)
+	// 失败的 BeginWrite 不占用写锁
+	require.NoError(t, store.Write(ctx, "nums", columns, [][]interface{}{{4}}, WriteModeAppend))
+	assert.Equal(t, 4, count())
+}
+
+func TestExtractStore_WideSheet(t *testing.T) {
+	store := newTestExtractStore(t)
+	ctx := context.Background()
+
+	// 300 列时每批行数随列数缩小,单条语句参数不超过上限
+	columns := make([]ExtractColumn, 300)
+	for i := range columns {
+		columns[i] = ExtractColumn{Name: fmt.Sprintf("c%d", i), Type: ExtractTypeInteger}
+	}
+	rows := make([][]interface{}, 500)
+	for i := range rows {
+		rows[i] = make([]interface{}, len(columns))
+		for j := range rows[i] {
+			rows[i][j] = i
+		}
+	}
+	assert.Less(t, insertBatchSize(len(columns)), len(rows))
+	require.NoError(t, store.Write(ctx, "wide", columns, rows, WriteModeReplace))
+
+	var count, sum int
+	require.NoError(t, store.db.QueryRow(`SELECT COUNT(*), SUM("c299") FROM "wide"`).Scan(&count, &sum))
+	assert.Equal(t, len(rows), count)
+	assert.Equal(t, 499*500/2, sum)
+}
+
+func TestExtractStore_TargetReadableByRouter(t *testing.T) {
+	logger.InitLogger("error")
+	store := newTestExtractStore(t)
+	ctx := context.Background()
+	require.NoError(t, store.Write(ctx, "sales", []ExtractColumn{{Name: "region", Type: ExtractTypeText}}, [][]interface{}{{"east"}}, WriteModeReplace))
+
+	router := NewQueryRouter(NewNativeExecutor(NewConnectionManager(nil)))
+	result, err := router.Execute(ctx, store.Target(), &Query{Source: QuerySource{Table: "sales"}})
+	require.NoError(t, err)
+	assert.Equal(t, []map[string]interface{}{{"region": "east"}}, result.Rows)
+}
+
+func TestExtractStore_ReadableWithSQLiteDataDir(t *testing.T) {
+	logger.InitLogger("error")
+	store := newTestExtractStore(t)
+	ctx := context.Background()
+	require.NoError(t, store.Write(ctx, "sales", []ExtractColumn{{Name: "region", Type: ExtractTypeText}}, [][]interface{}{{"east"}}, WriteModeReplace))
+
+	// 抽取库在数据目录外且被列为禁止路径,内部读取不受影响
+	require.NoError(t, SetSQLiteDataDir(t.TempDir(), store.path))
+	t.Cleanup(func() {
+		sqlitePathMu.Lock()
+		sqliteDir, sqliteDenied = "", nil
+		sqlitePathMu.Unlock()
+	})
+
+	router := NewQueryRouter(NewNativeExecutor(NewConnectionManager(nil)))
+	result, err := router.Execute(ctx, store.Target(), &Query{Source: QuerySource{Table: "sales"}})
+	require.NoError(t, err)
+	assert.Equal(t, []map[string]interface{}{{"region": "east"}}, result.Rows)
+
+	// 用户数据源指向抽取库时仍被拒绝
+	target := *store.Target()
+	target.DatasourceID = "ds1"
+	_, err = router.Execute(ctx, &target, &Query{Source: QuerySource{Table: "sales"}})
+	assert.ErrorContains(t, err, "data directory")
+}
@@ -0,0 +1,418 @@
+package engine
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Query 结构化查询(中间表示)
+// 图表、预览、导出等查询统一先构建为 Query,再由 Build 按目标方言编译为 SQL 和绑定参数,
+// 字段名统一加引号,过滤值全部以参数形式传递,避免 SQL 注入
+type Query struct {
+	Source  QuerySource
+	Selects []SelectItem
+	Filters []Filter
+	GroupBy []string
+	OrderBy []OrderItem
+	Limit   int
+	Offset  int
+}
+
+// QuerySource 查询数据来源: 物理表、自定义SQL子查询或多表关联
+type QuerySource struct {
+	Table string        // 物理表名,支持 schema.table
+	SQL   string        // 自定义SQL,作为子查询使用
+	Args  []interface{} // 自定义SQL的绑定参数
+	Join  *JoinSource   // 多表关联,作为子查询使用
+
+	// Vars 自定义SQL中 ${name} 变量的值,编译时替换为绑定参数,切片值展开为多个参数
+	Vars map[string]interface{}
+
+	// Computed 非聚合计算字段,在数据来源外包一层子查询输出为普通列,可用于分组、过滤和排序
+	Computed []ComputedColumn
+
+	// Where 作用于数据来源的原始SQL条件(如行权限),在数据来源外包一层子查询过滤
+	Where string
+}
+
+// ComputedColumn 由表达式计算或时间分桶得到的列,Expr 和 Bucket 二选一
+type ComputedColumn struct {
+	Name   string
+	Expr   *Expression
+	Bucket *TimeBucket
+}
+
+// TimeBucket 时间维度分桶: 先换算时区,再按粒度截断
+type TimeBucket struct {
+	Field     string         // 时间列名
+	Expr      *Expression    // 时间类型的计算字段,设置时忽略 Field
+	Unit      string         // 截断粒度,取值同 TimeUnit 常量
+	WeekStart time.Weekday   // 周粒度的每周第一天,零值为周日
+	Location  *time.Location // 展示时区,为空或 UTC 时不换算
+}
+
+// sql 按目标方言编译分桶表达式
+func (b *TimeBucket) sql(d Dialect, args *[]interface{}) (string, error) {
+	expr := d.QuoteIdentifier(b.Field)
+	if b.Expr != nil {
+		sql, err := b.Expr.SQL(d, args)
+		if err != nil {
+			return "", err
+		}
+		expr = sql
+	} else if b.Field == "" {
+		return "", fmt.Errorf("time bucket field is required")
+	}
+
+	if b.Location != nil && b.Location != time.UTC {
+		converted, err := d.ConvertTimeZone(expr, b.Location)
+		if err != nil {
+			return "", err
+		}
+		expr = converted
+	}
+	if b.Unit == TimeUnitWeek {
+		return d.WeekTrunc(expr, b.WeekStart), nil
+	}
+	return d.DateTrunc(expr, b.Unit)
+}
+
+// SelectItem 查询列
+type SelectItem struct {
+	Field     string      // 字段名, "*" 仅可用于 COUNT
+	Aggregate string      // 聚合函数,取值同 Aggregate 常量
+	Expr      *Expression // 聚合计算字段的表达式,设置时忽略 Field
+	Alias     string
+
+	// OrderField FIRST、LAST 聚合的排序列(通常为时间列)
+	OrderField string
+}
+
+// Filter 过滤条件
+type Filter struct {
+	Field    string
+	Operator string // =, !=, >, <, >=, <=, LIKE, IN, PREFIX
+	Value    interface{}
+}
+
+// OrderItem 排序项,Field 为输出列名(别名)
+type OrderItem struct {
+	Field string
+	Desc  bool
+}
+
+// Build 按目标方言编译为 SQL 语句和绑定参数
+func (q *Query) Build(d Dialect) (string, []interface{}, error) {
+	if d == nil {
+		return "", nil, fmt.Errorf("dialect is required")
+	}
+
+	var args []interface{}
+
+	// 按SQL文本顺序编译,保证绑定参数与占位符一一对应
+	selectClause, err := q.buildSelect(d, &args)
+	if err != nil {
+		return "", nil, err
+	}
+
+	from, err := q.buildFrom(d, &args)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var sb strings.Builder
+	sb.WriteString("SELECT ")
+	sb.WriteString(selectClause)
+	sb.WriteString(" FROM ")
+	sb.WriteString(from)
+
+	if len(q.Filters) > 0 {
+		conditions := make([]string, 0, len(q.Filters))
+		for _, f := range q.Filters {
+			cond, err := buildFilter(d, f, &args)
+			if err != nil {
+				return "", nil, err
+			}
+			conditions = append(conditions, cond)
+		}
+		sb.WriteString(" WHERE ")
+		sb.WriteString(strings.Join(conditions, " AND "))
+	}
+
+	if len(q.GroupBy) > 0 {
+		groupBy := make([]string, 0, len(q.GroupBy))
+		for _, field := range q.GroupBy {
+			groupBy = append(groupBy, d.QuoteIdentifier(field))
+		}
+		sb.WriteString(" GROUP BY ")
+		sb.WriteString(strings.Join(groupBy, ", "))
+	}
+
+	if len(q.OrderBy) > 0 {
+		orderBy := make([]string, 0, len(q.OrderBy))
+		for _, item := range q.OrderBy {
+			direction := "ASC"
+			if item.Desc {
+				direction = "DESC"
+			}
+			orderBy = append(orderBy, d.QuoteIdentifier(item.Field)+" "+direction)
+		}
+		sb.WriteString(" ORDER BY ")
+		sb.WriteString(strings.Join(orderBy, ", "))
+	}
+
+	sb.WriteString(d.LimitOffset(q.Limit, q.Offset))
+
+	return sb.String(), args, nil
+}
+
+// buildFrom 构建 FROM 子句,有计算列时在数据来源外包一层输出计算列的子查询
+func (q *Query) buildFrom(d Dialect, args *[]interface{}) (string, error) {
+	if len(q.Source.Computed) == 0 {
+		return q.buildRelation(d, args, "")
+	}
+
+	columns := []string{d.QuoteIdentifier("src") + ".*"}
+	for _, c := range q.Source.Computed {
+		if c.Name == "" {
+			return "", fmt.Errorf("computed column name is required")
+		}
+		var sql string
+		var err error
+		switch {
+		case c.Bucket != nil:
+			sql, err = c.Bucket.sql(d, args)
+		case c.Expr != nil:
+			sql, err = c.Expr.SQL(d, args)
+		default:
+			err = fmt.Errorf("expression is required")
+		}
+		if err != nil {
+			return "", fmt.Errorf("computed column %s: %w", c.Name, err)
+		}
+		columns = append(columns, sql+" AS "+d.QuoteIdentifier(c.Name))
+	}
+	relation, err := q.buildRelation(d, args, "src")
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("(SELECT %s FROM %s) AS %s", strings.Join(columns, ", "), relation, d.QuoteIdentifier("base")), nil
+}
+
+// buildRelation 构建数据来源,子查询默认别名为 base,物理表仅在指定别名时加别名
+// 数据来源带原始条件时外包一层过滤子查询
+func (q *Query) buildRelation(d Dialect, args *[]interface{}, alias string) (string, error) {
+	if q.Source.Where == "" {
+		return q.buildSourceRelation(d, args, alias)
+	}
+	relation, err := q.buildSourceRelation(d, args, "")
+	if err != nil {
+		return "", err
+	}
+	if q.Source.Table != "" {
+		relation += " AS " + d.QuoteIdentifier("src_where")
+	}
+	return fmt.Sprintf("(SELECT * FROM %s WHERE (%s)) AS %s", relation, q.Source.Where, d.QuoteIdentifier(defaultAlias(alias))), nil
+}
+
+// buildSourceRelation 构建不带原始条件的数据来源
+func (q *Query) buildSourceRelation(d Dialect, args *[]interface{}, alias string) (string, error) {
+	switch {
+	case q.Source.Table != "":
+		if alias != "" {
+			return quoteTableName(d, q.Source.Table) + " AS " + d.QuoteIdentifier(alias), nil
+		}
+		return quoteTableName(d, q.Source.Table), nil
+	case q.Source.SQL != "":
+		sql, err := buildSQLSource(d, q.Source, args)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("(%s) AS %s", sql, d.QuoteIdentifier(defaultAlias(alias))), nil
+	case q.Source.Join != nil:
+		sql, err := q.Source.Join.build(d, args)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("(%s) AS %s", sql, d.QuoteIdentifier(defaultAlias(alias))), nil
+	default:
+		return "", fmt.Errorf("query source is required")
+	}
+}
+
+func defaultAlias(alias string) string {
+	if alias == "" {
+		return "base"
+	}
+	return alias
+}
+
+// hasExpressions 是否包含计算字段表达式
+func (q *Query) hasExpressions() bool {
+	if len(q.Source.Computed) > 0 {
+		return true
+	}
+	for _, item := range q.Selects {
+		if item.Expr != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// buildSelect 构建 SELECT 子句
+func (q *Query) buildSelect(d Dialect, args *[]interface{}) (string, error) {
+	if len(q.Selects) == 0 {
+		return "*", nil
+	}
+
+	items := make([]string, 0, len(q.Selects))
+	for _, item := range q.Selects {
+		var expr string
+		var err error
+		if item.Expr != nil {
+			expr, err = buildExprSelectItem(d, item, args)
+		} else {
+			expr, err = buildSelectItem(d, item)
+		}
+		if err != nil {
+			return "", err
+		}
+		items = append(items, expr)
+	}
+	return strings.Join(items, ", "), nil
+}
+
+// buildExprSelectItem 构建表达式查询列,非聚合表达式可再套一层聚合函数
+func buildExprSelectItem(d Dialect, item SelectItem, args *[]interface{}) (string, error) {
+	if item.Alias == "" {
+		return "", fmt.Errorf("expression column requires an alias")
+	}
+	bound := len(*args)
+	expr, err := item.Expr.SQL(d, args)
+	if err != nil {
+		return "", fmt.Errorf("expression column %s: %w", item.Alias, err)
+	}
+	if item.Aggregate != "" {
+		if item.Expr.Aggregated {
+			return "", fmt.Errorf("expression column %s is already aggregated", item.Alias)
+		}
+		// 扩展聚合可能多次引用表达式,带绑定参数的表达式需先作为计算列输出
+		if extendedAggregates[strings.ToUpper(item.Aggregate)] && len(*args) > bound {
+			return "", fmt.Errorf("aggregate %s on expression column %s with parameters requires a computed column", item.Aggregate, item.Alias)
+		}
+		expr, err = buildAggregate(d, item.Aggregate, expr, orderExpr(d, item))
+		if err != nil {
+			return "", err
+		}
+	}
+	return expr + " AS " + d.QuoteIdentifier(item.Alias), nil
+}
+
+// buildSelectItem 构建单个查询列
+func buildSelectItem(d Dialect, item SelectItem) (string, error) {
+	if item.Field == "" {
+		return "", fmt.Errorf("select field is required")
+	}
+
+	var expr string
+	if item.Aggregate == "" {
+		if item.Field == "*" {
+			return "", fmt.Errorf("'*' can only be used with COUNT")
+		}
+		expr = d.QuoteIdentifier(item.Field)
+	} else {
+		if item.Field == "*" {
+			if strings.ToUpper(item.Aggregate) != AggregateCount {
+				return "", fmt.Errorf("'*' can only be used with COUNT")
+			}
+			expr = "COUNT(*)"
+		} else {
+			var err error
+			expr, err = buildAggregate(d, item.Aggregate, d.QuoteIdentifier(item.Field), orderExpr(d, item))
+			if err != nil {
+				return "", err
+			}
+		}
+	}
+
+	if item.Alias != "" && (item.Aggregate != "" || item.Alias != item.Field) {
+		expr += " AS " + d.QuoteIdentifier(item.Alias)
+	}
+	return expr, nil
+}
+
+// orderExpr FIRST、LAST 聚合的排序表达式
+func orderExpr(d Dialect, item SelectItem) string {
+	if item.OrderField == "" {
+		return ""
+	}
+	return d.QuoteIdentifier(item.OrderField)
+}
+
+// buildFilter 构建过滤条件,值以占位符绑定
+func buildFilter(d Dialect, f Filter, args *[]interface{}) (string, error) {
+	if f.Field == "" {
+		return "", fmt.Errorf("filter field is required")
+	}
+	field := d.QuoteIdentifier(f.Field)
+
+	switch op := strings.ToUpper(strings.TrimSpace(f.Operator)); op {
+	case "=", "!=", ">", "<", ">=", "<=":
+		return fmt.Sprintf("%s %s %s", field, op, bindArg(d, args, f.Value)), nil
+	case "LIKE":
+		return fmt.Sprintf("%s LIKE %s", field, bindArg(d, args, fmt.Sprintf("%%%v%%", f.Value))), nil
+	case "IN":
+		values := toValueList(f.Value)
+		if len(values) == 0 {
+			return "", fmt.Errorf("IN filter on %s requires at least one value", f.Field)
+		}
+		placeholders := make([]string, len(values))
+		for i, v := range values {
+			placeholders[i] = bindArg(d, args, v)
+		}
+		return fmt.Sprintf("%s IN (%s)", field, strings.Join(placeholders, ", ")), nil
+	case "PREFIX":
+		// 不区分大小写的前缀匹配,按字符截取比较,避免转义 LIKE 通配符
+		prefix := strings.ToLower(fmt.Sprint(f.Value))
+		head, err := d.StringFunc(StringFuncSubstring, field, "1", strconv.Itoa(utf8.RuneCountInString(prefix)))
+		if err != nil {
+			return "", err
+		}
+		lower, err := d.StringFunc(StringFuncLower, head)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s = %s", lower, bindArg(d, args, prefix)), nil
+	default:
+		return "", fmt.Errorf("unsupported filter operator: %s", f.Operator)
+	}
+}
+
+// bindArg 追加绑定参数并返回对应的占位符
+func bindArg(d Dialect, args *[]interface{}, value interface{}) string {
+	*args = append(*args, value)
+	return d.Placeholder(len(*args))
+}
+
+// toValueList 将切片类型的过滤值展开为列表,非切片值视为单个值
+func toValueList(value interface{}) []interface{} {
+	if value == nil {
+		return nil
+	}
+
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return []interface{}{value}
+	}
+
+	values := make([]interface{}, rv.Len())
+	for i := 0; i < rv.Len(); i++ {
+		values[i] = rv.Index(i).Interface()
+	}
+	return values
+}
@@ -0,0 +1,192 @@
+package engine
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// 执行路径
+const (
+	ExecPathNative  = "native"
+	ExecPathCalcite = "calcite"
+)
+
+// QueryExecutor 查询执行器,负责在某一路径上执行已编译的SQL
+type QueryExecutor interface {
+	// Name 执行路径名称
+	Name() string
+	// Supports 是否可以执行该目标的查询
+	Supports(target *QueryTarget) bool
+	// Dialect 编译该目标查询时使用的方言
+	Dialect(target *QueryTarget) (Dialect, error)
+	// Execute 执行SQL并返回结果行
+	Execute(ctx context.Context, target *QueryTarget, sql string, args ...interface{}) ([]map[string]interface{}, error)
+}
+
+// ResultColumn 结果列元数据,取自驱动的 sql.ColumnType
+type ResultColumn struct {
+	Name         string
+	DatabaseType string // 驱动报告的数据库类型名,表达式列等无法确定时为空
+	Precision    int64  // 数值精度或字符长度,未知时为 0
+	Scale        int64  // 数值小数位数,未知时为 0
+	Nullable     bool   // 驱动未提供时视为可空
+}
+
+// ColumnExecutor 可同时返回结果列元数据的执行器,列按查询输出顺序排列
+type ColumnExecutor interface {
+	ExecuteColumns(ctx context.Context, target *QueryTarget, sql string, args ...interface{}) ([]map[string]interface{}, []ResultColumn, error)
+}
+
+// nativeExecutor 通过数据源自身的 database/sql 驱动直连执行
+type nativeExecutor struct {
+	pools *ConnectionManager
+}
+
+// NewNativeExecutor 创建直连执行器
+func NewNativeExecutor(pools *ConnectionManager) QueryExecutor {
+	return &nativeExecutor{pools: pools}
+}
+
+func (e *nativeExecutor) Name() string { return ExecPathNative }
+
+func (e *nativeExecutor) Supports(target *QueryTarget) bool {
+	if e.pools == nil || target.Federated || target.DatasourceID == "" {
+		return false
+	}
+	if _, err := GetDialect(target.DatasourceType); err != nil {
+		return false
+	}
+	return driverRegistered(driverName(target.DatasourceType))
+}
+
+func (e *nativeExecutor) Dialect(target *QueryTarget) (Dialect, error) {
+	return GetDialect(target.DatasourceType)
+}
+
+func (e *nativeExecutor) Execute(ctx context.Context, target *QueryTarget, query string, args ...interface{}) ([]map[string]interface{}, error) {
+	result, _, err := e.ExecuteColumns(ctx, target, query, args...)
+	return result, err
+}
+
+func (e *nativeExecutor) ExecuteColumns(ctx context.Context, target *QueryTarget, query string, args ...interface{}) ([]map[string]interface{}, []ResultColumn, error) {
+	db, _, release, err := e.pools.Get(target.DatasourceID, target.DatasourceType, target.Configuration, "")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer release()
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("query execution failed: %w", err)
+	}
+	defer rows.Close()
+
+	columns, err := resultColumns(rows)
+	if err != nil {
+		return nil, nil, err
+	}
+	result, err := scanRows(rows)
+	if err != nil {
+		return nil, nil, err
+	}
+	return result, columns, nil
+}
+
+// calciteExecutor 通过 Avatica 交给 Calcite 执行,可处理联邦查询
+type calciteExecutor struct {
+	client *CalciteClient
+}
+
+// NewCalciteExecutor 创建 Calcite 执行器,client 为 nil 时视为不可用
+func NewCalciteExecutor(client *CalciteClient) QueryExecutor {
+	return &calciteExecutor{client: client}
+}
+
+func (e *calciteExecutor) Name() string { return ExecPathCalcite }
+
+func (e *calciteExecutor) Supports(target *QueryTarget) bool {
+	return e.client != nil
+}
+
+func (e *calciteExecutor) Dialect(target *QueryTarget) (Dialect, error) {
+	return GetDialect(DialectCalcite)
+}
+
+func (e *calciteExecutor) Execute(ctx context.Context, target *QueryTarget, query string, args ...interface{}) ([]map[string]interface{}, error) {
+	return e.client.ExecuteQuery(ctx, query, args...)
+}
+
+func (e *calciteExecutor) ExecuteColumns(ctx context.Context, target *QueryTarget, query string, args ...interface{}) ([]map[string]interface{}, []ResultColumn, error) {
+	return e.client.ExecuteQueryColumns(ctx, query, args...)
+}
+
+// driverRegistered 判断 database/sql 驱动是否已注册
+func driverRegistered(name string) bool {
+	for _, d := range sql.Drivers() {
+		if d == name {
+			return true
+		}
+	}
+	return false
+}
+
+// resultColumns 读取结果列元数据
+func resultColumns(rows *sql.Rows) ([]ResultColumn, error) {
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get column types: %w", err)
+	}
+
+	columns := make([]ResultColumn, len(types))
+	for i, ct := range types {
+		col := ResultColumn{Name: ct.Name(), DatabaseType: ct.DatabaseTypeName(), Nullable: true}
+		if precision, scale, ok := ct.DecimalSize(); ok {
+			col.Precision, col.Scale = precision, scale
+		} else if length, ok := ct.Length(); ok {
+			col.Precision = length
+		}
+		if nullable, ok := ct.Nullable(); ok {
+			col.Nullable = nullable
+		}
+		columns[i] = col
+	}
+	return columns, nil
+}
+
+// scanRows 将查询结果转换为 map 数组,字节数组转为字符串
+func scanRows(rows *sql.Rows) ([]map[string]interface{}, error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get columns: %w", err)
+	}
+
+	var result []map[string]interface{}
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		valuePtrs := make([]interface{}, len(columns))
+		for i := range values {
+			valuePtrs[i] = &values[i]
+		}
+
+		if err := rows.Scan(valuePtrs...); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+
+		row := make(map[string]interface{}, len(columns))
+		for i, col := range columns {
+			if b, ok := values[i].([]byte); ok {
+				row[col] = string(b)
+			} else {
+				row[col] = values[i]
+			}
+		}
+		result = append(result, row)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,136 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+)
+
+// 关联类型
+const (
+	JoinLeft  = "LEFT"
+	JoinRight = "RIGHT"
+	JoinInner = "INNER"
+	JoinFull  = "FULL"
+)
+
+// JoinSource 多表关联来源,Tables[0] 为主表,其余表按顺序关联到之前出现的表
+// 编译为只输出 Columns 的子查询,外层查询按列别名引用字段
+type JoinSource struct {
+	Tables  []JoinTable
+	Columns []JoinColumn
+}
+
+// JoinTable 参与关联的表
+type JoinTable struct {
+	Alias  string          // 表别名,在关联内唯一
+	Source QuerySource     // 物理表或自定义SQL,不支持嵌套关联
+	Type   string          // LEFT, RIGHT, INNER, FULL,主表为空
+	On     []JoinCondition // 关联条件,多个条件以 AND 连接
+}
+
+// JoinCondition 关联条件: 之前出现的表 Table 的 Field 等于当前表的 CurrentField
+type JoinCondition struct {
+	Table        string
+	Field        string
+	CurrentField string
+}
+
+// JoinColumn 关联结果的输出列
+type JoinColumn struct {
+	Table string // 表别名
+	Field string
+	Alias string
+}
+
+// build 编译为 SELECT ... FROM ... JOIN ... 语句
+func (j *JoinSource) build(d Dialect, args *[]interface{}) (string, error) {
+	if len(j.Tables) == 0 {
+		return "", fmt.Errorf("join requires at least one table")
+	}
+	if len(j.Columns) == 0 {
+		return "", fmt.Errorf("join requires at least one column")
+	}
+
+	seen := make(map[string]bool, len(j.Tables))
+	var from strings.Builder
+	for i, table := range j.Tables {
+		if table.Alias == "" {
+			return "", fmt.Errorf("join table alias is required")
+		}
+		if seen[table.Alias] {
+			return "", fmt.Errorf("duplicate join table alias: %s", table.Alias)
+		}
+
+		source, err := buildJoinTableSource(d, table, args)
+		if err != nil {
+			return "", err
+		}
+		if i == 0 {
+			from.WriteString(source)
+			seen[table.Alias] = true
+			continue
+		}
+
+		joinType := strings.ToUpper(table.Type)
+		switch joinType {
+		case JoinLeft, JoinRight, JoinInner:
+		case JoinFull:
+			if d.Name() == DialectMySQL {
+				return "", fmt.Errorf("full join is not supported by %s", d.Name())
+			}
+		default:
+			return "", fmt.Errorf("unsupported join type: %s", table.Type)
+		}
+		if len(table.On) == 0 {
+			return "", fmt.Errorf("join of %s requires at least one condition", table.Alias)
+		}
+		conditions := make([]string, 0, len(table.On))
+		for _, on := range table.On {
+			if !seen[on.Table] {
+				return "", fmt.Errorf("join condition references unknown table: %s", on.Table)
+			}
+			if on.Field == "" || on.CurrentField == "" {
+				return "", fmt.Errorf("join condition field is required")
+			}
+			conditions = append(conditions, fmt.Sprintf("%s.%s = %s.%s",
+				d.QuoteIdentifier(on.Table), d.QuoteIdentifier(on.Field),
+				d.QuoteIdentifier(table.Alias), d.QuoteIdentifier(on.CurrentField)))
+		}
+		fmt.Fprintf(&from, " %s JOIN %s ON %s", joinType, source, strings.Join(conditions, " AND "))
+		seen[table.Alias] = true
+	}
+
+	columns := make([]string, 0, len(j.Columns))
+	for _, col := range j.Columns {
+		if !seen[col.Table] {
+			return "", fmt.Errorf("join column references unknown table: %s", col.Table)
+		}
+		if col.Field == "" {
+			return "", fmt.Errorf("join column field is required")
+		}
+		expr := d.QuoteIdentifier(col.Table) + "." + d.QuoteIdentifier(col.Field)
+		if col.Alias != "" {
+			expr += " AS " + d.QuoteIdentifier(col.Alias)
+		}
+		columns = append(columns, expr)
+	}
+
+	return "SELECT " + strings.Join(columns, ", ") + " FROM " + from.String(), nil
+}
+
+// buildJoinTableSource 构建关联中单个表的来源及别名
+func buildJoinTableSource(d Dialect, table JoinTable, args *[]interface{}) (string, error) {
+	alias := d.QuoteIdentifier(table.Alias)
+	switch {
+	case table.Source.Table != "":
+		return quoteTableName(d, table.Source.Table) + " AS " + alias, nil
+	case table.Source.SQL != "":
+		sql, err := buildSQLSource(d, table.Source, args)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("(%s) AS %s", sql, alias), nil
+	default:
+		return "", fmt.Errorf("join table %s requires a table or sql source", table.Alias)
+	}
+}
@@ -0,0 +1,148 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"cozy-insight-backend/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// QueryTarget 查询目标,描述数据集所在的数据源
+type QueryTarget struct {
+	DatasourceID   string
+	DatasourceType string
+	Configuration  string
+	Federated      bool // 跨数据源查询,只能由 Calcite 执行
+}
+
+// QueryResult 查询结果及实际使用的执行路径
+type QueryResult struct {
+	Rows     []map[string]interface{}
+	Columns  []ResultColumn // 结果列元数据,执行路径不提供时为空
+	Path     string         // native, document, calcite
+	Fallback bool           // 首选路径失败后由备用路径执行
+}
+
+// QueryRouter 查询路由器,为每个查询选择执行器并在失败时自动切换
+// 单数据源查询优先直连执行,Calcite 作为备用;联邦查询只走 Calcite
+type QueryRouter struct {
+	executors []QueryExecutor
+	timeZones sync.Map // 已确认加载了时区表的 MySQL 数据源和时区
+}
+
+// NewQueryRouter 创建查询路由器,executors 按优先级排列
+func NewQueryRouter(executors ...QueryExecutor) *QueryRouter {
+	return &QueryRouter{executors: executors}
+}
+
+// Execute 按目标选择执行器,分别以各自方言编译并执行查询
+func (r *QueryRouter) Execute(ctx context.Context, target *QueryTarget, query *Query) (*QueryResult, error) {
+	if target == nil {
+		target = &QueryTarget{Federated: true}
+	}
+
+	candidates := r.candidates(target)
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("no query executor available for datasource %q", target.DatasourceID)
+	}
+
+	var errs []string
+	for i, executor := range candidates {
+		rows, columns, err := r.executeOn(ctx, executor, target, query)
+		if err == nil {
+			return &QueryResult{Rows: rows, Columns: columns, Path: executor.Name(), Fallback: i > 0}, nil
+		}
+
+		errs = append(errs, fmt.Sprintf("%s: %v", executor.Name(), err))
+		if i < len(candidates)-1 {
+			logger.Log.Warn("query executor failed, falling back",
+				zap.String("path", executor.Name()),
+				zap.String("next", candidates[i+1].Name()),
+				zap.String("datasourceId", target.DatasourceID),
+				zap.Error(err))
+		}
+	}
+
+	return nil, fmt.Errorf("query failed on all executors: %s", strings.Join(errs, "; "))
+}
+
+// candidates 可执行该目标的执行器
+func (r *QueryRouter) candidates(target *QueryTarget) []QueryExecutor {
+	var result []QueryExecutor
+	for _, executor := range r.executors {
+		if executor != nil && executor.Supports(target) {
+			result = append(result, executor)
+		}
+	}
+	return result
+}
+
+// executeOn 以执行器对应的方言编译查询并执行,执行器支持时一并返回结果列元数据
+func (r *QueryRouter) executeOn(ctx context.Context, executor QueryExecutor, target *QueryTarget, query *Query) ([]map[string]interface{}, []ResultColumn, error) {
+	// 文档数据源等直接执行结构化查询
+	if planner, ok := executor.(PlanExecutor); ok {
+		logger.Log.Debug("executing query plan",
+			zap.String("path", executor.Name()),
+			zap.String("source", query.Source.Table))
+		return planner.ExecuteQuery(ctx, target, query)
+	}
+
+	dialect, err := executor.Dialect(target)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := r.checkTimeZones(ctx, executor, target, dialect, query); err != nil {
+		return nil, nil, err
+	}
+	sql, args, err := query.Build(dialect)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	logger.Log.Debug("executing query",
+		zap.String("path", executor.Name()),
+		zap.String("sql", sql),
+		zap.Int("args", len(args)))
+
+	if ce, ok := executor.(ColumnExecutor); ok {
+		return ce.ExecuteColumns(ctx, target, sql, args...)
+	}
+	rows, err := executor.Execute(ctx, target, sql, args...)
+	return rows, nil, err
+}
+
+// checkTimeZones MySQL 按名称换算时区依赖时区表,未加载时 CONVERT_TZ 返回 NULL,
+// 时间分桶会静默为空;执行前按数据源和时区探测一次,未加载时返回错误
+func (r *QueryRouter) checkTimeZones(ctx context.Context, executor QueryExecutor, target *QueryTarget, dialect Dialect, query *Query) error {
+	if dialect.Name() != DialectMySQL {
+		return nil
+	}
+	for _, c := range query.Source.Computed {
+		if c.Bucket == nil || c.Bucket.Location == nil || c.Bucket.Location == time.UTC {
+			continue
+		}
+		loc := c.Bucket.Location
+		if _, err := fixedOffsetMinutes(dialect.Name(), loc); err == nil {
+			continue
+		}
+		key := target.DatasourceID + "\x00" + loc.String()
+		if _, ok := r.timeZones.Load(key); ok {
+			continue
+		}
+		rows, err := executor.Execute(ctx, target, "SELECT CONVERT_TZ('2000-01-01 00:00:00', '+00:00', ?) AS converted", loc.String())
+		if err != nil {
+			return fmt.Errorf("failed to check time zone %s: %w", loc, err)
+		}
+		if len(rows) == 0 || rows[0]["converted"] == nil {
+			return fmt.Errorf("time zone %s is not loaded in MySQL, load the time zone tables (mysql_tzinfo_to_sql) or use a fixed offset time zone", loc)
+		}
+		r.timeZones.Store(key, true)
+	}
+	return nil
+}
@@ -0,0 +1,207 @@
+package engine
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"cozy-insight-backend/pkg/logger"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeExecutor 用于测试的执行器
+type fakeExecutor struct {
+	name      string
+	dialect   string
+	supported bool
+	err       error
+	gotSQL    string
+	gotArgs   []interface{}
+}
+
+func (e *fakeExecutor) Name() string { return e.name }
+
+func (e *fakeExecutor) Supports(target *QueryTarget) bool { return e.supported }
+
+func (e *fakeExecutor) Dialect(target *QueryTarget) (Dialect, error) { return GetDialect(e.dialect) }
+
+func (e *fakeExecutor) Execute(ctx context.Context, target *QueryTarget, sql string, args ...interface{}) ([]map[string]interface{}, error) {
+	e.gotSQL = sql
+	e.gotArgs = args
+	if e.err != nil {
+		return nil, e.err
+	}
+	return []map[string]interface{}{{"path": e.name}}, nil
+}
+
+func routerTestQuery() *Query {
+	return &Query{
+		Source:  QuerySource{Table: "orders"},
+		Filters: []Filter{{Field: "region", Operator: "=", Value: "east"}},
+		Limit:   10,
+	}
+}
+
+func TestQueryRouter_PrefersFirstExecutor(t *testing.T) {
+	logger.InitLogger("error")
+	native := &fakeExecutor{name: ExecPathNative, dialect: DialectPostgreSQL, supported: true}
+	calcite := &fakeExecutor{name: ExecPathCalcite, dialect: DialectCalcite, supported: true}
+	router := NewQueryRouter(native, calcite)
+
+	result, err := router.Execute(context.Background(), &QueryTarget{DatasourceID: "ds1"}, routerTestQuery())
+	assert.NoError(t, err)
+	assert.Equal(t, ExecPathNative, result.Path)
+	assert.False(t, result.Fallback)
+	assert.Equal(t, `SELECT * FROM "orders" WHERE "region" = $1 LIMIT 10`, native.gotSQL)
+	assert.Empty(t, calcite.gotSQL)
+}
+
+func TestQueryRouter_FallbackRebuildsForDialect(t *testing.T) {
+	logger.InitLogger("error")
+	native := &fakeExecutor{name: ExecPathNative, dialect: DialectMySQL, supported: true, err: errors.New("connection refused")}
+	calcite := &fakeExecutor{name: ExecPathCalcite, dialect: DialectCalcite, supported: true}
+	router := NewQueryRouter(native, calcite)
+
+	result, err := router.Execute(context.Background(), &QueryTarget{DatasourceID: "ds1"}, routerTestQuery())
+	assert.NoError(t, err)
+	assert.Equal(t, ExecPathCalcite, result.Path)
+	assert.True(t, result.Fallback)
+	assert.Equal(t, "SELECT * FROM `orders` WHERE `region` = ? LIMIT 10", native.gotSQL)
+	assert.Equal(t, `SELECT * FROM "orders" WHERE "region" = ? LIMIT 10`, calcite.gotSQL)
+	assert.Equal(t, []interface{}{"east"}, calcite.gotArgs)
+}
+
+func TestQueryRouter_SkipsUnsupportedExecutor(t *testing.T) {
+	logger.InitLogger("error")
+	native := &fakeExecutor{name: ExecPathNative, dialect: DialectMySQL, supported: false}
+	calcite := &fakeExecutor{name: ExecPathCalcite, dialect: DialectCalcite, supported: true}
+	router := NewQueryRouter(native, calcite)
+
+	result, err := router.Execute(context.Background(), &QueryTarget{Federated: true}, routerTestQuery())
+	assert.NoError(t, err)
+	assert.Equal(t, ExecPathCalcite, result.Path)
+	assert.False(t, result.Fallback)
+	assert.Empty(t, native.gotSQL)
+}
+
+func TestQueryRouter_AllExecutorsFail(t *testing.T) {
+	logger.InitLogger("error")
+	native := &fakeExecutor{name: ExecPathNative, dialect: DialectMySQL, supported: true, err: errors.New("native down")}
+	calcite := &fakeExecutor{name: ExecPathCalcite, dialect: DialectCalcite, supported: true, err: errors.New("avatica down")}
+	router := NewQueryRouter(native, calcite)
+
+	_, err := router.Execute(context.Background(), &QueryTarget{DatasourceID: "ds1"}, routerTestQuery())
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "native down")
+	assert.Contains(t, err.Error(), "avatica down")
+}
+
+func TestQueryRouter_NoExecutorAvailable(t *testing.T) {
+	router := NewQueryRouter(NewCalciteExecutor(nil))
+
+	_, err := router.Execute(context.Background(), &QueryTarget{Federated: true}, routerTestQuery())
+	assert.Error(t, err)
+}
+
+func TestNativeExecutor_Supports(t *testing.T) {
+	executor := NewNativeExecutor(NewConnectionManager(nil))
+
+	assert.True(t, executor.Supports(&QueryTarget{DatasourceID: "ds1", DatasourceType: DialectMySQL}))
+	assert.False(t, executor.Supports(&QueryTarget{DatasourceID: "ds1", DatasourceType: DialectMySQL, Federated: true}))
+	assert.False(t, executor.Supports(&QueryTarget{DatasourceType: DialectMySQL}))
+	assert.False(t, executor.Supports(&QueryTarget{DatasourceID: "ds1", DatasourceType: "oracle"}))
+}
+
+func TestQueryRouter_ReturnsResultColumns(t *testing.T) {
+	logger.InitLogger("error")
+	path := filepath.Join(t.TempDir(), "columns.db")
+	db, err := sql.Open("sqlite3", path)
+	require.NoError(t, err)
+	_, err = db.Exec(`CREATE TABLE items (code TEXT, qty INTEGER, price DECIMAL(10,2), created DATETIME)`)
+	require.NoError(t, err)
+	db.Close()
+
+	router := NewQueryRouter(NewNativeExecutor(NewConnectionManager(nil)))
+	target := &QueryTarget{DatasourceID: "ds1", DatasourceType: DialectSQLite, Configuration: fmt.Sprintf(`{"path":%q}`, path)}
+	result, err := router.Execute(context.Background(), target, &Query{Source: QuerySource{Table: "items"}})
+	require.NoError(t, err)
+
+	// 空表也能取得列元数据,顺序与查询输出一致
+	assert.Empty(t, result.Rows)
+	require.Len(t, result.Columns, 4)
+	var names, types []string
+	for _, col := range result.Columns {
+		names = append(names, col.Name)
+		types = append(types, col.DatabaseType)
+	}
+	assert.Equal(t, []string{"code", "qty", "price", "created"}, names)
+	assert.Equal(t, []string{"TEXT", "INTEGER", "DECIMAL(10,2)", "DATETIME"}, types)
+}
+
+// tzExecutor 模拟 MySQL: loaded 中的时区已加载时区表
+type tzExecutor struct {
+	fakeExecutor
+	loaded map[string]bool
+	probes int
+}
+
+func (e *tzExecutor) Execute(ctx context.Context, target *QueryTarget, sql string, args ...interface{}) ([]map[string]interface{}, error) {
+	if strings.HasPrefix(sql, "SELECT CONVERT_TZ(") {
+		e.probes++
+		if e.loaded[args[0].(string)] {
+			return []map[string]interface{}{{"converted": "2000-01-01 01:00:00"}}, nil
+		}
+		return []map[string]interface{}{{"converted": nil}}, nil
+	}
+	return e.fakeExecutor.Execute(ctx, target, sql, args...)
+}
+
+func TestQueryRouter_ChecksMySQLTimeZones(t *testing.T) {
+	logger.InitLogger("error")
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+	newYork, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+	bucketQuery := func(loc *time.Location) *Query {
+		return &Query{
+			Source: QuerySource{Table: "orders", Computed: []ComputedColumn{
+				{Name: "month", Bucket: &TimeBucket{Field: "created_at", Unit: TimeUnitMonth, Location: loc}},
+			}},
+			Selects: []SelectItem{{Field: "month", Alias: "month"}},
+			GroupBy: []string{"month"},
+		}
+	}
+
+	executor := &tzExecutor{
+		fakeExecutor: fakeExecutor{name: ExecPathNative, dialect: DialectMySQL, supported: true},
+		loaded:       map[string]bool{"Europe/Berlin": true},
+	}
+	router := NewQueryRouter(executor)
+	target := &QueryTarget{DatasourceID: "ds1"}
+
+	// 已加载的时区只探测一次
+	for i := 0; i < 2; i++ {
+		_, err = router.Execute(context.Background(), target, bucketQuery(berlin))
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 1, executor.probes)
+	assert.Contains(t, executor.gotSQL, "CONVERT_TZ(`created_at`, '+00:00', 'Europe/Berlin')")
+
+	// 未加载时区表时报错,而不是返回空分桶
+	_, err = router.Execute(context.Background(), target, bucketQuery(newYork))
+	assert.ErrorContains(t, err, "America/New_York is not loaded")
+
+	// 固定偏移时区无需时区表
+	shanghai, err := time.LoadLocation("Asia/Shanghai")
+	require.NoError(t, err)
+	_, err = router.Execute(context.Background(), target, bucketQuery(shanghai))
+	require.NoError(t, err)
+	assert.Equal(t, 2, executor.probes)
+}
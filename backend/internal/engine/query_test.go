@@ -0,0 +1,243 @@
+package engine
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuery_Build(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    Query
+		wantSQL  string
+		wantArgs []interface{}
+	}{
+		{
+			name:    "table preview",
+			query:   Query{Source: QuerySource{Table: "orders"}, Limit: 10},
+			wantSQL: `SELECT * FROM "orders" LIMIT 10`,
+		},
+		{
+			name:    "schema qualified table",
+			query:   Query{Source: QuerySource{Table: "sales.orders"}},
+			wantSQL: `SELECT * FROM "sales"."orders"`,
+		},
+		{
+			name: "sql source with args",
+			query: Query{
+				Source:  QuerySource{SQL: "SELECT * FROM t WHERE region = ?", Args: []interface{}{"east"}},
+				Filters: []Filter{{Field: "amount", Operator: ">=", Value: 10}},
+				Limit:   5,
+				Offset:  10,
+			},
+			wantSQL:  `SELECT * FROM (SELECT * FROM t WHERE region = ?) AS "base" WHERE "amount" >= ? LIMIT 5 OFFSET 10`,
+			wantArgs: []interface{}{"east", 10},
+		},
+		{
+			name: "aggregate with group and order",
+			query: Query{
+				Source: QuerySource{Table: "sales"},
+				Selects: []SelectItem{
+					{Field: "region", Alias: "region"},
+					{Field: "amount", Aggregate: "sum", Alias: "total"},
+					{Field: "*", Aggregate: "COUNT", Alias: "count"},
+				},
+				GroupBy: []string{"region"},
+				OrderBy: []OrderItem{{Field: "total", Desc: true}},
+			},
+			wantSQL: `SELECT "region", SUM("amount") AS "total", COUNT(*) AS "count" FROM "sales" GROUP BY "region" ORDER BY "total" DESC`,
+		},
+		{
+			name: "in and like filters",
+			query: Query{
+				Source: QuerySource{Table: "users"},
+				Filters: []Filter{
+					{Field: "city", Operator: "in", Value: []string{"a", "b"}},
+					{Field: "name", Operator: "LIKE", Value: "bo"},
+				},
+			},
+			wantSQL:  `SELECT * FROM "users" WHERE "city" IN (?, ?) AND "name" LIKE ?`,
+			wantArgs: []interface{}{"a", "b", "%bo%"},
+		},
+		{
+			name: "prefix filter",
+			query: Query{
+				Source:  QuerySource{Table: "users"},
+				Filters: []Filter{{Field: "name", Operator: "PREFIX", Value: "Bö"}},
+			},
+			wantSQL:  `SELECT * FROM "users" WHERE LOWER(SUBSTRING("name" FROM 1 FOR 2)) = ?`,
+			wantArgs: []interface{}{"bö"},
+		},
+		{
+			name: "source condition",
+			query: Query{
+				Source:  QuerySource{Table: "sales", Where: "region = 'east'"},
+				Filters: []Filter{{Field: "amount", Operator: ">", Value: 1}},
+			},
+			wantSQL:  `SELECT * FROM (SELECT * FROM "sales" AS "src_where" WHERE (region = 'east')) AS "base" WHERE "amount" > ?`,
+			wantArgs: []interface{}{1},
+		},
+		{
+			name: "source condition on sql source",
+			query: Query{
+				Source: QuerySource{SQL: "SELECT * FROM t", Where: "a = 1"},
+			},
+			wantSQL: `SELECT * FROM (SELECT * FROM (SELECT * FROM t) AS "base" WHERE (a = 1)) AS "base"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, _ := GetDialect(DialectCalcite)
+			sql, args, err := tt.query.Build(d)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantSQL, sql)
+			assert.Equal(t, tt.wantArgs, args)
+		})
+	}
+}
+
+func TestQuery_BuildErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		query Query
+	}{
+		{"missing source", Query{}},
+		{"bad aggregate", Query{Source: QuerySource{Table: "t"}, Selects: []SelectItem{{Field: "a", Aggregate: "SLEEP"}}}},
+		{"star without count", Query{Source: QuerySource{Table: "t"}, Selects: []SelectItem{{Field: "*", Aggregate: "SUM"}}}},
+		{"first without order field", Query{Source: QuerySource{Table: "t"}, Selects: []SelectItem{{Field: "a", Aggregate: "FIRST"}}}},
+		{"bad operator", Query{Source: QuerySource{Table: "t"}, Filters: []Filter{{Field: "a", Operator: "OR 1=1 --"}}}},
+		{"empty in", Query{Source: QuerySource{Table: "t"}, Filters: []Filter{{Field: "a", Operator: "IN", Value: []interface{}{}}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, _ := GetDialect(DialectCalcite)
+			_, _, err := tt.query.Build(d)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestQuery_BuildWithoutDialect(t *testing.T) {
+	q := Query{Source: QuerySource{Table: "t"}}
+	_, _, err := q.Build(nil)
+	assert.Error(t, err)
+}
+
+func TestQuery_BuildPostgreSQL(t *testing.T) {
+	d, err := GetDialect(DialectPostgreSQL)
+	assert.NoError(t, err)
+
+	q := Query{
+		Source: QuerySource{SQL: "SELECT * FROM t WHERE region = $1", Args: []interface{}{"east"}},
+		Filters: []Filter{
+			{Field: "city", Operator: "IN", Value: []string{"a", "b"}},
+			{Field: "amount", Operator: ">", Value: 10},
+		},
+		Limit: 20,
+	}
+	sql, args, err := q.Build(d)
+	assert.NoError(t, err)
+	assert.Equal(t, `SELECT * FROM (SELECT * FROM t WHERE region = $1) AS "base" WHERE "city" IN ($2, $3) AND "amount" > $4 LIMIT 20`, sql)
+	assert.Equal(t, []interface{}{"east", "a", "b", 10}, args)
+}
+
+func TestQuery_BuildMySQL(t *testing.T) {
+	d, err := GetDialect(DialectMySQL)
+	assert.NoError(t, err)
+
+	q := Query{
+		Source:  QuerySource{Table: "shop.orders"},
+		Selects: []SelectItem{{Field: "region"}, {Field: "amount", Aggregate: "SUM", Alias: "total"}},
+		GroupBy: []string{"region"},
+		Offset:  5,
+	}
+	sql, _, err := q.Build(d)
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT `region`, SUM(`amount`) AS `total` FROM `shop`.`orders` GROUP BY `region` LIMIT 18446744073709551615 OFFSET 5", sql)
+}
+
+func TestQuery_BuildJoin(t *testing.T) {
+	join := &JoinSource{
+		Tables: []JoinTable{
+			{Alias: "t0", Source: QuerySource{Table: "orders"}},
+			{Alias: "t1", Source: QuerySource{SQL: "SELECT * FROM customers WHERE active = ?", Args: []interface{}{true}}, Type: "left",
+				On: []JoinCondition{{Table: "t0", Field: "customer_id", CurrentField: "id"}, {Table: "t0", Field: "tenant", CurrentField: "tenant"}}},
+		},
+		Columns: []JoinColumn{{Table: "t0", Field: "amount", Alias: "amount"}, {Table: "t1", Field: "name", Alias: "customer"}},
+	}
+	q := Query{
+		Source:  QuerySource{Join: join},
+		Filters: []Filter{{Field: "customer", Operator: "=", Value: "alice"}},
+	}
+
+	d, err := GetDialect(DialectPostgreSQL)
+	assert.NoError(t, err)
+	sql, args, err := q.Build(d)
+	assert.NoError(t, err)
+	assert.Equal(t, `SELECT * FROM (SELECT "t0"."amount" AS "amount", "t1"."name" AS "customer" FROM "orders" AS "t0" `+
+		`LEFT JOIN (SELECT * FROM customers WHERE active = ?) AS "t1" ON "t0"."customer_id" = "t1"."id" AND "t0"."tenant" = "t1"."tenant") AS "base" `+
+		`WHERE "customer" = $2`, sql)
+	assert.Equal(t, []interface{}{true, "alice"}, args)
+
+	join.Tables[1].Type = JoinFull
+	mysql, err := GetDialect(DialectMySQL)
+	assert.NoError(t, err)
+	_, _, err = q.Build(mysql)
+	assert.Error(t, err)
+
+	join.Tables[1].On[0].Table = "t2"
+	_, _, err = q.Build(d)
+	assert.Error(t, err)
+}
+
+func TestQuery_BuildExtendedAggregates(t *testing.T) {
+	d, _ := GetDialect(DialectSQLite)
+	q := Query{
+		Source: QuerySource{Table: "orders"},
+		Selects: []SelectItem{
+			{Field: "region"},
+			{Field: "customer", Aggregate: "COUNT_DISTINCT", Alias: "customers"},
+			{Field: "amount", Aggregate: "median", Alias: "median"},
+			{Field: "amount", Aggregate: "P90", Alias: "p90"},
+			{Field: "amount", Aggregate: "VARIANCE", Alias: "variance"},
+			{Field: "amount", Aggregate: "FIRST", OrderField: "created_at", Alias: "first"},
+			{Field: "amount", Aggregate: "LAST", OrderField: "created_at", Alias: "last"},
+		},
+		GroupBy: []string{"region"},
+		OrderBy: []OrderItem{{Field: "region"}},
+	}
+	query, args, err := q.Build(d)
+	require.NoError(t, err)
+
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "agg.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec(`CREATE TABLE orders (region TEXT, customer TEXT, amount REAL, created_at TEXT);
+		INSERT INTO orders VALUES
+		('east', 'a', 40, '2024-01-03'), ('east', 'a', 10, '2024-01-01'), ('east', 'b', 30, '2024-01-04'),
+		('east', 'c', 20, '2024-01-02'), ('east', 'c', NULL, '2024-01-05'), ('west', 'd', 5, NULL)`)
+	require.NoError(t, err)
+
+	var region string
+	var customers int
+	var median, p90, variance, first, last sql.NullFloat64
+	require.NoError(t, db.QueryRow(query, args...).Scan(&region, &customers, &median, &p90, &variance, &first, &last))
+	assert.Equal(t, "east", region)
+	assert.Equal(t, 3, customers)
+	// 最近秩法: 4 个值中位数取第 2 个,P90 取第 4 个
+	assert.Equal(t, 20.0, median.Float64)
+	assert.Equal(t, 40.0, p90.Float64)
+	assert.InDelta(t, 500.0/3, variance.Float64, 1e-9)
+	assert.Equal(t, 10.0, first.Float64)
+	assert.False(t, last.Valid, "last row by time has no amount")
+
+	stddev := Query{Source: QuerySource{Table: "orders"}, Selects: []SelectItem{{Field: "amount", Aggregate: "STDDEV"}}}
+	_, _, err = stddev.Build(d)
+	assert.ErrorContains(t, err, "not supported by sqlite")
+}
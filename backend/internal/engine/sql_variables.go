@@ -0,0 +1,73 @@
+package engine
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// sqlVariablePattern ${name} 形式的变量引用,整体包在单引号中的引用一并替换,避免绑定后仍被当作字符串常量
+var sqlVariablePattern = regexp.MustCompile(`'\$\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}'|\$\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}`)
+
+// SQLVariableNames 返回 SQL 中引用的变量名,按首次出现顺序去重
+func SQLVariableNames(sql string) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, m := range sqlVariablePattern.FindAllStringSubmatch(sql, -1) {
+		name := m[1] + m[2]
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// bindSQLVariables 将 SQL 中的 ${name} 替换为绑定参数占位符,值追加到 args
+// 切片值展开为逗号分隔的多个占位符,用于 IN (${name}) 形式
+func bindSQLVariables(d Dialect, sql string, vars map[string]interface{}, args *[]interface{}) (string, error) {
+	var bindErr error
+	bound := sqlVariablePattern.ReplaceAllStringFunc(sql, func(ref string) string {
+		if bindErr != nil {
+			return ref
+		}
+		m := sqlVariablePattern.FindStringSubmatch(ref)
+		name := m[1] + m[2]
+		value, ok := vars[name]
+		if !ok {
+			bindErr = fmt.Errorf("missing value for sql variable: %s", name)
+			return ref
+		}
+
+		rv := reflect.ValueOf(value)
+		if value == nil || (rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array) || rv.Type().Elem().Kind() == reflect.Uint8 {
+			return bindArg(d, args, value)
+		}
+		if rv.Len() == 0 {
+			bindErr = fmt.Errorf("sql variable %s requires at least one value", name)
+			return ref
+		}
+		placeholders := make([]string, rv.Len())
+		for i := range placeholders {
+			placeholders[i] = bindArg(d, args, rv.Index(i).Interface())
+		}
+		return strings.Join(placeholders, ", ")
+	})
+	if bindErr != nil {
+		return "", bindErr
+	}
+	return bound, nil
+}
+
+// buildSQLSource 自定义SQL来源: 绑定变量或追加位置参数,两者不能同时使用
+func buildSQLSource(d Dialect, source QuerySource, args *[]interface{}) (string, error) {
+	if source.Vars == nil && !sqlVariablePattern.MatchString(source.SQL) {
+		*args = append(*args, source.Args...)
+		return source.SQL, nil
+	}
+	if len(source.Args) > 0 {
+		return "", fmt.Errorf("sql source cannot mix positional arguments and variables")
+	}
+	return bindSQLVariables(d, source.SQL, source.Vars, args)
+}
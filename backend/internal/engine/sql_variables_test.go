@@ -0,0 +1,43 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSQLVariableNames(t *testing.T) {
+	names := SQLVariableNames("SELECT * FROM t WHERE d >= '${start}' AND d < ${ end } AND r IN (${region}) AND x = ${start}")
+	assert.Equal(t, []string{"start", "end", "region"}, names)
+	assert.Empty(t, SQLVariableNames("SELECT '$' || name FROM t"))
+}
+
+func TestQuery_BuildSQLVariables(t *testing.T) {
+	q := Query{
+		Source: QuerySource{
+			SQL:  "SELECT * FROM orders WHERE day >= '${start}' AND region IN (${regions}) AND note = ${note}",
+			Vars: map[string]interface{}{"start": "2024-01-01", "regions": []interface{}{"east", "west"}, "note": nil},
+		},
+		Filters: []Filter{{Field: "amount", Operator: ">", Value: 10}},
+	}
+
+	d, err := GetDialect(DialectPostgreSQL)
+	require.NoError(t, err)
+	sql, args, err := q.Build(d)
+	require.NoError(t, err)
+	assert.Equal(t, `SELECT * FROM (SELECT * FROM orders WHERE day >= $1 AND region IN ($2, $3) AND note = $4) AS "base" WHERE "amount" > $5`, sql)
+	assert.Equal(t, []interface{}{"2024-01-01", "east", "west", nil, 10}, args)
+
+	q.Source.Vars = map[string]interface{}{"start": "2024-01-01", "regions": []string{}, "note": nil}
+	_, _, err = q.Build(d)
+	assert.ErrorContains(t, err, "at least one value")
+
+	q.Source.Vars = map[string]interface{}{"start": "2024-01-01"}
+	_, _, err = q.Build(d)
+	assert.ErrorContains(t, err, "missing value for sql variable: regions")
+
+	q.Source = QuerySource{SQL: "SELECT * FROM t WHERE a = ? AND b = ${b}", Args: []interface{}{1}, Vars: map[string]interface{}{"b": 2}}
+	_, _, err = q.Build(d)
+	assert.Error(t, err)
+}
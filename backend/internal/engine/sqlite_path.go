@@ -0,0 +1,86 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+var (
+	sqlitePathMu sync.RWMutex
+	sqliteDir    string   // SQLite 数据源文件所在目录,为空时不限制
+	sqliteDenied []string // 目录内禁止作为数据源打开的文件,如抽取库
+)
+
+// SetSQLiteDataDir 限制 SQLite 数据源只能打开 dir 内的文件,denied 中的文件(如抽取库)始终拒绝
+// 相对路径按 dir 解析;路径中的符号链接解析后再校验,避免通过链接访问目录外的文件
+func SetSQLiteDataDir(dir string, denied ...string) error {
+	if dir == "" {
+		return fmt.Errorf("sqlite data directory is required")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create sqlite data directory: %w", err)
+	}
+	resolvedDir, err := realPath(dir)
+	if err != nil {
+		return fmt.Errorf("invalid sqlite data directory: %w", err)
+	}
+	resolvedDenied := make([]string, 0, len(denied))
+	for _, path := range denied {
+		if path == "" {
+			continue
+		}
+		resolved, err := realPath(path)
+		if err != nil {
+			// 文件尚不存在时按绝对路径比较
+			if resolved, err = filepath.Abs(path); err != nil {
+				return fmt.Errorf("invalid path %s: %w", path, err)
+			}
+		}
+		resolvedDenied = append(resolvedDenied, resolved)
+	}
+
+	sqlitePathMu.Lock()
+	defer sqlitePathMu.Unlock()
+	sqliteDir = resolvedDir
+	sqliteDenied = resolvedDenied
+	return nil
+}
+
+// resolveSQLitePath 校验 SQLite 数据源的文件路径,返回解析符号链接后的绝对路径
+func resolveSQLitePath(path string) (string, error) {
+	sqlitePathMu.RLock()
+	dir, denied := sqliteDir, sqliteDenied
+	sqlitePathMu.RUnlock()
+	if dir == "" {
+		return path, nil
+	}
+
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	resolved, err := realPath(path)
+	if err != nil {
+		return "", fmt.Errorf("database file not found: %s", path)
+	}
+	if rel, err := filepath.Rel(dir, resolved); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("database file must be inside the data directory %s", dir)
+	}
+	for _, d := range denied {
+		if resolved == d {
+			return "", fmt.Errorf("database file %s cannot be used as a datasource", path)
+		}
+	}
+	return resolved, nil
+}
+
+// realPath 绝对路径并解析符号链接,要求路径存在
+func realPath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(abs)
+}
@@ -0,0 +1,220 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cozy-insight-backend/pkg/logger"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/ssh"
+)
+
+// SSHTunnelConfig SSH 隧道配置,数据库位于堡垒机之后时通过隧道连接
+type SSHTunnelConfig struct {
+	Enabled    bool   `json:"enabled"`
+	Host       string `json:"host"`
+	Port       int    `json:"port"` // 默认 22
+	Username   string `json:"username"`
+	Password   string `json:"password"`
+	PrivateKey string `json:"privateKey"` // PEM 格式私钥,优先于密码
+	Passphrase string `json:"passphrase"` // 私钥口令
+	HostKey    string `json:"hostKey"`    // authorized_keys 格式的主机公钥,或 SHA256:... 格式的公钥指纹
+
+	// InsecureSkipHostKey 不校验主机公钥,存在中间人风险,仅用于测试环境
+	InsecureSkipHostKey bool `json:"insecureSkipHostKey"`
+}
+
+// sshTunnel 本地端口转发: 监听 127.0.0.1 随机端口,经 SSH 连接转发到远端数据库
+type sshTunnel struct {
+	config   *ssh.ClientConfig
+	addr     string // SSH 服务器地址
+	remote   string // 经 SSH 访问的数据库地址
+	listener net.Listener
+
+	mu     sync.Mutex
+	client *ssh.Client
+	closed bool
+}
+
+// openSSHTunnel 建立 SSH 连接并开始转发到 remoteHost:remotePort
+func openSSHTunnel(cfg *SSHTunnelConfig, remoteHost string, remotePort int) (*sshTunnel, error) {
+	if cfg.Host == "" {
+		return nil, fmt.Errorf("ssh host is required")
+	}
+	if cfg.Username == "" {
+		return nil, fmt.Errorf("ssh username is required")
+	}
+	if remotePort == 0 {
+		return nil, fmt.Errorf("port is required when connecting through an ssh tunnel")
+	}
+
+	clientConfig, err := sshClientConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	port := cfg.Port
+	if port == 0 {
+		port = 22
+	}
+	t := &sshTunnel{
+		config: clientConfig,
+		addr:   net.JoinHostPort(cfg.Host, strconv.Itoa(port)),
+		remote: net.JoinHostPort(remoteHost, strconv.Itoa(remotePort)),
+	}
+
+	if t.client, err = ssh.Dial("tcp", t.addr, clientConfig); err != nil {
+		return nil, fmt.Errorf("failed to connect to ssh server: %w", err)
+	}
+	if t.listener, err = net.Listen("tcp", "127.0.0.1:0"); err != nil {
+		t.client.Close()
+		return nil, fmt.Errorf("failed to start ssh tunnel listener: %w", err)
+	}
+
+	go t.serve()
+	return t, nil
+}
+
+// sshClientConfig 根据配置选择认证方式和主机公钥校验
+func sshClientConfig(cfg *SSHTunnelConfig) (*ssh.ClientConfig, error) {
+	var auth []ssh.AuthMethod
+	if cfg.PrivateKey != "" {
+		var signer ssh.Signer
+		var err error
+		if cfg.Passphrase != "" {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase([]byte(cfg.PrivateKey), []byte(cfg.Passphrase))
+		} else {
+			signer, err = ssh.ParsePrivateKey([]byte(cfg.PrivateKey))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid ssh private key: %w", err)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if cfg.Password != "" {
+		auth = append(auth, ssh.Password(cfg.Password))
+	}
+	if len(auth) == 0 {
+		return nil, fmt.Errorf("ssh private key or password is required")
+	}
+
+	hostKeyCallback, err := sshHostKeyCallback(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ssh.ClientConfig{
+		User:            cfg.Username,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         10 * time.Second,
+	}, nil
+}
+
+// sshHostKeyCallback 主机公钥校验,未配置公钥或指纹时必须显式选择不校验
+func sshHostKeyCallback(cfg *SSHTunnelConfig) (ssh.HostKeyCallback, error) {
+	hostKey := strings.TrimSpace(cfg.HostKey)
+	switch {
+	case strings.HasPrefix(hostKey, "SHA256:"):
+		return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			if fingerprint := ssh.FingerprintSHA256(key); fingerprint != hostKey {
+				return fmt.Errorf("ssh host key mismatch: got %s", fingerprint)
+			}
+			return nil
+		}, nil
+	case hostKey != "":
+		key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(hostKey))
+		if err != nil {
+			return nil, fmt.Errorf("invalid ssh host key: %w", err)
+		}
+		return ssh.FixedHostKey(key), nil
+	case cfg.InsecureSkipHostKey:
+		return ssh.InsecureIgnoreHostKey(), nil
+	default:
+		return nil, fmt.Errorf("ssh host key or fingerprint is required")
+	}
+}
+
+// LocalAddr 隧道本地监听地址,数据库驱动连接该地址
+func (t *sshTunnel) LocalAddr() (string, int) {
+	addr := t.listener.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port
+}
+
+// serve 接受本地连接并逐个转发
+func (t *sshTunnel) serve() {
+	for {
+		local, err := t.listener.Accept()
+		if err != nil {
+			return
+		}
+		go t.forward(local)
+	}
+}
+
+// forward 将本地连接经 SSH 转发到远端数据库
+func (t *sshTunnel) forward(local net.Conn) {
+	defer local.Close()
+
+	remote, err := t.dialRemote()
+	if err != nil {
+		logger.Log.Warn("ssh tunnel forward failed", zap.String("remote", t.remote), zap.Error(err))
+		return
+	}
+	defer remote.Close()
+
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(remote, local)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(local, remote)
+		done <- struct{}{}
+	}()
+	<-done
+}
+
+// dialRemote 经 SSH 连接远端地址,SSH 连接断开时重连一次
+func (t *sshTunnel) dialRemote() (net.Conn, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return nil, fmt.Errorf("ssh tunnel is closed")
+	}
+	conn, err := t.client.Dial("tcp", t.remote)
+	var rejected *ssh.OpenChannelError
+	if err == nil || errors.As(err, &rejected) {
+		// 远端拒绝连接时 SSH 连接仍然可用,无需重连
+		return conn, err
+	}
+
+	client, dialErr := ssh.Dial("tcp", t.addr, t.config)
+	if dialErr != nil {
+		return nil, fmt.Errorf("failed to reconnect to ssh server: %w", dialErr)
+	}
+	t.client.Close()
+	t.client = client
+	return t.client.Dial("tcp", t.remote)
+}
+
+// Close 停止监听并关闭 SSH 连接
+func (t *sshTunnel) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return nil
+	}
+	t.closed = true
+	t.listener.Close()
+	return t.client.Close()
+}
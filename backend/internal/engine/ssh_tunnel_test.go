@@ -0,0 +1,221 @@
+package engine
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	"cozy-insight-backend/pkg/logger"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+// startTestSSHServer 启动只支持 direct-tcpip 转发的 SSH 服务器,返回地址和主机公钥
+func startTestSSHServer(t *testing.T, password string) (string, ssh.PublicKey) {
+	_, hostPriv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	hostSigner, err := ssh.NewSignerFromKey(hostPriv)
+	require.NoError(t, err)
+
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, pw []byte) (*ssh.Permissions, error) {
+			if conn.User() == "tunnel" && string(pw) == password {
+				return nil, nil
+			}
+			return nil, io.EOF
+		},
+	}
+	config.AddHostKey(hostSigner)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveTestSSHConn(conn, config)
+		}
+	}()
+	return listener.Addr().String(), hostSigner.PublicKey()
+}
+
+func serveTestSSHConn(conn net.Conn, config *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "direct-tcpip" {
+			newChannel.Reject(ssh.UnknownChannelType, "unsupported")
+			continue
+		}
+		// RFC 4254 7.2: host string, port uint32, originator string, originator port uint32
+		payload := newChannel.ExtraData()
+		hostLen := binary.BigEndian.Uint32(payload)
+		host := string(payload[4 : 4+hostLen])
+		port := binary.BigEndian.Uint32(payload[4+hostLen:])
+
+		target, err := net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(int(port))))
+		if err != nil {
+			newChannel.Reject(ssh.ConnectionFailed, err.Error())
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			target.Close()
+			continue
+		}
+		go ssh.DiscardRequests(requests)
+		go func() {
+			defer channel.Close()
+			defer target.Close()
+			go io.Copy(target, channel)
+			io.Copy(channel, target)
+		}()
+	}
+}
+
+// startEchoServer 启动回显服务器,模拟堡垒机之后的数据库
+func startEchoServer(t *testing.T) (string, int) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	addr := listener.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port
+}
+
+func TestSSHTunnel_Forward(t *testing.T) {
+	logger.InitLogger("error")
+	sshAddr, hostKey := startTestSSHServer(t, "pw")
+	sshHost, sshPort, _ := net.SplitHostPort(sshAddr)
+	port, _ := strconv.Atoi(sshPort)
+	dbHost, dbPort := startEchoServer(t)
+
+	cfg := &SSHTunnelConfig{
+		Enabled:  true,
+		Host:     sshHost,
+		Port:     port,
+		Username: "tunnel",
+		Password: "pw",
+		HostKey:  string(ssh.MarshalAuthorizedKey(hostKey)),
+	}
+	tunnel, err := openSSHTunnel(cfg, dbHost, dbPort)
+	require.NoError(t, err)
+	defer tunnel.Close()
+
+	localHost, localPort := tunnel.LocalAddr()
+	assert.Equal(t, "127.0.0.1", localHost)
+	assert.NotEqual(t, dbPort, localPort)
+
+	conn, err := net.Dial("tcp", net.JoinHostPort(localHost, strconv.Itoa(localPort)))
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("ping"))
+	require.NoError(t, err)
+	buf := make([]byte, 4)
+	_, err = io.ReadFull(conn, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "ping", string(buf))
+
+	// 关闭后不再接受连接
+	require.NoError(t, tunnel.Close())
+	_, err = net.Dial("tcp", net.JoinHostPort(localHost, strconv.Itoa(localPort)))
+	assert.Error(t, err)
+}
+
+func TestSSHTunnel_Errors(t *testing.T) {
+	sshAddr, _ := startTestSSHServer(t, "pw")
+	sshHost, sshPort, _ := net.SplitHostPort(sshAddr)
+	port, _ := strconv.Atoi(sshPort)
+
+	// 密码错误
+	_, err := openSSHTunnel(&SSHTunnelConfig{Host: sshHost, Port: port, Username: "tunnel", Password: "bad", InsecureSkipHostKey: true}, "127.0.0.1", 3306)
+	assert.Error(t, err)
+
+	// 未配置主机公钥时拒绝连接,除非显式选择不校验
+	_, err = openSSHTunnel(&SSHTunnelConfig{Host: sshHost, Port: port, Username: "tunnel", Password: "pw"}, "127.0.0.1", 3306)
+	assert.ErrorContains(t, err, "host key or fingerprint is required")
+	tunnel, err := openSSHTunnel(&SSHTunnelConfig{Host: sshHost, Port: port, Username: "tunnel", Password: "pw", InsecureSkipHostKey: true}, "127.0.0.1", 3306)
+	require.NoError(t, err)
+	tunnel.Close()
+
+	// 指纹不匹配
+	_, err = openSSHTunnel(&SSHTunnelConfig{
+		Host: sshHost, Port: port, Username: "tunnel", Password: "pw",
+		HostKey: "SHA256:" + strings.Repeat("A", 43),
+	}, "127.0.0.1", 3306)
+	assert.ErrorContains(t, err, "host key mismatch")
+
+	// 主机公钥不匹配
+	otherPub, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	otherKey, err := ssh.NewPublicKey(otherPub)
+	require.NoError(t, err)
+	_, err = openSSHTunnel(&SSHTunnelConfig{
+		Host: sshHost, Port: port, Username: "tunnel", Password: "pw",
+		HostKey: string(ssh.MarshalAuthorizedKey(otherKey)),
+	}, "127.0.0.1", 3306)
+	assert.Error(t, err)
+
+	// 缺少认证信息和私钥格式错误
+	_, err = openSSHTunnel(&SSHTunnelConfig{Host: sshHost, Username: "tunnel"}, "127.0.0.1", 3306)
+	assert.Error(t, err)
+	_, err = openSSHTunnel(&SSHTunnelConfig{Host: sshHost, Username: "tunnel", PrivateKey: "bad"}, "127.0.0.1", 3306)
+	assert.Error(t, err)
+}
+
+func TestConnectionManager_SSHTunnelLifecycle(t *testing.T) {
+	logger.InitLogger("error")
+	sshAddr, hostKey := startTestSSHServer(t, "pw")
+	sshHost, sshPort, _ := net.SplitHostPort(sshAddr)
+	dbHost, dbPort := startEchoServer(t)
+
+	// 按公钥指纹校验主机
+	configJSON := `{"type":"mysql","host":"` + dbHost + `","port":` + strconv.Itoa(dbPort) +
+		`,"ssh":{"enabled":true,"host":"` + sshHost + `","port":` + sshPort + `,"username":"tunnel","password":"pw","hostKey":"` + ssh.FingerprintSHA256(hostKey) + `"}}`
+
+	m := NewConnectionManager(nil)
+	defer m.Close()
+	db, config, _, err := m.Get("ds1", "mysql", configJSON, "")
+	require.NoError(t, err)
+	// 返回的配置保持原地址,连接经隧道的本地地址建立
+	assert.Equal(t, dbHost, config.Host)
+
+	reused, _, _, err := m.Get("ds1", "mysql", configJSON, "")
+	require.NoError(t, err)
+	assert.Same(t, db, reused)
+
+	// 关闭连接池时一并关闭隧道,重建时建立新隧道
+	m.Invalidate("ds1")
+	rebuilt, _, _, err := m.Get("ds1", "mysql", configJSON, "")
+	require.NoError(t, err)
+	assert.NotSame(t, db, rebuilt)
+
+	// SSH 认证失败时不创建连接池
+	_, _, _, err = m.Get("ds2", "mysql", strings.Replace(configJSON, `"password":"pw"`, `"password":"bad"`, 1), "")
+	assert.Error(t, err)
+}
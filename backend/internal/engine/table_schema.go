@@ -0,0 +1,408 @@
+package engine
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// 逻辑字段类型,与 DatasetTableField.DeType 取值一致
+const (
+	DeTypeText  = 0
+	DeTypeTime  = 1
+	DeTypeInt   = 2
+	DeTypeFloat = 3
+	DeTypeBool  = 4
+	DeTypeGeo   = 5
+)
+
+// ColumnInfo 统一的字段元数据
+type ColumnInfo struct {
+	Name        string  `json:"name"`
+	NativeType  string  `json:"nativeType"`  // 数据库原生类型,如 varchar(255)
+	LogicalType int     `json:"logicalType"` // 归一化后的 DeType
+	Nullable    bool    `json:"nullable"`
+	PrimaryKey  bool    `json:"primaryKey"`
+	Default     *string `json:"default"` // 默认值表达式,无默认值时为 nil
+	Comment     string  `json:"comment"`
+	Ordinal     int     `json:"ordinal"` // 字段位置,从1开始
+}
+
+// IndexInfo 索引元数据
+type IndexInfo struct {
+	Name    string   `json:"name"`
+	Columns []string `json:"columns"`
+	Unique  bool     `json:"unique"`
+	Primary bool     `json:"primary"`
+}
+
+// TableInfo 统一的表结构元数据
+type TableInfo struct {
+	Name        string       `json:"name"`
+	Comment     string       `json:"comment"`
+	RowEstimate int64        `json:"rowEstimate"` // 估算行数,未知时为 -1
+	Columns     []ColumnInfo `json:"columns"`
+	Indexes     []IndexInfo  `json:"indexes"`
+}
+
+// SchemaInspector 由方言实现,读取完整的表结构元数据
+// 未实现的方言退回到 TableSchemaQuery,只能得到字段名、类型和可空性
+type SchemaInspector interface {
+	InspectTable(ctx context.Context, db *sql.DB, database, table string) (*TableInfo, error)
+}
+
+// LogicalType 将数据库原生类型映射为 DeType
+func LogicalType(nativeType string) int {
+	t := strings.ToLower(strings.TrimSpace(unwrapNativeType(nativeType)))
+	switch {
+	case t == "":
+		return DeTypeText
+	case t == "tinyint(1)" || t == "bit" || t == "bit(1)" || strings.HasPrefix(t, "bool"):
+		return DeTypeBool
+	case containsAny(t, "geometry", "geography", "point", "polygon", "linestring"):
+		return DeTypeGeo
+	case strings.HasPrefix(t, "interval"):
+		return DeTypeText
+	case containsAny(t, "date", "time", "year"):
+		return DeTypeTime
+	case containsAny(t, "int", "serial"):
+		return DeTypeInt
+	case containsAny(t, "float", "double", "decimal", "numeric", "real", "money", "number"):
+		return DeTypeFloat
+	default:
+		return DeTypeText
+	}
+}
+
+// unwrapNativeType 去掉 ClickHouse 的 Nullable(...)/LowCardinality(...) 包装
+func unwrapNativeType(t string) string {
+	for {
+		lower := strings.ToLower(t)
+		switch {
+		case strings.HasPrefix(lower, "nullable(") && strings.HasSuffix(t, ")"):
+			t = t[len("nullable(") : len(t)-1]
+		case strings.HasPrefix(lower, "lowcardinality(") && strings.HasSuffix(t, ")"):
+			t = t[len("lowcardinality(") : len(t)-1]
+		default:
+			return t
+		}
+	}
+}
+
+func containsAny(s string, subs ...string) bool {
+	for _, sub := range subs {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
+
+// inspectTable 读取表结构,方言未实现 SchemaInspector 时按通用字段名解析 TableSchemaQuery 的结果
+func inspectTable(ctx context.Context, db *sql.DB, dialect Dialect, database, table string) (*TableInfo, error) {
+	if inspector, ok := dialect.(SchemaInspector); ok {
+		info, err := inspector.InspectTable(ctx, db, database, table)
+		if err != nil {
+			return nil, err
+		}
+		if len(info.Columns) == 0 {
+			return nil, fmt.Errorf("table not found: %s", table)
+		}
+		return info, nil
+	}
+
+	query, args := dialect.TableSchemaQuery(database, table)
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	records, err := scanRows(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &TableInfo{Name: table, RowEstimate: -1, Columns: make([]ColumnInfo, 0, len(records)), Indexes: []IndexInfo{}}
+	for _, row := range records {
+		name := rowString(row, "name", "Field", "column_name", "columnName", "COLUMN_NAME")
+		if name == "" {
+			continue
+		}
+		nativeType := rowString(row, "type", "Type", "data_type", "typeName", "DATA_TYPE")
+		nullable := strings.ToUpper(rowString(row, "is_nullable", "isNullable", "Null", "IS_NULLABLE"))
+		info.Columns = append(info.Columns, ColumnInfo{
+			Name:        name,
+			NativeType:  nativeType,
+			LogicalType: LogicalType(nativeType),
+			Nullable:    nullable != "NO" && nullable != "FALSE",
+			Ordinal:     len(info.Columns) + 1,
+		})
+	}
+	return info, nil
+}
+
+// documentTableInfo 由采样推断的文档字段构造表结构,文档字段均可为空
+func documentTableInfo(collection string, fields []DocumentField) *TableInfo {
+	info := &TableInfo{Name: collection, RowEstimate: -1, Columns: make([]ColumnInfo, len(fields)), Indexes: []IndexInfo{}}
+	for i, f := range fields {
+		info.Columns[i] = ColumnInfo{
+			Name:        f.Name,
+			NativeType:  f.Type,
+			LogicalType: LogicalType(f.Type),
+			Nullable:    true,
+			PrimaryKey:  f.Name == "_id",
+			Ordinal:     i + 1,
+		}
+	}
+	return info
+}
+
+// rowString 按候选键顺序读取结果行中的字符串值
+func rowString(row map[string]interface{}, keys ...string) string {
+	for _, key := range keys {
+		switch v := row[key].(type) {
+		case nil:
+			continue
+		case []byte:
+			return string(v)
+		default:
+			return fmt.Sprint(v)
+		}
+	}
+	return ""
+}
+
+// collectIndexes 将 (索引名, 是否唯一, 是否主键, 字段) 按顺序排列的结果行合并为索引列表
+func collectIndexes(rows *sql.Rows) ([]IndexInfo, error) {
+	indexes := []IndexInfo{}
+	for rows.Next() {
+		var name, column string
+		var unique, primary bool
+		if err := rows.Scan(&name, &unique, &primary, &column); err != nil {
+			return nil, err
+		}
+		if n := len(indexes); n > 0 && indexes[n-1].Name == name {
+			indexes[n-1].Columns = append(indexes[n-1].Columns, column)
+			continue
+		}
+		indexes = append(indexes, IndexInfo{Name: name, Columns: []string{column}, Unique: unique || primary, Primary: primary})
+	}
+	return indexes, rows.Err()
+}
+
+func (d *mysqlDialect) InspectTable(ctx context.Context, db *sql.DB, database, table string) (*TableInfo, error) {
+	info := &TableInfo{Name: table, RowEstimate: -1}
+
+	var rowEstimate sql.NullInt64
+	err := db.QueryRowContext(ctx, `SELECT TABLE_ROWS, TABLE_COMMENT FROM information_schema.TABLES
+		WHERE TABLE_SCHEMA = COALESCE(NULLIF(?, ''), DATABASE()) AND TABLE_NAME = ?`, database, table).
+		Scan(&rowEstimate, &info.Comment)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to read table info: %w", err)
+	}
+	if rowEstimate.Valid {
+		info.RowEstimate = rowEstimate.Int64
+	}
+
+	rows, err := db.QueryContext(ctx, `SELECT COLUMN_NAME, COLUMN_TYPE, IS_NULLABLE = 'YES', COLUMN_KEY = 'PRI', COLUMN_DEFAULT, COLUMN_COMMENT, ORDINAL_POSITION
+		FROM information_schema.COLUMNS
+		WHERE TABLE_SCHEMA = COALESCE(NULLIF(?, ''), DATABASE()) AND TABLE_NAME = ?
+		ORDER BY ORDINAL_POSITION`, database, table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read columns: %w", err)
+	}
+	info.Columns, err = scanColumnInfos(rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read columns: %w", err)
+	}
+
+	rows, err = db.QueryContext(ctx, `SELECT INDEX_NAME, NON_UNIQUE = 0, INDEX_NAME = 'PRIMARY', COLUMN_NAME
+		FROM information_schema.STATISTICS
+		WHERE TABLE_SCHEMA = COALESCE(NULLIF(?, ''), DATABASE()) AND TABLE_NAME = ?
+		ORDER BY INDEX_NAME, SEQ_IN_INDEX`, database, table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read indexes: %w", err)
+	}
+	defer rows.Close()
+	if info.Indexes, err = collectIndexes(rows); err != nil {
+		return nil, fmt.Errorf("failed to read indexes: %w", err)
+	}
+	return info, nil
+}
+
+// InspectTable PostgreSQL 的 database 参数为连接的数据库,表在 search_path 中查找
+func (d *postgresDialect) InspectTable(ctx context.Context, db *sql.DB, database, table string) (*TableInfo, error) {
+	info := &TableInfo{Name: table, RowEstimate: -1}
+
+	var rowEstimate sql.NullInt64
+	var comment sql.NullString
+	err := db.QueryRowContext(ctx, `SELECT c.reltuples::bigint, obj_description(c.oid, 'pg_class')
+		FROM pg_class c WHERE c.oid = to_regclass(quote_ident($1))`, table).Scan(&rowEstimate, &comment)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to read table info: %w", err)
+	}
+	// 从未 ANALYZE 的表 reltuples 为 -1(PostgreSQL 14+)或 0
+	if rowEstimate.Valid && rowEstimate.Int64 >= 0 {
+		info.RowEstimate = rowEstimate.Int64
+	}
+	info.Comment = comment.String
+
+	rows, err := db.QueryContext(ctx, `SELECT c.column_name,
+			CASE WHEN c.character_maximum_length IS NOT NULL THEN c.data_type || '(' || c.character_maximum_length || ')' ELSE c.data_type END,
+			c.is_nullable = 'YES',
+			EXISTS (SELECT 1 FROM information_schema.table_constraints tc
+				JOIN information_schema.key_column_usage k
+					ON k.constraint_name = tc.constraint_name AND k.table_schema = tc.table_schema AND k.table_name = tc.table_name
+				WHERE tc.constraint_type = 'PRIMARY KEY' AND tc.table_schema = c.table_schema
+					AND tc.table_name = c.table_name AND k.column_name = c.column_name),
+			c.column_default,
+			COALESCE(col_description(to_regclass(quote_ident(c.table_schema) || '.' || quote_ident(c.table_name)), c.ordinal_position::int), ''),
+			c.ordinal_position
+		FROM information_schema.columns c
+		WHERE c.table_name = $1 AND c.table_schema = ANY (current_schemas(false))
+		ORDER BY c.ordinal_position`, table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read columns: %w", err)
+	}
+	info.Columns, err = scanColumnInfos(rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read columns: %w", err)
+	}
+
+	rows, err = db.QueryContext(ctx, `SELECT i.relname, ix.indisunique, ix.indisprimary, a.attname
+		FROM pg_index ix
+		JOIN pg_class i ON i.oid = ix.indexrelid
+		JOIN pg_attribute a ON a.attrelid = ix.indrelid AND a.attnum = ANY (ix.indkey)
+		WHERE ix.indrelid = to_regclass(quote_ident($1))
+		ORDER BY i.relname, array_position(ix.indkey::int2[], a.attnum)`, table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read indexes: %w", err)
+	}
+	defer rows.Close()
+	if info.Indexes, err = collectIndexes(rows); err != nil {
+		return nil, fmt.Errorf("failed to read indexes: %w", err)
+	}
+	return info, nil
+}
+
+// InspectTable SQLite 没有表注释,行数仅在执行过 ANALYZE 后可从 sqlite_stat1 读取
+func (d *sqliteDialect) InspectTable(ctx context.Context, db *sql.DB, database, table string) (*TableInfo, error) {
+	info := &TableInfo{Name: table, RowEstimate: -1}
+
+	rows, err := db.QueryContext(ctx, `SELECT name, type, "notnull" = 0, pk > 0, dflt_value, '', cid + 1
+		FROM pragma_table_info(?) ORDER BY cid`, table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read columns: %w", err)
+	}
+	info.Columns, err = scanColumnInfos(rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read columns: %w", err)
+	}
+
+	var stat string
+	if err := db.QueryRowContext(ctx, "SELECT stat FROM sqlite_stat1 WHERE tbl = ? LIMIT 1", table).Scan(&stat); err == nil {
+		fmt.Sscanf(stat, "%d", &info.RowEstimate)
+	}
+
+	rows, err = db.QueryContext(ctx, `SELECT l.name, l."unique", l.origin = 'pk', i.name
+		FROM pragma_index_list(?) l, pragma_index_info(l.name) i
+		ORDER BY l.name, i.seqno`, table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read indexes: %w", err)
+	}
+	defer rows.Close()
+	if info.Indexes, err = collectIndexes(rows); err != nil {
+		return nil, fmt.Errorf("failed to read indexes: %w", err)
+	}
+
+	// INTEGER PRIMARY KEY 是 rowid 的别名,不会出现在索引列表中
+	hasPrimary := false
+	var pkColumns []string
+	for _, idx := range info.Indexes {
+		hasPrimary = hasPrimary || idx.Primary
+	}
+	for _, col := range info.Columns {
+		if col.PrimaryKey {
+			pkColumns = append(pkColumns, col.Name)
+		}
+	}
+	if !hasPrimary && len(pkColumns) > 0 {
+		info.Indexes = append([]IndexInfo{{Name: "PRIMARY", Columns: pkColumns, Unique: true, Primary: true}}, info.Indexes...)
+	}
+	return info, nil
+}
+
+// InspectTable ClickHouse 的主键来自排序键,跳数索引作为普通索引返回
+func (d *clickhouseDialect) InspectTable(ctx context.Context, db *sql.DB, database, table string) (*TableInfo, error) {
+	info := &TableInfo{Name: table, RowEstimate: -1}
+
+	var rowEstimate sql.NullInt64
+	err := db.QueryRowContext(ctx, `SELECT total_rows, comment FROM system.tables
+		WHERE database = if(? = '', currentDatabase(), ?) AND name = ?`, database, database, table).
+		Scan(&rowEstimate, &info.Comment)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to read table info: %w", err)
+	}
+	if rowEstimate.Valid {
+		info.RowEstimate = rowEstimate.Int64
+	}
+
+	rows, err := db.QueryContext(ctx, `SELECT name, type, startsWith(type, 'Nullable('), is_in_primary_key = 1,
+			if(default_expression = '', NULL, default_expression), comment, position
+		FROM system.columns
+		WHERE database = if(? = '', currentDatabase(), ?) AND table = ?
+		ORDER BY position`, database, database, table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read columns: %w", err)
+	}
+	info.Columns, err = scanColumnInfos(rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read columns: %w", err)
+	}
+
+	info.Indexes = []IndexInfo{}
+	var pkColumns []string
+	for _, col := range info.Columns {
+		if col.PrimaryKey {
+			pkColumns = append(pkColumns, col.Name)
+		}
+	}
+	if len(pkColumns) > 0 {
+		info.Indexes = append(info.Indexes, IndexInfo{Name: "PRIMARY", Columns: pkColumns, Primary: true})
+	}
+
+	rows, err = db.QueryContext(ctx, `SELECT name, expr FROM system.data_skipping_indices
+		WHERE database = if(? = '', currentDatabase(), ?) AND table = ? ORDER BY name`, database, database, table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read indexes: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name, expr string
+		if err := rows.Scan(&name, &expr); err != nil {
+			return nil, fmt.Errorf("failed to read indexes: %w", err)
+		}
+		info.Indexes = append(info.Indexes, IndexInfo{Name: name, Columns: []string{expr}})
+	}
+	return info, rows.Err()
+}
+
+// scanColumnInfos 读取 (名称, 类型, 可空, 主键, 默认值, 注释, 位置) 形式的结果行并关闭 rows
+func scanColumnInfos(rows *sql.Rows) ([]ColumnInfo, error) {
+	defer rows.Close()
+	columns := []ColumnInfo{}
+	for rows.Next() {
+		var col ColumnInfo
+		var def sql.NullString
+		if err := rows.Scan(&col.Name, &col.NativeType, &col.Nullable, &col.PrimaryKey, &def, &col.Comment, &col.Ordinal); err != nil {
+			return nil, err
+		}
+		if def.Valid {
+			col.Default = &def.String
+		}
+		col.LogicalType = LogicalType(col.NativeType)
+		columns = append(columns, col)
+	}
+	return columns, rows.Err()
+}
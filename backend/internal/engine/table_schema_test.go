@@ -0,0 +1,138 @@
+package engine
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogicalType(t *testing.T) {
+	cases := map[string]int{
+		"varchar(255)":                   DeTypeText,
+		"TEXT":                           DeTypeText,
+		"int(11) unsigned":               DeTypeInt,
+		"bigint":                         DeTypeInt,
+		"UInt64":                         DeTypeInt,
+		"Nullable(Int32)":                DeTypeInt,
+		"decimal(10,2)":                  DeTypeFloat,
+		"double precision":               DeTypeFloat,
+		"Float64":                        DeTypeFloat,
+		"datetime":                       DeTypeTime,
+		"timestamp without time zone":    DeTypeTime,
+		"LowCardinality(Nullable(Date))": DeTypeTime,
+		"interval":                       DeTypeText,
+		"tinyint(1)":                     DeTypeBool,
+		"boolean":                        DeTypeBool,
+		"point":                          DeTypeGeo,
+		"geometry":                       DeTypeGeo,
+		"":                               DeTypeText,
+	}
+	for nativeType, want := range cases {
+		assert.Equal(t, want, LogicalType(nativeType), nativeType)
+	}
+}
+
+func TestSQLiteInspectTable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schema.db")
+	db, err := sql.Open("sqlite3", path)
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.Exec(`CREATE TABLE orders (
+		tenant TEXT NOT NULL,
+		id INTEGER NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		amount DECIMAL(10,2),
+		code VARCHAR(20) UNIQUE,
+		PRIMARY KEY (tenant, id))`)
+	require.NoError(t, err)
+	_, err = db.Exec(`CREATE INDEX idx_orders_created ON orders (created_at, amount)`)
+	require.NoError(t, err)
+
+	dialect, err := GetDialect(DialectSQLite)
+	require.NoError(t, err)
+	info, err := inspectTable(context.Background(), db, dialect, "", "orders")
+	require.NoError(t, err)
+
+	assert.Equal(t, "orders", info.Name)
+	assert.Equal(t, int64(-1), info.RowEstimate)
+	require.Len(t, info.Columns, 5)
+
+	tenant := info.Columns[0]
+	assert.Equal(t, ColumnInfo{Name: "tenant", NativeType: "TEXT", LogicalType: DeTypeText, PrimaryKey: true, Ordinal: 1}, tenant)
+
+	created := info.Columns[2]
+	assert.Equal(t, DeTypeTime, created.LogicalType)
+	assert.True(t, created.Nullable)
+	require.NotNil(t, created.Default)
+	assert.Equal(t, "CURRENT_TIMESTAMP", *created.Default)
+
+	assert.Equal(t, DeTypeFloat, info.Columns[3].LogicalType)
+	assert.Equal(t, 5, info.Columns[4].Ordinal)
+
+	indexes := make(map[string]IndexInfo)
+	for _, idx := range info.Indexes {
+		indexes[idx.Name] = idx
+	}
+	require.Len(t, indexes, 3)
+	assert.Equal(t, []string{"created_at", "amount"}, indexes["idx_orders_created"].Columns)
+	assert.False(t, indexes["idx_orders_created"].Unique)
+
+	var primary, unique IndexInfo
+	for _, idx := range info.Indexes {
+		switch {
+		case idx.Primary:
+			primary = idx
+		case idx.Unique:
+			unique = idx
+		}
+	}
+	assert.Equal(t, []string{"tenant", "id"}, primary.Columns)
+	assert.Equal(t, []string{"code"}, unique.Columns)
+
+	_, err = db.Exec(`INSERT INTO orders (tenant, id, amount) VALUES ('a', 1, 10), ('a', 2, 20), ('b', 1, 5)`)
+	require.NoError(t, err)
+	_, err = db.Exec(`ANALYZE`)
+	require.NoError(t, err)
+	info, err = inspectTable(context.Background(), db, dialect, "", "orders")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), info.RowEstimate)
+
+	_, err = inspectTable(context.Background(), db, dialect, "", "missing")
+	assert.Error(t, err)
+}
+
+func TestSQLiteInspectTable_RowidPrimaryKey(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "rowid.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec(`CREATE TABLE items (id INTEGER PRIMARY KEY, name TEXT)`)
+	require.NoError(t, err)
+
+	dialect, err := GetDialect(DialectSQLite)
+	require.NoError(t, err)
+	info, err := inspectTable(context.Background(), db, dialect, "", "items")
+	require.NoError(t, err)
+
+	assert.True(t, info.Columns[0].PrimaryKey)
+	require.Len(t, info.Indexes, 1)
+	assert.Equal(t, IndexInfo{Name: "PRIMARY", Columns: []string{"id"}, Unique: true, Primary: true}, info.Indexes[0])
+}
+
+func TestDocumentTableInfo(t *testing.T) {
+	info := documentTableInfo("events", []DocumentField{
+		{Name: "_id", Type: "TEXT", Count: 3},
+		{Name: "ts", Type: "TIMESTAMP", Count: 3},
+		{Name: "value", Type: "REAL", Count: 2},
+	})
+	require.Len(t, info.Columns, 3)
+	assert.True(t, info.Columns[0].PrimaryKey)
+	assert.Equal(t, DeTypeTime, info.Columns[1].LogicalType)
+	assert.Equal(t, DeTypeFloat, info.Columns[2].LogicalType)
+	assert.True(t, info.Columns[2].Nullable)
+	assert.Equal(t, 3, info.Columns[2].Ordinal)
+}
@@ -47,6 +47,63 @@ func (h *CalculatedFieldHandler) Create(c *gin.Context) {
 	c.JSON(http.StatusOK, field)
 }
 
+// Update 更新计算字段
+func (h *CalculatedFieldHandler) Update(c *gin.Context) {
+	var req struct {
+		FieldName   string `json:"fieldName"`
+		DisplayName string `json:"displayName"`
+		Expression  string `json:"expression"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	field := &model.DatasetTableFieldCalculated{
+		ID:          c.Param("id"),
+		FieldName:   req.FieldName,
+		DisplayName: req.DisplayName,
+		Expression:  req.Expression,
+	}
+
+	if err := h.service.Update(c.Request.Context(), field); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, field)
+}
+
+// Validate 校验计算字段表达式
+// 表达式有误时仍返回 200,错误列表中包含位置和原因
+func (h *CalculatedFieldHandler) Validate(c *gin.Context) {
+	var req struct {
+		ID             string `json:"id"`
+		DatasetTableID string `json:"datasetTableId" binding:"required"`
+		FieldName      string `json:"fieldName"`
+		Expression     string `json:"expression"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := h.service.Validate(c.Request.Context(), &model.DatasetTableFieldCalculated{
+		ID:             req.ID,
+		DatasetTableID: req.DatasetTableID,
+		FieldName:      req.FieldName,
+		Expression:     req.Expression,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
 // List 获取计算字段列表
 func (h *CalculatedFieldHandler) List(c *gin.Context) {
 	tableID := c.Param("tableId")
@@ -4,6 +4,7 @@ import (
 	"cozy-insight-backend/internal/model"
 	"cozy-insight-backend/internal/service"
 	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
@@ -84,14 +85,48 @@ func (h *ChartHandler) List(c *gin.Context) {
 	c.JSON(http.StatusOK, list)
 }
 
-// GetData 获取图表数据
+// GetData 获取图表数据, SQL 数据集的变量通过 vars[name]=value 查询参数传入
 func (h *ChartHandler) GetData(c *gin.Context) {
 	id := c.Param("id")
-	data, err := h.chartDataSvc.GetChartData(c.Request.Context(), id)
+	result, err := h.chartDataSvc.GetChartDataWithFilter(c.Request.Context(), id, &service.QueryFilter{Variables: queryVariables(c)})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, data)
+	c.JSON(http.StatusOK, result)
+}
+
+// QueryData 按过滤条件和变量获取图表数据
+func (h *ChartHandler) QueryData(c *gin.Context) {
+	var filter service.QueryFilter
+	if err := c.ShouldBindJSON(&filter); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := h.chartDataSvc.GetChartDataWithFilter(c.Request.Context(), c.Param("id"), &filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// queryVariables 读取 vars[name]=value 形式的查询参数,同名参数出现多次时为多值
+func queryVariables(c *gin.Context) map[string]interface{} {
+	vars := make(map[string]interface{})
+	for key, values := range c.Request.URL.Query() {
+		if !strings.HasPrefix(key, "vars[") || !strings.HasSuffix(key, "]") || len(values) == 0 {
+			continue
+		}
+		name := key[len("vars[") : len(key)-1]
+		if len(values) == 1 {
+			vars[name] = values[0]
+		} else {
+			vars[name] = values
+		}
+	}
+	return vars
 }
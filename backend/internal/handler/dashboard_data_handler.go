@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"cozy-insight-backend/internal/service"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type DashboardDataHandler struct {
+	svc service.DashboardDataService
+}
+
+func NewDashboardDataHandler(svc service.DashboardDataService) *DashboardDataHandler {
+	return &DashboardDataHandler{svc: svc}
+}
+
+// GetData 获取仪表板所有图表组件的数据
+// 仪表板参数按 params[name]=value 传入,SQL 变量按 vars[name]=value 传入,
+// 各组件的过滤条件按 filters={"组件ID":[...]} 以 JSON 传入
+func (h *DashboardDataHandler) GetData(c *gin.Context) {
+	req := &service.DashboardDataRequest{Parameters: queryParameters(c), Variables: queryVariables(c)}
+	if raw := c.Query("filters"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &req.Filters); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid filters: %v", err)})
+			return
+		}
+	}
+
+	result, err := h.svc.GetDashboardData(c.Request.Context(), c.Param("id"), req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// queryParameters 读取 params[name]=value 形式的仪表板参数,同名参数出现多次时以逗号连接
+func queryParameters(c *gin.Context) map[string]string {
+	params := make(map[string]string)
+	for key, values := range c.Request.URL.Query() {
+		if !strings.HasPrefix(key, "params[") || !strings.HasSuffix(key, "]") || len(values) == 0 {
+			continue
+		}
+		params[key[len("params["):len(key)-1]] = strings.Join(values, ",")
+	}
+	return params
+}
@@ -0,0 +1,33 @@
+package handler
+
+import (
+	"cozy-insight-backend/internal/service"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type DashboardLinkageHandler struct {
+	svc service.DashboardLinkageService
+}
+
+func NewDashboardLinkageHandler(svc service.DashboardLinkageService) *DashboardLinkageHandler {
+	return &DashboardLinkageHandler{svc: svc}
+}
+
+// Trigger 处理组件联动事件,返回受影响组件刷新后的数据
+func (h *DashboardLinkageHandler) Trigger(c *gin.Context) {
+	var event service.LinkageEvent
+	if err := c.ShouldBindJSON(&event); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := h.svc.Trigger(c.Request.Context(), c.Param("id"), &event)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
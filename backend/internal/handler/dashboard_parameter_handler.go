@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"cozy-insight-backend/internal/model"
+	"cozy-insight-backend/internal/service"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type DashboardParameterHandler struct {
+	svc service.DashboardParameterService
+}
+
+func NewDashboardParameterHandler(svc service.DashboardParameterService) *DashboardParameterHandler {
+	return &DashboardParameterHandler{svc: svc}
+}
+
+// Create 创建仪表板参数
+func (h *DashboardParameterHandler) Create(c *gin.Context) {
+	var param model.DashboardParameter
+	if err := c.ShouldBindJSON(&param); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	param.DashboardID = c.Param("id")
+
+	if err := h.svc.Create(c.Request.Context(), &param); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, param)
+}
+
+// Update 更新仪表板参数
+func (h *DashboardParameterHandler) Update(c *gin.Context) {
+	var param model.DashboardParameter
+	if err := c.ShouldBindJSON(&param); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	param.ID = c.Param("paramId")
+
+	if err := h.svc.Update(c.Request.Context(), &param); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, param)
+}
+
+// Delete 删除仪表板参数
+func (h *DashboardParameterHandler) Delete(c *gin.Context) {
+	if err := h.svc.Delete(c.Request.Context(), c.Param("paramId")); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// List 获取仪表板的所有参数
+func (h *DashboardParameterHandler) List(c *gin.Context) {
+	params, err := h.svc.List(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, params)
+}
+
+// Options 获取下拉参数的可选值
+func (h *DashboardParameterHandler) Options(c *gin.Context) {
+	options, err := h.svc.Options(c.Request.Context(), c.Param("paramId"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, options)
+}
@@ -3,6 +3,7 @@ package handler
 import (
 	"cozy-insight-backend/internal/model"
 	"cozy-insight-backend/internal/service"
+	"fmt"
 	"net/http"
 	"strconv"
 
@@ -105,10 +106,145 @@ func (h *DatasetHandler) GetFields(c *gin.Context) {
 func (h *DatasetHandler) SyncFields(c *gin.Context) {
 	id := c.Param("id")
 
-	if err := h.svc.SyncFields(c.Request.Context(), id); err != nil {
+	report, err := h.svc.SyncFields(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// maxUploadSize 上传文件大小上限
+const maxUploadSize = 50 << 20
+
+// Upload 上传 CSV/Excel 文件创建数据集
+func (h *DatasetHandler) Upload(c *gin.Context) {
+	h.upload(c, "")
+}
+
+// ReUpload 重新上传文件到已有数据集, editType: 0 替换, 1 追加
+func (h *DatasetHandler) ReUpload(c *gin.Context) {
+	h.upload(c, c.Param("id"))
+}
+
+func (h *DatasetHandler) upload(c *gin.Context, tableID string) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxUploadSize)
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("file is required: %v", err)})
+		return
+	}
+
+	editType := 0
+	if v := c.PostForm("editType"); v != "" {
+		if editType, err = strconv.Atoi(v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid editType"})
+			return
+		}
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer file.Close()
+
+	table, err := h.svc.UploadTable(c.Request.Context(), &service.UploadRequest{
+		TableID:        tableID,
+		Name:           c.PostForm("name"),
+		DatasetGroupID: c.PostForm("datasetGroupId"),
+		FileName:       fileHeader.Filename,
+		Sheet:          c.PostForm("sheet"),
+		EditType:       editType,
+		Reader:         file,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, table)
+}
+
+// Extract 重新请求 API 数据源并刷新数据集的抽取数据
+func (h *DatasetHandler) Extract(c *gin.Context) {
+	result, err := h.svc.ExtractTable(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// Sync 将数据集同步到抽取库,请求体为空时执行全量抽取
+func (h *DatasetHandler) Sync(c *gin.Context) {
+	var req service.SyncRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	task, err := h.svc.SyncTable(c.Request.Context(), c.Param("id"), &req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "task": task})
+		return
+	}
+
+	c.JSON(http.StatusOK, task)
+}
+
+// ListSyncTasks 获取数据集的抽取任务记录
+func (h *DatasetHandler) ListSyncTasks(c *gin.Context) {
+	tasks, err := h.svc.ListSyncTasks(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"tasks": tasks})
+}
+
+// DisableSync 数据集切换回直连模式
+func (h *DatasetHandler) DisableSync(c *gin.Context) {
+	if err := h.svc.DisableSync(c.Request.Context(), c.Param("id")); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "success"})
+}
+
+// GetUnions 获取关联数据集的关联关系
+func (h *DatasetHandler) GetUnions(c *gin.Context) {
+	unions, err := h.svc.GetUnions(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"unions": unions})
+}
+
+// SaveUnions 保存关联数据集的关联关系并同步字段
+func (h *DatasetHandler) SaveUnions(c *gin.Context) {
+	var req struct {
+		Unions []*model.DatasetTableUnion `json:"unions"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.svc.SaveUnions(c.Request.Context(), c.Param("id"), req.Unions); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "字段同步成功"})
+	c.JSON(http.StatusOK, gin.H{"unions": req.Unions})
 }
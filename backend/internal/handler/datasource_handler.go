@@ -155,3 +155,20 @@ func (h *DatasourceHandler) GetTableSchema(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"schema": schema})
 }
+
+// PoolStats 获取数据源连接池的健康状态和统计信息
+func (h *DatasourceHandler) PoolStats(c *gin.Context) {
+	stats := h.svc.PoolStats(c.Request.Context())
+	c.JSON(http.StatusOK, gin.H{"pools": stats})
+}
+
+// RotateCredentials 使用当前主密钥重新加密所有数据源凭据
+func (h *DatasourceHandler) RotateCredentials(c *gin.Context) {
+	rotated, err := h.svc.RotateCredentials(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"rotated": rotated})
+}
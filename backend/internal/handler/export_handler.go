@@ -65,11 +65,12 @@ func (h *ExportHandler) ExportChartData(c *gin.Context) {
 	format := c.DefaultQuery("format", "excel")
 
 	// 获取图表数据
-	data, err := h.chartService.GetChartData(c.Request.Context(), chartID)
+	result, err := h.chartService.GetChartData(c.Request.Context(), chartID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	data := result.Data
 
 	filename := fmt.Sprintf("chart_%s", chartID)
 	var filePath string
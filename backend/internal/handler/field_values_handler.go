@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"cozy-insight-backend/internal/service"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type FieldValuesHandler struct {
+	svc service.FieldValuesService
+}
+
+func NewFieldValuesHandler(svc service.FieldValuesService) *FieldValuesHandler {
+	return &FieldValuesHandler{svc: svc}
+}
+
+// Values 获取数据集字段的去重值,用于过滤组件的下拉选项
+// 支持 search 前缀搜索、limit/offset 分页、counts=true 返回每个值的行数,SQL 变量按 vars[name]=value 传入
+func (h *FieldValuesHandler) Values(c *gin.Context) {
+	req := &service.FieldValuesRequest{
+		DatasetID: c.Param("id"),
+		FieldID:   c.Param("fieldId"),
+		Search:    c.Query("search"),
+		Variables: queryVariables(c),
+	}
+	var err error
+	if v := c.Query("limit"); v != "" {
+		if req.Limit, err = strconv.Atoi(v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit: " + v})
+			return
+		}
+	}
+	if v := c.Query("offset"); v != "" {
+		if req.Offset, err = strconv.Atoi(v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid offset: " + v})
+			return
+		}
+	}
+	if v := c.Query("counts"); v != "" {
+		if req.Counts, err = strconv.ParseBool(v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid counts: " + v})
+			return
+		}
+	}
+
+	userID := c.GetString("userID")
+	result, err := h.svc.Values(c.Request.Context(), userID, req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
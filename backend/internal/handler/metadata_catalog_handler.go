@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"cozy-insight-backend/internal/service"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type MetadataCatalogHandler struct {
+	svc service.MetadataCatalogService
+}
+
+func NewMetadataCatalogHandler(svc service.MetadataCatalogService) *MetadataCatalogHandler {
+	return &MetadataCatalogHandler{svc: svc}
+}
+
+// Refresh 立即采集数据源元数据,返回快照及与上一次快照相比的变更
+func (h *MetadataCatalogHandler) Refresh(c *gin.Context) {
+	result, err := h.svc.Refresh(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// Get 获取数据源最近一次成功的元数据快照
+func (h *MetadataCatalogHandler) Get(c *gin.Context) {
+	snapshot, err := h.svc.GetCatalog(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, snapshot)
+}
+
+// ListSnapshots 获取数据源的快照历史,默认最近 20 次
+func (h *MetadataCatalogHandler) ListSnapshots(c *gin.Context) {
+	limit := 20
+	if limitStr := c.Query("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
+			limit = l
+		}
+	}
+
+	list, err := h.svc.ListSnapshots(c.Request.Context(), c.Param("id"), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, list)
+}
+
+// GetChanges 获取快照的变更及受影响的数据集和图表
+func (h *MetadataCatalogHandler) GetChanges(c *gin.Context) {
+	changes, err := h.svc.GetChanges(c.Request.Context(), c.Param("snapshotId"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"changes": changes})
+}
@@ -0,0 +1,40 @@
+package handler
+
+import (
+	"cozy-insight-backend/internal/service"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ShareDataHandler 分享链接的公开数据访问
+type ShareDataHandler struct {
+	shares    service.ShareService
+	chartData service.ChartDataService
+}
+
+func NewShareDataHandler(shares service.ShareService, chartData service.ChartDataService) *ShareDataHandler {
+	return &ShareDataHandler{shares: shares, chartData: chartData}
+}
+
+// ChartData 获取分享图表的数据(公开访问)
+// 分享链接上的 vars[name]=value 查询参数作为 SQL 数据集的变量值
+func (h *ShareDataHandler) ChartData(c *gin.Context) {
+	share, err := h.shares.ValidateShare(c.Request.Context(), c.Param("token"), c.Query("password"))
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	if share.ResourceType != "chart" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "share is not a chart"})
+		return
+	}
+
+	result, err := h.chartData.GetChartDataWithFilter(c.Request.Context(), share.ResourceID, &service.QueryFilter{Variables: queryVariables(c)})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
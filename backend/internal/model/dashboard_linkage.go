@@ -27,6 +27,7 @@ type DashboardParameter struct {
 	ParamType     string `gorm:"type:varchar(50)" json:"paramType"` // text, date, select, multiselect
 	DefaultValue  string `gorm:"type:varchar(500)" json:"defaultValue"`
 	Options       string `gorm:"type:text" json:"options"` // JSON数组,下拉选项
+	FieldMapping  string `gorm:"type:text" json:"fieldMapping"` // JSON对象,组件ID -> 该组件数据集上的字段
 	Required      bool   `gorm:"default:false" json:"required"`
 	Enable        bool   `gorm:"default:true" json:"enable"`
 	CreateTime    int64  `gorm:"autoCreateTime:milli" json:"createTime"`
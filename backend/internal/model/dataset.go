@@ -23,8 +23,9 @@ type DatasetTable struct {
 	PhysicalTableName string `gorm:"column:table_name;type:varchar(255)" json:"tableName"` // 物理表名或生成的表名
 	DatasourceID      string `gorm:"type:varchar(50)" json:"datasourceId"`
 	DatasetGroupID    string `gorm:"type:varchar(50)" json:"datasetGroupId"`
-	Type              string `gorm:"type:varchar(50)" json:"type"` // db, sql
-	Info              string `gorm:"type:longtext" json:"info"`    // JSON配置: SQL语句等
+	Type              string `gorm:"type:varchar(50)" json:"type"`   // db, sql
+	Info              string `gorm:"type:longtext" json:"info"`      // JSON配置: SQL语句等
+	Mode              int    `gorm:"type:int;default:0" json:"mode"` // 0: 直连, 1: 抽取到本地抽取库
 	CreateTime        int64  `gorm:"autoCreateTime:milli" json:"createTime"`
 	UpdateTime        int64  `gorm:"autoUpdateTime:milli" json:"updateTime"`
 	CreateBy          string `gorm:"type:varchar(50)" json:"createBy"`
@@ -47,6 +48,7 @@ type DatasetTableField struct {
 	GroupType      string `gorm:"type:varchar(50)" json:"groupType"` // d: dimension, q: measure
 	Checked        bool   `gorm:"type:boolean" json:"checked"`
 	ColumnIndex    int    `gorm:"type:int" json:"columnIndex"`
+	Missing        bool   `gorm:"type:boolean;default:false" json:"missing"` // 源中已不存在的列,保留字段ID和用户设置
 }
 
 func (DatasetTableField) TableName() string {
@@ -27,8 +27,23 @@ type APIDatasourceConfig struct {
 	Headers     map[string]string `json:"headers"`
 	Body        string            `json:"body"`
 	AuthType    string            `json:"authType"`    // none, basic, bearer
-	AuthToken   string            `json:"authToken"`
-	ResponseType string            `json:"responseType"` // json, xml
+	AuthToken   string            `json:"authToken"`   // basic 认证时为 user:password
+	ResponseType string            `json:"responseType"` // json
+	RowsPath    string            `json:"rowsPath"`    // 数据行数组路径, 如 $.data.items
+	Pagination  *APIPagination    `json:"pagination"`
+}
+
+// APIPagination API分页配置
+type APIPagination struct {
+	Type        string `json:"type"`        // none, page, offset, cursor
+	PageParam   string `json:"pageParam"`   // 页码参数名, 默认 page
+	SizeParam   string `json:"sizeParam"`   // 每页条数参数名, page 默认 pageSize, offset 默认 limit
+	OffsetParam string `json:"offsetParam"` // 偏移参数名, 默认 offset
+	CursorParam string `json:"cursorParam"` // 游标参数名, 默认 cursor
+	CursorPath  string `json:"cursorPath"`  // 响应中下一页游标的路径, 如 $.next
+	PageSize    int    `json:"pageSize"`    // 每页条数, 默认 100
+	StartPage   int    `json:"startPage"`   // 起始页码, 默认 1
+	MaxPages    int    `json:"maxPages"`    // 最多请求页数, 默认 100
 }
 
 // 扩展数据源类型常量
@@ -0,0 +1,35 @@
+package model
+
+// MetadataSnapshot 数据源元数据快照
+type MetadataSnapshot struct {
+	ID           string `gorm:"primaryKey;type:varchar(50)" json:"id"`
+	DatasourceID string `gorm:"type:varchar(50);index" json:"datasourceId"`
+	Status       string `gorm:"type:varchar(20)" json:"status"` // success, failed
+	Error        string `gorm:"type:text" json:"error"`
+	TableCount   int    `gorm:"type:int" json:"tableCount"`
+	ColumnCount  int    `gorm:"type:int" json:"columnCount"`
+	ChangeCount  int    `gorm:"type:int" json:"changeCount"`  // 与上一次成功快照相比的变更数
+	Catalog      string `gorm:"type:longtext" json:"catalog"` // JSON: 数据库、表和字段
+	CreateTime   int64  `gorm:"autoCreateTime:milli" json:"createTime"`
+}
+
+func (MetadataSnapshot) TableName() string {
+	return "core_metadata_snapshot"
+}
+
+// MetadataChange 相邻两次快照之间的元数据变更
+type MetadataChange struct {
+	ID           string `gorm:"primaryKey;type:varchar(50)" json:"id"`
+	SnapshotID   string `gorm:"type:varchar(50);index" json:"snapshotId"`
+	DatasourceID string `gorm:"type:varchar(50);index" json:"datasourceId"`
+	ChangeType   string `gorm:"type:varchar(50)" json:"changeType"` // table_added, table_removed, column_added, column_removed, column_type_changed
+	SourceTable  string `gorm:"column:table_name;type:varchar(255)" json:"tableName"`
+	ColumnName   string `gorm:"type:varchar(255)" json:"columnName"`
+	OldType      string `gorm:"type:varchar(100)" json:"oldType"`
+	NewType      string `gorm:"type:varchar(100)" json:"newType"`
+	CreateTime   int64  `gorm:"autoCreateTime:milli" json:"createTime"`
+}
+
+func (MetadataChange) TableName() string {
+	return "core_metadata_change"
+}
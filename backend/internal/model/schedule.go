@@ -4,7 +4,7 @@ package model
 type ScheduleTask struct {
 	ID          string `gorm:"primaryKey;type:varchar(50)" json:"id"`
 	Name        string `gorm:"type:varchar(200);not null" json:"name"`
-	Type        string `gorm:"type:varchar(50)" json:"type"` // email_report, snapshot, data_sync
+	Type        string `gorm:"type:varchar(50)" json:"type"` // email_report, snapshot, data_sync, metadata_refresh
 	CronExpr    string `gorm:"type:varchar(100)" json:"cronExpr"`
 	Enabled     bool   `gorm:"default:false" json:"enabled"`
 	Status      string `gorm:"type:varchar(20)" json:"status"` // active, inactive, running
@@ -41,7 +41,7 @@ type DatasetTableFieldCalculated struct {
 	FieldName      string `gorm:"type:varchar(255)" json:"fieldName"`
 	DisplayName    string `gorm:"type:varchar(255)" json:"displayName"`
 	Expression     string `gorm:"type:text" json:"expression"` // 计算公式
-	DataType       string `gorm:"type:varchar(50)" json:"dataType"` // string, long, double, date
+	DataType       string `gorm:"type:varchar(50)" json:"dataType"` // string, double, date, boolean,由表达式类型推断
 	CreateTime     int64  `gorm:"autoCreateTime:milli" json:"createTime"`
 	UpdateTime     int64  `gorm:"autoUpdateTime:milli" json:"updateTime"`
 }
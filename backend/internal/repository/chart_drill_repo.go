@@ -0,0 +1,45 @@
+package repository
+
+import (
+	"context"
+	"cozy-insight-backend/internal/model"
+	"cozy-insight-backend/pkg/database"
+
+	"gorm.io/gorm"
+)
+
+type ChartDrillRepository interface {
+	Create(ctx context.Context, drill *model.ChartViewDrill) error
+	Update(ctx context.Context, drill *model.ChartViewDrill) error
+	Delete(ctx context.Context, id string) error
+	ListByChart(ctx context.Context, chartID string) ([]*model.ChartViewDrill, error)
+}
+
+type chartDrillRepository struct {
+	db *gorm.DB
+}
+
+func NewChartDrillRepository() ChartDrillRepository {
+	return &chartDrillRepository{
+		db: database.DB,
+	}
+}
+
+func (r *chartDrillRepository) Create(ctx context.Context, drill *model.ChartViewDrill) error {
+	return r.db.WithContext(ctx).Create(drill).Error
+}
+
+func (r *chartDrillRepository) Update(ctx context.Context, drill *model.ChartViewDrill) error {
+	return r.db.WithContext(ctx).Save(drill).Error
+}
+
+func (r *chartDrillRepository) Delete(ctx context.Context, id string) error {
+	return r.db.WithContext(ctx).Delete(&model.ChartViewDrill{}, "id = ?", id).Error
+}
+
+// ListByChart 按创建顺序返回图表的钻取配置
+func (r *chartDrillRepository) ListByChart(ctx context.Context, chartID string) ([]*model.ChartViewDrill, error) {
+	var drills []*model.ChartViewDrill
+	err := r.db.WithContext(ctx).Where("chart_view_id = ?", chartID).Order("create_time").Find(&drills).Error
+	return drills, err
+}
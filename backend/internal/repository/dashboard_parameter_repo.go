@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"context"
+	"cozy-insight-backend/internal/model"
+	"cozy-insight-backend/pkg/database"
+
+	"gorm.io/gorm"
+)
+
+type DashboardParameterRepository interface {
+	Create(ctx context.Context, param *model.DashboardParameter) error
+	Update(ctx context.Context, param *model.DashboardParameter) error
+	Delete(ctx context.Context, id string) error
+	Get(ctx context.Context, id string) (*model.DashboardParameter, error)
+	ListByDashboard(ctx context.Context, dashboardID string) ([]*model.DashboardParameter, error)
+}
+
+type dashboardParameterRepository struct {
+	db *gorm.DB
+}
+
+func NewDashboardParameterRepository() DashboardParameterRepository {
+	return &dashboardParameterRepository{
+		db: database.DB,
+	}
+}
+
+func (r *dashboardParameterRepository) Create(ctx context.Context, param *model.DashboardParameter) error {
+	return r.db.WithContext(ctx).Create(param).Error
+}
+
+func (r *dashboardParameterRepository) Update(ctx context.Context, param *model.DashboardParameter) error {
+	return r.db.WithContext(ctx).Save(param).Error
+}
+
+func (r *dashboardParameterRepository) Delete(ctx context.Context, id string) error {
+	return r.db.WithContext(ctx).Delete(&model.DashboardParameter{}, "id = ?", id).Error
+}
+
+func (r *dashboardParameterRepository) Get(ctx context.Context, id string) (*model.DashboardParameter, error) {
+	var param model.DashboardParameter
+	if err := r.db.WithContext(ctx).First(&param, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &param, nil
+}
+
+// ListByDashboard 按创建顺序返回仪表板的参数
+func (r *dashboardParameterRepository) ListByDashboard(ctx context.Context, dashboardID string) ([]*model.DashboardParameter, error) {
+	var params []*model.DashboardParameter
+	err := r.db.WithContext(ctx).Where("dashboard_id = ?", dashboardID).Order("create_time").Find(&params).Error
+	return params, err
+}
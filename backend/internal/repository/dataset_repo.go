@@ -27,6 +27,15 @@ type DatasetRepository interface {
 	GetFields(ctx context.Context, tableId string) ([]*model.DatasetTableField, error)
 	DeleteFieldsByTableID(ctx context.Context, tableId string) error
 	BatchCreateFields(ctx context.Context, fields []*model.DatasetTableField) error
+
+	// Dataset Union
+	ListUnions(ctx context.Context, tableId string) ([]*model.DatasetTableUnion, error)
+	SaveUnions(ctx context.Context, tableId string, unions []*model.DatasetTableUnion) error
+
+	// Dataset Task
+	CreateTask(ctx context.Context, task *model.DatasetTableTask) error
+	UpdateTask(ctx context.Context, task *model.DatasetTableTask) error
+	ListTasks(ctx context.Context, tableId string) ([]*model.DatasetTableTask, error)
 }
 
 type datasetRepository struct{}
@@ -120,3 +129,37 @@ func (r *datasetRepository) BatchCreateFields(ctx context.Context, fields []*mod
 	}
 	return database.DB.WithContext(ctx).Create(&fields).Error
 }
+
+func (r *datasetRepository) ListUnions(ctx context.Context, tableId string) ([]*model.DatasetTableUnion, error) {
+	var list []*model.DatasetTableUnion
+	err := database.DB.WithContext(ctx).Where("dataset_table_id = ?", tableId).Order("create_time, id").Find(&list).Error
+	return list, err
+}
+
+func (r *datasetRepository) SaveUnions(ctx context.Context, tableId string, unions []*model.DatasetTableUnion) error {
+	// Transaction to replace unions
+	return database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&model.DatasetTableUnion{}, "dataset_table_id = ?", tableId).Error; err != nil {
+			return err
+		}
+		if len(unions) == 0 {
+			return nil
+		}
+		return tx.Create(unions).Error
+	})
+}
+
+func (r *datasetRepository) CreateTask(ctx context.Context, task *model.DatasetTableTask) error {
+	return database.DB.WithContext(ctx).Create(task).Error
+}
+
+func (r *datasetRepository) UpdateTask(ctx context.Context, task *model.DatasetTableTask) error {
+	return database.DB.WithContext(ctx).Save(task).Error
+}
+
+// ListTasks 按创建时间倒序返回数据集的抽取任务
+func (r *datasetRepository) ListTasks(ctx context.Context, tableId string) ([]*model.DatasetTableTask, error) {
+	var list []*model.DatasetTableTask
+	err := database.DB.WithContext(ctx).Where("table_id = ?", tableId).Order("create_time DESC, id DESC").Find(&list).Error
+	return list, err
+}
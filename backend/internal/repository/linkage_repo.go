@@ -0,0 +1,37 @@
+package repository
+
+import (
+	"context"
+	"cozy-insight-backend/internal/model"
+	"cozy-insight-backend/pkg/database"
+
+	"gorm.io/gorm"
+)
+
+// LinkageRepository 图表联动和仪表板联动配置
+type LinkageRepository interface {
+	ListByDashboard(ctx context.Context, dashboardID string) ([]*model.DashboardLinkage, error)
+	ListBySourceChart(ctx context.Context, chartID string) ([]*model.ChartViewLinkage, error)
+}
+
+type linkageRepository struct {
+	db *gorm.DB
+}
+
+func NewLinkageRepository() LinkageRepository {
+	return &linkageRepository{
+		db: database.DB,
+	}
+}
+
+func (r *linkageRepository) ListByDashboard(ctx context.Context, dashboardID string) ([]*model.DashboardLinkage, error) {
+	var linkages []*model.DashboardLinkage
+	err := r.db.WithContext(ctx).Where("dashboard_id = ?", dashboardID).Order("create_time").Find(&linkages).Error
+	return linkages, err
+}
+
+func (r *linkageRepository) ListBySourceChart(ctx context.Context, chartID string) ([]*model.ChartViewLinkage, error) {
+	var linkages []*model.ChartViewLinkage
+	err := r.db.WithContext(ctx).Where("source_view_id = ?", chartID).Order("create_time").Find(&linkages).Error
+	return linkages, err
+}
@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"context"
+	"cozy-insight-backend/internal/model"
+	"cozy-insight-backend/pkg/database"
+
+	"gorm.io/gorm"
+)
+
+type MetadataRepository interface {
+	// CreateSnapshot 保存快照及其变更
+	CreateSnapshot(ctx context.Context, snapshot *model.MetadataSnapshot, changes []*model.MetadataChange) error
+	GetSnapshot(ctx context.Context, id string) (*model.MetadataSnapshot, error)
+	// LatestSnapshot 数据源最近一次成功的快照,不存在时返回 nil
+	LatestSnapshot(ctx context.Context, datasourceID string) (*model.MetadataSnapshot, error)
+	ListSnapshots(ctx context.Context, datasourceID string, limit int) ([]*model.MetadataSnapshot, error)
+	ListChanges(ctx context.Context, snapshotID string) ([]*model.MetadataChange, error)
+}
+
+type metadataRepository struct{}
+
+func NewMetadataRepository() MetadataRepository {
+	return &metadataRepository{}
+}
+
+func (r *metadataRepository) CreateSnapshot(ctx context.Context, snapshot *model.MetadataSnapshot, changes []*model.MetadataChange) error {
+	return database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(snapshot).Error; err != nil {
+			return err
+		}
+		if len(changes) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(changes, 100).Error
+	})
+}
+
+func (r *metadataRepository) GetSnapshot(ctx context.Context, id string) (*model.MetadataSnapshot, error) {
+	var snapshot model.MetadataSnapshot
+	err := database.DB.WithContext(ctx).First(&snapshot, "id = ?", id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+func (r *metadataRepository) LatestSnapshot(ctx context.Context, datasourceID string) (*model.MetadataSnapshot, error) {
+	var list []*model.MetadataSnapshot
+	err := database.DB.WithContext(ctx).
+		Where("datasource_id = ? AND status = ?", datasourceID, "success").
+		Order("create_time desc").Limit(1).Find(&list).Error
+	if err != nil || len(list) == 0 {
+		return nil, err
+	}
+	return list[0], nil
+}
+
+func (r *metadataRepository) ListSnapshots(ctx context.Context, datasourceID string, limit int) ([]*model.MetadataSnapshot, error) {
+	var list []*model.MetadataSnapshot
+	query := database.DB.WithContext(ctx).Omit("catalog").Where("datasource_id = ?", datasourceID).Order("create_time desc")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	err := query.Find(&list).Error
+	return list, err
+}
+
+func (r *metadataRepository) ListChanges(ctx context.Context, snapshotID string) ([]*model.MetadataChange, error) {
+	var list []*model.MetadataChange
+	err := database.DB.WithContext(ctx).Where("snapshot_id = ?", snapshotID).Order("table_name, column_name").Find(&list).Error
+	return list, err
+}
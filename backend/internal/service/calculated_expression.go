@@ -0,0 +1,163 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"cozy-insight-backend/internal/engine"
+	"cozy-insight-backend/internal/model"
+	"cozy-insight-backend/internal/repository"
+)
+
+// 计算字段数据类型,与 DatasetTableFieldCalculated.DataType 取值一致
+const (
+	CalculatedTypeString  = "string"
+	CalculatedTypeDouble  = "double"
+	CalculatedTypeDate    = "date"
+	CalculatedTypeBoolean = "boolean"
+)
+
+// ExpressionCheck 表达式校验结果
+type ExpressionCheck struct {
+	Valid      bool                `json:"valid"`
+	DataType   string              `json:"dataType,omitempty"`
+	Aggregated bool                `json:"aggregated"`
+	Errors     []*engine.ExprError `json:"errors"`
+}
+
+// calculatedFields 数据集字段和计算字段的名称解析,计算字段按字段名、显示名或ID引用
+type calculatedFields struct {
+	resolver *fieldResolver
+	defs     map[string]*model.DatasetTableFieldCalculated
+	parsed   map[string]*engine.Expression
+	parsing  map[string]bool
+}
+
+func newCalculatedFields(fields []*model.DatasetTableField, calculated []*model.DatasetTableFieldCalculated) *calculatedFields {
+	c := &calculatedFields{
+		resolver: newFieldResolver(fields),
+		defs:     make(map[string]*model.DatasetTableFieldCalculated, len(calculated)*3),
+		parsed:   make(map[string]*engine.Expression),
+		parsing:  make(map[string]bool),
+	}
+	for _, def := range calculated {
+		c.add(def)
+	}
+	return c
+}
+
+// loadCalculatedFields 加载数据集的计算字段,未配置计算字段仓库时视为没有计算字段
+func loadCalculatedFields(ctx context.Context, repo repository.CalculatedFieldRepository, tableID string, fields []*model.DatasetTableField) (*calculatedFields, error) {
+	var calculated []*model.DatasetTableFieldCalculated
+	if repo != nil {
+		var err error
+		calculated, err = repo.ListByTable(ctx, tableID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get calculated fields: %w", err)
+		}
+	}
+	return newCalculatedFields(fields, calculated), nil
+}
+
+// add 加入或替换计算字段定义
+func (c *calculatedFields) add(def *model.DatasetTableFieldCalculated) {
+	for name, existing := range c.defs {
+		if existing.ID == def.ID {
+			delete(c.defs, name)
+		}
+	}
+	for _, name := range []string{def.DisplayName, def.ID, def.FieldName} {
+		if name != "" {
+			c.defs[name] = def
+		}
+	}
+	c.parsed = make(map[string]*engine.Expression)
+}
+
+// get 按名称查找计算字段
+func (c *calculatedFields) get(name string) (*model.DatasetTableFieldCalculated, bool) {
+	def, ok := c.defs[name]
+	return def, ok
+}
+
+// lookup 表达式中 [name] 的查找函数
+func (c *calculatedFields) lookup(name string) (*engine.ExprField, error) {
+	if def, ok := c.defs[name]; ok {
+		expr, err := c.expression(def)
+		if err != nil {
+			return nil, err
+		}
+		return &engine.ExprField{Column: def.FieldName, Type: expr.Type, Expr: expr}, nil
+	}
+
+	field, ok := c.resolver.fields[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown field [%s]", name)
+	}
+	column, err := c.resolver.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	return &engine.ExprField{Column: column, Type: engine.ExprTypeOf(field.DeType)}, nil
+}
+
+// expression 解析计算字段的表达式,检测计算字段之间的循环引用
+func (c *calculatedFields) expression(def *model.DatasetTableFieldCalculated) (*engine.Expression, error) {
+	if expr, ok := c.parsed[def.ID]; ok {
+		return expr, nil
+	}
+	if c.parsing[def.ID] {
+		return nil, fmt.Errorf("circular reference to calculated field [%s]", def.FieldName)
+	}
+
+	c.parsing[def.ID] = true
+	expr, err := engine.ParseExpression(def.Expression, c.lookup)
+	delete(c.parsing, def.ID)
+	if err != nil {
+		if _, nested := err.(engine.ExprErrors); nested && len(c.parsing) > 0 {
+			return nil, fmt.Errorf("calculated field [%s] is invalid: %w", def.FieldName, err)
+		}
+		return nil, err
+	}
+	c.parsed[def.ID] = expr
+	return expr, nil
+}
+
+// column 解析图表引用的字段
+// 普通字段返回原始列名;非聚合计算字段作为计算列加入查询并返回列名;聚合计算字段返回表达式
+func (c *calculatedFields) column(query *engine.Query, name string) (string, *engine.Expression, error) {
+	def, ok := c.defs[name]
+	if !ok {
+		column, err := c.resolver.resolve(name)
+		return column, nil, err
+	}
+
+	expr, err := c.expression(def)
+	if err != nil {
+		return "", nil, fmt.Errorf("calculated field %s: %w", def.FieldName, err)
+	}
+	if expr.Aggregated {
+		return "", expr, nil
+	}
+	for _, computed := range query.Source.Computed {
+		if computed.Name == def.FieldName {
+			return def.FieldName, nil, nil
+		}
+	}
+	query.Source.Computed = append(query.Source.Computed, engine.ComputedColumn{Name: def.FieldName, Expr: expr})
+	return def.FieldName, nil, nil
+}
+
+// calculatedDataType 表达式类型对应的计算字段数据类型
+func calculatedDataType(t engine.ExprType) string {
+	switch t {
+	case engine.ExprNumber:
+		return CalculatedTypeDouble
+	case engine.ExprTime:
+		return CalculatedTypeDate
+	case engine.ExprBool:
+		return CalculatedTypeBoolean
+	default:
+		return CalculatedTypeString
+	}
+}
@@ -2,10 +2,11 @@ package service
 
 import (
 	"context"
+	"cozy-insight-backend/internal/engine"
 	"cozy-insight-backend/internal/model"
 	"cozy-insight-backend/internal/repository"
+	"errors"
 	"fmt"
-	"strings"
 
 	"github.com/google/uuid"
 )
@@ -16,17 +17,18 @@ type CalculatedFieldService interface {
 	Delete(ctx context.Context, id string) error
 	Get(ctx context.Context, id string) (*model.DatasetTableFieldCalculated, error)
 	ListByTable(ctx context.Context, tableID string) ([]*model.DatasetTableFieldCalculated, error)
-	
-	// 计算字段值
-	CalculateValue(ctx context.Context, expression string, row map[string]interface{}) (interface{}, error)
+
+	// Validate 校验计算字段表达式,语法和类型错误在结果中返回并带有位置信息
+	Validate(ctx context.Context, field *model.DatasetTableFieldCalculated) (*ExpressionCheck, error)
 }
 
 type calculatedFieldService struct {
-	repo repository.CalculatedFieldRepository
+	repo        repository.CalculatedFieldRepository
+	datasetRepo repository.DatasetRepository
 }
 
-func NewCalculatedFieldService(repo repository.CalculatedFieldRepository) CalculatedFieldService {
-	return &calculatedFieldService{repo: repo}
+func NewCalculatedFieldService(repo repository.CalculatedFieldRepository, datasetRepo repository.DatasetRepository) CalculatedFieldService {
+	return &calculatedFieldService{repo: repo, datasetRepo: datasetRepo}
 }
 
 func (s *calculatedFieldService) Create(ctx context.Context, field *model.DatasetTableFieldCalculated) error {
@@ -42,6 +44,9 @@ func (s *calculatedFieldService) Create(ctx context.Context, field *model.Datase
 		field.ID = uuid.New().String()
 	}
 
+	if err := s.check(ctx, field); err != nil {
+		return err
+	}
 	return s.repo.Create(ctx, field)
 }
 
@@ -51,11 +56,35 @@ func (s *calculatedFieldService) Update(ctx context.Context, field *model.Datase
 		return fmt.Errorf("field not found: %w", err)
 	}
 
+	field.DatasetTableID = existing.DatasetTableID
 	field.CreateTime = existing.CreateTime
+	if field.FieldName == "" {
+		field.FieldName = existing.FieldName
+	}
+	if field.Expression == "" {
+		field.Expression = existing.Expression
+	}
+	if err := s.check(ctx, field); err != nil {
+		return err
+	}
 	return s.repo.Update(ctx, field)
 }
 
+// Delete 删除计算字段,被其他计算字段引用时拒绝删除
 func (s *calculatedFieldService) Delete(ctx context.Context, id string) error {
+	field, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return fmt.Errorf("field not found: %w", err)
+	}
+	fields, calculated, err := s.load(ctx, field.DatasetTableID)
+	if err != nil {
+		return err
+	}
+
+	others := excludeCalculated(calculated, id)
+	if err := checkDependents(field.FieldName, newCalculatedFields(fields, calculated), newCalculatedFields(fields, others), others); err != nil {
+		return err
+	}
 	return s.repo.Delete(ctx, id)
 }
 
@@ -67,23 +96,98 @@ func (s *calculatedFieldService) ListByTable(ctx context.Context, tableID string
 	return s.repo.ListByTable(ctx, tableID)
 }
 
-// CalculateValue 计算字段值 (简化实现,支持基本四则运算)
-func (s *calculatedFieldService) CalculateValue(ctx context.Context, expression string, row map[string]interface{}) (interface{}, error) {
-	// 简化的表达式计算
-	// 支持格式: [字段名] + [字段名] * 数字 等
-	
-	expr := expression
-	
-	// 替换字段名为实际值
-	for key, value := range row {
-		placeholder := fmt.Sprintf("[%s]", key)
-		if strings.Contains(expr, placeholder) {
-			expr = strings.ReplaceAll(expr, placeholder, fmt.Sprintf("%v", value))
+func (s *calculatedFieldService) Validate(ctx context.Context, field *model.DatasetTableFieldCalculated) (*ExpressionCheck, error) {
+	if field.DatasetTableID == "" {
+		return nil, fmt.Errorf("table id is required")
+	}
+	fields, calculated, err := s.load(ctx, field.DatasetTableID)
+	if err != nil {
+		return nil, err
+	}
+
+	calc := newCalculatedFields(fields, excludeCalculated(calculated, field.ID))
+	calc.add(field)
+	expr, err := calc.expression(field)
+	if err != nil {
+		var exprErrs engine.ExprErrors
+		if !errors.As(err, &exprErrs) {
+			return nil, err
+		}
+		return &ExpressionCheck{Errors: exprErrs}, nil
+	}
+	return &ExpressionCheck{
+		Valid:      true,
+		DataType:   calculatedDataType(expr.Type),
+		Aggregated: expr.Aggregated,
+		Errors:     []*engine.ExprError{},
+	}, nil
+}
+
+// check 保存前校验字段名和表达式,并按表达式类型设置数据类型
+// 引用该字段的其他计算字段在修改后必须仍然有效
+func (s *calculatedFieldService) check(ctx context.Context, field *model.DatasetTableFieldCalculated) error {
+	fields, calculated, err := s.load(ctx, field.DatasetTableID)
+	if err != nil {
+		return err
+	}
+
+	others := excludeCalculated(calculated, field.ID)
+	calc := newCalculatedFields(fields, others)
+	if f, ok := calc.resolver.fields[field.FieldName]; ok {
+		return fmt.Errorf("field name %s conflicts with dataset field %s", field.FieldName, f.OriginName)
+	}
+	if _, ok := calc.get(field.FieldName); ok {
+		return fmt.Errorf("calculated field %s already exists", field.FieldName)
+	}
+
+	calc.add(field)
+	expr, err := calc.expression(field)
+	if err != nil {
+		return fmt.Errorf("invalid expression: %w", err)
+	}
+	if err := checkDependents(field.FieldName, newCalculatedFields(fields, calculated), calc, others); err != nil {
+		return err
+	}
+	field.DataType = calculatedDataType(expr.Type)
+	return nil
+}
+
+// load 加载数据集字段和计算字段
+func (s *calculatedFieldService) load(ctx context.Context, tableID string) ([]*model.DatasetTableField, []*model.DatasetTableFieldCalculated, error) {
+	if _, err := s.datasetRepo.GetTable(ctx, tableID); err != nil {
+		return nil, nil, fmt.Errorf("dataset not found: %w", err)
+	}
+	fields, err := s.datasetRepo.GetFields(ctx, tableID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get dataset fields: %w", err)
+	}
+	calculated, err := s.repo.ListByTable(ctx, tableID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get calculated fields: %w", err)
+	}
+	return fields, calculated, nil
+}
+
+// excludeCalculated 去掉指定ID的计算字段
+func excludeCalculated(calculated []*model.DatasetTableFieldCalculated, id string) []*model.DatasetTableFieldCalculated {
+	others := make([]*model.DatasetTableFieldCalculated, 0, len(calculated))
+	for _, def := range calculated {
+		if def.ID != id {
+			others = append(others, def)
+		}
+	}
+	return others
+}
+
+// checkDependents 修改或删除计算字段后,原本有效的其他计算字段必须仍然有效
+func checkDependents(name string, before, after *calculatedFields, others []*model.DatasetTableFieldCalculated) error {
+	for _, def := range others {
+		if _, err := before.expression(def); err != nil {
+			continue
+		}
+		if _, err := after.expression(def); err != nil {
+			return fmt.Errorf("calculated field %s is used by %s: %w", name, def.FieldName, err)
 		}
 	}
-	
-	// 这里简化处理,实际应该使用表达式解析器
-	// 可以集成 github.com/Knetic/govaluate 等库
-	
-	return expr, nil
+	return nil
 }
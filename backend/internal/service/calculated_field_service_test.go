@@ -0,0 +1,184 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"cozy-insight-backend/internal/engine"
+	"cozy-insight-backend/internal/model"
+	"cozy-insight-backend/pkg/logger"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// memCalculatedFieldRepo 内存计算字段仓库
+type memCalculatedFieldRepo struct {
+	items []*model.DatasetTableFieldCalculated
+}
+
+func (r *memCalculatedFieldRepo) Create(ctx context.Context, field *model.DatasetTableFieldCalculated) error {
+	r.items = append(r.items, field)
+	return nil
+}
+
+func (r *memCalculatedFieldRepo) Update(ctx context.Context, field *model.DatasetTableFieldCalculated) error {
+	for i, item := range r.items {
+		if item.ID == field.ID {
+			r.items[i] = field
+			return nil
+		}
+	}
+	return fmt.Errorf("field %s not found", field.ID)
+}
+
+func (r *memCalculatedFieldRepo) Delete(ctx context.Context, id string) error {
+	for i, item := range r.items {
+		if item.ID == id {
+			r.items = append(r.items[:i], r.items[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+func (r *memCalculatedFieldRepo) Get(ctx context.Context, id string) (*model.DatasetTableFieldCalculated, error) {
+	for _, item := range r.items {
+		if item.ID == id {
+			return item, nil
+		}
+	}
+	return nil, fmt.Errorf("field %s not found", id)
+}
+
+func (r *memCalculatedFieldRepo) ListByTable(ctx context.Context, tableID string) ([]*model.DatasetTableFieldCalculated, error) {
+	var items []*model.DatasetTableFieldCalculated
+	for _, item := range r.items {
+		if item.DatasetTableID == tableID {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+func newCalculatedTestRepos() (*stubDatasetRepo, *memCalculatedFieldRepo) {
+	datasetRepo := &stubDatasetRepo{
+		table: &model.DatasetTable{ID: "table1", DatasourceID: "ds1", Type: DatasetTypeDB, PhysicalTableName: "sales"},
+		fields: []*model.DatasetTableField{
+			{ID: "f1", OriginName: "region", Name: "region", DeType: engine.DeTypeText},
+			{ID: "f2", OriginName: "amount", Name: "amount", DeType: engine.DeTypeFloat},
+			{ID: "f3", OriginName: "cost", Name: "cost", DeType: engine.DeTypeFloat},
+		},
+	}
+	return datasetRepo, &memCalculatedFieldRepo{}
+}
+
+func TestCalculatedFieldService_Validate(t *testing.T) {
+	datasetRepo, calcRepo := newCalculatedTestRepos()
+	svc := NewCalculatedFieldService(calcRepo, datasetRepo)
+	ctx := context.Background()
+
+	result, err := svc.Validate(ctx, &model.DatasetTableFieldCalculated{DatasetTableID: "table1", Expression: "SUM([amount]) / SUM([cost])"})
+	require.NoError(t, err)
+	assert.True(t, result.Valid)
+	assert.True(t, result.Aggregated)
+	assert.Equal(t, CalculatedTypeDouble, result.DataType)
+
+	result, err = svc.Validate(ctx, &model.DatasetTableFieldCalculated{DatasetTableID: "table1", Expression: "[region] + [unknown]"})
+	require.NoError(t, err)
+	assert.False(t, result.Valid)
+	require.Len(t, result.Errors, 2)
+	assert.Equal(t, 10, result.Errors[0].Pos)
+	assert.Contains(t, result.Errors[0].Message, "use CONCAT")
+	assert.Equal(t, 12, result.Errors[1].Pos)
+	assert.Contains(t, result.Errors[1].Message, "unknown field [unknown]")
+
+	_, err = svc.Validate(ctx, &model.DatasetTableFieldCalculated{DatasetTableID: "missing", Expression: "1"})
+	assert.ErrorContains(t, err, "dataset not found")
+}
+
+func TestCalculatedFieldService_CreateUpdateDelete(t *testing.T) {
+	datasetRepo, calcRepo := newCalculatedTestRepos()
+	svc := NewCalculatedFieldService(calcRepo, datasetRepo)
+	ctx := context.Background()
+
+	profit := &model.DatasetTableFieldCalculated{DatasetTableID: "table1", FieldName: "profit", Expression: "[amount] - [cost]"}
+	require.NoError(t, svc.Create(ctx, profit))
+	assert.Equal(t, CalculatedTypeDouble, profit.DataType)
+
+	margin := &model.DatasetTableFieldCalculated{DatasetTableID: "table1", FieldName: "margin", Expression: "[profit] / [amount]"}
+	require.NoError(t, svc.Create(ctx, margin))
+
+	err := svc.Create(ctx, &model.DatasetTableFieldCalculated{DatasetTableID: "table1", FieldName: "amount", Expression: "1"})
+	assert.ErrorContains(t, err, "conflicts with dataset field")
+	err = svc.Create(ctx, &model.DatasetTableFieldCalculated{DatasetTableID: "table1", FieldName: "profit", Expression: "1"})
+	assert.ErrorContains(t, err, "already exists")
+	err = svc.Create(ctx, &model.DatasetTableFieldCalculated{DatasetTableID: "table1", FieldName: "bad", Expression: "[amount] +"})
+	assert.ErrorContains(t, err, "invalid expression: position 11")
+
+	// 计算字段之间不能循环引用
+	err = svc.Update(ctx, &model.DatasetTableFieldCalculated{ID: profit.ID, Expression: "[margin] * 2"})
+	assert.ErrorContains(t, err, "circular reference")
+
+	err = svc.Update(ctx, &model.DatasetTableFieldCalculated{ID: profit.ID, Expression: "IF([amount] > [cost], 'gain', 'loss')"})
+	assert.ErrorContains(t, err, "must be number, got text")
+
+	// 被引用的计算字段不能删除
+	assert.ErrorContains(t, svc.Delete(ctx, profit.ID), "is used by margin")
+	require.NoError(t, svc.Delete(ctx, margin.ID))
+	require.NoError(t, svc.Delete(ctx, profit.ID))
+	assert.Empty(t, calcRepo.items)
+}
+
+func TestGetChartData_CalculatedFields(t *testing.T) {
+	logger.InitLogger("error")
+
+	path := filepath.Join(t.TempDir(), "sales.db")
+	db, err := sql.Open("sqlite3", path)
+	require.NoError(t, err)
+	_, err = db.Exec(`CREATE TABLE sales (region TEXT, amount REAL, cost REAL)`)
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO sales VALUES ('east', 100, 60), ('east', 50, 40), ('west', 80, 20), ('north', 10, 30)`)
+	require.NoError(t, err)
+	db.Close()
+
+	datasetRepo, calcRepo := newCalculatedTestRepos()
+	calcRepo.items = []*model.DatasetTableFieldCalculated{
+		{ID: "c1", DatasetTableID: "table1", FieldName: "profit", Expression: "[amount] - [cost]"},
+		{ID: "c2", DatasetTableID: "table1", FieldName: "result", DisplayName: "盈亏", Expression: "IF([profit] >= 0, 'gain', 'loss')"},
+		{ID: "c3", DatasetTableID: "table1", FieldName: "margin", Expression: "SUM([profit]) / SUM([amount])"},
+	}
+	chart := &model.ChartView{
+		ID:      "chart1",
+		TableID: "table1",
+		XAxis:   `{"fields":[{"name":"盈亏"}]}`,
+		YAxis:   `{"fields":[{"name":"profit","aggregate":"SUM"},{"name":"margin","aggregate":"SUM","sort":"DESC"}]}`,
+	}
+	chartRepo := new(MockChartRepository)
+	chartRepo.On("Get", mock.Anything, "chart1").Return(chart, nil)
+	dsRepo := &stubDatasourceRepo{items: map[string]*model.Datasource{
+		"ds1": {ID: "ds1", Type: "sqlite", Configuration: fmt.Sprintf(`{"path":%q}`, path)},
+	}}
+	router := engine.NewQueryRouter(engine.NewNativeExecutor(engine.NewConnectionManager(nil)))
+	svc := NewChartDataService(chartRepo, datasetRepo, dsRepo, calcRepo, nil, router, nil)
+	ctx := context.Background()
+
+	// 非聚合计算字段可作为维度和过滤条件,聚合计算字段作为指标
+	result, err := svc.GetChartDataWithFilter(ctx, "chart1", &QueryFilter{Filters: []FilterCondition{
+		{Field: "profit", Operator: "!=", Value: 10},
+	}})
+	require.NoError(t, err)
+	require.Len(t, result.Data, 2)
+	assert.Equal(t, "gain", result.Data[0]["盈亏"])
+	assert.Equal(t, 100.0, result.Data[0]["profit"])
+	assert.InDelta(t, 100.0/180, result.Data[0]["margin"], 1e-9)
+	assert.Equal(t, "loss", result.Data[1]["盈亏"])
+
+	chart.XAxis = `{"fields":[{"name":"margin"}]}`
+	_, err = svc.GetChartData(ctx, "chart1")
+	assert.ErrorContains(t, err, "cannot be used as a dimension")
+}
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"cozy-insight-backend/internal/engine"
 	"cozy-insight-backend/internal/model"
 	"encoding/json"
 	"fmt"
@@ -10,11 +11,21 @@ import (
 type AggregateType string
 
 const (
-	AggregateSum   AggregateType = "SUM"
-	AggregateAvg   AggregateType = "AVG"
-	AggregateCount AggregateType = "COUNT"
-	AggregateMax   AggregateType = "MAX"
-	AggregateMin   AggregateType = "MIN"
+	AggregateSum                 AggregateType = engine.AggregateSum
+	AggregateAvg                 AggregateType = engine.AggregateAvg
+	AggregateCount               AggregateType = engine.AggregateCount
+	AggregateMax                 AggregateType = engine.AggregateMax
+	AggregateMin                 AggregateType = engine.AggregateMin
+	AggregateCountDistinct       AggregateType = engine.AggregateCountDistinct
+	AggregateApproxCountDistinct AggregateType = engine.AggregateApproxCountDistinct // 近似去重计数,方言不支持时为精确计数
+	AggregateMedian              AggregateType = engine.AggregateMedian
+	AggregateP90                 AggregateType = engine.AggregateP90
+	AggregateP95                 AggregateType = engine.AggregateP95
+	AggregateP99                 AggregateType = engine.AggregateP99
+	AggregateStddev              AggregateType = engine.AggregateStddev   // 样本标准差
+	AggregateVariance            AggregateType = engine.AggregateVariance // 样本方差
+	AggregateFirst               AggregateType = engine.AggregateFirst    // 按时间字段排序的第一个值
+	AggregateLast                AggregateType = engine.AggregateLast     // 按时间字段排序的最后一个值
 )
 
 // ValidateAggregate 验证聚合类型
@@ -25,6 +36,16 @@ func ValidateAggregate(agg string) bool {
 		AggregateCount,
 		AggregateMax,
 		AggregateMin,
+		AggregateCountDistinct,
+		AggregateApproxCountDistinct,
+		AggregateMedian,
+		AggregateP90,
+		AggregateP95,
+		AggregateP99,
+		AggregateStddev,
+		AggregateVariance,
+		AggregateFirst,
+		AggregateLast,
 	}
 
 	for _, valid := range validAggregates {
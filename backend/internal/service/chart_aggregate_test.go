@@ -17,6 +17,9 @@ func TestValidateAggregate(t *testing.T) {
 		{"Valid COUNT", "COUNT", true},
 		{"Valid MAX", "MAX", true},
 		{"Valid MIN", "MIN", true},
+		{"Valid COUNT_DISTINCT", "COUNT_DISTINCT", true},
+		{"Valid P95", "P95", true},
+		{"Valid LAST", "LAST", true},
 		{"Invalid TOTAL", "TOTAL", false},
 		{"Invalid empty", "", false},
 		{"Invalid lowercase", "sum", false},
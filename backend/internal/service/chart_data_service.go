@@ -6,7 +6,6 @@ import (
 	"cozy-insight-backend/internal/model"
 	"cozy-insight-backend/internal/repository"
 	"cozy-insight-backend/pkg/logger"
-	"encoding/json"
 	"fmt"
 	"strings"
 
@@ -14,14 +13,36 @@ import (
 )
 
 type ChartDataService interface {
-	GetChartData(ctx context.Context, chartID string) ([]map[string]interface{}, error)
-	GetChartDataWithFilter(ctx context.Context, chartID string, filter *QueryFilter) ([]map[string]interface{}, error)
+	GetChartData(ctx context.Context, chartID string) (*ChartDataResult, error)
+	GetChartDataWithFilter(ctx context.Context, chartID string, filter *QueryFilter) (*ChartDataResult, error)
+	// QueryChart 使用已加载的图表和数据集查询,批量查询时避免重复读取
+	QueryChart(ctx context.Context, source *ChartSource, filter *QueryFilter) (*ChartDataResult, error)
+}
+
+// ChartSource 查询图表所需的图表、数据集和字段
+type ChartSource struct {
+	Chart  *model.ChartView
+	Table  *model.DatasetTable
+	Fields []*model.DatasetTableField
 }
 
 type chartDataService struct {
-	chartRepo   repository.ChartRepository
-	datasetRepo repository.DatasetRepository
-	calcite     *engine.CalciteClient
+	chartRepo      repository.ChartRepository
+	datasetRepo    repository.DatasetRepository
+	datasourceRepo repository.DatasourceRepository
+	calculatedRepo repository.CalculatedFieldRepository
+	drillRepo      repository.ChartDrillRepository
+	router         *engine.QueryRouter
+	extract        *engine.ExtractStore
+}
+
+// ChartDataResult 图表数据及查询执行路径
+type ChartDataResult struct {
+	Data     []map[string]interface{} `json:"data"`
+	Engine   string                   `json:"engine"`   // native, calcite
+	Fallback bool                     `json:"fallback"` // 是否由备用路径执行
+	Measures []MeasureMeta            `json:"measures"` // 指标列的数据类型和展示格式
+	Drill    *DrillState              `json:"drill,omitempty"`
 }
 
 // QueryFilter 查询过滤器
@@ -29,6 +50,13 @@ type QueryFilter struct {
 	Filters []FilterCondition `json:"filters"`
 	Limit   int               `json:"limit"`
 	Offset  int               `json:"offset"`
+
+	// Variables SQL 数据集的变量值,按变量名提供
+	// 字段名为已声明变量名的 = 或 IN 过滤条件同样作为变量值
+	Variables map[string]interface{} `json:"variables"`
+
+	// Drill 钻取路径,按层级依次为点击的字段和值,为空时显示第一层
+	Drill []DrillStep `json:"drill"`
 }
 
 // FilterCondition 过滤条件
@@ -46,24 +74,38 @@ type AxisConfig struct {
 // FieldConfig 字段配置
 type FieldConfig struct {
 	Name      string `json:"name"`
-	Aggregate string `json:"aggregate"` // SUM, AVG, COUNT, MAX, MIN
+	Aggregate string `json:"aggregate"` // 取值同 AggregateType
 	Sort      string `json:"sort"`      // ASC, DESC
 	DataType  string `json:"dataType"`
+
+	// 指标配置
+	OrderBy string         `json:"orderBy,omitempty"` // FIRST、LAST 的排序字段,默认为数据集的第一个时间字段
+	Format  *MeasureFormat `json:"format,omitempty"`  // 展示格式
+
+	// 时间维度配置,仅对时间字段生效
+	Granularity string `json:"granularity,omitempty"` // year, quarter, month, week, day, hour, minute
+	WeekStart   string `json:"weekStart,omitempty"`   // 周粒度的每周第一天,默认 monday
+	TimeZone    string `json:"timeZone,omitempty"`    // 展示时区(IANA 名称),时间值按 UTC 存储
+	GapFill     string `json:"gapFill,omitempty"`     // 空桶补齐: null, zero,为空时不补齐
 }
 
-func NewChartDataService(chartRepo repository.ChartRepository, datasetRepo repository.DatasetRepository, calcite *engine.CalciteClient) ChartDataService {
+func NewChartDataService(chartRepo repository.ChartRepository, datasetRepo repository.DatasetRepository, datasourceRepo repository.DatasourceRepository, calculatedRepo repository.CalculatedFieldRepository, drillRepo repository.ChartDrillRepository, router *engine.QueryRouter, extract *engine.ExtractStore) ChartDataService {
 	return &chartDataService{
-		chartRepo:   chartRepo,
-		datasetRepo: datasetRepo,
-		calcite:     calcite,
+		chartRepo:      chartRepo,
+		datasetRepo:    datasetRepo,
+		datasourceRepo: datasourceRepo,
+		calculatedRepo: calculatedRepo,
+		drillRepo:      drillRepo,
+		router:         router,
+		extract:        extract,
 	}
 }
 
-func (s *chartDataService) GetChartData(ctx context.Context, chartID string) ([]map[string]interface{}, error) {
+func (s *chartDataService) GetChartData(ctx context.Context, chartID string) (*ChartDataResult, error) {
 	return s.GetChartDataWithFilter(ctx, chartID, nil)
 }
 
-func (s *chartDataService) GetChartDataWithFilter(ctx context.Context, chartID string, filter *QueryFilter) ([]map[string]interface{}, error) {
+func (s *chartDataService) GetChartDataWithFilter(ctx context.Context, chartID string, filter *QueryFilter) (*ChartDataResult, error) {
 	// 获取图表配置
 	chart, err := s.chartRepo.Get(ctx, chartID)
 	if err != nil {
@@ -78,159 +120,236 @@ func (s *chartDataService) GetChartDataWithFilter(ctx context.Context, chartID s
 		return nil, fmt.Errorf("dataset not found: %w", err)
 	}
 
-	// 构建 SQL
-	sql, err := s.buildChartSQL(chart, table, filter)
+	// 获取数据集字段,用于校验图表引用的字段
+	fields, err := s.datasetRepo.GetFields(ctx, table.ID)
+	if err != nil {
+		logger.Log.Error("failed to get fields", zap.String("tableId", table.ID), zap.Error(err))
+		return nil, fmt.Errorf("failed to get dataset fields: %w", err)
+	}
+
+	return s.QueryChart(ctx, &ChartSource{Chart: chart, Table: table, Fields: fields}, filter)
+}
+
+func (s *chartDataService) QueryChart(ctx context.Context, source *ChartSource, filter *QueryFilter) (*ChartDataResult, error) {
+	table, fields := source.Table, source.Fields
+
+	// 应用钻取路径
+	chart, filter, drill, err := s.applyDrill(ctx, source.Chart, table, fields, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	// 构建查询
+	config, err := ParseChartConfig(chart)
 	if err != nil {
-		logger.Log.Error("failed to build SQL", zap.Error(err))
+		return nil, err
+	}
+	calc, err := loadCalculatedFields(ctx, s.calculatedRepo, table.ID, fields)
+	if err != nil {
+		return nil, err
+	}
+	query, err := s.buildChartQuery(ctx, config, calc, table, fields, filter)
+	if err != nil {
+		logger.Log.Error("failed to build query", zap.Error(err))
 		return nil, fmt.Errorf("failed to build SQL: %w", err)
 	}
 
-	logger.Log.Info("executing chart query", zap.String("sql", sql))
+	// 确定执行目标
+	target, err := resolveQueryTarget(ctx, s.datasourceRepo, s.extract, table)
+	if err != nil {
+		logger.Log.Error("failed to resolve query target", zap.String("tableId", table.ID), zap.Error(err))
+		return nil, err
+	}
 
 	// 执行查询
-	data, err := s.executeQuery(ctx, sql)
+	result, err := s.executeQuery(ctx, target, query)
 	if err != nil {
 		logger.Log.Error("failed to execute query", zap.Error(err))
 		return nil, fmt.Errorf("failed to execute query: %w", err)
 	}
 
-	return data, nil
+	// 补齐时间维度的空桶,生成指标元数据
+	rows, err := fillTimeGaps(config, result.Rows)
+	if err != nil {
+		return nil, err
+	}
+	measures, err := chartMeasures(config, calc)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Log.Info("chart query executed",
+		zap.String("chartId", chart.ID),
+		zap.String("engine", result.Path),
+		zap.Bool("fallback", result.Fallback))
+
+	return &ChartDataResult{
+		Data:     rows,
+		Engine:   result.Path,
+		Fallback: result.Fallback,
+		Measures: measures,
+		Drill:    drill,
+	}, nil
 }
 
-// buildChartSQL 构建图表查询 SQL
-func (s *chartDataService) buildChartSQL(chart *model.ChartView, dataset *model.DatasetTable, filter *QueryFilter) (string, error) {
-	// 解析 X 轴和 Y 轴配置
-	var xAxisConfig, yAxisConfig AxisConfig
-	if chart.XAxis != "" {
-		if err := json.Unmarshal([]byte(chart.XAxis), &xAxisConfig); err != nil {
-			return "", fmt.Errorf("invalid xAxis config: %w", err)
-		}
+// buildChartQuery 将解析后的图表配置转换为结构化查询
+func (s *chartDataService) buildChartQuery(ctx context.Context, config *ChartQueryConfig, calc *calculatedFields, dataset *model.DatasetTable, fields []*model.DatasetTableField, filter *QueryFilter) (*engine.Query, error) {
+	filters, values := splitVariableFilters(dataset, calc.resolver, filter)
+	source, err := loadDatasetSource(ctx, s.datasetRepo, dataset, values)
+	if err != nil {
+		return nil, err
 	}
-	if chart.YAxis != "" {
-		if err := json.Unmarshal([]byte(chart.YAxis), &yAxisConfig); err != nil {
-			return "", fmt.Errorf("invalid yAxis config: %w", err)
-		}
+
+	query := &engine.Query{Source: source}
+	hasFieldRefs := len(config.XAxis.Fields) > 0 || len(config.YAxis.Fields) > 0 || len(filters) > 0
+	if hasFieldRefs && len(fields) == 0 {
+		return nil, fmt.Errorf("dataset %s has no synced fields", dataset.ID)
 	}
 
-	// 获取基础 SQL
-	var baseSQL string
-	if dataset.Type == "sql" {
-		var info map[string]interface{}
-		if err := json.Unmarshal([]byte(dataset.Info), &info); err != nil {
-			return "", fmt.Errorf("invalid dataset info: %w", err)
+	// X 轴字段（维度）
+	for _, field := range config.XAxis.Fields {
+		bucket, err := chartTimeBucket(field)
+		if err != nil {
+			return nil, err
 		}
-		if v, ok := info["sql"].(string); ok {
-			baseSQL = v
+		if bucket != nil {
+			column, err := calc.bucketColumn(query, field.Name, bucket)
+			if err != nil {
+				return nil, err
+			}
+			query.Selects = append(query.Selects, engine.SelectItem{Field: column, Alias: field.Name})
+			query.GroupBy = append(query.GroupBy, column)
+			continue
 		}
-	} else if dataset.Type == "db" {
-		baseSQL = fmt.Sprintf("SELECT * FROM %s", dataset.PhysicalTableName)
-	}
-
-	// 构建 SELECT 子句
-	var selectFields []string
-	var groupByFields []string
 
-	// X 轴字段（维度）
-	for _, field := range xAxisConfig.Fields {
-		selectFields = append(selectFields, field.Name)
-		groupByFields = append(groupByFields, field.Name)
+		column, expr, err := calc.column(query, field.Name)
+		if err != nil {
+			return nil, err
+		}
+		if expr != nil {
+			return nil, fmt.Errorf("aggregated calculated field %s cannot be used as a dimension", field.Name)
+		}
+		query.Selects = append(query.Selects, engine.SelectItem{Field: column, Alias: field.Name})
+		query.GroupBy = append(query.GroupBy, column)
 	}
 
 	// Y 轴字段（指标，需要聚合）
-	for _, field := range yAxisConfig.Fields {
-		if field.Aggregate != "" {
-			selectFields = append(selectFields, fmt.Sprintf("%s(%s) AS %s",
-				field.Aggregate, field.Name, field.Name))
+	for _, field := range config.YAxis.Fields {
+		item := engine.SelectItem{Aggregate: field.Aggregate, Alias: field.Name}
+		if field.Aggregate != "" && !ValidateAggregate(field.Aggregate) {
+			return nil, fmt.Errorf("unsupported aggregate: %s", field.Aggregate)
+		}
+		if field.Name == "*" && field.Aggregate == string(AggregateCount) {
+			item.Field = "*"
+			item.Alias = "count"
 		} else {
-			selectFields = append(selectFields, field.Name)
+			column, expr, err := calc.column(query, field.Name)
+			if err != nil {
+				return nil, err
+			}
+			item.Field = column
+			if expr != nil {
+				// 聚合计算字段自身已包含聚合,忽略轴上的聚合方式
+				item.Expr = expr
+				item.Aggregate = ""
+			}
 		}
-	}
-
-	if len(selectFields) == 0 {
-		selectFields = append(selectFields, "*")
-	}
-
-	// 构建完整 SQL
-	sql := fmt.Sprintf("SELECT %s FROM (%s) AS base",
-		strings.Join(selectFields, ", "), baseSQL)
-
-	// 添加 WHERE 条件
-	if filter != nil && len(filter.Filters) > 0 {
-		whereConditions := s.buildWhereConditions(filter.Filters)
-		if len(whereConditions) > 0 {
-			sql += " WHERE " + strings.Join(whereConditions, " AND ")
+		if item.Aggregate != "" && engine.AggregateNeedsOrder(item.Aggregate) {
+			orderField := field.OrderBy
+			if orderField == "" {
+				orderField = defaultOrderField(fields)
+			}
+			if orderField == "" {
+				return nil, fmt.Errorf("%s on %s requires an order field", field.Aggregate, field.Name)
+			}
+			column, expr, err := calc.column(query, orderField)
+			if err != nil {
+				return nil, err
+			}
+			if expr != nil {
+				return nil, fmt.Errorf("aggregated calculated field %s cannot be used as an order field", orderField)
+			}
+			item.OrderField = column
 		}
+		query.Selects = append(query.Selects, item)
 	}
 
-	// 添加 GROUP BY
-	if len(groupByFields) > 0 {
-		sql += " GROUP BY " + strings.Join(groupByFields, ", ")
+	// 排序（只取第一个排序字段,指标优先）
+	sortFields := make([]FieldConfig, 0, len(config.YAxis.Fields)+len(config.XAxis.Fields))
+	sortFields = append(sortFields, config.YAxis.Fields...)
+	sortFields = append(sortFields, config.XAxis.Fields...)
+	for _, field := range sortFields {
+		if field.Sort == "" {
+			continue
+		}
+		sort := strings.ToUpper(field.Sort)
+		if sort != "ASC" && sort != "DESC" {
+			return nil, fmt.Errorf("invalid sort direction: %s", field.Sort)
+		}
+		alias := field.Name
+		if field.Name == "*" {
+			alias = "count"
+		}
+		query.OrderBy = append(query.OrderBy, engine.OrderItem{Field: alias, Desc: sort == "DESC"})
+		break
 	}
 
-	// 添加 ORDER BY
-	for _, field := range yAxisConfig.Fields {
-		if field.Sort != "" {
-			sql += fmt.Sprintf(" ORDER BY %s %s", field.Name, field.Sort)
-			break // 只取第一个排序字段
+	// 过滤条件
+	for _, f := range filters {
+		column, expr, err := calc.column(query, f.Field)
+		if err != nil {
+			return nil, err
+		}
+		if expr != nil {
+			return nil, fmt.Errorf("aggregated calculated field %s cannot be used in filters", f.Field)
 		}
+		query.Filters = append(query.Filters, engine.Filter{Field: column, Operator: f.Operator, Value: f.Value})
 	}
 
-	// 添加 LIMIT
+	// 分页
 	if filter != nil && filter.Limit > 0 {
-		sql += fmt.Sprintf(" LIMIT %d", filter.Limit)
-		if filter.Offset > 0 {
-			sql += fmt.Sprintf(" OFFSET %d", filter.Offset)
-		}
+		query.Limit = filter.Limit
+		query.Offset = filter.Offset
 	} else {
-		sql += " LIMIT 1000" // 默认限制
+		query.Limit = 1000 // 默认限制
 	}
 
-	return sql, nil
+	return query, nil
 }
 
-// extractFields 从配置中提取字段名
-func (s *chartDataService) extractFields(config map[string]interface{}) []string {
-	var fields []string
-
-	if config == nil {
-		return fields
+// splitVariableFilters 拆分过滤条件和 SQL 变量值
+// 字段名不属于数据集且为已声明变量名的 = 或 IN 条件作为变量值
+// 返回的变量值始终不为 nil,图表查询缺少必填变量时报错而不是以 NULL 绑定
+func splitVariableFilters(dataset *model.DatasetTable, resolver *fieldResolver, filter *QueryFilter) ([]FilterCondition, map[string]interface{}) {
+	values := make(map[string]interface{})
+	if filter == nil {
+		return nil, values
 	}
-
-	// 尝试从 fields 数组中提取
-	if fieldsData, ok := config["fields"].([]interface{}); ok {
-		for _, f := range fieldsData {
-			if fieldMap, ok := f.(map[string]interface{}); ok {
-				if name, ok := fieldMap["name"].(string); ok {
-					fields = append(fields, name)
-				}
-			}
-		}
+	for name, value := range filter.Variables {
+		values[name] = value
 	}
 
-	return fields
-}
-
-// executeQuery 执行 SQL 查询
-func (s *chartDataService) executeQuery(ctx context.Context, sql string) ([]map[string]interface{}, error) {
-	if s.calcite == nil {
-		return nil, fmt.Errorf("calcite engine not initialized")
+	declared := make(map[string]bool)
+	for _, v := range datasetVariables(dataset) {
+		declared[v.Name] = true
 	}
-
-	return s.calcite.ExecuteQuery(ctx, sql)
+	filters := make([]FilterCondition, 0, len(filter.Filters))
+	for _, f := range filter.Filters {
+		op := strings.ToUpper(strings.TrimSpace(f.Operator))
+		if _, err := resolver.resolve(f.Field); err != nil && declared[f.Field] && (op == "=" || op == "IN") {
+			values[f.Field] = f.Value
+			continue
+		}
+		filters = append(filters, f)
+	}
+	return filters, values
 }
 
-// joinFields 连接字段名
-func joinFields(fields []string) string {
-	if len(fields) == 0 {
-		return "*"
+// executeQuery 经查询路由器执行查询
+func (s *chartDataService) executeQuery(ctx context.Context, target *engine.QueryTarget, query *engine.Query) (*engine.QueryResult, error) {
+	if s.router == nil {
+		return nil, fmt.Errorf("query router not initialized")
 	}
 
-	result := ""
-	for i, field := range fields {
-		if i > 0 {
-			result += ", "
-		}
-		result += field
-	}
-	return result
+	return s.router.Execute(ctx, target, query)
 }
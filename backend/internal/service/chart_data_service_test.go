@@ -2,12 +2,18 @@ package service
 
 import (
 	"context"
+	"cozy-insight-backend/internal/engine"
 	"cozy-insight-backend/internal/model"
 	"cozy-insight-backend/internal/repository"
+	"cozy-insight-backend/pkg/logger"
+	"database/sql"
+	"fmt"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 // Mock Repository
@@ -92,6 +98,64 @@ func (m *MockDatasetRepository) BatchCreateFields(ctx context.Context, fields []
 	return nil
 }
 
+func (m *MockDatasetRepository) ListUnions(ctx context.Context, tableId string) ([]*model.DatasetTableUnion, error) {
+	return nil, nil
+}
+
+func (m *MockDatasetRepository) SaveUnions(ctx context.Context, tableId string, unions []*model.DatasetTableUnion) error {
+	return nil
+}
+
+func (m *MockDatasetRepository) CreateTask(ctx context.Context, task *model.DatasetTableTask) error {
+	return nil
+}
+
+func (m *MockDatasetRepository) UpdateTask(ctx context.Context, task *model.DatasetTableTask) error {
+	return nil
+}
+
+func (m *MockDatasetRepository) ListTasks(ctx context.Context, tableId string) ([]*model.DatasetTableTask, error) {
+	return nil, nil
+}
+
+// salesFields 测试用数据集字段
+func salesFields() []*model.DatasetTableField {
+	return []*model.DatasetTableField{
+		{ID: "f1", OriginName: "category", Name: "category"},
+		{ID: "f2", OriginName: "amount", Name: "amount"},
+		{ID: "f3", OriginName: "total", Name: "total"},
+		{ID: "f4", OriginName: "average", Name: "average"},
+		{ID: "f5", OriginName: "count", Name: "count"},
+		{ID: "f6", OriginName: "date", Name: "date"},
+		{ID: "f7", OriginName: "revenue", Name: "revenue"},
+		{ID: "f8", OriginName: "status", Name: "status"},
+		{ID: "f9", OriginName: "cust_name", Name: "customer"},
+	}
+}
+
+// calciteDialect 查询经 Calcite 执行时使用的方言
+func calciteDialect() engine.Dialect {
+	d, _ := engine.GetDialect(engine.DialectCalcite)
+	return d
+}
+
+// buildChartSQL 按 Calcite 方言构建图表查询 SQL,返回语句和绑定参数
+func (s *chartDataService) buildChartSQL(ctx context.Context, chart *model.ChartView, dataset *model.DatasetTable, fields []*model.DatasetTableField, filter *QueryFilter) (string, []interface{}, error) {
+	config, err := ParseChartConfig(chart)
+	if err != nil {
+		return "", nil, err
+	}
+	calc, err := loadCalculatedFields(ctx, s.calculatedRepo, dataset.ID, fields)
+	if err != nil {
+		return "", nil, err
+	}
+	query, err := s.buildChartQuery(ctx, config, calc, dataset, fields, filter)
+	if err != nil {
+		return "", nil, err
+	}
+	return query.Build(calciteDialect())
+}
+
 // Test buildChartSQL
 func TestBuildChartSQL_WithAggregates(t *testing.T) {
 	service := &chartDataService{}
@@ -100,8 +164,8 @@ func TestBuildChartSQL_WithAggregates(t *testing.T) {
 		ID:      "chart1",
 		TableID: "table1",
 		Type:    "bar",
-		XAxis:   `{\"fields\":[{\"name\":\"category\"}]}`,
-		YAxis:   `{\"fields\":[{\"name\":\"amount\",\"aggregate\":\"SUM\",\"sort\":\"DESC\"}]}`,
+		XAxis:   `{"fields":[{"name":"category"}]}`,
+		YAxis:   `{"fields":[{"name":"amount","aggregate":"SUM","sort":"DESC"}]}`,
 	}
 
 	dataset := &model.DatasetTable{
@@ -110,13 +174,10 @@ func TestBuildChartSQL_WithAggregates(t *testing.T) {
 		Type:              "db",
 	}
 
-	sql, err := service.buildChartSQL(chart, dataset, nil)
+	sql, args, err := service.buildChartSQL(context.Background(), chart, dataset, salesFields(), nil)
 	assert.NoError(t, err)
-	assert.Contains(t, sql, "SELECT")
-	assert.Contains(t, sql, "category")
-	assert.Contains(t, sql, "SUM(amount)")
-	assert.Contains(t, sql, "GROUP BY category")
-	assert.Contains(t, sql, "ORDER BY amount DESC")
+	assert.Empty(t, args)
+	assert.Equal(t, `SELECT "category", SUM("amount") AS "amount" FROM "sales" GROUP BY "category" ORDER BY "amount" DESC LIMIT 1000`, sql)
 }
 
 func TestBuildChartSQL_WithFilter(t *testing.T) {
@@ -126,8 +187,8 @@ func TestBuildChartSQL_WithFilter(t *testing.T) {
 		ID:      "chart1",
 		TableID: "table1",
 		Type:    "line",
-		XAxis:   `{\"fields\":[{\"name\":\"date\"}]}`,
-		YAxis:   `{\"fields\":[{\"name\":\"revenue\",\"aggregate\":\"SUM\"}]}`,
+		XAxis:   `{"fields":[{"name":"date"}]}`,
+		YAxis:   `{"fields":[{"name":"revenue","aggregate":"SUM"}]}`,
 	}
 
 	dataset := &model.DatasetTable{
@@ -145,10 +206,11 @@ func TestBuildChartSQL_WithFilter(t *testing.T) {
 		Offset: 0,
 	}
 
-	sql, err := service.buildChartSQL(chart, dataset, filter)
+	sql, args, err := service.buildChartSQL(context.Background(), chart, dataset, salesFields(), filter)
 	assert.NoError(t, err)
-	assert.Contains(t, sql, "WHERE")
+	assert.Contains(t, sql, `WHERE "status" = ? AND "amount" > ?`)
 	assert.Contains(t, sql, "LIMIT 50")
+	assert.Equal(t, []interface{}{"completed", 100}, args)
 }
 
 func TestBuildChartSQL_MultipleAggregates(t *testing.T) {
@@ -158,11 +220,11 @@ func TestBuildChartSQL_MultipleAggregates(t *testing.T) {
 		ID:      "chart1",
 		TableID: "table1",
 		Type:    "bar",
-		XAxis:   `{\"fields\":[{\"name\":\"category\"}]}`,
-		YAxis: `{\"fields\":[
-			{\"name\":\"total\",\"aggregate\":\"SUM\"},
-			{\"name\":\"average\",\"aggregate\":\"AVG\"},
-			{\"name\":\"count\",\"aggregate\":\"COUNT\"}
+		XAxis:   `{"fields":[{"name":"category"}]}`,
+		YAxis: `{"fields":[
+			{"name":"total","aggregate":"SUM"},
+			{"name":"average","aggregate":"AVG"},
+			{"name":"count","aggregate":"COUNT"}
 		]}`,
 	}
 
@@ -172,56 +234,216 @@ func TestBuildChartSQL_MultipleAggregates(t *testing.T) {
 		Type:              "db",
 	}
 
-	sql, err := service.buildChartSQL(chart, dataset, nil)
+	sql, _, err := service.buildChartSQL(context.Background(), chart, dataset, salesFields(), nil)
+	assert.NoError(t, err)
+	assert.Contains(t, sql, `SUM("total")`)
+	assert.Contains(t, sql, `AVG("average")`)
+	assert.Contains(t, sql, `COUNT("count")`)
+}
+
+func TestBuildChartSQL_FieldAlias(t *testing.T) {
+	service := &chartDataService{}
+
+	chart := &model.ChartView{
+		XAxis: `{"fields":[{"name":"customer"}]}`,
+		YAxis: `{"fields":[{"name":"*","aggregate":"COUNT"}]}`,
+	}
+	dataset := &model.DatasetTable{
+		ID:   "table1",
+		Type: "sql",
+		Info: `{"sql":"SELECT * FROM orders"}`,
+	}
+
+	sql, _, err := service.buildChartSQL(context.Background(), chart, dataset, salesFields(), nil)
 	assert.NoError(t, err)
-	assert.Contains(t, sql, "SUM(total)")
-	assert.Contains(t, sql, "AVG(average)")
-	assert.Contains(t, sql, "COUNT(count)")
+	assert.Equal(t, `SELECT "cust_name" AS "customer", COUNT(*) AS "count" FROM (SELECT * FROM orders) AS "base" GROUP BY "cust_name" LIMIT 1000`, sql)
 }
 
-func TestBuildWhereConditions(t *testing.T) {
+func TestBuildChartSQL_RejectsInjection(t *testing.T) {
 	service := &chartDataService{}
+	dataset := &model.DatasetTable{ID: "table1", PhysicalTableName: "sales", Type: "db"}
 
 	tests := []struct {
-		name     string
-		filters  []FilterCondition
-		expected int // 期望的条件数量
+		name   string
+		chart  *model.ChartView
+		filter *QueryFilter
 	}{
 		{
-			name: "等于条件",
-			filters: []FilterCondition{
-				{Field: "status", Operator: "=", Value: "active"},
-			},
-			expected: 1,
+			name:  "未知维度字段",
+			chart: &model.ChartView{XAxis: `{"fields":[{"name":"category; DROP TABLE sales"}]}`},
 		},
 		{
-			name: "大于条件",
-			filters: []FilterCondition{
-				{Field: "age", Operator: ">", Value: 18},
-			},
-			expected: 1,
+			name:  "非法聚合函数",
+			chart: &model.ChartView{YAxis: `{"fields":[{"name":"amount","aggregate":"SUM(1)); --"}]}`},
 		},
 		{
-			name: "LIKE条件",
-			filters: []FilterCondition{
-				{Field: "name", Operator: "LIKE", Value: "%test%"},
-			},
-			expected: 1,
+			name:  "非法排序方向",
+			chart: &model.ChartView{YAxis: `{"fields":[{"name":"amount","aggregate":"SUM","sort":"DESC; --"}]}`},
 		},
 		{
-			name: "多个条件",
-			filters: []FilterCondition{
-				{Field: "status", Operator: "=", Value: "active"},
-				{Field: "amount", Operator: ">=", Value: 100},
-			},
-			expected: 2,
+			name:   "未知过滤字段",
+			chart:  &model.ChartView{},
+			filter: &QueryFilter{Filters: []FilterCondition{{Field: "1=1 OR status", Operator: "=", Value: "x"}}},
+		},
+		{
+			name:   "非法过滤操作符",
+			chart:  &model.ChartView{},
+			filter: &QueryFilter{Filters: []FilterCondition{{Field: "status", Operator: "= 1 OR", Value: "x"}}},
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			conditions := service.buildWhereConditions(tt.filters)
-			assert.Equal(t, tt.expected, len(conditions))
+			_, _, err := service.buildChartSQL(context.Background(), tt.chart, dataset, salesFields(), tt.filter)
+			assert.Error(t, err)
 		})
 	}
 }
+
+func TestBuildChartSQL_FilterValuesAreBound(t *testing.T) {
+	service := &chartDataService{}
+	dataset := &model.DatasetTable{ID: "table1", PhysicalTableName: "sales", Type: "db"}
+
+	filter := &QueryFilter{
+		Filters: []FilterCondition{
+			{Field: "status", Operator: "=", Value: "x' OR '1'='1"},
+			{Field: "category", Operator: "IN", Value: []interface{}{"a", "b"}},
+			{Field: "customer", Operator: "LIKE", Value: "bob"},
+		},
+	}
+
+	sql, args, err := service.buildChartSQL(context.Background(), &model.ChartView{}, dataset, salesFields(), filter)
+	assert.NoError(t, err)
+	assert.NotContains(t, sql, "OR '1'='1")
+	assert.Contains(t, sql, `"status" = ? AND "category" IN (?, ?) AND "cust_name" LIKE ?`)
+	assert.Equal(t, []interface{}{"x' OR '1'='1", "a", "b", "%bob%"}, args)
+}
+
+func TestBuildChartSQL_RequiresSyncedFields(t *testing.T) {
+	service := &chartDataService{}
+	dataset := &model.DatasetTable{ID: "table1", PhysicalTableName: "sales", Type: "db"}
+	chart := &model.ChartView{XAxis: `{"fields":[{"name":"category"}]}`}
+
+	_, _, err := service.buildChartSQL(context.Background(), chart, dataset, nil, nil)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "no synced fields")
+}
+
+func TestResolveQueryTarget_Federated(t *testing.T) {
+	tests := []struct {
+		name  string
+		table *model.DatasetTable
+	}{
+		{"no datasource", &model.DatasetTable{ID: "t1", Type: "db", PhysicalTableName: "sales"}},
+		{"federated sql", &model.DatasetTable{ID: "t2", DatasourceID: "ds1", Type: "sql", Info: `{"sql":"SELECT 1","federated":true}`}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target, err := resolveQueryTarget(context.Background(), nil, nil, tt.table)
+			assert.NoError(t, err)
+			assert.True(t, target.Federated)
+		})
+	}
+}
+
+// stubDatasourceRepo 内存数据源仓库
+type stubDatasourceRepo struct {
+	repository.DatasourceRepository
+	items map[string]*model.Datasource
+}
+
+func (r *stubDatasourceRepo) GetByID(ctx context.Context, id string) (*model.Datasource, error) {
+	ds, ok := r.items[id]
+	if !ok {
+		return nil, fmt.Errorf("datasource %s not found", id)
+	}
+	return ds, nil
+}
+
+func (r *stubDatasourceRepo) Create(ctx context.Context, ds *model.Datasource) error {
+	copied := *ds
+	r.items[ds.ID] = &copied
+	return nil
+}
+
+func (r *stubDatasourceRepo) Update(ctx context.Context, ds *model.Datasource) error {
+	copied := *ds
+	r.items[ds.ID] = &copied
+	return nil
+}
+
+func (r *stubDatasourceRepo) List(ctx context.Context) ([]*model.Datasource, error) {
+	list := make([]*model.Datasource, 0, len(r.items))
+	for _, ds := range r.items {
+		list = append(list, ds)
+	}
+	return list, nil
+}
+
+// stubDatasetRepo 内存数据集仓库
+type stubDatasetRepo struct {
+	repository.DatasetRepository
+	table  *model.DatasetTable
+	fields []*model.DatasetTableField
+}
+
+func (r *stubDatasetRepo) GetTable(ctx context.Context, id string) (*model.DatasetTable, error) {
+	if r.table == nil || r.table.ID != id {
+		return nil, fmt.Errorf("table %s not found", id)
+	}
+	return r.table, nil
+}
+
+func (r *stubDatasetRepo) GetFields(ctx context.Context, tableID string) ([]*model.DatasetTableField, error) {
+	return r.fields, nil
+}
+
+func (r *stubDatasetRepo) ListTables(ctx context.Context, groupID string) ([]*model.DatasetTable, error) {
+	if r.table == nil {
+		return nil, nil
+	}
+	return []*model.DatasetTable{r.table}, nil
+}
+
+func TestGetChartData_SQLiteEndToEnd(t *testing.T) {
+	logger.InitLogger("error")
+
+	path := filepath.Join(t.TempDir(), "sales.db")
+	db, err := sql.Open("sqlite3", path)
+	require.NoError(t, err)
+	_, err = db.Exec(`CREATE TABLE sales (category TEXT, amount REAL)`)
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO sales VALUES ('a', 1), ('a', 2), ('b', 10)`)
+	require.NoError(t, err)
+	db.Close()
+
+	chart := &model.ChartView{
+		ID:      "chart1",
+		TableID: "table1",
+		XAxis:   `{"fields":[{"name":"category"}]}`,
+		YAxis:   `{"fields":[{"name":"amount","aggregate":"SUM","sort":"DESC"}]}`,
+	}
+	table := &model.DatasetTable{ID: "table1", DatasourceID: "ds1", Type: "db", PhysicalTableName: "sales"}
+
+	chartRepo := new(MockChartRepository)
+	chartRepo.On("Get", mock.Anything, "chart1").Return(chart, nil)
+	datasetRepo := &stubDatasetRepo{table: table, fields: salesFields()}
+	dsRepo := &stubDatasourceRepo{items: map[string]*model.Datasource{
+		"ds1": {ID: "ds1", Type: "sqlite", Configuration: fmt.Sprintf(`{"path":%q}`, path)},
+	}}
+
+	router := engine.NewQueryRouter(
+		engine.NewNativeExecutor(engine.NewConnectionManager(nil)),
+		engine.NewCalciteExecutor(nil),
+	)
+	svc := NewChartDataService(chartRepo, datasetRepo, dsRepo, nil, nil, router, nil)
+
+	result, err := svc.GetChartData(context.Background(), "chart1")
+	require.NoError(t, err)
+	assert.Equal(t, engine.ExecPathNative, result.Engine)
+	assert.False(t, result.Fallback)
+	require.Len(t, result.Data, 2)
+	assert.Equal(t, "b", result.Data[0]["category"])
+	assert.Equal(t, 10.0, result.Data[0]["amount"])
+}
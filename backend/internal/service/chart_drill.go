@@ -0,0 +1,180 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"cozy-insight-backend/internal/model"
+)
+
+// DrillStep 钻取路径中的一级: 在 Field 层级点击了 Value
+type DrillStep struct {
+	Field string      `json:"field"`
+	Value interface{} `json:"value"`
+}
+
+// DrillState 钻取状态,供前端展示面包屑和继续钻取
+type DrillState struct {
+	DrillID      string       `json:"drillId"`
+	Hierarchy    []string     `json:"hierarchy"`
+	Level        int          `json:"level"` // 当前层级,从0开始
+	Field        string       `json:"field"` // 当前层级的维度字段
+	CanDrillDown bool         `json:"canDrillDown"`
+	Breadcrumbs  []DrillCrumb `json:"breadcrumbs"`
+}
+
+// DrillCrumb 面包屑,返回该层级时钻取路径保留前 Level 级
+type DrillCrumb struct {
+	Level int         `json:"level"`
+	Field string      `json:"field"`
+	Label string      `json:"label"`
+	Value interface{} `json:"value,omitempty"` // 该层级点击的值,当前层级为空
+}
+
+// chartDrill 图表的一个钻取层级
+type chartDrill struct {
+	id        string
+	hierarchy []string
+}
+
+// parseChartDrill 解析钻取配置,FieldID 不在 DrillFields 开头时作为第一层
+func parseChartDrill(drill *model.ChartViewDrill) (*chartDrill, error) {
+	var fields []string
+	if drill.DrillFields != "" {
+		if err := json.Unmarshal([]byte(drill.DrillFields), &fields); err != nil {
+			return nil, fmt.Errorf("invalid drill fields of drill %s: %w", drill.ID, err)
+		}
+	}
+	if drill.FieldID != "" && (len(fields) == 0 || fields[0] != drill.FieldID) {
+		fields = append([]string{drill.FieldID}, fields...)
+	}
+	return &chartDrill{id: drill.ID, hierarchy: fields}, nil
+}
+
+// applyDrill 按钻取路径替换当前层级的维度,并为上级层级加等值过滤
+// 返回替换后的图表副本和过滤器副本,图表没有匹配的钻取配置时原样返回
+func (s *chartDataService) applyDrill(ctx context.Context, chart *model.ChartView, table *model.DatasetTable, fields []*model.DatasetTableField, filter *QueryFilter) (*model.ChartView, *QueryFilter, *DrillState, error) {
+	var path []DrillStep
+	if filter != nil {
+		path = filter.Drill
+	}
+	if s.drillRepo == nil {
+		if len(path) > 0 {
+			return nil, nil, nil, fmt.Errorf("chart %s has no drill configuration", chart.ID)
+		}
+		return chart, filter, nil, nil
+	}
+
+	drills, err := s.drillRepo.ListByChart(ctx, chart.ID)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to get chart drills: %w", err)
+	}
+	config, err := ParseChartConfig(chart)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	calc, err := loadCalculatedFields(ctx, s.calculatedRepo, table.ID, fields)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	// 选择第一层在 X 轴上、且与钻取路径一致的钻取配置
+	var drill *chartDrill
+	axis := -1
+	for _, d := range drills {
+		parsed, err := parseChartDrill(d)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if len(parsed.hierarchy) < 2 {
+			continue
+		}
+		index := -1
+		for i, field := range config.XAxis.Fields {
+			if calc.fieldKey(field.Name) == calc.fieldKey(parsed.hierarchy[0]) {
+				index = i
+				break
+			}
+		}
+		if index < 0 || (len(path) > 0 && calc.fieldKey(path[0].Field) != calc.fieldKey(parsed.hierarchy[0])) {
+			continue
+		}
+		drill, axis = parsed, index
+		break
+	}
+	if drill == nil {
+		if len(path) > 0 {
+			return nil, nil, nil, fmt.Errorf("no drill hierarchy of chart %s starts with %s", chart.ID, path[0].Field)
+		}
+		return chart, filter, nil, nil
+	}
+
+	level := len(path)
+	if level >= len(drill.hierarchy) {
+		return nil, nil, nil, fmt.Errorf("drill path has %d levels but hierarchy %s has only %d", level, drill.id, len(drill.hierarchy))
+	}
+
+	drilled := &QueryFilter{}
+	if filter != nil {
+		*drilled = *filter
+		drilled.Filters = append([]FilterCondition(nil), filter.Filters...)
+	}
+	state := &DrillState{
+		DrillID:      drill.id,
+		Hierarchy:    drill.hierarchy,
+		Level:        level,
+		Field:        drill.hierarchy[level],
+		CanDrillDown: level < len(drill.hierarchy)-1,
+	}
+	for i, step := range path {
+		if calc.fieldKey(step.Field) != calc.fieldKey(drill.hierarchy[i]) {
+			return nil, nil, nil, fmt.Errorf("drill level %d must be %s, got %s", i, drill.hierarchy[i], step.Field)
+		}
+		if step.Value == nil {
+			return nil, nil, nil, fmt.Errorf("drill value of %s is required", step.Field)
+		}
+		drilled.Filters = append(drilled.Filters, FilterCondition{Field: drill.hierarchy[i], Operator: "=", Value: step.Value})
+		state.Breadcrumbs = append(state.Breadcrumbs, DrillCrumb{Level: i, Field: drill.hierarchy[i], Label: calc.label(drill.hierarchy[i]), Value: step.Value})
+	}
+	state.Breadcrumbs = append(state.Breadcrumbs, DrillCrumb{Level: level, Field: state.Field, Label: calc.label(state.Field)})
+
+	if level == 0 {
+		return chart, filter, state, nil
+	}
+
+	// 下钻后的维度只保留排序方式,时间粒度等配置属于第一层字段
+	config.XAxis.Fields[axis] = FieldConfig{Name: state.Field, Sort: config.XAxis.Fields[axis].Sort}
+	xAxis, err := json.Marshal(config.XAxis)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to encode drilled axis: %w", err)
+	}
+	copied := *chart
+	copied.XAxis = string(xAxis)
+	return &copied, drilled, state, nil
+}
+
+// fieldKey 字段的唯一标识,同一字段按列名、ID或显示名引用时一致
+func (c *calculatedFields) fieldKey(name string) string {
+	if def, ok := c.defs[name]; ok {
+		return "calc:" + def.ID
+	}
+	if field, ok := c.resolver.fields[name]; ok {
+		return "field:" + field.ID
+	}
+	return name
+}
+
+// label 字段的显示名
+func (c *calculatedFields) label(name string) string {
+	if def, ok := c.defs[name]; ok {
+		if def.DisplayName != "" {
+			return def.DisplayName
+		}
+		return def.FieldName
+	}
+	if field, ok := c.resolver.fields[name]; ok && field.Name != "" {
+		return field.Name
+	}
+	return name
+}
@@ -0,0 +1,125 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"cozy-insight-backend/internal/engine"
+	"cozy-insight-backend/internal/model"
+	"cozy-insight-backend/pkg/logger"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// memChartDrillRepo 内存钻取配置仓库
+type memChartDrillRepo struct {
+	items []*model.ChartViewDrill
+}
+
+func (r *memChartDrillRepo) Create(ctx context.Context, drill *model.ChartViewDrill) error {
+	r.items = append(r.items, drill)
+	return nil
+}
+
+func (r *memChartDrillRepo) Update(ctx context.Context, drill *model.ChartViewDrill) error {
+	return nil
+}
+
+func (r *memChartDrillRepo) Delete(ctx context.Context, id string) error {
+	return nil
+}
+
+func (r *memChartDrillRepo) ListByChart(ctx context.Context, chartID string) ([]*model.ChartViewDrill, error) {
+	var items []*model.ChartViewDrill
+	for _, item := range r.items {
+		if item.ChartViewID == chartID {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+func TestGetChartData_Drill(t *testing.T) {
+	logger.InitLogger("error")
+
+	path := filepath.Join(t.TempDir(), "sales.db")
+	db, err := sql.Open("sqlite3", path)
+	require.NoError(t, err)
+	_, err = db.Exec(`CREATE TABLE sales (region TEXT, city TEXT, store TEXT, amount REAL)`)
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO sales VALUES
+		('east', 'hangzhou', 's1', 10), ('east', 'hangzhou', 's2', 20), ('east', 'shanghai', 's3', 5), ('west', 'chengdu', 's4', 7)`)
+	require.NoError(t, err)
+	db.Close()
+
+	datasetRepo := &stubDatasetRepo{
+		table: &model.DatasetTable{ID: "table1", DatasourceID: "ds1", Type: DatasetTypeDB, PhysicalTableName: "sales"},
+		fields: []*model.DatasetTableField{
+			{ID: "f1", OriginName: "region", Name: "区域", DeType: engine.DeTypeText},
+			{ID: "f2", OriginName: "city", Name: "城市", DeType: engine.DeTypeText},
+			{ID: "f3", OriginName: "store", Name: "门店", DeType: engine.DeTypeText},
+			{ID: "f4", OriginName: "amount", Name: "amount", DeType: engine.DeTypeFloat},
+		},
+	}
+	drillRepo := &memChartDrillRepo{items: []*model.ChartViewDrill{
+		{ID: "d1", ChartViewID: "chart1", FieldID: "f1", DrillFields: `["f2","f3"]`, DrillType: "down"},
+	}}
+	chart := &model.ChartView{
+		ID:      "chart1",
+		TableID: "table1",
+		XAxis:   `{"fields":[{"name":"区域","sort":"ASC"}]}`,
+		YAxis:   `{"fields":[{"name":"amount","aggregate":"SUM"}]}`,
+	}
+	chartRepo := new(MockChartRepository)
+	chartRepo.On("Get", mock.Anything, "chart1").Return(chart, nil)
+	dsRepo := &stubDatasourceRepo{items: map[string]*model.Datasource{
+		"ds1": {ID: "ds1", Type: "sqlite", Configuration: fmt.Sprintf(`{"path":%q}`, path)},
+	}}
+	router := engine.NewQueryRouter(engine.NewNativeExecutor(engine.NewConnectionManager(nil)))
+	svc := NewChartDataService(chartRepo, datasetRepo, dsRepo, nil, drillRepo, router, nil)
+	ctx := context.Background()
+
+	// 第一层: 钻取状态可继续下钻
+	result, err := svc.GetChartData(ctx, "chart1")
+	require.NoError(t, err)
+	require.Len(t, result.Data, 2)
+	require.NotNil(t, result.Drill)
+	assert.Equal(t, 0, result.Drill.Level)
+	assert.True(t, result.Drill.CanDrillDown)
+	assert.Equal(t, []DrillCrumb{{Level: 0, Field: "f1", Label: "区域"}}, result.Drill.Breadcrumbs)
+
+	// 下钻两层,维度替换为门店,结果列名为当前层级字段
+	result, err = svc.GetChartDataWithFilter(ctx, "chart1", &QueryFilter{Drill: []DrillStep{
+		{Field: "区域", Value: "east"},
+		{Field: "city", Value: "hangzhou"},
+	}})
+	require.NoError(t, err)
+	require.Len(t, result.Data, 2)
+	assert.Equal(t, "s1", result.Data[0]["f3"])
+	assert.Equal(t, 20.0, result.Data[1]["amount"])
+	assert.Equal(t, 2, result.Drill.Level)
+	assert.Equal(t, "f3", result.Drill.Field)
+	assert.False(t, result.Drill.CanDrillDown)
+	assert.Equal(t, []DrillCrumb{
+		{Level: 0, Field: "f1", Label: "区域", Value: "east"},
+		{Level: 1, Field: "f2", Label: "城市", Value: "hangzhou"},
+		{Level: 2, Field: "f3", Label: "门店"},
+	}, result.Drill.Breadcrumbs)
+	// 图表配置本身不被修改
+	assert.Equal(t, `{"fields":[{"name":"区域","sort":"ASC"}]}`, chart.XAxis)
+
+	_, err = svc.GetChartDataWithFilter(ctx, "chart1", &QueryFilter{Drill: []DrillStep{
+		{Field: "region", Value: "east"}, {Field: "store", Value: "s1"},
+	}})
+	assert.ErrorContains(t, err, "drill level 1 must be f2")
+
+	_, err = svc.GetChartDataWithFilter(ctx, "chart1", &QueryFilter{Drill: []DrillStep{
+		{Field: "region", Value: "east"}, {Field: "city", Value: "hangzhou"}, {Field: "store", Value: "s1"},
+	}})
+	assert.ErrorContains(t, err, "only 3")
+}
@@ -0,0 +1,148 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	"cozy-insight-backend/internal/engine"
+	"cozy-insight-backend/internal/model"
+)
+
+// 指标格式类型
+const (
+	FormatNumber   = "number"
+	FormatPercent  = "percent"  // 值乘以100后加 %
+	FormatCurrency = "currency" // 使用 Prefix 作为货币符号
+)
+
+// 指标结果数据类型
+const (
+	MeasureTypeNumber = "number"
+	MeasureTypeText   = "text"
+	MeasureTypeTime   = "time"
+)
+
+// maxFormatDecimals 最多保留的小数位数
+const maxFormatDecimals = 10
+
+// formatUnits 数量单位
+var formatUnits = map[string]bool{"": true, "K": true, "M": true, "B": true, "万": true, "亿": true}
+
+// MeasureFormat 指标的展示格式,未设置的项按聚合方式和字段类型取默认值
+type MeasureFormat struct {
+	Type               string `json:"type,omitempty"` // number, percent, currency
+	Decimals           *int   `json:"decimals,omitempty"`
+	ThousandsSeparator *bool  `json:"thousandsSeparator,omitempty"`
+	Unit               string `json:"unit,omitempty"` // K, M, B, 万, 亿
+	Prefix             string `json:"prefix,omitempty"`
+	Suffix             string `json:"suffix,omitempty"`
+}
+
+// MeasureMeta 查询结果中指标列的元数据
+type MeasureMeta struct {
+	Name      string         `json:"name"` // 结果中的列名
+	Field     string         `json:"field"`
+	Aggregate string         `json:"aggregate,omitempty"`
+	DataType  string         `json:"dataType"`         // number, text, time
+	Format    *MeasureFormat `json:"format,omitempty"` // 仅数值指标有格式
+}
+
+// chartMeasures 生成 Y 轴指标的元数据
+func chartMeasures(config *ChartQueryConfig, calc *calculatedFields) ([]MeasureMeta, error) {
+	measures := make([]MeasureMeta, 0, len(config.YAxis.Fields))
+	for _, field := range config.YAxis.Fields {
+		meta := MeasureMeta{Name: field.Name, Field: field.Name, Aggregate: field.Aggregate}
+		if field.Name == "*" {
+			meta.Name = "count"
+		}
+
+		dataType, integer := measureType(field, calc)
+		meta.DataType = dataType
+		if dataType != MeasureTypeNumber {
+			if field.Format != nil {
+				return nil, fmt.Errorf("format on %s requires a numeric measure", field.Name)
+			}
+			measures = append(measures, meta)
+			continue
+		}
+
+		format, err := measureFormat(field.Format, integer)
+		if err != nil {
+			return nil, fmt.Errorf("invalid format on %s: %w", field.Name, err)
+		}
+		meta.Format = format
+		measures = append(measures, meta)
+	}
+	return measures, nil
+}
+
+// measureType 指标结果的数据类型,integer 表示结果为整数
+func measureType(field FieldConfig, calc *calculatedFields) (dataType string, integer bool) {
+	switch AggregateType(strings.ToUpper(field.Aggregate)) {
+	case AggregateCount, AggregateCountDistinct, AggregateApproxCountDistinct:
+		return MeasureTypeNumber, true
+	case AggregateAvg, AggregateStddev, AggregateVariance:
+		return MeasureTypeNumber, false
+	}
+
+	// 求和、极值、百分位和首末值与字段类型一致
+	exprType, deType := engine.ExprNumber, engine.DeTypeFloat
+	if def, ok := calc.get(field.Name); ok {
+		if expr, err := calc.expression(def); err == nil {
+			exprType = expr.Type
+		}
+	} else if f, ok := calc.resolver.fields[field.Name]; ok {
+		exprType, deType = engine.ExprTypeOf(f.DeType), f.DeType
+	}
+	switch exprType {
+	case engine.ExprNumber, engine.ExprBool, engine.ExprNull:
+		return MeasureTypeNumber, deType == engine.DeTypeInt
+	case engine.ExprTime:
+		return MeasureTypeTime, false
+	default:
+		return MeasureTypeText, false
+	}
+}
+
+// measureFormat 校验图表配置的格式并补全默认值
+func measureFormat(configured *MeasureFormat, integer bool) (*MeasureFormat, error) {
+	format := MeasureFormat{}
+	if configured != nil {
+		format = *configured
+	}
+
+	switch format.Type {
+	case "":
+		format.Type = FormatNumber
+	case FormatNumber, FormatPercent, FormatCurrency:
+	default:
+		return nil, fmt.Errorf("unsupported format type: %s", format.Type)
+	}
+	if !formatUnits[format.Unit] {
+		return nil, fmt.Errorf("unsupported unit: %s", format.Unit)
+	}
+	if format.Decimals == nil {
+		decimals := 2
+		if integer && format.Type != FormatPercent && format.Unit == "" {
+			decimals = 0
+		}
+		format.Decimals = &decimals
+	} else if *format.Decimals < 0 || *format.Decimals > maxFormatDecimals {
+		return nil, fmt.Errorf("decimals must be between 0 and %d", maxFormatDecimals)
+	}
+	if format.ThousandsSeparator == nil {
+		separator := format.Type != FormatPercent
+		format.ThousandsSeparator = &separator
+	}
+	return &format, nil
+}
+
+// defaultOrderField FIRST、LAST 未指定排序字段时使用数据集的第一个时间字段
+func defaultOrderField(fields []*model.DatasetTableField) string {
+	for _, f := range fields {
+		if f.DeType == engine.DeTypeTime {
+			return f.OriginName
+		}
+	}
+	return ""
+}
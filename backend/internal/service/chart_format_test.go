@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"cozy-insight-backend/internal/engine"
+	"cozy-insight-backend/internal/model"
+	"cozy-insight-backend/pkg/logger"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetChartData_ExtendedAggregates(t *testing.T) {
+	logger.InitLogger("error")
+
+	path := filepath.Join(t.TempDir(), "orders.db")
+	db, err := sql.Open("sqlite3", path)
+	require.NoError(t, err)
+	_, err = db.Exec(`CREATE TABLE orders (region TEXT, customer TEXT, qty INTEGER, price REAL, created_at TEXT)`)
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO orders VALUES
+		('east', 'a', 3, 9.5, '2024-01-02'), ('east', 'a', 1, 12, '2024-01-01'), ('east', 'b', 5, 8, '2024-01-03')`)
+	require.NoError(t, err)
+	db.Close()
+
+	datasetRepo := &stubDatasetRepo{
+		table: &model.DatasetTable{ID: "table1", DatasourceID: "ds1", Type: DatasetTypeDB, PhysicalTableName: "orders"},
+		fields: []*model.DatasetTableField{
+			{ID: "f1", OriginName: "region", Name: "region", DeType: engine.DeTypeText},
+			{ID: "f2", OriginName: "customer", Name: "customer", DeType: engine.DeTypeText},
+			{ID: "f3", OriginName: "qty", Name: "qty", DeType: engine.DeTypeInt},
+			{ID: "f4", OriginName: "price", Name: "price", DeType: engine.DeTypeFloat},
+			{ID: "f5", OriginName: "created_at", Name: "created_at", DeType: engine.DeTypeTime},
+		},
+	}
+	chart := &model.ChartView{
+		ID:      "chart1",
+		TableID: "table1",
+		XAxis:   `{"fields":[{"name":"region"}]}`,
+		YAxis: `{"fields":[
+			{"name":"customer","aggregate":"COUNT_DISTINCT"},
+			{"name":"qty","aggregate":"MEDIAN"},
+			{"name":"price","aggregate":"LAST","format":{"type":"currency","prefix":"¥"}},
+			{"name":"created_at","aggregate":"MAX"}]}`,
+	}
+	chartRepo := new(MockChartRepository)
+	chartRepo.On("Get", mock.Anything, "chart1").Return(chart, nil)
+	dsRepo := &stubDatasourceRepo{items: map[string]*model.Datasource{
+		"ds1": {ID: "ds1", Type: "sqlite", Configuration: fmt.Sprintf(`{"path":%q}`, path)},
+	}}
+	router := engine.NewQueryRouter(engine.NewNativeExecutor(engine.NewConnectionManager(nil)))
+	svc := NewChartDataService(chartRepo, datasetRepo, dsRepo, nil, nil, router, nil)
+	ctx := context.Background()
+
+	// LAST 未指定排序字段时按数据集的第一个时间字段排序
+	result, err := svc.GetChartData(ctx, "chart1")
+	require.NoError(t, err)
+	require.Len(t, result.Data, 1)
+	assert.EqualValues(t, 2, result.Data[0]["customer"])
+	assert.EqualValues(t, 3, result.Data[0]["qty"])
+	assert.EqualValues(t, 8, result.Data[0]["price"])
+
+	require.Len(t, result.Measures, 4)
+	assert.Equal(t, MeasureTypeNumber, result.Measures[0].DataType)
+	assert.Equal(t, 0, *result.Measures[0].Format.Decimals)
+	assert.Equal(t, 0, *result.Measures[1].Format.Decimals)
+	assert.Equal(t, FormatCurrency, result.Measures[2].Format.Type)
+	assert.Equal(t, "¥", result.Measures[2].Format.Prefix)
+	assert.Equal(t, 2, *result.Measures[2].Format.Decimals)
+	assert.True(t, *result.Measures[2].Format.ThousandsSeparator)
+	assert.Equal(t, MeasureTypeTime, result.Measures[3].DataType)
+	assert.Nil(t, result.Measures[3].Format)
+
+	chart.YAxis = `{"fields":[{"name":"price","aggregate":"AVG","format":{"decimals":12}}]}`
+	_, err = svc.GetChartData(ctx, "chart1")
+	assert.ErrorContains(t, err, "decimals must be between 0 and 10")
+
+	chart.YAxis = `{"fields":[{"name":"price","aggregate":"STDDEV"}]}`
+	_, err = svc.GetChartData(ctx, "chart1")
+	assert.ErrorContains(t, err, "not supported by sqlite")
+
+	datasetRepo.fields = datasetRepo.fields[:4]
+	chart.YAxis = `{"fields":[{"name":"price","aggregate":"FIRST"}]}`
+	_, err = svc.GetChartData(ctx, "chart1")
+	assert.ErrorContains(t, err, "requires an order field")
+}
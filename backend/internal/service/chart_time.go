@@ -0,0 +1,302 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"cozy-insight-backend/internal/engine"
+)
+
+// 空桶补齐方式
+const (
+	GapFillNull = "null" // 补齐的行指标为空
+	GapFillZero = "zero" // 补齐的行指标为0
+)
+
+// maxGapFillBuckets 补齐后单个序列的最大分桶数,避免细粒度跨长时间范围时生成过多行
+const maxGapFillBuckets = 10000
+
+// weekdays 每周第一天的可选值
+var weekdays = map[string]time.Weekday{
+	"sunday":    time.Sunday,
+	"monday":    time.Monday,
+	"tuesday":   time.Tuesday,
+	"wednesday": time.Wednesday,
+	"thursday":  time.Thursday,
+	"friday":    time.Friday,
+	"saturday":  time.Saturday,
+}
+
+// bucketLayouts 解析分桶值时尝试的时间格式
+var bucketLayouts = []string{
+	"2006-01-02 15:04:05",
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// chartTimeBucket 解析字段的时间粒度配置,未设置粒度时返回 nil
+func chartTimeBucket(field FieldConfig) (*engine.TimeBucket, error) {
+	if field.Granularity == "" {
+		if field.GapFill != "" {
+			return nil, fmt.Errorf("gap filling on %s requires a granularity", field.Name)
+		}
+		return nil, nil
+	}
+
+	bucket := &engine.TimeBucket{Unit: strings.ToLower(field.Granularity), WeekStart: time.Monday}
+	switch bucket.Unit {
+	case engine.TimeUnitYear, engine.TimeUnitQuarter, engine.TimeUnitMonth, engine.TimeUnitWeek,
+		engine.TimeUnitDay, engine.TimeUnitHour, engine.TimeUnitMinute:
+	default:
+		return nil, fmt.Errorf("unsupported granularity: %s", field.Granularity)
+	}
+	if field.WeekStart != "" {
+		day, ok := weekdays[strings.ToLower(field.WeekStart)]
+		if !ok {
+			return nil, fmt.Errorf("invalid week start: %s", field.WeekStart)
+		}
+		bucket.WeekStart = day
+	}
+	if field.TimeZone != "" {
+		loc, err := time.LoadLocation(field.TimeZone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time zone %s: %w", field.TimeZone, err)
+		}
+		bucket.Location = loc
+	}
+	switch field.GapFill {
+	case "", GapFillNull, GapFillZero:
+	default:
+		return nil, fmt.Errorf("invalid gap fill mode: %s", field.GapFill)
+	}
+	return bucket, nil
+}
+
+// bucketColumn 将时间分桶加入查询的计算列,返回分桶列名
+func (c *calculatedFields) bucketColumn(query *engine.Query, name string, bucket *engine.TimeBucket) (string, error) {
+	if def, ok := c.defs[name]; ok {
+		expr, err := c.expression(def)
+		if err != nil {
+			return "", fmt.Errorf("calculated field %s: %w", def.FieldName, err)
+		}
+		if expr.Aggregated || expr.Type != engine.ExprTime {
+			return "", fmt.Errorf("granularity requires a time field: %s", name)
+		}
+		bucket.Expr = expr
+		name = def.FieldName
+	} else {
+		field, ok := c.resolver.fields[name]
+		if ok && field.DeType != engine.DeTypeTime {
+			return "", fmt.Errorf("granularity requires a time field: %s", name)
+		}
+		column, err := c.resolver.resolve(name)
+		if err != nil {
+			return "", err
+		}
+		bucket.Field = column
+		name = column
+	}
+
+	column := name + "__" + bucket.Unit
+	for _, computed := range query.Source.Computed {
+		if computed.Name == column {
+			return column, nil
+		}
+	}
+	query.Source.Computed = append(query.Source.Computed, engine.ComputedColumn{Name: column, Bucket: bucket})
+	return column, nil
+}
+
+// fillTimeGaps 按图表配置补齐时间维度的空桶
+// 只处理第一个开启补齐的时间维度,其余维度视为序列,每个序列在整体时间范围内补齐;
+// 补齐后结果按该时间维度排序
+func fillTimeGaps(config *ChartQueryConfig, rows []map[string]interface{}) ([]map[string]interface{}, error) {
+	var timeField *FieldConfig
+	var series []string
+	for i := range config.XAxis.Fields {
+		field := &config.XAxis.Fields[i]
+		if timeField == nil && field.GapFill != "" {
+			timeField = field
+			continue
+		}
+		series = append(series, field.Name)
+	}
+	if timeField == nil || len(rows) == 0 {
+		return rows, nil
+	}
+
+	var metrics []string
+	for _, field := range config.YAxis.Fields {
+		if field.Name == "*" {
+			metrics = append(metrics, "count")
+		} else {
+			metrics = append(metrics, field.Name)
+		}
+	}
+	var fill interface{}
+	if timeField.GapFill == GapFillZero {
+		fill = 0
+	}
+
+	// 按首次出现的顺序分组序列,并记录每行的分桶时间
+	type seriesRows struct {
+		values  []interface{}
+		buckets map[string]bool
+	}
+	var order []string
+	groups := make(map[string]*seriesRows)
+	var format func(time.Time) interface{}
+	var min, max time.Time
+	times := make([]time.Time, len(rows))
+	parsed := make([]bool, len(rows))
+	for i, row := range rows {
+		t, f, ok := parseBucket(row[timeField.Name])
+		if !ok {
+			continue
+		}
+		if format == nil {
+			format = f
+		}
+		times[i], parsed[i] = t, true
+		if min.IsZero() || t.Before(min) {
+			min = t
+		}
+		if t.After(max) {
+			max = t
+		}
+
+		values := make([]interface{}, len(series))
+		for j, name := range series {
+			values[j] = row[name]
+		}
+		key := fmt.Sprint(values...)
+		g, ok := groups[key]
+		if !ok {
+			g = &seriesRows{values: values, buckets: make(map[string]bool)}
+			groups[key] = g
+			order = append(order, key)
+		}
+		g.buckets[bucketKey(t)] = true
+	}
+	if format == nil {
+		return rows, nil
+	}
+
+	var buckets []time.Time
+	for t := min; !t.After(max); t = nextBucket(t, timeField.Granularity) {
+		if len(buckets) == maxGapFillBuckets {
+			return nil, fmt.Errorf("gap filling %s would produce more than %d buckets, use a coarser granularity", timeField.Name, maxGapFillBuckets)
+		}
+		buckets = append(buckets, t)
+	}
+
+	filled := make([]map[string]interface{}, 0, len(buckets)*len(order))
+	filledTimes := make([]time.Time, 0, cap(filled))
+	for i, row := range rows {
+		if parsed[i] {
+			filled = append(filled, row)
+			filledTimes = append(filledTimes, times[i])
+		}
+	}
+	for _, key := range order {
+		g := groups[key]
+		for _, t := range buckets {
+			if g.buckets[bucketKey(t)] {
+				continue
+			}
+			row := map[string]interface{}{timeField.Name: format(t)}
+			for j, name := range series {
+				row[name] = g.values[j]
+			}
+			for _, name := range metrics {
+				row[name] = fill
+			}
+			filled = append(filled, row)
+			filledTimes = append(filledTimes, t)
+		}
+	}
+
+	// 按时间排序,同一分桶内保持序列顺序
+	rank := make(map[string]int, len(order))
+	for i, key := range order {
+		rank[key] = i
+	}
+	seriesRank := func(row map[string]interface{}) int {
+		values := make([]interface{}, len(series))
+		for j, name := range series {
+			values[j] = row[name]
+		}
+		return rank[fmt.Sprint(values...)]
+	}
+	desc := strings.ToUpper(timeField.Sort) == "DESC"
+	indexes := make([]int, len(filled))
+	for i := range indexes {
+		indexes[i] = i
+	}
+	sort.SliceStable(indexes, func(a, b int) bool {
+		ta, tb := filledTimes[indexes[a]], filledTimes[indexes[b]]
+		if !ta.Equal(tb) {
+			return ta.Before(tb) != desc
+		}
+		return seriesRank(filled[indexes[a]]) < seriesRank(filled[indexes[b]])
+	})
+
+	result := make([]map[string]interface{}, 0, len(filled)+len(rows))
+	for _, i := range indexes {
+		result = append(result, filled[i])
+	}
+	// 无法解析为时间的行保留在末尾
+	for i, row := range rows {
+		if !parsed[i] {
+			result = append(result, row)
+		}
+	}
+	return result, nil
+}
+
+// parseBucket 解析分桶值,返回时间和生成同类型分桶值的格式化函数
+func parseBucket(value interface{}) (time.Time, func(time.Time) interface{}, bool) {
+	switch v := value.(type) {
+	case time.Time:
+		loc := v.Location()
+		return v, func(t time.Time) interface{} { return t.In(loc) }, true
+	case []byte:
+		return parseBucket(string(v))
+	case string:
+		for _, layout := range bucketLayouts {
+			if t, err := time.Parse(layout, v); err == nil {
+				return t, func(t time.Time) interface{} { return t.Format(layout) }, true
+			}
+		}
+	}
+	return time.Time{}, nil, false
+}
+
+// bucketKey 分桶的比较键,按本地时间比较
+func bucketKey(t time.Time) string {
+	return t.Format("2006-01-02 15:04:05")
+}
+
+// nextBucket 下一个分桶的起始时间
+func nextBucket(t time.Time, granularity string) time.Time {
+	switch strings.ToLower(granularity) {
+	case engine.TimeUnitYear:
+		return t.AddDate(1, 0, 0)
+	case engine.TimeUnitQuarter:
+		return t.AddDate(0, 3, 0)
+	case engine.TimeUnitMonth:
+		return t.AddDate(0, 1, 0)
+	case engine.TimeUnitWeek:
+		return t.AddDate(0, 0, 7)
+	case engine.TimeUnitDay:
+		return t.AddDate(0, 0, 1)
+	case engine.TimeUnitHour:
+		return t.Add(time.Hour)
+	default:
+		return t.Add(time.Minute)
+	}
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"cozy-insight-backend/internal/engine"
+	"cozy-insight-backend/internal/model"
+	"cozy-insight-backend/pkg/logger"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetChartData_TimeGranularity(t *testing.T) {
+	logger.InitLogger("error")
+
+	path := filepath.Join(t.TempDir(), "orders.db")
+	db, err := sql.Open("sqlite3", path)
+	require.NoError(t, err)
+	_, err = db.Exec(`CREATE TABLE orders (region TEXT, created_at TEXT, amount REAL)`)
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO orders VALUES
+		('east', '2024-01-15 10:00:00', 10), ('east', '2024-01-28 10:00:00', 5),
+		('west', '2024-02-03 10:00:00', 7), ('east', '2024-04-01 10:00:00', 3)`)
+	require.NoError(t, err)
+	db.Close()
+
+	datasetRepo := &stubDatasetRepo{
+		table: &model.DatasetTable{ID: "table1", DatasourceID: "ds1", Type: DatasetTypeDB, PhysicalTableName: "orders"},
+		fields: []*model.DatasetTableField{
+			{ID: "f1", OriginName: "region", Name: "region", DeType: engine.DeTypeText},
+			{ID: "f2", OriginName: "created_at", Name: "下单时间", DeType: engine.DeTypeTime},
+			{ID: "f3", OriginName: "amount", Name: "amount", DeType: engine.DeTypeFloat},
+		},
+	}
+	chart := &model.ChartView{
+		ID:      "chart1",
+		TableID: "table1",
+		XAxis:   `{"fields":[{"name":"下单时间","granularity":"month","gapFill":"zero"}]}`,
+		YAxis:   `{"fields":[{"name":"amount","aggregate":"SUM"}]}`,
+	}
+	chartRepo := new(MockChartRepository)
+	chartRepo.On("Get", mock.Anything, "chart1").Return(chart, nil)
+	dsRepo := &stubDatasourceRepo{items: map[string]*model.Datasource{
+		"ds1": {ID: "ds1", Type: "sqlite", Configuration: fmt.Sprintf(`{"path":%q}`, path)},
+	}}
+	router := engine.NewQueryRouter(engine.NewNativeExecutor(engine.NewConnectionManager(nil)))
+	svc := NewChartDataService(chartRepo, datasetRepo, dsRepo, nil, nil, router, nil)
+	ctx := context.Background()
+
+	// 按月分桶,三月没有数据补 0
+	result, err := svc.GetChartData(ctx, "chart1")
+	require.NoError(t, err)
+	require.Len(t, result.Data, 4)
+	var months []interface{}
+	for _, row := range result.Data {
+		months = append(months, row["下单时间"])
+	}
+	assert.Equal(t, []interface{}{"2024-01-01", "2024-02-01", "2024-03-01", "2024-04-01"}, months)
+	assert.Equal(t, 15.0, result.Data[0]["amount"])
+	assert.Equal(t, 0, result.Data[2]["amount"])
+
+	// 多维度时按序列补齐,周日作为每周第一天,按时间倒序
+	chart.XAxis = `{"fields":[{"name":"下单时间","granularity":"week","weekStart":"sunday","gapFill":"null","sort":"DESC"},{"name":"region"}]}`
+	result, err = svc.GetChartDataWithFilter(ctx, "chart1", &QueryFilter{Filters: []FilterCondition{
+		{Field: "下单时间", Operator: "<", Value: "2024-02-01"},
+	}})
+	require.NoError(t, err)
+	require.Len(t, result.Data, 3)
+	assert.Equal(t, "2024-01-28", result.Data[0]["下单时间"])
+	assert.Equal(t, 5.0, result.Data[0]["amount"])
+	assert.Equal(t, "2024-01-21", result.Data[1]["下单时间"])
+	assert.Nil(t, result.Data[1]["amount"])
+	assert.Equal(t, "east", result.Data[1]["region"])
+	assert.Equal(t, "2024-01-14", result.Data[2]["下单时间"])
+
+	chart.XAxis = `{"fields":[{"name":"region","granularity":"month"}]}`
+	_, err = svc.GetChartData(ctx, "chart1")
+	assert.ErrorContains(t, err, "granularity requires a time field")
+
+	chart.XAxis = `{"fields":[{"name":"下单时间","granularity":"month","timeZone":"Mars/Base"}]}`
+	_, err = svc.GetChartData(ctx, "chart1")
+	assert.ErrorContains(t, err, "invalid time zone")
+}
@@ -3,6 +3,7 @@ package service
 import (
 	"context"
 	"cozy-insight-backend/internal/model"
+	"cozy-insight-backend/internal/repository"
 	"encoding/json"
 	"fmt"
 	"time"
@@ -133,3 +134,55 @@ func (s *dashboardService) SaveComponentsBatch(ctx context.Context, dashboardID
 	}
 	return s.SaveComponents(ctx, dashboardID, components)
 }
+
+// DashboardChart 仪表板中引用图表的组件
+type DashboardChart struct {
+	ComponentID string `json:"componentId"`
+	ChartID     string `json:"chartId"`
+}
+
+// dashboardLayoutItem 仪表板 ComponentData 中保存的布局项
+type dashboardLayoutItem struct {
+	I             string `json:"i"`
+	ComponentType string `json:"componentType"`
+	ComponentID   string `json:"componentId"`
+}
+
+// dashboardCharts 按布局顺序返回仪表板中的图表组件
+// 布局保存在 ComponentData 中,没有布局时读取组件表
+func dashboardCharts(ctx context.Context, dashboard *model.Dashboard, componentRepo repository.DashboardComponentRepository) ([]DashboardChart, error) {
+	if dashboard.ComponentData != "" {
+		var data struct {
+			Layouts []dashboardLayoutItem `json:"layouts"`
+		}
+		if err := json.Unmarshal([]byte(dashboard.ComponentData), &data); err != nil {
+			return nil, fmt.Errorf("invalid component data of dashboard %s: %w", dashboard.ID, err)
+		}
+		if len(data.Layouts) > 0 {
+			var charts []DashboardChart
+			for _, item := range data.Layouts {
+				if item.ComponentID == "" || (item.ComponentType != "" && item.ComponentType != "chart") {
+					continue
+				}
+				charts = append(charts, DashboardChart{ComponentID: item.I, ChartID: item.ComponentID})
+			}
+			return charts, nil
+		}
+	}
+
+	if componentRepo == nil {
+		return nil, nil
+	}
+	components, err := componentRepo.ListByDashboard(ctx, dashboard.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get components: %w", err)
+	}
+	var charts []DashboardChart
+	for _, component := range components {
+		if component.ChartID == "" || (component.Type != "" && component.Type != "chart") {
+			continue
+		}
+		charts = append(charts, DashboardChart{ComponentID: component.ID, ChartID: component.ChartID})
+	}
+	return charts, nil
+}
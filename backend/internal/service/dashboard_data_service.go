@@ -0,0 +1,268 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"cozy-insight-backend/internal/model"
+	"cozy-insight-backend/internal/repository"
+	"cozy-insight-backend/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// 仪表板批量查询的默认并发数和单个查询超时
+const (
+	DefaultDashboardQueryWorkers = 4
+	DefaultDashboardQueryTimeout = 30 * time.Second
+)
+
+type DashboardDataService interface {
+	// GetDashboardData 并发查询仪表板中所有图表组件的数据,单个组件失败时返回其错误而不影响其他组件
+	GetDashboardData(ctx context.Context, dashboardID string, req *DashboardDataRequest) (*DashboardDataResult, error)
+}
+
+// DashboardDataRequest 仪表板数据查询条件
+type DashboardDataRequest struct {
+	// Parameters 仪表板参数取值,按参数名提供,未提供时使用默认值
+	// 参数值作为映射字段上的过滤条件,同时作为同名的 SQL 数据集变量
+	Parameters map[string]string `json:"parameters"`
+
+	Variables map[string]interface{}       `json:"variables"` // SQL 数据集变量,优先于同名参数
+	Filters   map[string][]FilterCondition `json:"filters"`   // 各组件的过滤条件,按组件ID提供
+}
+
+// DashboardDataResult 仪表板数据,按布局顺序返回图表组件
+type DashboardDataResult struct {
+	Components []*DashboardComponentData `json:"components"`
+}
+
+// DashboardComponentData 单个图表组件的数据或错误
+type DashboardComponentData struct {
+	ComponentID string           `json:"componentId"`
+	ChartID     string           `json:"chartId"`
+	Data        *ChartDataResult `json:"data,omitempty"`
+	Error       string           `json:"error,omitempty"`
+}
+
+// dashboardQuery 一个待执行的组件查询
+type dashboardQuery struct {
+	result *DashboardComponentData
+	source *ChartSource
+	filter *QueryFilter
+}
+
+// dashboardParameter 已取值的仪表板参数
+type dashboardParameter struct {
+	param   *model.DashboardParameter
+	value   interface{}
+	mapping map[string]string
+}
+
+type dashboardDataService struct {
+	dashboardRepo repository.DashboardRepository
+	componentRepo repository.DashboardComponentRepository
+	paramRepo     repository.DashboardParameterRepository
+	chartRepo     repository.ChartRepository
+	datasetRepo   repository.DatasetRepository
+	chartData     ChartDataService
+	workers       int
+	timeout       time.Duration
+}
+
+// NewDashboardDataService 创建仪表板数据服务,workers、timeout 不大于0时使用默认值
+func NewDashboardDataService(dashboardRepo repository.DashboardRepository, componentRepo repository.DashboardComponentRepository, paramRepo repository.DashboardParameterRepository, chartRepo repository.ChartRepository, datasetRepo repository.DatasetRepository, chartData ChartDataService, workers int, timeout time.Duration) DashboardDataService {
+	if workers <= 0 {
+		workers = DefaultDashboardQueryWorkers
+	}
+	if timeout <= 0 {
+		timeout = DefaultDashboardQueryTimeout
+	}
+	return &dashboardDataService{
+		dashboardRepo: dashboardRepo,
+		componentRepo: componentRepo,
+		paramRepo:     paramRepo,
+		chartRepo:     chartRepo,
+		datasetRepo:   datasetRepo,
+		chartData:     chartData,
+		workers:       workers,
+		timeout:       timeout,
+	}
+}
+
+func (s *dashboardDataService) GetDashboardData(ctx context.Context, dashboardID string, req *DashboardDataRequest) (*DashboardDataResult, error) {
+	dashboard, err := s.dashboardRepo.Get(ctx, dashboardID)
+	if err != nil {
+		return nil, fmt.Errorf("dashboard not found: %w", err)
+	}
+	charts, err := dashboardCharts(ctx, dashboard, s.componentRepo)
+	if err != nil {
+		return nil, err
+	}
+	if req == nil {
+		req = &DashboardDataRequest{}
+	}
+	params, variables, err := s.parameters(ctx, dashboardID, req)
+	if err != nil {
+		return nil, err
+	}
+
+	queries := s.prepare(ctx, charts, params, variables, req)
+	s.run(ctx, queries)
+
+	result := &DashboardDataResult{Components: make([]*DashboardComponentData, 0, len(queries))}
+	for _, q := range queries {
+		result.Components = append(result.Components, q.result)
+	}
+	return result, nil
+}
+
+// parameters 解析仪表板参数的取值,返回有取值的参数和合并后的 SQL 变量
+func (s *dashboardDataService) parameters(ctx context.Context, dashboardID string, req *DashboardDataRequest) ([]dashboardParameter, map[string]interface{}, error) {
+	if s.paramRepo == nil {
+		return nil, req.Variables, nil
+	}
+	defined, err := s.paramRepo.ListByDashboard(ctx, dashboardID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get dashboard parameters: %w", err)
+	}
+	values, err := DashboardParameterValues(defined, req.Parameters)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var params []dashboardParameter
+	for _, p := range defined {
+		value, ok := values[p.Name]
+		if !ok {
+			continue
+		}
+		mapping, err := parameterMapping(p)
+		if err != nil {
+			return nil, nil, err
+		}
+		params = append(params, dashboardParameter{param: p, value: value, mapping: mapping})
+	}
+	for name, value := range req.Variables {
+		values[name] = value
+	}
+	return params, values, nil
+}
+
+// prepare 加载组件引用的图表和数据集,相同的图表、数据集只读取一次
+func (s *dashboardDataService) prepare(ctx context.Context, charts []DashboardChart, params []dashboardParameter, variables map[string]interface{}, req *DashboardDataRequest) []*dashboardQuery {
+	type loaded struct {
+		chart *model.ChartView
+		err   error
+	}
+	type dataset struct {
+		table  *model.DatasetTable
+		fields []*model.DatasetTableField
+		err    error
+	}
+	chartCache := make(map[string]loaded)
+	datasetCache := make(map[string]dataset)
+
+	queries := make([]*dashboardQuery, 0, len(charts))
+	for _, c := range charts {
+		q := &dashboardQuery{result: &DashboardComponentData{ComponentID: c.ComponentID, ChartID: c.ChartID}}
+		queries = append(queries, q)
+
+		l, ok := chartCache[c.ChartID]
+		if !ok {
+			l.chart, l.err = s.chartRepo.Get(ctx, c.ChartID)
+			if l.err != nil {
+				l.err = fmt.Errorf("chart not found: %w", l.err)
+			}
+			chartCache[c.ChartID] = l
+		}
+		if l.err != nil {
+			q.result.Error = l.err.Error()
+			continue
+		}
+
+		d, ok := datasetCache[l.chart.TableID]
+		if !ok {
+			d.table, d.err = s.datasetRepo.GetTable(ctx, l.chart.TableID)
+			if d.err != nil {
+				d.err = fmt.Errorf("dataset not found: %w", d.err)
+			} else if d.fields, d.err = s.datasetRepo.GetFields(ctx, d.table.ID); d.err != nil {
+				d.err = fmt.Errorf("failed to get dataset fields: %w", d.err)
+			}
+			datasetCache[l.chart.TableID] = d
+		}
+		if d.err != nil {
+			q.result.Error = d.err.Error()
+			continue
+		}
+
+		q.source = &ChartSource{Chart: l.chart, Table: d.table, Fields: d.fields}
+		q.filter = &QueryFilter{
+			Filters:   append([]FilterCondition(nil), req.Filters[c.ComponentID]...),
+			Variables: variables,
+		}
+		for _, p := range params {
+			if field, ok := p.mapping[c.ComponentID]; ok {
+				q.filter.Filters = append(q.filter.Filters, parameterFilters(p.param, field, p.value)...)
+			}
+		}
+	}
+	return queries
+}
+
+// run 以固定数量的 worker 执行查询,每个查询单独计时
+func (s *dashboardDataService) run(ctx context.Context, queries []*dashboardQuery) {
+	jobs := make(chan *dashboardQuery)
+	var wg sync.WaitGroup
+	for i := 0; i < s.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for q := range jobs {
+				s.execute(ctx, q)
+			}
+		}()
+	}
+	for _, q := range queries {
+		if q.source != nil {
+			jobs <- q
+		}
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// execute 执行单个组件的查询,超时、失败或 panic 时记录到组件结果中
+// panic 不能传出 worker,否则会终止整个进程
+func (s *dashboardDataService) execute(ctx context.Context, q *dashboardQuery) {
+	queryCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Log.Error("dashboard component query panicked",
+				zap.String("componentId", q.result.ComponentID),
+				zap.String("chartId", q.result.ChartID),
+				zap.Any("panic", r),
+				zap.Stack("stack"))
+			q.result.Data = nil
+			q.result.Error = fmt.Sprintf("query panicked: %v", r)
+		}
+	}()
+
+	data, err := s.chartData.QueryChart(queryCtx, q.source, q.filter)
+	if err != nil {
+		if (errors.Is(err, context.DeadlineExceeded) || queryCtx.Err() == context.DeadlineExceeded) && ctx.Err() == nil {
+			err = fmt.Errorf("query timed out after %s", s.timeout)
+		}
+		logger.Log.Warn("dashboard component query failed",
+			zap.String("componentId", q.result.ComponentID),
+			zap.String("chartId", q.result.ChartID),
+			zap.Error(err))
+		q.result.Error = err.Error()
+		return
+	}
+	q.result.Data = data
+}
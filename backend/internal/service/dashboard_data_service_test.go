@@ -0,0 +1,162 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"cozy-insight-backend/internal/model"
+	"cozy-insight-backend/pkg/logger"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// countingDatasetRepo 记录数据集读取次数
+type countingDatasetRepo struct {
+	stubDatasetRepo
+	mu     sync.Mutex
+	tables int
+	fields int
+}
+
+func (r *countingDatasetRepo) GetTable(ctx context.Context, id string) (*model.DatasetTable, error) {
+	r.mu.Lock()
+	r.tables++
+	r.mu.Unlock()
+	return r.stubDatasetRepo.GetTable(ctx, id)
+}
+
+func (r *countingDatasetRepo) GetFields(ctx context.Context, tableID string) ([]*model.DatasetTableField, error) {
+	r.mu.Lock()
+	r.fields++
+	r.mu.Unlock()
+	return r.stubDatasetRepo.GetFields(ctx, tableID)
+}
+
+// concurrentChartData 记录最大并发数,slow 中的图表阻塞到超时
+type concurrentChartData struct {
+	recordingChartData
+	mu     sync.Mutex
+	active int
+	peak   int
+	slow   map[string]bool
+}
+
+func (s *concurrentChartData) QueryChart(ctx context.Context, source *ChartSource, filter *QueryFilter) (*ChartDataResult, error) {
+	s.mu.Lock()
+	s.active++
+	if s.active > s.peak {
+		s.peak = s.active
+	}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.active--
+		s.mu.Unlock()
+	}()
+
+	if source.Chart.ID == "panic" {
+		panic("nil map")
+	}
+	if s.slow[source.Chart.ID] {
+		<-ctx.Done()
+		return nil, fmt.Errorf("failed to execute query: %w", ctx.Err())
+	}
+	time.Sleep(20 * time.Millisecond)
+	if err := s.fail[source.Chart.ID]; err != nil {
+		return nil, err
+	}
+	return &ChartDataResult{Data: []map[string]interface{}{{"filters": filter.Filters, "vars": filter.Variables}}}, nil
+}
+
+func TestDashboardDataService_GetDashboardData(t *testing.T) {
+	logger.InitLogger("error")
+
+	var layouts string
+	for i := 1; i <= 6; i++ {
+		layouts += fmt.Sprintf(`{"i":"c%d","componentType":"chart","componentId":"chart%d"},`, i, (i+1)/2)
+	}
+	dashboardRepo := &stubDashboardRepo{dashboard: &model.Dashboard{
+		ID: "dash1",
+		ComponentData: `{"layouts":[` + layouts + `
+			{"i":"c7","componentType":"chart","componentId":"missing"},
+			{"i":"c8","componentType":"chart","componentId":"slow"},
+			{"i":"c9","componentType":"text"}]}`,
+	}}
+	chartRepo := new(MockChartRepository)
+	for _, id := range []string{"chart1", "chart2", "chart3", "slow"} {
+		chartRepo.On("Get", mock.Anything, id).Return(&model.ChartView{ID: id, TableID: "table1"}, nil).Once()
+	}
+	chartRepo.On("Get", mock.Anything, "missing").Return(nil, fmt.Errorf("record not found")).Once()
+	datasetRepo := &countingDatasetRepo{stubDatasetRepo: stubDatasetRepo{table: &model.DatasetTable{ID: "table1"}}}
+	chartData := &concurrentChartData{
+		recordingChartData: recordingChartData{filters: map[string][]FilterCondition{}, fail: map[string]error{"chart3": fmt.Errorf("boom")}},
+		slow:               map[string]bool{"slow": true},
+	}
+
+	svc := NewDashboardDataService(dashboardRepo, nil, nil, chartRepo, datasetRepo, chartData, 2, 100*time.Millisecond)
+	result, err := svc.GetDashboardData(context.Background(), "dash1", &DashboardDataRequest{
+		Variables: map[string]interface{}{"region": "east"},
+		Filters:   map[string][]FilterCondition{"c1": {{Field: "city", Operator: "=", Value: "hz"}}},
+	})
+	require.NoError(t, err)
+
+	// 每个图表、数据集只读取一次
+	chartRepo.AssertExpectations(t)
+	assert.Equal(t, 1, datasetRepo.tables)
+	assert.Equal(t, 1, datasetRepo.fields)
+	assert.LessOrEqual(t, chartData.peak, 2)
+
+	// 按布局顺序返回,失败、超时的组件带错误,其余组件正常返回
+	require.Len(t, result.Components, 8)
+	for i, c := range result.Components {
+		assert.Equal(t, fmt.Sprintf("c%d", i+1), c.ComponentID)
+	}
+	for _, c := range result.Components[:4] {
+		require.NotNil(t, c.Data, c.ComponentID)
+		assert.Empty(t, c.Error)
+		assert.Equal(t, map[string]interface{}{"region": "east"}, c.Data.Data[0]["vars"])
+	}
+	assert.Equal(t, []FilterCondition{{Field: "city", Operator: "=", Value: "hz"}}, result.Components[0].Data.Data[0]["filters"])
+	assert.Empty(t, result.Components[1].Data.Data[0]["filters"])
+	for _, c := range result.Components[4:6] {
+		assert.Nil(t, c.Data)
+		assert.Equal(t, "boom", c.Error)
+	}
+	assert.Contains(t, result.Components[6].Error, "chart not found")
+	assert.Equal(t, "query timed out after 100ms", result.Components[7].Error)
+
+	_, err = svc.GetDashboardData(context.Background(), "unknown", nil)
+	assert.Error(t, err)
+}
+
+func TestDashboardDataService_RecoversPanics(t *testing.T) {
+	logger.InitLogger("error")
+
+	dashboardRepo := &stubDashboardRepo{dashboard: &model.Dashboard{
+		ID: "dash1",
+		ComponentData: `{"layouts":[
+			{"i":"c1","componentType":"chart","componentId":"panic"},
+			{"i":"c2","componentType":"chart","componentId":"chart1"}]}`,
+	}}
+	chartRepo := new(MockChartRepository)
+	for _, id := range []string{"panic", "chart1"} {
+		chartRepo.On("Get", mock.Anything, id).Return(&model.ChartView{ID: id, TableID: "table1"}, nil).Once()
+	}
+	datasetRepo := &countingDatasetRepo{stubDatasetRepo: stubDatasetRepo{table: &model.DatasetTable{ID: "table1"}}}
+	chartData := &concurrentChartData{recordingChartData: recordingChartData{filters: map[string][]FilterCondition{}}}
+
+	// 一个组件 panic 时只影响该组件,其余组件正常返回
+	svc := NewDashboardDataService(dashboardRepo, nil, nil, chartRepo, datasetRepo, chartData, 2, time.Second)
+	result, err := svc.GetDashboardData(context.Background(), "dash1", nil)
+	require.NoError(t, err)
+	require.Len(t, result.Components, 2)
+	assert.Nil(t, result.Components[0].Data)
+	assert.Equal(t, "query panicked: nil map", result.Components[0].Error)
+	assert.NotNil(t, result.Components[1].Data)
+	assert.Empty(t, result.Components[1].Error)
+}
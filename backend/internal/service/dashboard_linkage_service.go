@@ -0,0 +1,246 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"cozy-insight-backend/internal/repository"
+)
+
+// 联动更新方式
+const (
+	LinkageUpdateReplace = "replace" // 替换目标字段上已有的过滤条件
+	LinkageUpdateAppend  = "append"  // 保留目标字段上已有的过滤条件,与新条件同时生效
+)
+
+// LinkageTypeClick 默认的联动触发方式
+const LinkageTypeClick = "click"
+
+type DashboardLinkageService interface {
+	// Trigger 处理仪表板组件上的联动事件,返回受影响组件的过滤条件和刷新后的数据
+	Trigger(ctx context.Context, dashboardID string, event *LinkageEvent) (*LinkageResult, error)
+}
+
+// LinkageEvent 仪表板组件上的联动事件
+type LinkageEvent struct {
+	SourceComponentID string      `json:"sourceComponentId" binding:"required"`
+	Field             string      `json:"field" binding:"required"` // 源图表上被点击的字段
+	Value             interface{} `json:"value"`                    // 为空时清除目标字段上的联动条件,数组按 IN 过滤
+	LinkageType       string      `json:"linkageType"`              // click, hover, select,默认 click
+
+	// Filters 各组件当前生效的过滤条件,按组件ID提供,用于叠加多次联动
+	Filters map[string][]FilterCondition `json:"filters"`
+}
+
+// LinkageResult 联动结果,按仪表板布局顺序返回受影响的组件
+type LinkageResult struct {
+	Components []*LinkedComponent `json:"components"`
+}
+
+// LinkedComponent 受联动影响的组件,单个组件失败不影响其他组件
+type LinkedComponent struct {
+	ComponentID string            `json:"componentId"`
+	ChartID     string            `json:"chartId"`
+	Filters     []FilterCondition `json:"filters"` // 联动后生效的过滤条件,后续事件原样回传
+	Data        *ChartDataResult  `json:"data,omitempty"`
+	Error       string            `json:"error,omitempty"`
+}
+
+// linkageTarget 一条联动在目标组件上的作用
+type linkageTarget struct {
+	field      string
+	updateType string
+}
+
+type dashboardLinkageService struct {
+	dashboardRepo  repository.DashboardRepository
+	componentRepo  repository.DashboardComponentRepository
+	linkageRepo    repository.LinkageRepository
+	chartRepo      repository.ChartRepository
+	datasetRepo    repository.DatasetRepository
+	calculatedRepo repository.CalculatedFieldRepository
+	chartData      ChartDataService
+}
+
+func NewDashboardLinkageService(dashboardRepo repository.DashboardRepository, componentRepo repository.DashboardComponentRepository, linkageRepo repository.LinkageRepository, chartRepo repository.ChartRepository, datasetRepo repository.DatasetRepository, calculatedRepo repository.CalculatedFieldRepository, chartData ChartDataService) DashboardLinkageService {
+	return &dashboardLinkageService{
+		dashboardRepo:  dashboardRepo,
+		componentRepo:  componentRepo,
+		linkageRepo:    linkageRepo,
+		chartRepo:      chartRepo,
+		datasetRepo:    datasetRepo,
+		calculatedRepo: calculatedRepo,
+		chartData:      chartData,
+	}
+}
+
+func (s *dashboardLinkageService) Trigger(ctx context.Context, dashboardID string, event *LinkageEvent) (*LinkageResult, error) {
+	dashboard, err := s.dashboardRepo.Get(ctx, dashboardID)
+	if err != nil {
+		return nil, fmt.Errorf("dashboard not found: %w", err)
+	}
+	charts, err := dashboardCharts(ctx, dashboard, s.componentRepo)
+	if err != nil {
+		return nil, err
+	}
+	var source *DashboardChart
+	for i := range charts {
+		if charts[i].ComponentID == event.SourceComponentID {
+			source = &charts[i]
+			break
+		}
+	}
+	if source == nil {
+		return nil, fmt.Errorf("component %s not found in dashboard %s", event.SourceComponentID, dashboardID)
+	}
+	linkageType := event.LinkageType
+	if linkageType == "" {
+		linkageType = LinkageTypeClick
+	}
+
+	// 源字段统一为字段标识,联动配置可按字段ID、列名或显示名引用
+	sourceFields, err := s.chartFields(ctx, source.ChartID)
+	if err != nil {
+		return nil, err
+	}
+	sourceKey := sourceFields.fieldKey(event.Field)
+	if _, ok := sourceFields.resolver.fields[event.Field]; !ok {
+		if _, ok := sourceFields.get(event.Field); !ok {
+			return nil, fmt.Errorf("unknown field %s of chart %s", event.Field, source.ChartID)
+		}
+	}
+	matches := func(configType, sourceField string) bool {
+		if configType != "" && configType != linkageType {
+			return false
+		}
+		return sourceField == "" || sourceFields.fieldKey(sourceField) == sourceKey
+	}
+
+	// 仪表板联动优先,图表联动作用于仪表板中引用目标图表、且没有仪表板联动的组件
+	targets := make(map[string][]linkageTarget)
+	dashboardLinkages, err := s.linkageRepo.ListByDashboard(ctx, dashboardID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get dashboard linkages: %w", err)
+	}
+	for _, l := range dashboardLinkages {
+		if !l.Enable || l.SourceComponentID != source.ComponentID || l.TargetComponentID == source.ComponentID || !matches(l.LinkageType, l.SourceFieldID) {
+			continue
+		}
+		targets[l.TargetComponentID] = append(targets[l.TargetComponentID], linkageTarget{field: l.TargetFieldID, updateType: l.UpdateType})
+	}
+	configured := make(map[string]bool, len(targets))
+	for id := range targets {
+		configured[id] = true
+	}
+	chartLinkages, err := s.linkageRepo.ListBySourceChart(ctx, source.ChartID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chart linkages: %w", err)
+	}
+	for _, l := range chartLinkages {
+		if !matches(l.LinkageType, l.SourceFieldID) {
+			continue
+		}
+		for _, c := range charts {
+			if c.ChartID != l.TargetViewID || c.ComponentID == source.ComponentID || configured[c.ComponentID] {
+				continue
+			}
+			targets[c.ComponentID] = append(targets[c.ComponentID], linkageTarget{field: l.TargetFieldID, updateType: l.UpdateType})
+		}
+	}
+
+	result := &LinkageResult{Components: []*LinkedComponent{}}
+	for _, c := range charts {
+		if links, ok := targets[c.ComponentID]; ok {
+			result.Components = append(result.Components, s.refresh(ctx, c, links, event, sourceFields))
+		}
+	}
+	return result, nil
+}
+
+// refresh 将联动值转换为目标组件的过滤条件并重新查询
+func (s *dashboardLinkageService) refresh(ctx context.Context, component DashboardChart, links []linkageTarget, event *LinkageEvent, sourceFields *calculatedFields) *LinkedComponent {
+	linked := &LinkedComponent{ComponentID: component.ComponentID, ChartID: component.ChartID}
+	filters := append([]FilterCondition{}, event.Filters[component.ComponentID]...)
+	linked.Filters = filters
+
+	targetFields, err := s.chartFields(ctx, component.ChartID)
+	if err != nil {
+		linked.Error = err.Error()
+		return linked
+	}
+	for _, link := range links {
+		field := link.field
+		if field == "" {
+			// 未配置目标字段时按源字段的列名匹配
+			field = sourceFields.columnName(event.Field)
+		}
+		key := targetFields.fieldKey(field)
+		switch link.updateType {
+		case "", LinkageUpdateReplace:
+			filters = removeFieldFilters(filters, targetFields, key)
+		case LinkageUpdateAppend:
+			if event.Value == nil {
+				filters = removeFieldFilters(filters, targetFields, key)
+			}
+		default:
+			linked.Error = fmt.Sprintf("unsupported linkage update type: %s", link.updateType)
+			return linked
+		}
+		if event.Value != nil {
+			filters = append(filters, linkageFilter(field, event.Value))
+		}
+	}
+	linked.Filters = filters
+
+	data, err := s.chartData.GetChartDataWithFilter(ctx, component.ChartID, &QueryFilter{Filters: filters})
+	if err != nil {
+		linked.Error = err.Error()
+		return linked
+	}
+	linked.Data = data
+	return linked
+}
+
+// chartFields 图表所在数据集的字段和计算字段
+func (s *dashboardLinkageService) chartFields(ctx context.Context, chartID string) (*calculatedFields, error) {
+	chart, err := s.chartRepo.Get(ctx, chartID)
+	if err != nil {
+		return nil, fmt.Errorf("chart not found: %w", err)
+	}
+	fields, err := s.datasetRepo.GetFields(ctx, chart.TableID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get dataset fields: %w", err)
+	}
+	return loadCalculatedFields(ctx, s.calculatedRepo, chart.TableID, fields)
+}
+
+// columnName 字段的原始列名,计算字段为字段名
+func (c *calculatedFields) columnName(name string) string {
+	if def, ok := c.defs[name]; ok {
+		return def.FieldName
+	}
+	if field, ok := c.resolver.fields[name]; ok && field.OriginName != "" {
+		return field.OriginName
+	}
+	return name
+}
+
+// removeFieldFilters 去掉指定字段上的过滤条件
+func removeFieldFilters(filters []FilterCondition, fields *calculatedFields, key string) []FilterCondition {
+	kept := make([]FilterCondition, 0, len(filters))
+	for _, f := range filters {
+		if fields.fieldKey(f.Field) != key {
+			kept = append(kept, f)
+		}
+	}
+	return kept
+}
+
+// linkageFilter 联动值对应的过滤条件,多个值时为 IN
+func linkageFilter(field string, value interface{}) FilterCondition {
+	if v := reflect.ValueOf(value); v.Kind() == reflect.Slice {
+		return FilterCondition{Field: field, Operator: "IN", Value: value}
+	}
+	return FilterCondition{Field: field, Operator: "=", Value: value}
+}
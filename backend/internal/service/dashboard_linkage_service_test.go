@@ -0,0 +1,159 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"cozy-insight-backend/internal/engine"
+	"cozy-insight-backend/internal/model"
+	"cozy-insight-backend/internal/repository"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// stubDashboardRepo 单个仪表板的仓库
+type stubDashboardRepo struct {
+	repository.DashboardRepository
+	dashboard *model.Dashboard
+}
+
+func (r *stubDashboardRepo) Get(ctx context.Context, id string) (*model.Dashboard, error) {
+	if r.dashboard == nil || r.dashboard.ID != id {
+		return nil, fmt.Errorf("dashboard %s not found", id)
+	}
+	return r.dashboard, nil
+}
+
+// memLinkageRepo 内存联动配置仓库
+type memLinkageRepo struct {
+	dashboard []*model.DashboardLinkage
+	chart     []*model.ChartViewLinkage
+}
+
+func (r *memLinkageRepo) ListByDashboard(ctx context.Context, dashboardID string) ([]*model.DashboardLinkage, error) {
+	var items []*model.DashboardLinkage
+	for _, l := range r.dashboard {
+		if l.DashboardID == dashboardID {
+			items = append(items, l)
+		}
+	}
+	return items, nil
+}
+
+func (r *memLinkageRepo) ListBySourceChart(ctx context.Context, chartID string) ([]*model.ChartViewLinkage, error) {
+	var items []*model.ChartViewLinkage
+	for _, l := range r.chart {
+		if l.SourceViewID == chartID {
+			items = append(items, l)
+		}
+	}
+	return items, nil
+}
+
+// recordingChartData 记录每个图表收到的过滤条件
+type recordingChartData struct {
+	filters map[string][]FilterCondition
+	fail    map[string]error
+}
+
+func (s *recordingChartData) GetChartData(ctx context.Context, chartID string) (*ChartDataResult, error) {
+	return s.GetChartDataWithFilter(ctx, chartID, nil)
+}
+
+func (s *recordingChartData) GetChartDataWithFilter(ctx context.Context, chartID string, filter *QueryFilter) (*ChartDataResult, error) {
+	if err := s.fail[chartID]; err != nil {
+		return nil, err
+	}
+	s.filters[chartID] = filter.Filters
+	return &ChartDataResult{Data: []map[string]interface{}{{"chart": chartID}}}, nil
+}
+
+func (s *recordingChartData) QueryChart(ctx context.Context, source *ChartSource, filter *QueryFilter) (*ChartDataResult, error) {
+	return s.GetChartDataWithFilter(ctx, source.Chart.ID, filter)
+}
+
+func TestDashboardLinkageService_Trigger(t *testing.T) {
+	dashboardRepo := &stubDashboardRepo{dashboard: &model.Dashboard{
+		ID: "dash1",
+		ComponentData: `{"layouts":[
+			{"i":"c1","componentType":"chart","componentId":"chart1"},
+			{"i":"c2","componentType":"chart","componentId":"chart2"},
+			{"i":"c3","componentType":"chart","componentId":"chart3"},
+			{"i":"c4","componentType":"chart","componentId":"chart3"},
+			{"i":"c5","componentType":"text"}]}`,
+	}}
+	linkageRepo := &memLinkageRepo{
+		dashboard: []*model.DashboardLinkage{
+			{ID: "l1", DashboardID: "dash1", SourceComponentID: "c1", TargetComponentID: "c2", SourceFieldID: "f1", TargetFieldID: "f1", UpdateType: LinkageUpdateReplace, Enable: true},
+			{ID: "l2", DashboardID: "dash1", SourceComponentID: "c1", TargetComponentID: "c4", SourceFieldID: "f1", Enable: false},
+			{ID: "l3", DashboardID: "dash1", SourceComponentID: "c1", TargetComponentID: "c2", SourceFieldID: "f2", Enable: true},
+		},
+		chart: []*model.ChartViewLinkage{
+			{ID: "v1", SourceViewID: "chart1", TargetViewID: "chart3", UpdateType: LinkageUpdateAppend},
+			{ID: "v2", SourceViewID: "chart1", TargetViewID: "chart2", LinkageType: "hover"},
+		},
+	}
+	chartRepo := new(MockChartRepository)
+	for _, id := range []string{"chart1", "chart2", "chart3"} {
+		chartRepo.On("Get", mock.Anything, id).Return(&model.ChartView{ID: id, TableID: "table1"}, nil)
+	}
+	datasetRepo := &stubDatasetRepo{
+		table: &model.DatasetTable{ID: "table1"},
+		fields: []*model.DatasetTableField{
+			{ID: "f1", OriginName: "region", Name: "区域", DeType: engine.DeTypeText},
+			{ID: "f2", OriginName: "city", Name: "城市", DeType: engine.DeTypeText},
+		},
+	}
+	chartData := &recordingChartData{filters: map[string][]FilterCondition{}, fail: map[string]error{}}
+	svc := NewDashboardLinkageService(dashboardRepo, nil, linkageRepo, chartRepo, datasetRepo, nil, chartData)
+	ctx := context.Background()
+
+	// 仪表板联动替换目标字段上的条件;图表联动作用于引用目标图表的所有组件并追加条件
+	result, err := svc.Trigger(ctx, "dash1", &LinkageEvent{
+		SourceComponentID: "c1",
+		Field:             "区域",
+		Value:             "east",
+		Filters: map[string][]FilterCondition{
+			"c2": {{Field: "region", Operator: "=", Value: "west"}, {Field: "city", Operator: "=", Value: "chengdu"}},
+			"c3": {{Field: "region", Operator: "=", Value: "west"}},
+		},
+	})
+	require.NoError(t, err)
+	require.Len(t, result.Components, 3)
+	assert.Equal(t, "c2", result.Components[0].ComponentID)
+	assert.Equal(t, []FilterCondition{{Field: "city", Operator: "=", Value: "chengdu"}, {Field: "f1", Operator: "=", Value: "east"}}, result.Components[0].Filters)
+	assert.NotNil(t, result.Components[0].Data)
+	assert.Equal(t, "c3", result.Components[1].ComponentID)
+	assert.Equal(t, []FilterCondition{{Field: "region", Operator: "=", Value: "west"}, {Field: "region", Operator: "=", Value: "east"}}, result.Components[1].Filters)
+	assert.Equal(t, "c4", result.Components[2].ComponentID)
+	assert.Equal(t, []FilterCondition{{Field: "region", Operator: "=", Value: "east"}}, result.Components[2].Filters)
+
+	// 清空联动值时去掉目标字段上的条件,多值按 IN 过滤;单个组件失败不影响其他组件
+	chartData.fail["chart3"] = fmt.Errorf("datasource unavailable")
+	result, err = svc.Trigger(ctx, "dash1", &LinkageEvent{
+		SourceComponentID: "c1",
+		Field:             "region",
+		Value:             []interface{}{"east", "north"},
+	})
+	require.NoError(t, err)
+	require.Len(t, result.Components, 3)
+	assert.Equal(t, []FilterCondition{{Field: "f1", Operator: "IN", Value: []interface{}{"east", "north"}}}, result.Components[0].Filters)
+	assert.Equal(t, "datasource unavailable", result.Components[1].Error)
+	assert.Nil(t, result.Components[1].Data)
+
+	result, err = svc.Trigger(ctx, "dash1", &LinkageEvent{
+		SourceComponentID: "c1",
+		Field:             "区域",
+		Filters:           map[string][]FilterCondition{"c2": {{Field: "区域", Operator: "=", Value: "east"}}},
+	})
+	require.NoError(t, err)
+	assert.Empty(t, result.Components[0].Filters)
+
+	_, err = svc.Trigger(ctx, "dash1", &LinkageEvent{SourceComponentID: "c9", Field: "region", Value: "east"})
+	assert.ErrorContains(t, err, "component c9 not found")
+	_, err = svc.Trigger(ctx, "dash1", &LinkageEvent{SourceComponentID: "c1", Field: "amount", Value: 1})
+	assert.ErrorContains(t, err, "unknown field amount")
+}
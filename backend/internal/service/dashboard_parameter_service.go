@@ -0,0 +1,299 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"cozy-insight-backend/internal/model"
+	"cozy-insight-backend/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+// 仪表板参数类型
+const (
+	ParameterTypeText        = "text"
+	ParameterTypeDate        = "date" // 单个日期,或以逗号分隔的起止日期
+	ParameterTypeSelect      = "select"
+	ParameterTypeMultiSelect = "multiselect"
+)
+
+// maxParameterOptions 从映射字段查询下拉选项时的最大选项数
+const maxParameterOptions = 1000
+
+type DashboardParameterService interface {
+	Create(ctx context.Context, param *model.DashboardParameter) error
+	Update(ctx context.Context, param *model.DashboardParameter) error
+	Delete(ctx context.Context, id string) error
+	Get(ctx context.Context, id string) (*model.DashboardParameter, error)
+	List(ctx context.Context, dashboardID string) ([]*model.DashboardParameter, error)
+
+	// Options 下拉参数的可选值,配置了静态选项时直接返回,否则查询各映射字段的去重值
+	Options(ctx context.Context, id string) ([]interface{}, error)
+}
+
+type dashboardParameterService struct {
+	repo           repository.DashboardParameterRepository
+	dashboardRepo  repository.DashboardRepository
+	componentRepo  repository.DashboardComponentRepository
+	chartRepo      repository.ChartRepository
+	datasetRepo    repository.DatasetRepository
+	calculatedRepo repository.CalculatedFieldRepository
+	chartData      ChartDataService
+}
+
+func NewDashboardParameterService(repo repository.DashboardParameterRepository, dashboardRepo repository.DashboardRepository, componentRepo repository.DashboardComponentRepository, chartRepo repository.ChartRepository, datasetRepo repository.DatasetRepository, calculatedRepo repository.CalculatedFieldRepository, chartData ChartDataService) DashboardParameterService {
+	return &dashboardParameterService{
+		repo:           repo,
+		dashboardRepo:  dashboardRepo,
+		componentRepo:  componentRepo,
+		chartRepo:      chartRepo,
+		datasetRepo:    datasetRepo,
+		calculatedRepo: calculatedRepo,
+		chartData:      chartData,
+	}
+}
+
+func (s *dashboardParameterService) Create(ctx context.Context, param *model.DashboardParameter) error {
+	if param.DashboardID == "" || param.Name == "" {
+		return fmt.Errorf("dashboard id and name are required")
+	}
+	if param.ID == "" {
+		param.ID = uuid.New().String()
+	}
+	if err := s.check(ctx, param); err != nil {
+		return err
+	}
+	return s.repo.Create(ctx, param)
+}
+
+func (s *dashboardParameterService) Update(ctx context.Context, param *model.DashboardParameter) error {
+	existing, err := s.repo.Get(ctx, param.ID)
+	if err != nil {
+		return fmt.Errorf("parameter not found: %w", err)
+	}
+
+	param.DashboardID = existing.DashboardID
+	param.CreateTime = existing.CreateTime
+	if param.Name == "" {
+		param.Name = existing.Name
+	}
+	if err := s.check(ctx, param); err != nil {
+		return err
+	}
+	return s.repo.Update(ctx, param)
+}
+
+func (s *dashboardParameterService) Delete(ctx context.Context, id string) error {
+	return s.repo.Delete(ctx, id)
+}
+
+func (s *dashboardParameterService) Get(ctx context.Context, id string) (*model.DashboardParameter, error) {
+	return s.repo.Get(ctx, id)
+}
+
+func (s *dashboardParameterService) List(ctx context.Context, dashboardID string) ([]*model.DashboardParameter, error) {
+	return s.repo.ListByDashboard(ctx, dashboardID)
+}
+
+// check 校验参数类型、选项和字段映射,参数名在仪表板内唯一
+func (s *dashboardParameterService) check(ctx context.Context, param *model.DashboardParameter) error {
+	if param.ParamType == "" {
+		param.ParamType = ParameterTypeText
+	}
+	switch param.ParamType {
+	case ParameterTypeText, ParameterTypeDate, ParameterTypeSelect, ParameterTypeMultiSelect:
+	default:
+		return fmt.Errorf("unsupported parameter type: %s", param.ParamType)
+	}
+	if _, err := parameterOptions(param); err != nil {
+		return err
+	}
+
+	params, err := s.repo.ListByDashboard(ctx, param.DashboardID)
+	if err != nil {
+		return fmt.Errorf("failed to get parameters: %w", err)
+	}
+	for _, p := range params {
+		if p.ID != param.ID && p.Name == param.Name {
+			return fmt.Errorf("parameter %s already exists", param.Name)
+		}
+	}
+
+	mapping, err := parameterMapping(param)
+	if err != nil {
+		return err
+	}
+	if len(mapping) == 0 {
+		return nil
+	}
+	dashboard, err := s.dashboardRepo.Get(ctx, param.DashboardID)
+	if err != nil {
+		return fmt.Errorf("dashboard not found: %w", err)
+	}
+	charts, err := dashboardCharts(ctx, dashboard, s.componentRepo)
+	if err != nil {
+		return err
+	}
+	chartIDs := make(map[string]string, len(charts))
+	for _, c := range charts {
+		chartIDs[c.ComponentID] = c.ChartID
+	}
+	for componentID, field := range mapping {
+		chartID, ok := chartIDs[componentID]
+		if !ok {
+			return fmt.Errorf("component %s not found in dashboard %s", componentID, param.DashboardID)
+		}
+		_, calc, err := s.load(ctx, chartID)
+		if err != nil {
+			return err
+		}
+		if _, ok := calc.get(field); !ok {
+			if _, err := calc.resolver.resolve(field); err != nil {
+				return fmt.Errorf("invalid field mapping of component %s: %w", componentID, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (s *dashboardParameterService) Options(ctx context.Context, id string) ([]interface{}, error) {
+	param, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("parameter not found: %w", err)
+	}
+	options, err := parameterOptions(param)
+	if err != nil {
+		return nil, err
+	}
+	if len(options) > 0 {
+		return options, nil
+	}
+	mapping, err := parameterMapping(param)
+	if err != nil {
+		return nil, err
+	}
+	if len(mapping) == 0 {
+		return []interface{}{}, nil
+	}
+
+	dashboard, err := s.dashboardRepo.Get(ctx, param.DashboardID)
+	if err != nil {
+		return nil, fmt.Errorf("dashboard not found: %w", err)
+	}
+	charts, err := dashboardCharts(ctx, dashboard, s.componentRepo)
+	if err != nil {
+		return nil, err
+	}
+
+	// 按布局顺序合并各映射字段的去重值,同一数据集上的同一字段只查询一次
+	values := []interface{}{}
+	seen := make(map[string]bool)
+	queried := make(map[string]bool)
+	for _, c := range charts {
+		field, ok := mapping[c.ComponentID]
+		if !ok {
+			continue
+		}
+		source, calc, err := s.load(ctx, c.ChartID)
+		if err != nil {
+			return nil, err
+		}
+		key := source.Table.ID + "/" + calc.fieldKey(field)
+		if queried[key] {
+			continue
+		}
+		queried[key] = true
+
+		xAxis, err := json.Marshal(AxisConfig{Fields: []FieldConfig{{Name: field, Sort: "asc"}}})
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode option query: %w", err)
+		}
+		source.Chart = &model.ChartView{ID: param.ID, TableID: source.Table.ID, XAxis: string(xAxis)}
+		result, err := s.chartData.QueryChart(ctx, source, &QueryFilter{Limit: maxParameterOptions})
+		if err != nil {
+			return nil, fmt.Errorf("failed to query options of %s: %w", field, err)
+		}
+		for _, row := range result.Data {
+			value := row[field]
+			if value == nil || seen[fmt.Sprint(value)] {
+				continue
+			}
+			seen[fmt.Sprint(value)] = true
+			values = append(values, value)
+			if len(values) == maxParameterOptions {
+				return values, nil
+			}
+		}
+	}
+	return values, nil
+}
+
+// load 图表所在数据集及其字段
+func (s *dashboardParameterService) load(ctx context.Context, chartID string) (*ChartSource, *calculatedFields, error) {
+	chart, err := s.chartRepo.Get(ctx, chartID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("chart not found: %w", err)
+	}
+	table, err := s.datasetRepo.GetTable(ctx, chart.TableID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("dataset not found: %w", err)
+	}
+	fields, err := s.datasetRepo.GetFields(ctx, table.ID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get dataset fields: %w", err)
+	}
+	calc, err := loadCalculatedFields(ctx, s.calculatedRepo, table.ID, fields)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &ChartSource{Chart: chart, Table: table, Fields: fields}, calc, nil
+}
+
+// parameterOptions 解析参数的静态选项
+func parameterOptions(param *model.DashboardParameter) ([]interface{}, error) {
+	if strings.TrimSpace(param.Options) == "" {
+		return nil, nil
+	}
+	var options []interface{}
+	if err := json.Unmarshal([]byte(param.Options), &options); err != nil {
+		return nil, fmt.Errorf("invalid options of parameter %s: %w", param.Name, err)
+	}
+	return options, nil
+}
+
+// parameterMapping 解析参数的字段映射,组件ID -> 字段
+func parameterMapping(param *model.DashboardParameter) (map[string]string, error) {
+	if strings.TrimSpace(param.FieldMapping) == "" {
+		return nil, nil
+	}
+	var mapping map[string]string
+	if err := json.Unmarshal([]byte(param.FieldMapping), &mapping); err != nil {
+		return nil, fmt.Errorf("invalid field mapping of parameter %s: %w", param.Name, err)
+	}
+	return mapping, nil
+}
+
+// parameterFilters 参数值在映射字段上的过滤条件
+// 多选为 IN,以逗号分隔的日期为起止范围(包含两端),其余为等值
+func parameterFilters(param *model.DashboardParameter, field string, value interface{}) []FilterCondition {
+	switch param.ParamType {
+	case ParameterTypeMultiSelect:
+		return []FilterCondition{{Field: field, Operator: "IN", Value: variableItems(value)}}
+	case ParameterTypeDate:
+		if s, ok := value.(string); ok && strings.Contains(s, ",") {
+			parts := strings.SplitN(s, ",", 2)
+			var filters []FilterCondition
+			if start := strings.TrimSpace(parts[0]); start != "" {
+				filters = append(filters, FilterCondition{Field: field, Operator: ">=", Value: start})
+			}
+			if end := strings.TrimSpace(parts[1]); end != "" {
+				filters = append(filters, FilterCondition{Field: field, Operator: "<=", Value: end})
+			}
+			return filters
+		}
+	}
+	return []FilterCondition{{Field: field, Operator: "=", Value: value}}
+}
@@ -0,0 +1,181 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"cozy-insight-backend/internal/engine"
+	"cozy-insight-backend/internal/model"
+	"cozy-insight-backend/pkg/logger"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// memParameterRepo 内存仪表板参数仓库
+type memParameterRepo struct {
+	items []*model.DashboardParameter
+}
+
+func (r *memParameterRepo) Create(ctx context.Context, param *model.DashboardParameter) error {
+	r.items = append(r.items, param)
+	return nil
+}
+
+func (r *memParameterRepo) Update(ctx context.Context, param *model.DashboardParameter) error {
+	for i, p := range r.items {
+		if p.ID == param.ID {
+			r.items[i] = param
+		}
+	}
+	return nil
+}
+
+func (r *memParameterRepo) Delete(ctx context.Context, id string) error {
+	for i, p := range r.items {
+		if p.ID == id {
+			r.items = append(r.items[:i], r.items[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (r *memParameterRepo) Get(ctx context.Context, id string) (*model.DashboardParameter, error) {
+	for _, p := range r.items {
+		if p.ID == id {
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("parameter %s not found", id)
+}
+
+func (r *memParameterRepo) ListByDashboard(ctx context.Context, dashboardID string) ([]*model.DashboardParameter, error) {
+	var items []*model.DashboardParameter
+	for _, p := range r.items {
+		if p.DashboardID == dashboardID {
+			items = append(items, p)
+		}
+	}
+	return items, nil
+}
+
+func TestDashboardParameterService(t *testing.T) {
+	logger.InitLogger("error")
+
+	path := filepath.Join(t.TempDir(), "sales.db")
+	db, err := sql.Open("sqlite3", path)
+	require.NoError(t, err)
+	_, err = db.Exec(`CREATE TABLE sales (region TEXT, day TEXT, amount REAL)`)
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO sales VALUES ('west', '2024-01-01', 1), ('east', '2024-01-02', 2), ('east', '2024-01-03', 3), (NULL, '2024-01-04', 4)`)
+	require.NoError(t, err)
+	db.Close()
+
+	dashboardRepo := &stubDashboardRepo{dashboard: &model.Dashboard{
+		ID: "dash1",
+		ComponentData: `{"layouts":[
+			{"i":"c1","componentType":"chart","componentId":"chart1"},
+			{"i":"c2","componentType":"chart","componentId":"chart1"}]}`,
+	}}
+	chartRepo := new(MockChartRepository)
+	chartRepo.On("Get", mock.Anything, "chart1").Return(&model.ChartView{ID: "chart1", TableID: "table1"}, nil)
+	datasetRepo := &stubDatasetRepo{
+		table: &model.DatasetTable{ID: "table1", DatasourceID: "ds1", Type: DatasetTypeDB, PhysicalTableName: "sales"},
+		fields: []*model.DatasetTableField{
+			{ID: "f1", OriginName: "region", Name: "区域", DeType: engine.DeTypeText},
+			{ID: "f2", OriginName: "day", Name: "日期", DeType: engine.DeTypeTime},
+		},
+	}
+	dsRepo := &stubDatasourceRepo{items: map[string]*model.Datasource{
+		"ds1": {ID: "ds1", Type: "sqlite", Configuration: fmt.Sprintf(`{"path":%q}`, path)},
+	}}
+	router := engine.NewQueryRouter(engine.NewNativeExecutor(engine.NewConnectionManager(nil)))
+	chartData := NewChartDataService(chartRepo, datasetRepo, dsRepo, nil, nil, router, nil)
+	repo := &memParameterRepo{}
+	svc := NewDashboardParameterService(repo, dashboardRepo, nil, chartRepo, datasetRepo, nil, chartData)
+	ctx := context.Background()
+
+	// 类型、名称唯一性和字段映射校验
+	region := &model.DashboardParameter{DashboardID: "dash1", Name: "region", ParamType: ParameterTypeSelect, FieldMapping: `{"c1":"f1","c2":"区域"}`, Enable: true}
+	require.NoError(t, svc.Create(ctx, region))
+	assert.NotEmpty(t, region.ID)
+	assert.ErrorContains(t, svc.Create(ctx, &model.DashboardParameter{DashboardID: "dash1", Name: "region"}), "already exists")
+	assert.ErrorContains(t, svc.Create(ctx, &model.DashboardParameter{DashboardID: "dash1", Name: "x", ParamType: "number"}), "unsupported parameter type")
+	assert.ErrorContains(t, svc.Create(ctx, &model.DashboardParameter{DashboardID: "dash1", Name: "x", FieldMapping: `{"c9":"f1"}`}), "component c9 not found")
+	assert.ErrorContains(t, svc.Create(ctx, &model.DashboardParameter{DashboardID: "dash1", Name: "x", FieldMapping: `{"c1":"city"}`}), "unknown field: city")
+	assert.ErrorContains(t, svc.Create(ctx, &model.DashboardParameter{DashboardID: "dash1", Name: "x", Options: `{}`}), "invalid options")
+
+	// 未配置静态选项时查询映射字段的去重值,空值不作为选项
+	options, err := svc.Options(ctx, region.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"east", "west"}, options)
+
+	region.Options = `["north","south"]`
+	require.NoError(t, svc.Update(ctx, region))
+	options, err = svc.Options(ctx, region.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"north", "south"}, options)
+
+	params, err := svc.List(ctx, "dash1")
+	require.NoError(t, err)
+	assert.Len(t, params, 1)
+	require.NoError(t, svc.Delete(ctx, region.ID))
+	params, err = svc.List(ctx, "dash1")
+	require.NoError(t, err)
+	assert.Empty(t, params)
+}
+
+func TestDashboardDataService_Parameters(t *testing.T) {
+	logger.InitLogger("error")
+
+	dashboardRepo := &stubDashboardRepo{dashboard: &model.Dashboard{
+		ID: "dash1",
+		ComponentData: `{"layouts":[
+			{"i":"c1","componentType":"chart","componentId":"chart1"},
+			{"i":"c2","componentType":"chart","componentId":"chart1"}]}`,
+	}}
+	paramRepo := &memParameterRepo{items: []*model.DashboardParameter{
+		{ID: "p1", DashboardID: "dash1", Name: "regions", ParamType: ParameterTypeMultiSelect, DefaultValue: "east", FieldMapping: `{"c1":"f1","c2":"f1"}`, Enable: true},
+		{ID: "p2", DashboardID: "dash1", Name: "period", ParamType: ParameterTypeDate, FieldMapping: `{"c2":"f2"}`, Enable: true},
+		{ID: "p3", DashboardID: "dash1", Name: "city", ParamType: ParameterTypeText, FieldMapping: `{"c1":"f3"}`, Enable: true},
+		{ID: "p4", DashboardID: "dash1", Name: "required", ParamType: ParameterTypeText, DefaultValue: "x", Required: true, Enable: true},
+	}}
+	chartRepo := new(MockChartRepository)
+	chartRepo.On("Get", mock.Anything, "chart1").Return(&model.ChartView{ID: "chart1", TableID: "table1"}, nil)
+	datasetRepo := &stubDatasetRepo{table: &model.DatasetTable{ID: "table1"}}
+	chartData := &concurrentChartData{recordingChartData: recordingChartData{filters: map[string][]FilterCondition{}, fail: map[string]error{}}}
+	svc := NewDashboardDataService(dashboardRepo, nil, paramRepo, chartRepo, datasetRepo, chartData, 2, time.Second)
+	ctx := context.Background()
+
+	// 参数值作为映射字段上的过滤条件,并作为 SQL 变量
+	result, err := svc.GetDashboardData(ctx, "dash1", &DashboardDataRequest{
+		Parameters: map[string]string{"regions": "east,west", "period": "2024-01-01,2024-01-31"},
+		Variables:  map[string]interface{}{"required": "y"},
+		Filters:    map[string][]FilterCondition{"c1": {{Field: "f2", Operator: ">", Value: "2023-12-31"}}},
+	})
+	require.NoError(t, err)
+	require.Len(t, result.Components, 2)
+	assert.Equal(t, []FilterCondition{
+		{Field: "f2", Operator: ">", Value: "2023-12-31"},
+		{Field: "f1", Operator: "IN", Value: []interface{}{"east", "west"}},
+	}, result.Components[0].Data.Data[0]["filters"])
+	assert.Equal(t, []FilterCondition{
+		{Field: "f1", Operator: "IN", Value: []interface{}{"east", "west"}},
+		{Field: "f2", Operator: ">=", Value: "2024-01-01"},
+		{Field: "f2", Operator: "<=", Value: "2024-01-31"},
+	}, result.Components[1].Data.Data[0]["filters"])
+	assert.Equal(t, map[string]interface{}{
+		"regions": []interface{}{"east", "west"}, "period": "2024-01-01,2024-01-31", "required": "y",
+	}, result.Components[0].Data.Data[0]["vars"])
+
+	// 缺少必填参数时整个请求失败
+	paramRepo.items[3].DefaultValue = ""
+	_, err = svc.GetDashboardData(ctx, "dash1", nil)
+	assert.ErrorContains(t, err, "parameter required is required")
+}
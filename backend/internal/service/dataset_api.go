@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"cozy-insight-backend/internal/engine"
+	"cozy-insight-backend/internal/model"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// apiExtractInfo API 数据集的 Info 配置,记录最近一次抽取结果
+type apiExtractInfo struct {
+	RowCount    int                    `json:"rowCount"`
+	Pages       int                    `json:"pages"`
+	Columns     []engine.ExtractColumn `json:"columns"`
+	ExtractTime int64                  `json:"extractTime"`
+}
+
+// ExtractResult 数据集抽取结果
+type ExtractResult struct {
+	TableID     string `json:"tableId"`
+	RowCount    int    `json:"rowCount"`
+	Pages       int    `json:"pages"`
+	ExtractTime int64  `json:"extractTime"`
+}
+
+// ExtractTable 重新请求 API 数据源并替换抽取库中的数据,随后同步字段
+func (s *datasetService) ExtractTable(ctx context.Context, id string) (*ExtractResult, error) {
+	table, err := s.repo.GetTable(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("table not found: %w", err)
+	}
+	if table.Type != DatasetTypeAPI {
+		return nil, fmt.Errorf("dataset %s is not an api dataset", table.ID)
+	}
+
+	info, err := s.extractAPI(ctx, table)
+	if err != nil {
+		return nil, err
+	}
+
+	table.UpdateTime = time.Now().UnixMilli()
+	if err := s.repo.UpdateTable(ctx, table); err != nil {
+		return nil, fmt.Errorf("failed to save dataset: %w", err)
+	}
+	if _, err := s.SyncFields(ctx, table.ID); err != nil {
+		return nil, fmt.Errorf("failed to sync fields: %w", err)
+	}
+
+	return &ExtractResult{TableID: table.ID, RowCount: info.RowCount, Pages: info.Pages, ExtractTime: info.ExtractTime}, nil
+}
+
+// createAPITable 创建 API 数据集,先完成首次抽取再保存
+func (s *datasetService) createAPITable(ctx context.Context, table *model.DatasetTable) error {
+	if table.DatasourceID == "" {
+		return fmt.Errorf("datasource is required")
+	}
+	if table.PhysicalTableName == "" {
+		table.PhysicalTableName = "api_" + strings.ReplaceAll(table.ID, "-", "")
+	}
+
+	if _, err := s.extractAPI(ctx, table); err != nil {
+		return err
+	}
+
+	table.CreateTime = time.Now().UnixMilli()
+	table.UpdateTime = table.CreateTime
+	if err := s.repo.CreateTable(ctx, table); err != nil {
+		return err
+	}
+	_, err := s.SyncFields(ctx, table.ID)
+	return err
+}
+
+// extractAPI 请求数据集绑定的 API 数据源,写入抽取表并更新 table.Info
+func (s *datasetService) extractAPI(ctx context.Context, table *model.DatasetTable) (*apiExtractInfo, error) {
+	if s.extract == nil {
+		return nil, fmt.Errorf("extract store not initialized")
+	}
+	if s.api == nil {
+		return nil, fmt.Errorf("api connector not initialized")
+	}
+
+	ds, err := s.datasourceRepo.GetByID(ctx, table.DatasourceID)
+	if err != nil {
+		return nil, fmt.Errorf("datasource not found: %w", err)
+	}
+	if ds.Type != model.DatasourceTypeAPI {
+		return nil, fmt.Errorf("datasource %s is not an api datasource", ds.ID)
+	}
+	config, err := engine.ParseAPIConfig(ds.Configuration)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := s.api.Fetch(ctx, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch api data: %w", err)
+	}
+	if len(result.Columns) == 0 {
+		return nil, fmt.Errorf("api returned no data")
+	}
+
+	if err := s.extract.Write(ctx, table.PhysicalTableName, result.Columns, result.Rows, engine.WriteModeReplace); err != nil {
+		return nil, fmt.Errorf("failed to store api data: %w", err)
+	}
+
+	info := &apiExtractInfo{
+		RowCount:    len(result.Rows),
+		Pages:       result.Pages,
+		Columns:     result.Columns,
+		ExtractTime: time.Now().UnixMilli(),
+	}
+	infoJSON, err := json.Marshal(info)
+	if err != nil {
+		return nil, err
+	}
+	table.Info = string(infoJSON)
+	return info, nil
+}
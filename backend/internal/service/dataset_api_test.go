@@ -0,0 +1,60 @@
+package service
+
+import (
+	"context"
+	"cozy-insight-backend/internal/engine"
+	"cozy-insight-backend/internal/model"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIDataset_CreatePreviewAndExtract(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		fmt.Fprintf(w, `{"result":[{"city":"sh","stats":{"sales":%d}},{"city":"bj","stats":{"sales":5}}]}`, calls*10)
+	}))
+	defer server.Close()
+
+	svc, repo := newUploadTestService(t)
+	svc.api = engine.NewAPIConnector(nil)
+	svc.datasourceRepo = &stubDatasourceRepo{items: map[string]*model.Datasource{
+		"api1": {ID: "api1", Type: model.DatasourceTypeAPI, Configuration: fmt.Sprintf(`{"url":%q,"rowsPath":"$.result"}`, server.URL)},
+	}}
+	ctx := context.Background()
+
+	table := &model.DatasetTable{Name: "sales", Type: DatasetTypeAPI, DatasourceID: "api1"}
+	require.NoError(t, svc.CreateTable(ctx, table))
+	assert.Contains(t, table.PhysicalTableName, "api_")
+	assert.Len(t, repo.fields[table.ID], 2)
+
+	preview, err := svc.PreviewData(ctx, table.ID, 10)
+	require.NoError(t, err)
+	require.Len(t, preview.Data, 2)
+	assert.Equal(t, engine.ExecPathNative, preview.Engine)
+	assert.Equal(t, int64(10), preview.Data[0]["stats.sales"])
+
+	result, err := svc.ExtractTable(ctx, table.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.RowCount)
+
+	preview, err = svc.PreviewData(ctx, table.ID, 10)
+	require.NoError(t, err)
+	assert.Equal(t, int64(20), preview.Data[0]["stats.sales"])
+}
+
+func TestAPIDataset_RejectsNonAPIDatasource(t *testing.T) {
+	svc, _ := newUploadTestService(t)
+	svc.api = engine.NewAPIConnector(nil)
+	svc.datasourceRepo = &stubDatasourceRepo{items: map[string]*model.Datasource{
+		"db1": {ID: "db1", Type: "mysql", Configuration: `{}`},
+	}}
+
+	err := svc.CreateTable(context.Background(), &model.DatasetTable{Name: "x", Type: DatasetTypeAPI, DatasourceID: "db1"})
+	assert.ErrorContains(t, err, "not an api datasource")
+}
@@ -0,0 +1,211 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"cozy-insight-backend/internal/engine"
+	"cozy-insight-backend/internal/repository"
+	"cozy-insight-backend/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// 字段去重值查询的分页和基数限制
+const (
+	defaultFieldValuesLimit = 100
+	maxFieldValuesLimit     = 1000
+	maxFieldValues          = 10000 // 单个字段最多可翻页读取的去重值数,超出时需要通过搜索缩小范围
+	fieldValuesCacheTTL     = 5 * time.Minute
+)
+
+type FieldValuesService interface {
+	// Values 数据集字段的去重值,按值升序分页返回,结果受调用者的行权限约束
+	Values(ctx context.Context, userID string, req *FieldValuesRequest) (*FieldValuesResult, error)
+}
+
+// FieldValuesRequest 字段去重值查询条件
+type FieldValuesRequest struct {
+	DatasetID string                 `json:"datasetId"`
+	FieldID   string                 `json:"fieldId"` // 字段ID、列名或计算字段
+	Search    string                 `json:"search"`  // 前缀搜索,不区分大小写
+	Limit     int                    `json:"limit"`
+	Offset    int                    `json:"offset"`
+	Counts    bool                   `json:"counts"`    // 是否返回每个值的行数
+	Variables map[string]interface{} `json:"variables"` // SQL 数据集变量
+}
+
+// FieldValuesResult 一页字段去重值
+type FieldValuesResult struct {
+	Values  []interface{} `json:"values"`
+	Counts  []int64       `json:"counts,omitempty"` // 与 Values 一一对应
+	HasMore bool          `json:"hasMore"`          // 是否还有下一页
+	Capped  bool          `json:"capped"`           // 去重值超过基数上限,其余值只能通过搜索获得
+}
+
+type fieldValuesService struct {
+	datasetRepo    repository.DatasetRepository
+	datasourceRepo repository.DatasourceRepository
+	calculatedRepo repository.CalculatedFieldRepository
+	rowPermissions RowPermissionService
+	router         *engine.QueryRouter
+	extract        *engine.ExtractStore
+	cache          engine.CacheService
+}
+
+// NewFieldValuesService 创建字段去重值服务,rowPermissions、cache 为空时不做行权限过滤和缓存
+func NewFieldValuesService(datasetRepo repository.DatasetRepository, datasourceRepo repository.DatasourceRepository, calculatedRepo repository.CalculatedFieldRepository, rowPermissions RowPermissionService, router *engine.QueryRouter, extract *engine.ExtractStore, cache engine.CacheService) FieldValuesService {
+	return &fieldValuesService{
+		datasetRepo:    datasetRepo,
+		datasourceRepo: datasourceRepo,
+		calculatedRepo: calculatedRepo,
+		rowPermissions: rowPermissions,
+		router:         router,
+		extract:        extract,
+		cache:          cache,
+	}
+}
+
+func (s *fieldValuesService) Values(ctx context.Context, userID string, req *FieldValuesRequest) (*FieldValuesResult, error) {
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultFieldValuesLimit
+	}
+	if limit > maxFieldValuesLimit {
+		limit = maxFieldValuesLimit
+	}
+	if req.Offset < 0 {
+		return nil, fmt.Errorf("invalid offset: %d", req.Offset)
+	}
+	if req.Offset >= maxFieldValues {
+		return nil, fmt.Errorf("offset exceeds the limit of %d distinct values, narrow the search instead", maxFieldValues)
+	}
+	if req.Offset+limit > maxFieldValues {
+		limit = maxFieldValues - req.Offset
+	}
+
+	table, err := s.datasetRepo.GetTable(ctx, req.DatasetID)
+	if err != nil {
+		return nil, fmt.Errorf("dataset not found: %w", err)
+	}
+	fields, err := s.datasetRepo.GetFields(ctx, table.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get dataset fields: %w", err)
+	}
+	calc, err := loadCalculatedFields(ctx, s.calculatedRepo, table.ID, fields)
+	if err != nil {
+		return nil, err
+	}
+
+	// 行权限条件,多个权限之间为或
+	var where string
+	if s.rowPermissions != nil {
+		if where, err = s.rowPermissions.GetUserRowPermissionWhere(ctx, userID, table.ID); err != nil {
+			return nil, fmt.Errorf("failed to get row permissions: %w", err)
+		}
+	}
+
+	// 缓存按查询条件和行权限区分,数据集更新后失效
+	var key string
+	if s.cache != nil {
+		raw, err := json.Marshal([]interface{}{table.ID, table.UpdateTime, calc.fieldKey(req.FieldID), strings.ToLower(req.Search), limit, req.Offset, req.Counts, req.Variables, where})
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode cache key: %w", err)
+		}
+		key = "field_values:" + string(raw)
+		if cached, err := s.cache.Get(ctx, key); err == nil {
+			if text, ok := cached.(string); ok {
+				var result FieldValuesResult
+				if err := json.Unmarshal([]byte(text), &result); err == nil {
+					return &result, nil
+				}
+			}
+		}
+	}
+
+	source, err := loadDatasetSource(ctx, s.datasetRepo, table, req.Variables)
+	if err != nil {
+		return nil, err
+	}
+	source.Where = where
+	query := &engine.Query{Source: source}
+	column, expr, err := calc.column(query, req.FieldID)
+	if err != nil {
+		return nil, err
+	}
+	if expr != nil {
+		return nil, fmt.Errorf("aggregated calculated field %s has no distinct values", req.FieldID)
+	}
+	query.Selects = []engine.SelectItem{{Field: column, Alias: "value"}}
+	if req.Counts {
+		query.Selects = append(query.Selects, engine.SelectItem{Field: "*", Aggregate: string(AggregateCount), Alias: "count"})
+	}
+	query.GroupBy = []string{column}
+	query.OrderBy = []engine.OrderItem{{Field: "value"}}
+	if req.Search != "" {
+		query.Filters = []engine.Filter{{Field: column, Operator: "PREFIX", Value: req.Search}}
+	}
+	// 多取一行判断是否还有更多值
+	query.Limit = limit + 1
+	query.Offset = req.Offset
+
+	target, err := resolveQueryTarget(ctx, s.datasourceRepo, s.extract, table)
+	if err != nil {
+		return nil, err
+	}
+	if s.router == nil {
+		return nil, fmt.Errorf("query router not initialized")
+	}
+	rows, err := s.router.Execute(ctx, target, query)
+	if err != nil {
+		logger.Log.Error("failed to query field values", zap.String("tableId", table.ID), zap.String("field", req.FieldID), zap.Error(err))
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+
+	result := &FieldValuesResult{Values: []interface{}{}}
+	more := len(rows.Rows) > limit
+	if more {
+		rows.Rows = rows.Rows[:limit]
+	}
+	if req.Offset+limit >= maxFieldValues {
+		result.Capped = more
+	} else {
+		result.HasMore = more
+	}
+	for _, row := range rows.Rows {
+		value := row["value"]
+		if b, ok := value.([]byte); ok {
+			value = string(b)
+		}
+		result.Values = append(result.Values, value)
+		if req.Counts {
+			result.Counts = append(result.Counts, rowCount(row["count"]))
+		}
+	}
+
+	if s.cache != nil {
+		if raw, err := json.Marshal(result); err == nil {
+			_ = s.cache.Set(ctx, key, string(raw), fieldValuesCacheTTL)
+		}
+	}
+	return result, nil
+}
+
+// rowCount 结果行中的计数值,不同驱动返回的整数类型不同
+func rowCount(v interface{}) int64 {
+	switch n := watermarkValue(v).(type) {
+	case int64:
+		return n
+	case float64:
+		return int64(n)
+	case string:
+		i, _ := strconv.ParseInt(n, 10, 64)
+		return i
+	default:
+		return 0
+	}
+}
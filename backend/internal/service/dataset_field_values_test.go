@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"cozy-insight-backend/internal/engine"
+	"cozy-insight-backend/internal/model"
+	"cozy-insight-backend/pkg/cache"
+	"cozy-insight-backend/pkg/logger"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubRowPermissions 按用户返回固定的行权限条件
+type stubRowPermissions struct {
+	RowPermissionService
+	where map[string]string
+}
+
+func (s *stubRowPermissions) GetUserRowPermissionWhere(ctx context.Context, userID, datasetID string) (string, error) {
+	return s.where[userID], nil
+}
+
+func TestFieldValuesService(t *testing.T) {
+	logger.InitLogger("error")
+
+	path := filepath.Join(t.TempDir(), "customers.db")
+	db, err := sql.Open("sqlite3", path)
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec(`CREATE TABLE customers (city TEXT, region TEXT)`)
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO customers VALUES
+		('Berlin', 'eu'), ('Bern', 'eu'), ('bergen', 'eu'), ('Boston', 'us'), ('Boston', 'us'), ('Austin', 'us'), (NULL, 'us')`)
+	require.NoError(t, err)
+
+	datasetRepo := &stubDatasetRepo{
+		table: &model.DatasetTable{ID: "table1", DatasourceID: "ds1", Type: DatasetTypeDB, PhysicalTableName: "customers", UpdateTime: 1},
+		fields: []*model.DatasetTableField{
+			{ID: "f1", OriginName: "city", Name: "city", DeType: engine.DeTypeText},
+			{ID: "f2", OriginName: "region", Name: "region", DeType: engine.DeTypeText},
+		},
+	}
+	dsRepo := &stubDatasourceRepo{items: map[string]*model.Datasource{
+		"ds1": {ID: "ds1", Type: "sqlite", Configuration: fmt.Sprintf(`{"path":%q}`, path)},
+	}}
+	permissions := &stubRowPermissions{where: map[string]string{"u2": `region = 'us'`}}
+	router := engine.NewQueryRouter(engine.NewNativeExecutor(engine.NewConnectionManager(nil)))
+	svc := NewFieldValuesService(datasetRepo, dsRepo, nil, permissions, router, nil, cache.NewMemoryCache(10))
+	ctx := context.Background()
+
+	// 按值升序分页,多取的一行用于判断是否还有下一页
+	result, err := svc.Values(ctx, "u1", &FieldValuesRequest{DatasetID: "table1", FieldID: "f1", Limit: 3, Counts: true})
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{nil, "Austin", "Berlin"}, result.Values)
+	assert.Equal(t, []int64{1, 1, 1}, result.Counts)
+	assert.True(t, result.HasMore)
+	assert.False(t, result.Capped)
+
+	result, err = svc.Values(ctx, "u1", &FieldValuesRequest{DatasetID: "table1", FieldID: "city", Limit: 3, Offset: 3, Counts: true})
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"Bern", "Boston", "bergen"}, result.Values)
+	assert.Equal(t, []int64{1, 2, 1}, result.Counts)
+	assert.False(t, result.HasMore)
+
+	// 前缀搜索不区分大小写
+	result, err = svc.Values(ctx, "u1", &FieldValuesRequest{DatasetID: "table1", FieldID: "city", Search: "BER"})
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"Berlin", "Bern", "bergen"}, result.Values)
+	assert.Nil(t, result.Counts)
+
+	// 行权限只放行 us 区域
+	result, err = svc.Values(ctx, "u2", &FieldValuesRequest{DatasetID: "table1", FieldID: "city", Search: "b"})
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"Boston"}, result.Values)
+
+	// 相同条件命中缓存,数据集更新后重新查询
+	_, err = db.Exec(`INSERT INTO customers VALUES ('Bergamo', 'eu')`)
+	require.NoError(t, err)
+	result, err = svc.Values(ctx, "u1", &FieldValuesRequest{DatasetID: "table1", FieldID: "city", Search: "ber"})
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"Berlin", "Bern", "bergen"}, result.Values)
+	datasetRepo.table.UpdateTime = 2
+	result, err = svc.Values(ctx, "u1", &FieldValuesRequest{DatasetID: "table1", FieldID: "city", Search: "ber"})
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"Bergamo", "Berlin", "Bern", "bergen"}, result.Values)
+
+	// 超出基数上限的偏移量需要改用搜索
+	_, err = svc.Values(ctx, "u1", &FieldValuesRequest{DatasetID: "table1", FieldID: "city", Offset: maxFieldValues})
+	assert.Error(t, err)
+}
@@ -0,0 +1,188 @@
+package service
+
+import (
+	"cozy-insight-backend/internal/engine"
+	"cozy-insight-backend/internal/model"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// fieldSampleRows 驱动不提供列类型时用于推断的采样行数
+const fieldSampleRows = 100
+
+// inferFields 按查询结果的列元数据推断字段并保持列顺序
+// 列缺少数据库类型时(如文档数据源)对该列的结果行采样推断
+func (s *datasetService) inferFields(result *engine.QueryResult) []*FieldInfo {
+	fields := make([]*FieldInfo, 0, len(result.Columns))
+	for i, col := range result.Columns {
+		field := &FieldInfo{
+			Name:        col.Name,
+			OriginName:  col.Name,
+			ColumnIndex: i,
+			Precision:   col.Precision,
+			Scale:       col.Scale,
+			Nullable:    col.Nullable,
+		}
+		if col.DatabaseType == "" {
+			field.Type, field.DeType, field.GroupType = s.sampleFieldType(result.Rows, col.Name)
+		} else {
+			field.Type = col.DatabaseType
+			field.DeType = columnDeType(col)
+			field.GroupType = deTypeGroup(field.DeType)
+		}
+		field.Sample = sampleValue(result.Rows, col.Name)
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+// columnDeType 由数据库类型确定字段类型,小数位为 0 的定点数视为整数
+func columnDeType(col engine.ResultColumn) int {
+	deType := engine.LogicalType(col.DatabaseType)
+	if deType == engine.DeTypeFloat && col.Precision > 0 && col.Scale == 0 {
+		t := strings.ToLower(col.DatabaseType)
+		if strings.Contains(t, "decimal") || strings.Contains(t, "numeric") {
+			return engine.DeTypeInt
+		}
+	}
+	return deType
+}
+
+// deTypeGroup 数值字段默认为指标,其余为维度
+func deTypeGroup(deType int) string {
+	if deType == engine.DeTypeInt || deType == engine.DeTypeFloat {
+		return "q"
+	}
+	return "d"
+}
+
+// sampleFieldType 综合一列的非空值推断类型: 类型一致时取该类型,整数与小数混合为小数,其余为文本
+func (s *datasetService) sampleFieldType(rows []map[string]interface{}, name string) (dbType string, deType int, groupType string) {
+	dbType, deType, groupType = s.detectFieldType(nil)
+	first := true
+	for _, row := range rows {
+		value := row[name]
+		if value == nil {
+			continue
+		}
+		t, d, g := s.detectFieldType(value)
+		switch {
+		case first:
+			dbType, deType, groupType = t, d, g
+			first = false
+		case d == deType:
+		case (d == engine.DeTypeInt && deType == engine.DeTypeFloat) || (d == engine.DeTypeFloat && deType == engine.DeTypeInt):
+			dbType, deType, groupType = "DECIMAL", engine.DeTypeFloat, "q"
+		default:
+			return s.detectFieldType(nil)
+		}
+	}
+	return dbType, deType, groupType
+}
+
+// sampleValue 列中第一个非空值,过长时截断
+func sampleValue(rows []map[string]interface{}, name string) string {
+	for _, row := range rows {
+		if value := row[name]; value != nil {
+			sample := fmt.Sprintf("%v", value)
+			if len(sample) > 50 {
+				sample = sample[:50] + "..."
+			}
+			return sample
+		}
+	}
+	return ""
+}
+
+// FieldSyncReport 字段同步的变更报告
+type FieldSyncReport struct {
+	Added     []*model.DatasetTableField `json:"added"`
+	Changed   []FieldTypeChange          `json:"changed"`  // 原始类型发生变化的字段
+	Missing   []*model.DatasetTableField `json:"missing"`  // 本次同步新发现缺失的字段
+	Restored  []*model.DatasetTableField `json:"restored"` // 曾缺失、本次重新出现的字段
+	Unchanged int                        `json:"unchanged"`
+}
+
+// FieldTypeChange 字段原始类型变化
+type FieldTypeChange struct {
+	Field   *model.DatasetTableField `json:"field"`
+	OldType string                   `json:"oldType"`
+	NewType string                   `json:"newType"`
+}
+
+// mergeFields 按原始列名将推断结果合并到已有字段,返回合并后的全部字段和变更报告
+// 已有字段保留ID、显示名、维度/指标和选中状态; 原始类型变化时才重新推断字段类型,避免覆盖用户调整
+// 源中消失的字段标记为缺失并排在现有列之后
+func mergeFields(table *model.DatasetTable, existing []*model.DatasetTableField, inferred []*FieldInfo) ([]*model.DatasetTableField, *FieldSyncReport) {
+	report := &FieldSyncReport{
+		Added:    []*model.DatasetTableField{},
+		Changed:  []FieldTypeChange{},
+		Missing:  []*model.DatasetTableField{},
+		Restored: []*model.DatasetTableField{},
+	}
+
+	byOrigin := make(map[string]*model.DatasetTableField, len(existing))
+	for _, f := range existing {
+		if _, ok := byOrigin[f.OriginName]; !ok {
+			byOrigin[f.OriginName] = f
+		}
+	}
+
+	fields := make([]*model.DatasetTableField, 0, len(inferred)+len(existing))
+	matched := make(map[*model.DatasetTableField]bool, len(existing))
+	for i, info := range inferred {
+		f, ok := byOrigin[info.OriginName]
+		if !ok || matched[f] {
+			f = &model.DatasetTableField{
+				ID:         uuid.New().String(),
+				OriginName: info.OriginName,
+				Name:       info.Name,
+				Type:       info.Type,
+				DeType:     info.DeType,
+				GroupType:  info.GroupType,
+				Checked:    true, // 默认选中
+			}
+			report.Added = append(report.Added, f)
+		} else {
+			changed := false
+			if f.Missing {
+				f.Missing = false
+				report.Restored = append(report.Restored, f)
+				changed = true
+			}
+			if f.Type != info.Type {
+				report.Changed = append(report.Changed, FieldTypeChange{Field: f, OldType: f.Type, NewType: info.Type})
+				f.Type = info.Type
+				f.DeType = info.DeType
+				changed = true
+			}
+			if !changed {
+				report.Unchanged++
+			}
+		}
+		matched[f] = true
+		f.ColumnIndex = i
+		fields = append(fields, f)
+	}
+
+	for _, f := range existing {
+		if matched[f] {
+			continue
+		}
+		if !f.Missing {
+			f.Missing = true
+			report.Missing = append(report.Missing, f)
+		}
+		f.ColumnIndex = len(fields)
+		fields = append(fields, f)
+	}
+
+	for _, f := range fields {
+		f.DatasourceID = table.DatasourceID
+		f.DatasetTableID = table.ID
+		f.DatasetGroupID = table.DatasetGroupID
+	}
+	return fields, report
+}
@@ -0,0 +1,198 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"cozy-insight-backend/internal/engine"
+	"cozy-insight-backend/internal/model"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSyncFields_UsesColumnMetadata(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "source.db")
+	db, err := sql.Open("sqlite3", path)
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec(`CREATE TABLE products (sku TEXT, stock INTEGER, price DECIMAL(10,2), amount DECIMAL(12,0), created DATETIME)`)
+	require.NoError(t, err)
+	// 首行为 NULL、文本列存放数字字符串,均不影响推断
+	_, err = db.Exec(`INSERT INTO products VALUES ('001', NULL, NULL, 5, NULL), ('002', 3, 9.5, 6, '2024-01-01 10:00:00')`)
+	require.NoError(t, err)
+
+	svc, repo := newUploadTestService(t)
+	svc.datasourceRepo = &stubDatasourceRepo{items: map[string]*model.Datasource{
+		"ds1": {ID: "ds1", Type: "sqlite", Configuration: fmt.Sprintf(`{"path":%q}`, path)},
+	}}
+	table := &model.DatasetTable{ID: "t1", DatasourceID: "ds1", Type: DatasetTypeDB, PhysicalTableName: "products"}
+	repo.tables[table.ID] = table
+
+	_, err = svc.SyncFields(context.Background(), table.ID)
+	require.NoError(t, err)
+	fields := repo.fields[table.ID]
+	require.Len(t, fields, 5)
+
+	want := []struct {
+		name   string
+		deType int
+		group  string
+	}{
+		{"sku", engine.DeTypeText, "d"},
+		{"stock", engine.DeTypeInt, "q"},
+		{"price", engine.DeTypeFloat, "q"},
+		{"amount", engine.DeTypeFloat, "q"},
+		{"created", engine.DeTypeTime, "d"},
+	}
+	for i, w := range want {
+		assert.Equal(t, w.name, fields[i].OriginName)
+		assert.Equal(t, i, fields[i].ColumnIndex)
+		assert.Equal(t, w.deType, fields[i].DeType, w.name)
+		assert.Equal(t, w.group, fields[i].GroupType, w.name)
+	}
+	assert.Equal(t, "TEXT", fields[0].Type)
+}
+
+func TestInferFields(t *testing.T) {
+	svc := &datasetService{}
+
+	result := &engine.QueryResult{
+		Columns: []engine.ResultColumn{
+			{Name: "total", DatabaseType: "DECIMAL", Precision: 18, Scale: 0, Nullable: true},
+			{Name: "ratio", DatabaseType: "DECIMAL", Precision: 5, Scale: 2},
+			{Name: "expr"},
+		},
+		Rows: []map[string]interface{}{
+			{"total": "10", "ratio": "0.5", "expr": nil},
+			{"total": "11", "ratio": "0.6", "expr": int64(3)},
+		},
+	}
+	fields := svc.inferFields(result)
+	require.Len(t, fields, 3)
+	assert.Equal(t, engine.DeTypeInt, fields[0].DeType)
+	assert.True(t, fields[0].Nullable)
+	assert.Equal(t, engine.DeTypeFloat, fields[1].DeType)
+	assert.Equal(t, int64(2), fields[1].Scale)
+	// 缺少数据库类型的列采样推断,跳过 NULL
+	assert.Equal(t, engine.DeTypeInt, fields[2].DeType)
+	assert.Equal(t, "3", fields[2].Sample)
+	assert.Equal(t, 2, fields[2].ColumnIndex)
+}
+
+func TestInferFields_Sampling(t *testing.T) {
+	svc := &datasetService{}
+
+	fields := svc.inferFields(&engine.QueryResult{
+		Columns: []engine.ResultColumn{{Name: "c"}, {Name: "a"}, {Name: "b"}},
+		Rows: []map[string]interface{}{
+			{"b": nil, "a": int64(1), "c": "x"},
+			{"b": 2.5, "a": 1.5, "c": int64(1)},
+		},
+	})
+	require.Len(t, fields, 3)
+	// 保持结果列顺序
+	assert.Equal(t, []string{"c", "a", "b"}, []string{fields[0].Name, fields[1].Name, fields[2].Name})
+	assert.Equal(t, engine.DeTypeText, fields[0].DeType)
+	assert.Equal(t, "d", fields[0].GroupType)
+	assert.Equal(t, engine.DeTypeFloat, fields[1].DeType)
+	assert.Equal(t, engine.DeTypeFloat, fields[2].DeType)
+	assert.Equal(t, "2.5", fields[2].Sample)
+}
+
+func TestSyncFields_MergePreservesEdits(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "source.db")
+	db, err := sql.Open("sqlite3", path)
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec(`CREATE TABLE orders (id INTEGER, region TEXT, amount INTEGER, note TEXT)`)
+	require.NoError(t, err)
+
+	svc, repo := newUploadTestService(t)
+	svc.datasourceRepo = &stubDatasourceRepo{items: map[string]*model.Datasource{
+		"ds1": {ID: "ds1", Type: "sqlite", Configuration: fmt.Sprintf(`{"path":%q}`, path)},
+	}}
+	table := &model.DatasetTable{ID: "t1", DatasourceID: "ds1", Type: DatasetTypeDB, PhysicalTableName: "orders"}
+	repo.tables[table.ID] = table
+	ctx := context.Background()
+
+	report, err := svc.SyncFields(ctx, table.ID)
+	require.NoError(t, err)
+	assert.Len(t, report.Added, 4)
+
+	// 用户修改显示名、分组和选中状态
+	fields := repo.fields[table.ID]
+	ids := map[string]string{}
+	for _, f := range fields {
+		ids[f.OriginName] = f.ID
+	}
+	fields[1].Name = "Sales Region"
+	fields[0].GroupType = "d"
+	fields[3].Checked = false
+
+	_, err = db.Exec(`ALTER TABLE orders DROP COLUMN note`)
+	require.NoError(t, err)
+	_, err = db.Exec(`ALTER TABLE orders ADD COLUMN created DATETIME`)
+	require.NoError(t, err)
+	// SQLite 已打开的连接会沿用旧表结构的列名,改表后换用新连接池
+	svc.router = engine.NewQueryRouter(engine.NewNativeExecutor(engine.NewConnectionManager(nil)))
+
+	report, err = svc.SyncFields(ctx, table.ID)
+	require.NoError(t, err)
+	require.Len(t, report.Added, 1)
+	assert.Equal(t, "created", report.Added[0].OriginName)
+	require.Len(t, report.Missing, 1)
+	assert.Equal(t, "note", report.Missing[0].OriginName)
+	assert.Equal(t, 3, report.Unchanged)
+
+	fields = repo.fields[table.ID]
+	require.Len(t, fields, 5)
+	assert.Equal(t, []string{"id", "region", "amount", "created", "note"},
+		[]string{fields[0].OriginName, fields[1].OriginName, fields[2].OriginName, fields[3].OriginName, fields[4].OriginName})
+	assert.Equal(t, ids["id"], fields[0].ID)
+	assert.Equal(t, "d", fields[0].GroupType)
+	assert.Equal(t, "Sales Region", fields[1].Name)
+	assert.Equal(t, ids["note"], fields[4].ID)
+	assert.True(t, fields[4].Missing)
+	assert.False(t, fields[4].Checked)
+	assert.Equal(t, 4, fields[4].ColumnIndex)
+
+	// 缺失字段不能再被查询引用
+	_, err = newFieldResolver(fields).resolve("note")
+	assert.ErrorContains(t, err, "no longer exists")
+
+	// 列重新出现时恢复原字段
+	_, err = db.Exec(`ALTER TABLE orders ADD COLUMN note TEXT`)
+	require.NoError(t, err)
+	svc.router = engine.NewQueryRouter(engine.NewNativeExecutor(engine.NewConnectionManager(nil)))
+	report, err = svc.SyncFields(ctx, table.ID)
+	require.NoError(t, err)
+	require.Len(t, report.Restored, 1)
+	assert.Equal(t, ids["note"], report.Restored[0].ID)
+	assert.Empty(t, report.Missing)
+}
+
+func TestMergeFields_TypeChange(t *testing.T) {
+	table := &model.DatasetTable{ID: "t1", DatasourceID: "ds1"}
+	existing := []*model.DatasetTableField{
+		{ID: "f1", OriginName: "code", Name: "Code", Type: "INTEGER", DeType: engine.DeTypeText, GroupType: "d", Checked: true},
+		{ID: "f2", OriginName: "day", Name: "day", Type: "TEXT", DeType: engine.DeTypeTime, GroupType: "d", Checked: true},
+	}
+	inferred := []*FieldInfo{
+		{OriginName: "code", Name: "code", Type: "TEXT", DeType: engine.DeTypeText, GroupType: "d"},
+		{OriginName: "day", Name: "day", Type: "TEXT", DeType: engine.DeTypeText, GroupType: "d"},
+	}
+
+	fields, report := mergeFields(table, existing, inferred)
+	require.Len(t, fields, 2)
+	require.Len(t, report.Changed, 1)
+	assert.Equal(t, "INTEGER", report.Changed[0].OldType)
+	assert.Equal(t, "TEXT", report.Changed[0].NewType)
+	assert.Equal(t, "Code", fields[0].Name)
+	// 原始类型未变时保留用户调整的字段类型
+	assert.Equal(t, engine.DeTypeTime, fields[1].DeType)
+	assert.Equal(t, "ds1", fields[1].DatasourceID)
+}
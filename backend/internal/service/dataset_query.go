@@ -0,0 +1,139 @@
+package service
+
+import (
+	"context"
+	"cozy-insight-backend/internal/engine"
+	"cozy-insight-backend/internal/model"
+	"cozy-insight-backend/internal/repository"
+	"encoding/json"
+	"fmt"
+)
+
+// 数据集类型
+const (
+	DatasetTypeDB    = "db"
+	DatasetTypeSQL   = "sql"
+	DatasetTypeExcel = "excel" // 上传的 CSV/Excel 文件,物化在抽取库中
+	DatasetTypeAPI   = "api"   // REST/JSON 接口数据,抽取后物化在抽取库中
+	DatasetTypeUnion = "union" // 多个数据集按关联关系组成,查询由 DatasetTableUnion 生成
+)
+
+// buildDatasetSource 根据数据集类型构建查询来源
+// values 为 SQL 数据集的变量值,取值规则见 resolveVariables
+func buildDatasetSource(table *model.DatasetTable, values map[string]interface{}) (engine.QuerySource, error) {
+	switch table.Type {
+	case DatasetTypeSQL:
+		// 自定义SQL数据集,${name} 变量以绑定参数传入
+		info, err := parseSQLDatasetInfo(table)
+		if err != nil {
+			return engine.QuerySource{}, err
+		}
+		vars, err := resolveVariables(info.Variables, values)
+		if err != nil {
+			return engine.QuerySource{}, err
+		}
+		return engine.QuerySource{SQL: info.SQL, Vars: vars}, nil
+	case DatasetTypeDB, DatasetTypeExcel, DatasetTypeAPI:
+		// 数据库表或抽取库中的物化表
+		if table.PhysicalTableName == "" {
+			return engine.QuerySource{}, fmt.Errorf("table name is required")
+		}
+		return engine.QuerySource{Table: table.PhysicalTableName}, nil
+	default:
+		return engine.QuerySource{}, fmt.Errorf("unsupported table type: %s", table.Type)
+	}
+}
+
+// resolveQueryTarget 确定数据集查询的目标数据源
+// 物化到抽取库的数据集读取抽取库; 未绑定数据源或标记为联邦查询的数据集只能交给 Calcite 执行
+func resolveQueryTarget(ctx context.Context, datasourceRepo repository.DatasourceRepository, extract *engine.ExtractStore, table *model.DatasetTable) (*engine.QueryTarget, error) {
+	if isExtractDataset(table) {
+		if extract == nil {
+			return nil, fmt.Errorf("extract store not initialized")
+		}
+		return extract.Target(), nil
+	}
+	return resolveOriginTarget(ctx, datasourceRepo, table)
+}
+
+// resolveOriginTarget 数据集原始数据所在的数据源,抽取同步时从这里读取
+func resolveOriginTarget(ctx context.Context, datasourceRepo repository.DatasourceRepository, table *model.DatasetTable) (*engine.QueryTarget, error) {
+	if table.DatasourceID == "" || datasourceRepo == nil || isFederatedDataset(table) {
+		return &engine.QueryTarget{DatasourceID: table.DatasourceID, Federated: true}, nil
+	}
+
+	ds, err := datasourceRepo.GetByID(ctx, table.DatasourceID)
+	if err != nil {
+		return nil, fmt.Errorf("datasource not found: %w", err)
+	}
+
+	return datasourceTarget(ds), nil
+}
+
+// isExtractDataset 数据集是否物化在抽取库中
+func isExtractDataset(table *model.DatasetTable) bool {
+	return isExtractType(table) || isSyncedDataset(table)
+}
+
+// isExtractType 数据集类型本身即物化在抽取库中(上传文件、API)
+func isExtractType(table *model.DatasetTable) bool {
+	return table.Type == DatasetTypeExcel || table.Type == DatasetTypeAPI
+}
+
+// isSyncedDataset 数据库、SQL 或关联数据集已切换为抽取模式,查询读取同步到抽取库的副本
+func isSyncedDataset(table *model.DatasetTable) bool {
+	return table.Mode == DatasetModeExtract && !isExtractType(table)
+}
+
+// isFederatedDataset 数据集配置中是否声明了跨数据源查询
+func isFederatedDataset(table *model.DatasetTable) bool {
+	if table.Info == "" {
+		return false
+	}
+	var info struct {
+		Federated bool `json:"federated"`
+	}
+	if err := json.Unmarshal([]byte(table.Info), &info); err != nil {
+		return false
+	}
+	return info.Federated
+}
+
+// fieldResolver 根据数据集已同步的字段校验并解析字段名
+type fieldResolver struct {
+	fields map[string]*model.DatasetTableField
+}
+
+// newFieldResolver 创建字段解析器,可按原始列名、字段ID或显示名查找
+func newFieldResolver(fields []*model.DatasetTableField) *fieldResolver {
+	r := &fieldResolver{fields: make(map[string]*model.DatasetTableField, len(fields)*3)}
+	// 优先级: 原始列名 > 字段ID > 显示名
+	for _, f := range fields {
+		if f.Name != "" {
+			r.fields[f.Name] = f
+		}
+	}
+	for _, f := range fields {
+		if f.ID != "" {
+			r.fields[f.ID] = f
+		}
+	}
+	for _, f := range fields {
+		if f.OriginName != "" {
+			r.fields[f.OriginName] = f
+		}
+	}
+	return r
+}
+
+// resolve 返回字段对应的原始列名,字段不属于数据集或源中已缺失时返回错误
+func (r *fieldResolver) resolve(name string) (string, error) {
+	field, ok := r.fields[name]
+	if !ok {
+		return "", fmt.Errorf("unknown field: %s", name)
+	}
+	if field.Missing {
+		return "", fmt.Errorf("field %s no longer exists in the dataset source", field.OriginName)
+	}
+	return field.OriginName, nil
+}
@@ -5,8 +5,8 @@ import (
 	"cozy-insight-backend/internal/engine"
 	"cozy-insight-backend/internal/model"
 	"cozy-insight-backend/internal/repository"
-	"encoding/json"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
@@ -23,19 +23,40 @@ type DatasetService interface {
 	// 数据预览和字段管理
 	PreviewData(ctx context.Context, id string, limit int) (*DataPreviewResult, error)
 	GetFields(ctx context.Context, id string) ([]*FieldInfo, error)
-	SyncFields(ctx context.Context, id string) error
+	SyncFields(ctx context.Context, id string) (*FieldSyncReport, error)
+
+	// 文件上传数据集
+	UploadTable(ctx context.Context, req *UploadRequest) (*model.DatasetTable, error)
+
+	// API 数据集抽取
+	ExtractTable(ctx context.Context, id string) (*ExtractResult, error)
+
+	// 关联数据集
+	GetUnions(ctx context.Context, id string) ([]*model.DatasetTableUnion, error)
+	SaveUnions(ctx context.Context, id string, unions []*model.DatasetTableUnion) error
+
+	// 抽取同步
+	SyncTable(ctx context.Context, id string, req *SyncRequest) (*model.DatasetTableTask, error)
+	ListSyncTasks(ctx context.Context, id string) ([]*model.DatasetTableTask, error)
+	DisableSync(ctx context.Context, id string) error
 }
 
 type datasetService struct {
-	repo    repository.DatasetRepository
-	calcite *engine.CalciteClient
+	repo           repository.DatasetRepository
+	datasourceRepo repository.DatasourceRepository
+	router         *engine.QueryRouter
+	extract        *engine.ExtractStore
+	api            *engine.APIConnector
+	syncing        sync.Map // 正在同步的数据集ID,避免同一数据集并发抽取
 }
 
 // DataPreviewResult 数据预览结果
 type DataPreviewResult struct {
-	Fields []*FieldInfo             `json:"fields"`
-	Data   []map[string]interface{} `json:"data"`
-	Total  int                      `json:"total"`
+	Fields   []*FieldInfo             `json:"fields"`
+	Data     []map[string]interface{} `json:"data"`
+	Total    int                      `json:"total"`
+	Engine   string                   `json:"engine"`   // native, calcite
+	Fallback bool                     `json:"fallback"` // 是否由备用路径执行
 }
 
 // FieldInfo 字段信息
@@ -46,13 +67,20 @@ type FieldInfo struct {
 	DeType      int    `json:"deType"`    // DataEase类型: 0:text, 1:time, 2:int, 3:float, 4:bool
 	GroupType   string `json:"groupType"` // d:维度, q:指标
 	Description string `json:"description"`
-	Sample      string `json:"sample"` // 示例值
+	Sample      string `json:"sample"`              // 示例值
+	ColumnIndex int    `json:"columnIndex"`         // 在查询结果中的列序号
+	Precision   int64  `json:"precision,omitempty"` // 数值精度或字符长度,驱动未提供时为 0
+	Scale       int64  `json:"scale,omitempty"`
+	Nullable    bool   `json:"nullable"`
 }
 
-func NewDatasetService(repo repository.DatasetRepository, calcite *engine.CalciteClient) DatasetService {
+func NewDatasetService(repo repository.DatasetRepository, datasourceRepo repository.DatasourceRepository, router *engine.QueryRouter, extract *engine.ExtractStore, api *engine.APIConnector) DatasetService {
 	return &datasetService{
-		repo:    repo,
-		calcite: calcite,
+		repo:           repo,
+		datasourceRepo: datasourceRepo,
+		router:         router,
+		extract:        extract,
+		api:            api,
 	}
 }
 
@@ -72,6 +100,15 @@ func (s *datasetService) CreateTable(ctx context.Context, table *model.DatasetTa
 	if table.ID == "" {
 		table.ID = uuid.New().String()
 	}
+	if table.Type == DatasetTypeAPI {
+		return s.createAPITable(ctx, table)
+	}
+	if table.Type == DatasetTypeSQL {
+		// 校验语句和变量声明
+		if _, err := parseSQLDatasetInfo(table); err != nil {
+			return err
+		}
+	}
 	table.CreateTime = time.Now().UnixMilli()
 	table.UpdateTime = time.Now().UnixMilli()
 	return s.repo.CreateTable(ctx, table)
@@ -92,25 +129,21 @@ func (s *datasetService) PreviewData(ctx context.Context, id string, limit int)
 		return nil, fmt.Errorf("table not found: %w", err)
 	}
 
-	// 构建 SQL
-	sql, err := s.buildPreviewSQL(table, limit)
-	if err != nil {
-		return nil, err
-	}
-
-	// 执行查询
-	rows, err := s.calcite.ExecuteQuery(ctx, sql)
+	// 执行预览查询
+	result, err := s.queryPreview(ctx, table, limit)
 	if err != nil {
 		return nil, fmt.Errorf("query failed: %w", err)
 	}
 
 	// 推断字段类型
-	fields := s.inferFieldTypes(rows)
+	fields := s.inferFields(result)
 
 	return &DataPreviewResult{
-		Fields: fields,
-		Data:   rows,
-		Total:  len(rows),
+		Fields:   fields,
+		Data:     result.Rows,
+		Total:    len(result.Rows),
+		Engine:   result.Path,
+		Fallback: result.Fallback,
 	}, nil
 }
 
@@ -121,130 +154,113 @@ func (s *datasetService) GetFields(ctx context.Context, id string) ([]*FieldInfo
 		return nil, err
 	}
 
-	// 查询少量数据用于类型推断
-	sql, err := s.buildPreviewSQL(table, 10)
-	if err != nil {
-		return nil, err
-	}
-
-	rows, err := s.calcite.ExecuteQuery(ctx, sql)
+	// 优先使用列元数据,采样行只在驱动不提供类型时使用
+	result, err := s.queryPreview(ctx, table, fieldSampleRows)
 	if err != nil {
 		return nil, err
 	}
 
-	return s.inferFieldTypes(rows), nil
+	return s.inferFields(result), nil
 }
 
-// SyncFields 同步字段（保存到数据库）
-func (s *datasetService) SyncFields(ctx context.Context, id string) error {
-	// 获取数据集表信息
+// SyncFields 按原始列名合并同步字段,保留已有字段的ID和用户设置
+// 新列追加为字段,源中消失的列标记为缺失而不删除
+func (s *datasetService) SyncFields(ctx context.Context, id string) (*FieldSyncReport, error) {
 	table, err := s.repo.GetTable(ctx, id)
 	if err != nil {
-		return fmt.Errorf("table not found: %w", err)
+		return nil, fmt.Errorf("table not found: %w", err)
 	}
 
-	// 获取字段信息
-	fields, err := s.GetFields(ctx, id)
+	inferred, err := s.sourceFields(ctx, table)
 	if err != nil {
-		return err
+		return nil, err
 	}
-
-	// 先删除旧字段
-	if err := s.repo.DeleteFieldsByTableID(ctx, id); err != nil {
-		return fmt.Errorf("failed to delete old fields: %w", err)
+	if len(inferred) == 0 {
+		return nil, fmt.Errorf("dataset returned no columns")
 	}
 
-	// 转换为模型并批量创建
-	modelFields := make([]*model.DatasetTableField, 0, len(fields))
-	for i, field := range fields {
-		modelField := &model.DatasetTableField{
-			ID:             uuid.New().String(),
-			DatasourceID:   table.DatasourceID,
-			DatasetTableID: id,
-			DatasetGroupID: table.DatasetGroupID,
-			OriginName:     field.OriginName,
-			Name:           field.Name,
-			Type:           field.Type,
-			DeType:         field.DeType,
-			GroupType:      field.GroupType,
-			Checked:        true, // 默认选中
-			ColumnIndex:    i,
-		}
-		modelFields = append(modelFields, modelField)
+	existing, err := s.repo.GetFields(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get fields: %w", err)
 	}
 
-	// 批量创建
-	if err := s.repo.BatchCreateFields(ctx, modelFields); err != nil {
-		return fmt.Errorf("failed to create fields: %w", err)
+	fields, report := mergeFields(table, existing, inferred)
+	if err := s.repo.SaveFields(ctx, fields); err != nil {
+		return nil, fmt.Errorf("failed to save fields: %w", err)
 	}
-
-	return nil
+	return report, nil
 }
 
-// buildPreviewSQL 构建预览SQL
-func (s *datasetService) buildPreviewSQL(table *model.DatasetTable, limit int) (string, error) {
-	if limit <= 0 {
-		limit = 100
+// sourceFields 字段同步使用的列,已抽取的数据集从原始数据源读取,使新增列能在下次抽取时写入
+func (s *datasetService) sourceFields(ctx context.Context, table *model.DatasetTable) ([]*FieldInfo, error) {
+	if !isSyncedDataset(table) {
+		return s.GetFields(ctx, table.ID)
 	}
-	if limit > 1000 {
-		limit = 1000 // 最大1000行
+	if s.router == nil {
+		return nil, fmt.Errorf("query router not initialized")
 	}
 
-	var sql string
-	if table.Type == "sql" {
-		// 自定义SQL数据集
-		var info map[string]interface{}
-		if err := json.Unmarshal([]byte(table.Info), &info); err != nil {
-			return "", fmt.Errorf("invalid table info: %w", err)
-		}
-		if v, ok := info["sql"].(string); ok {
-			sql = v
-		} else {
-			return "", fmt.Errorf("sql not found in table info")
-		}
-	} else if table.Type == "db" {
-		// 数据库表
-		sql = fmt.Sprintf("SELECT * FROM %s", table.PhysicalTableName)
-	} else {
-		return "", fmt.Errorf("unsupported table type: %s", table.Type)
+	source, err := loadOriginSource(ctx, s.repo, table, nil)
+	if err != nil {
+		return nil, err
 	}
-
-	// 添加 LIMIT
-	sql = fmt.Sprintf("%s LIMIT %d", sql, limit)
-
-	return sql, nil
+	target, err := resolveOriginTarget(ctx, s.datasourceRepo, table)
+	if err != nil {
+		return nil, err
+	}
+	result, err := s.router.Execute(ctx, target, &engine.Query{Source: source, Limit: fieldSampleRows})
+	if err != nil {
+		return nil, err
+	}
+	return s.inferFields(result), nil
 }
 
-// inferFieldTypes 推断字段类型
-func (s *datasetService) inferFieldTypes(rows []map[string]interface{}) []*FieldInfo {
-	if len(rows) == 0 {
-		return nil
+// queryPreview 经查询路由器执行预览查询
+func (s *datasetService) queryPreview(ctx context.Context, table *model.DatasetTable, limit int) (*engine.QueryResult, error) {
+	if s.router == nil {
+		return nil, fmt.Errorf("query router not initialized")
 	}
 
-	var fields []*FieldInfo
-	firstRow := rows[0]
+	query, err := s.buildPreviewQuery(ctx, table, limit)
+	if err != nil {
+		return nil, err
+	}
 
-	for key, value := range firstRow {
-		field := &FieldInfo{
-			Name:       key,
-			OriginName: key,
-		}
+	target, err := resolveQueryTarget(ctx, s.datasourceRepo, s.extract, table)
+	if err != nil {
+		return nil, err
+	}
 
-		// 推断类型和分组类型
-		field.Type, field.DeType, field.GroupType = s.detectFieldType(value)
+	return s.router.Execute(ctx, target, query)
+}
 
-		// 获取示例值
-		if value != nil {
-			field.Sample = fmt.Sprintf("%v", value)
-			if len(field.Sample) > 50 {
-				field.Sample = field.Sample[:50] + "..."
-			}
-		}
+// buildPreviewSQL 按目标方言构建预览SQL,返回语句和绑定参数
+func (s *datasetService) buildPreviewSQL(ctx context.Context, table *model.DatasetTable, limit int, dialect engine.Dialect) (string, []interface{}, error) {
+	query, err := s.buildPreviewQuery(ctx, table, limit)
+	if err != nil {
+		return "", nil, err
+	}
+	return query.Build(dialect)
+}
+
+// buildPreviewQuery 构建预览查询
+func (s *datasetService) buildPreviewQuery(ctx context.Context, table *model.DatasetTable, limit int) (*engine.Query, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+	if limit > 1000 {
+		limit = 1000 // 最大1000行
+	}
 
-		fields = append(fields, field)
+	source, err := loadDatasetSource(ctx, s.repo, table, nil)
+	if err != nil {
+		return nil, err
 	}
 
-	return fields
+	return &engine.Query{
+		Source: source,
+		Limit:  limit,
+	}, nil
 }
 
 // detectFieldType 检测字段类型
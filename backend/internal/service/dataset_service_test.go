@@ -94,7 +94,7 @@ func (m *MockCalciteClient) ExecuteQueryNoCache(ctx context.Context, sql string,
 // Test CreateGroup
 func TestDatasetService_CreateGroup(t *testing.T) {
 	mockRepo := new(MockDatasetRepo)
-	service := NewDatasetService(mockRepo, nil)
+	service := NewDatasetService(mockRepo, nil, nil, nil, nil)
 
 	group := &model.DatasetGroup{
 		ID:   "group1",
@@ -112,7 +112,7 @@ func TestDatasetService_CreateGroup(t *testing.T) {
 // Test ListGroups
 func TestDatasetService_ListGroups(t *testing.T) {
 	mockRepo := new(MockDatasetRepo)
-	service := NewDatasetService(mockRepo, nil)
+	service := NewDatasetService(mockRepo, nil, nil, nil, nil)
 
 	expectedGroups := []*model.DatasetGroup{
 		{ID: "group1", Name: "Group 1"},
@@ -131,7 +131,7 @@ func TestDatasetService_ListGroups(t *testing.T) {
 // Test CreateTable
 func TestDatasetService_CreateTable(t *testing.T) {
 	mockRepo := new(MockDatasetRepo)
-	service := NewDatasetService(mockRepo, nil)
+	service := NewDatasetService(mockRepo, nil, nil, nil, nil)
 
 	table := &model.DatasetTable{
 		ID:                "table1",
@@ -210,7 +210,11 @@ func TestDatasetService_InferFieldTypes(t *testing.T) {
 		},
 	}
 
-	fields := service.inferFieldTypes(testData)
+	var columns []engine.ResultColumn
+	for name := range testData[0] {
+		columns = append(columns, engine.ResultColumn{Name: name})
+	}
+	fields := service.inferFields(&engine.QueryResult{Columns: columns, Rows: testData})
 
 	assert.Equal(t, 6, len(fields))
 
@@ -300,7 +304,7 @@ func TestDatasetService_SyncFields(t *testing.T) {
 		return len(fields) == 3 // 应该有3个字段
 	})).Return(nil)
 
-	err := service.SyncFields(context.Background(), "table1")
+	_, err := service.SyncFields(context.Background(), "table1")
 	assert.NoError(t, err)
 	mockRepo.AssertExpectations(t)
 	mockCalcite.AssertExpectations(t)
@@ -323,7 +327,7 @@ func TestDatasetService_BuildPreviewSQL(t *testing.T) {
 				PhysicalTableName: "orders",
 			},
 			limit:     10,
-			expectSQL: "SELECT * FROM orders LIMIT 10",
+			expectSQL: `SELECT * FROM "orders" LIMIT 10`,
 		},
 		{
 			name: "sql type table",
@@ -332,16 +336,15 @@ func TestDatasetService_BuildPreviewSQL(t *testing.T) {
 				Info: `{"sql":"SELECT * FROM custom_view"}`,
 			},
 			limit:     20,
-			expectSQL: "SELECT * FROM (SELECT * FROM custom_view) AS preview LIMIT 20",
+			expectSQL: `SELECT * FROM (SELECT * FROM custom_view) AS "base" LIMIT 20`,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			sql, err := service.buildPreviewSQL(tt.table, tt.limit)
+			sql, _, err := service.buildPreviewSQL(context.Background(), tt.table, tt.limit, calciteDialect())
 			assert.NoError(t, err)
-			assert.Contains(t, sql, "SELECT")
-			assert.Contains(t, sql, "LIMIT")
+			assert.Equal(t, tt.expectSQL, sql)
 		})
 	}
 }
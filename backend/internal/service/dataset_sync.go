@@ -0,0 +1,511 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"cozy-insight-backend/internal/engine"
+	"cozy-insight-backend/internal/model"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// 数据集模式
+const (
+	DatasetModeDirect  = 0 // 直连数据源查询
+	DatasetModeExtract = 1 // 查询读取同步到抽取库的副本
+)
+
+// 抽取任务类型,与 DatasetTableTask.Type 取值一致
+const (
+	SyncTypeFull        = "all_scope"   // 全量: 原子替换整张抽取表
+	SyncTypeIncremental = "incremental" // 增量: 按水位列或自定义增量SQL追加
+)
+
+// 抽取任务状态
+const (
+	SyncStatusRunning = "running"
+	SyncStatusSuccess = "success"
+	SyncStatusFailed  = "failed"
+)
+
+// syncBatchSize 抽取时每次从源数据读取的行数
+var syncBatchSize = 5000
+
+// 自定义增量SQL可引用的内置变量,值为 2006-01-02 15:04:05 格式的时间
+const (
+	syncVarLastUpdateTime    = "__last_update_time__"    // 上次成功抽取的开始时间
+	syncVarCurrentUpdateTime = "__current_update_time__" // 本次抽取的开始时间
+)
+
+// SyncRequest 数据集抽取请求
+type SyncRequest struct {
+	Type string `json:"type"` // all_scope, incremental
+	// IncrementalField 水位列,增量抽取读取不小于上次水位的行并跳过已抽取的行,水位列可以不唯一;
+	// 全量抽取时指定则记录水位供后续增量使用
+	IncrementalField string `json:"incrementalField"`
+	// IncrementalSQL 自定义增量SQL,可引用 ${__last_update_time__} 和 ${__current_update_time__}
+	IncrementalSQL string `json:"incrementalSql"`
+}
+
+// syncTaskInfo 抽取任务的 Info 内容
+type syncTaskInfo struct {
+	IncrementalField string      `json:"incrementalField,omitempty"`
+	IncrementalSQL   string      `json:"incrementalSql,omitempty"`
+	RowCount         int         `json:"rowCount"`
+	Watermark        interface{} `json:"watermark,omitempty"` // 抽取后水位列的最大值
+	Error            string      `json:"error,omitempty"`
+}
+
+// SyncTable 将数据集的数据同步到抽取库并记录抽取任务
+// 全量抽取成功后数据集切换为抽取模式,图表和预览改为读取抽取表; 增量抽取要求已完成全量抽取
+func (s *datasetService) SyncTable(ctx context.Context, id string, req *SyncRequest) (*model.DatasetTableTask, error) {
+	if req == nil {
+		req = &SyncRequest{}
+	}
+	if req.Type == "" {
+		req.Type = SyncTypeFull
+	}
+	if req.Type != SyncTypeFull && req.Type != SyncTypeIncremental {
+		return nil, fmt.Errorf("unsupported sync type: %s", req.Type)
+	}
+	if s.extract == nil {
+		return nil, fmt.Errorf("extract store not initialized")
+	}
+	if s.router == nil {
+		return nil, fmt.Errorf("query router not initialized")
+	}
+
+	table, err := s.repo.GetTable(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("table not found: %w", err)
+	}
+	switch table.Type {
+	case DatasetTypeDB, DatasetTypeSQL, DatasetTypeUnion:
+	default:
+		return nil, fmt.Errorf("dataset of type %s cannot be synced", table.Type)
+	}
+	if len(datasetVariables(table)) > 0 {
+		return nil, fmt.Errorf("dataset %s declares sql variables and cannot be synced", table.Name)
+	}
+
+	if _, running := s.syncing.LoadOrStore(id, true); running {
+		return nil, fmt.Errorf("dataset %s is already being synced", table.Name)
+	}
+	defer s.syncing.Delete(id)
+
+	tasks, err := s.repo.ListTasks(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sync tasks: %w", err)
+	}
+	previous, previousInfo := lastSuccessfulSync(tasks)
+
+	// 未指定增量配置时沿用上次成功抽取的配置
+	info := &syncTaskInfo{IncrementalField: req.IncrementalField, IncrementalSQL: req.IncrementalSQL}
+	if info.IncrementalField == "" && info.IncrementalSQL == "" && previousInfo != nil {
+		info.IncrementalField = previousInfo.IncrementalField
+		info.IncrementalSQL = previousInfo.IncrementalSQL
+	}
+
+	now := time.Now().UnixMilli()
+	task := &model.DatasetTableTask{
+		ID:         uuid.New().String(),
+		TableID:    id,
+		Type:       req.Type,
+		Status:     SyncStatusRunning,
+		StartTime:  now,
+		CreateTime: now,
+		UpdateTime: now,
+	}
+	if err := s.repo.CreateTask(ctx, task); err != nil {
+		return nil, fmt.Errorf("failed to create sync task: %w", err)
+	}
+
+	runErr := s.runSync(ctx, table, task, info, previous, previousInfo)
+
+	task.EndTime = time.Now().UnixMilli()
+	task.UpdateTime = task.EndTime
+	task.Status = SyncStatusSuccess
+	if runErr != nil {
+		task.Status = SyncStatusFailed
+		info.Error = runErr.Error()
+	}
+	task.LastExecStatus = task.Status
+	infoJSON, err := json.Marshal(info)
+	if err != nil {
+		return nil, err
+	}
+	task.Info = string(infoJSON)
+	if err := s.repo.UpdateTask(ctx, task); err != nil {
+		return nil, fmt.Errorf("failed to save sync task: %w", err)
+	}
+	if runErr != nil {
+		return task, runErr
+	}
+
+	// 每次成功抽取都更新数据集的修改时间,使依赖它的缓存失效
+	table.Mode = DatasetModeExtract
+	table.UpdateTime = task.EndTime
+	if err := s.repo.UpdateTable(ctx, table); err != nil {
+		return task, fmt.Errorf("failed to save dataset: %w", err)
+	}
+	return task, nil
+}
+
+// ListSyncTasks 数据集的抽取任务记录,按时间倒序
+func (s *datasetService) ListSyncTasks(ctx context.Context, id string) ([]*model.DatasetTableTask, error) {
+	return s.repo.ListTasks(ctx, id)
+}
+
+// DisableSync 数据集切换回直连模式并删除抽取表
+func (s *datasetService) DisableSync(ctx context.Context, id string) error {
+	table, err := s.repo.GetTable(ctx, id)
+	if err != nil {
+		return fmt.Errorf("table not found: %w", err)
+	}
+	if !isSyncedDataset(table) {
+		return nil
+	}
+	if _, running := s.syncing.LoadOrStore(id, true); running {
+		return fmt.Errorf("dataset %s is being synced", table.Name)
+	}
+	defer s.syncing.Delete(id)
+
+	table.Mode = DatasetModeDirect
+	table.UpdateTime = time.Now().UnixMilli()
+	if err := s.repo.UpdateTable(ctx, table); err != nil {
+		return fmt.Errorf("failed to save dataset: %w", err)
+	}
+	if s.extract != nil {
+		return s.extract.DropTable(ctx, syncTableName(table))
+	}
+	return nil
+}
+
+// runSync 从原始数据源读取数据并写入抽取表,写入行数和水位记录到 info
+func (s *datasetService) runSync(ctx context.Context, table *model.DatasetTable, task *model.DatasetTableTask, info *syncTaskInfo, previous *model.DatasetTableTask, previousInfo *syncTaskInfo) error {
+	fields, err := s.repo.GetFields(ctx, table.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get fields: %w", err)
+	}
+	columns, selects := syncColumns(fields)
+	if len(columns) == 0 {
+		return fmt.Errorf("dataset has no synced fields")
+	}
+
+	source, err := loadOriginSource(ctx, s.repo, table, nil)
+	if err != nil {
+		return err
+	}
+	target, err := resolveOriginTarget(ctx, s.datasourceRepo, table)
+	if err != nil {
+		return err
+	}
+
+	name := syncTableName(table)
+	mode := engine.WriteModeReplace
+	query := &engine.Query{Source: source, Selects: selects}
+	if task.Type == SyncTypeIncremental {
+		existing, err := s.extract.Columns(ctx, name)
+		if err != nil {
+			return err
+		}
+		if len(existing) == 0 || previous == nil {
+			return fmt.Errorf("incremental sync requires a completed full sync")
+		}
+		mode = engine.WriteModeAppend
+
+		switch {
+		case info.IncrementalSQL != "":
+			query.Source = engine.QuerySource{SQL: info.IncrementalSQL, Vars: map[string]interface{}{
+				syncVarLastUpdateTime:    formatSyncTime(previous.StartTime),
+				syncVarCurrentUpdateTime: formatSyncTime(task.StartTime),
+			}}
+		case info.IncrementalField != "":
+			if previousInfo.Watermark == nil {
+				return fmt.Errorf("no watermark recorded for %s, run a full sync with the incremental field first", info.IncrementalField)
+			}
+			// 水位列不唯一时,与上次水位相同的行可能在上次抽取后才写入,因此包含等于水位的行再去重
+			query.Filters = []engine.Filter{{Field: info.IncrementalField, Operator: ">=", Value: previousInfo.Watermark}}
+		default:
+			return fmt.Errorf("incremental sync requires an incremental field or sql")
+		}
+	}
+	if info.IncrementalField != "" && !containsColumn(columns, info.IncrementalField) {
+		return fmt.Errorf("incremental field %s is not a dataset field", info.IncrementalField)
+	}
+
+	var stored map[string]int
+	if mode == engine.WriteModeAppend && info.IncrementalSQL == "" {
+		if stored, err = s.watermarkRows(ctx, name, columns, selects, info.IncrementalField, previousInfo.Watermark); err != nil {
+			return err
+		}
+	}
+	if info.IncrementalField != "" && previousInfo != nil && mode == engine.WriteModeAppend {
+		// 本次没有新数据时保留上次水位
+		info.Watermark = previousInfo.Watermark
+	}
+
+	writer, err := s.extract.BeginWrite(ctx, name, columns, mode)
+	if err != nil {
+		return fmt.Errorf("failed to store synced data: %w", err)
+	}
+	defer writer.Rollback()
+
+	// 按全部列排序分页读取,每页写入同一事务,失败时整体回滚;水位列排在最前以便利用索引
+	query.OrderBy = syncOrder(selects, info.IncrementalField)
+	query.Limit = syncBatchSize
+	info.RowCount = 0
+	for query.Offset = 0; ; query.Offset += syncBatchSize {
+		result, err := s.router.Execute(ctx, target, query)
+		if err != nil {
+			return fmt.Errorf("failed to read source data: %w", err)
+		}
+
+		rows := make([][]interface{}, 0, len(result.Rows))
+		for _, row := range result.Rows {
+			values := make([]interface{}, len(columns))
+			for j, col := range columns {
+				values[j] = extractValue(row[col.Name])
+			}
+			if info.IncrementalField != "" {
+				info.Watermark = maxWatermark(info.Watermark, watermarkValue(row[info.IncrementalField]))
+			}
+			// 跳过上次已抽取的水位行,相同的行按出现次数计
+			if key := syncRowKey(columns, values); stored[key] > 0 {
+				stored[key]--
+				continue
+			}
+			rows = append(rows, values)
+		}
+		if err := writer.Append(ctx, rows); err != nil {
+			return fmt.Errorf("failed to store synced data: %w", err)
+		}
+		info.RowCount += len(rows)
+
+		if len(result.Rows) < syncBatchSize {
+			break
+		}
+	}
+	if err := writer.Commit(); err != nil {
+		return fmt.Errorf("failed to store synced data: %w", err)
+	}
+	return nil
+}
+
+// syncOrder 分页读取的排序: 水位列在前,其余列依次排序,保证各页之间顺序稳定
+func syncOrder(selects []engine.SelectItem, incrementalField string) []engine.OrderItem {
+	order := make([]engine.OrderItem, 0, len(selects))
+	if incrementalField != "" {
+		order = append(order, engine.OrderItem{Field: incrementalField})
+	}
+	for _, item := range selects {
+		if item.Field != incrementalField {
+			order = append(order, engine.OrderItem{Field: item.Field})
+		}
+	}
+	return order
+}
+
+// watermarkRows 抽取表中水位列等于上次水位的行,按行内容计数
+func (s *datasetService) watermarkRows(ctx context.Context, name string, columns []engine.ExtractColumn, selects []engine.SelectItem, field string, watermark interface{}) (map[string]int, error) {
+	result, err := s.router.Execute(ctx, s.extract.Target(), &engine.Query{
+		Source:  engine.QuerySource{Table: name},
+		Selects: selects,
+		Filters: []engine.Filter{{Field: field, Operator: "=", Value: watermark}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read synced rows: %w", err)
+	}
+
+	stored := make(map[string]int, len(result.Rows))
+	for _, row := range result.Rows {
+		values := make([]interface{}, len(columns))
+		for j, col := range columns {
+			values[j] = row[col.Name]
+		}
+		stored[syncRowKey(columns, values)]++
+	}
+	return stored, nil
+}
+
+// syncRowKey 按抽取表列类型规范化后的行内容,源数据与抽取表读回的同一行得到相同的键
+func syncRowKey(columns []engine.ExtractColumn, values []interface{}) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		if b, ok := v.(bool); ok {
+			v = int64(0)
+			if b {
+				v = int64(1)
+			}
+		}
+		v = watermarkValue(v)
+		if columns[i].Type == engine.ExtractTypeInteger || columns[i].Type == engine.ExtractTypeReal {
+			if f, ok := watermarkNumber(v); ok {
+				v = f
+			}
+		}
+		if v == nil {
+			parts[i] = "\x01"
+			continue
+		}
+		parts[i] = fmt.Sprint(v)
+	}
+	return strings.Join(parts, "\x00")
+}
+
+// syncTableName 数据集在抽取库中的表名
+func syncTableName(table *model.DatasetTable) string {
+	return "sync_" + strings.ReplaceAll(table.ID, "-", "")
+}
+
+// lastSuccessfulSync 最近一次成功的抽取任务及其 Info,tasks 按时间倒序
+func lastSuccessfulSync(tasks []*model.DatasetTableTask) (*model.DatasetTableTask, *syncTaskInfo) {
+	for _, task := range tasks {
+		if task.Status != SyncStatusSuccess {
+			continue
+		}
+		info := &syncTaskInfo{}
+		if task.Info != "" {
+			decoder := json.NewDecoder(bytes.NewReader([]byte(task.Info)))
+			decoder.UseNumber()
+			if err := decoder.Decode(info); err != nil {
+				continue
+			}
+			info.Watermark = watermarkValue(info.Watermark)
+		}
+		return task, info
+	}
+	return nil, nil
+}
+
+// syncColumns 按字段顺序生成抽取表列和查询列,同名原始列只取一次
+func syncColumns(fields []*model.DatasetTableField) ([]engine.ExtractColumn, []engine.SelectItem) {
+	var columns []engine.ExtractColumn
+	var selects []engine.SelectItem
+	seen := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		if f.OriginName == "" || f.Missing || seen[f.OriginName] {
+			continue
+		}
+		seen[f.OriginName] = true
+		columns = append(columns, engine.ExtractColumn{Name: f.OriginName, Type: extractColumnType(f.DeType)})
+		selects = append(selects, engine.SelectItem{Field: f.OriginName})
+	}
+	return columns, selects
+}
+
+// extractColumnType 字段类型对应的抽取表列类型
+func extractColumnType(deType int) string {
+	switch deType {
+	case engine.DeTypeTime:
+		return engine.ExtractTypeTimestamp
+	case engine.DeTypeInt, engine.DeTypeBool:
+		return engine.ExtractTypeInteger
+	case engine.DeTypeFloat:
+		return engine.ExtractTypeReal
+	default:
+		return engine.ExtractTypeText
+	}
+}
+
+// extractValue 转换为抽取库存储的值,时间与上传数据集使用相同格式
+func extractValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case time.Time:
+		return val.Format("2006-01-02 15:04:05")
+	case []byte:
+		return string(val)
+	default:
+		return v
+	}
+}
+
+// watermarkValue 将水位值统一为 int64、float64 或字符串,便于比较和 JSON 保存
+func watermarkValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case nil:
+		return nil
+	case json.Number:
+		if i, err := val.Int64(); err == nil {
+			return i
+		}
+		if f, err := val.Float64(); err == nil {
+			return f
+		}
+		return val.String()
+	case int:
+		return int64(val)
+	case int32:
+		return int64(val)
+	case int64:
+		return val
+	case uint32:
+		return int64(val)
+	case uint64:
+		return int64(val)
+	case float32:
+		return float64(val)
+	case float64:
+		return val
+	case time.Time:
+		return val.Format("2006-01-02 15:04:05")
+	case []byte:
+		return string(val)
+	default:
+		return fmt.Sprint(val)
+	}
+}
+
+// maxWatermark 返回较大的水位,数值按大小比较,其余按字符串比较
+func maxWatermark(current, v interface{}) interface{} {
+	if v == nil {
+		return current
+	}
+	if current == nil {
+		return v
+	}
+	a, aNum := watermarkNumber(current)
+	b, bNum := watermarkNumber(v)
+	if aNum && bNum {
+		if b > a {
+			return v
+		}
+		return current
+	}
+	if fmt.Sprint(v) > fmt.Sprint(current) {
+		return v
+	}
+	return current
+}
+
+func watermarkNumber(v interface{}) (float64, bool) {
+	switch val := v.(type) {
+	case int64:
+		return float64(val), true
+	case float64:
+		return val, true
+	case string:
+		f, err := strconv.ParseFloat(val, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// formatSyncTime 毫秒时间戳格式化为增量SQL变量值
+func formatSyncTime(ms int64) string {
+	return time.UnixMilli(ms).Format("2006-01-02 15:04:05")
+}
+
+func containsColumn(columns []engine.ExtractColumn, name string) bool {
+	for _, col := range columns {
+		if col.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,216 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"cozy-insight-backend/internal/model"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSyncTable_FullAndIncremental(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "source.db")
+	db, err := sql.Open("sqlite3", path)
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec(`CREATE TABLE orders (id INTEGER, region TEXT, amount REAL)`)
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO orders VALUES (1, 'east', 10), (2, 'west', 20), (3, 'east', 30)`)
+	require.NoError(t, err)
+
+	svc, repo := newUploadTestService(t)
+	svc.datasourceRepo = &stubDatasourceRepo{items: map[string]*model.Datasource{
+		"ds1": {ID: "ds1", Type: "sqlite", Configuration: fmt.Sprintf(`{"path":%q}`, path)},
+	}}
+	table := &model.DatasetTable{ID: "t-1", Name: "orders", DatasourceID: "ds1", Type: DatasetTypeDB, PhysicalTableName: "orders"}
+	repo.tables[table.ID] = table
+	repo.fields[table.ID] = []*model.DatasetTableField{
+		{ID: "f1", OriginName: "id", DeType: 2},
+		{ID: "f2", OriginName: "region", DeType: 0},
+		{ID: "f3", OriginName: "amount", DeType: 3},
+	}
+	ctx := context.Background()
+
+	// 未完成全量抽取时增量抽取失败,并记录失败任务
+	task, err := svc.SyncTable(ctx, table.ID, &SyncRequest{Type: SyncTypeIncremental, IncrementalField: "id"})
+	assert.ErrorContains(t, err, "requires a completed full sync")
+	require.NotNil(t, task)
+	assert.Equal(t, SyncStatusFailed, task.Status)
+	assert.Equal(t, DatasetModeDirect, table.Mode)
+
+	task, err = svc.SyncTable(ctx, table.ID, &SyncRequest{Type: SyncTypeFull, IncrementalField: "id"})
+	require.NoError(t, err)
+	assert.Equal(t, SyncStatusSuccess, task.Status)
+	assert.Equal(t, DatasetModeExtract, table.Mode)
+	assert.JSONEq(t, `{"incrementalField":"id","rowCount":3,"watermark":3}`, task.Info)
+
+	// 切换为抽取模式后预览读取抽取表,源表变化在下次同步前不可见
+	_, err = db.Exec(`INSERT INTO orders VALUES (4, 'north', 40), (5, 'west', 50)`)
+	require.NoError(t, err)
+	preview, err := svc.PreviewData(ctx, table.ID, 100)
+	require.NoError(t, err)
+	assert.Len(t, preview.Data, 3)
+
+	// 增量抽取沿用上次的水位列,只追加新行
+	task, err = svc.SyncTable(ctx, table.ID, &SyncRequest{Type: SyncTypeIncremental})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"incrementalField":"id","rowCount":2,"watermark":5}`, task.Info)
+	preview, err = svc.PreviewData(ctx, table.ID, 100)
+	require.NoError(t, err)
+	assert.Len(t, preview.Data, 5)
+
+	task, err = svc.SyncTable(ctx, table.ID, &SyncRequest{Type: SyncTypeIncremental})
+	require.NoError(t, err)
+	var info syncTaskInfo
+	require.NoError(t, json.Unmarshal([]byte(task.Info), &info))
+	assert.Equal(t, 0, info.RowCount)
+	assert.EqualValues(t, 5, info.Watermark)
+
+	tasks, err := svc.ListSyncTasks(ctx, table.ID)
+	require.NoError(t, err)
+	assert.Len(t, tasks, 4)
+
+	// 切回直连后读取源表
+	require.NoError(t, svc.DisableSync(ctx, table.ID))
+	assert.Equal(t, DatasetModeDirect, table.Mode)
+	preview, err = svc.PreviewData(ctx, table.ID, 100)
+	require.NoError(t, err)
+	assert.Len(t, preview.Data, 5)
+}
+
+func TestSyncTable_IncrementalNonUniqueWatermark(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "source.db")
+	db, err := sql.Open("sqlite3", path)
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec(`CREATE TABLE events (name TEXT, amount REAL, created TEXT)`)
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO events VALUES ('a', 1.5, '2024-01-01 10:00:00'), ('b', 2, '2024-01-01 10:00:00')`)
+	require.NoError(t, err)
+
+	svc, repo := newUploadTestService(t)
+	svc.datasourceRepo = &stubDatasourceRepo{items: map[string]*model.Datasource{
+		"ds1": {ID: "ds1", Type: "sqlite", Configuration: fmt.Sprintf(`{"path":%q}`, path)},
+	}}
+	table := &model.DatasetTable{ID: "t3", Name: "events", DatasourceID: "ds1", Type: DatasetTypeDB, PhysicalTableName: "events"}
+	repo.tables[table.ID] = table
+	repo.fields[table.ID] = []*model.DatasetTableField{
+		{ID: "f1", OriginName: "name"},
+		{ID: "f2", OriginName: "amount", DeType: 3},
+		{ID: "f3", OriginName: "created"},
+	}
+	ctx := context.Background()
+
+	_, err = svc.SyncTable(ctx, table.ID, &SyncRequest{Type: SyncTypeFull, IncrementalField: "created"})
+	require.NoError(t, err)
+	firstUpdate := table.UpdateTime
+
+	// 与上次水位相同时间戳的行在上次抽取后写入,增量抽取不能遗漏,已抽取的行不能重复
+	_, err = db.Exec(`INSERT INTO events VALUES ('b', 2, '2024-01-01 10:00:00'), ('c', 3, '2024-01-01 10:00:00'), ('d', 4, '2024-01-02 00:00:00')`)
+	require.NoError(t, err)
+	time.Sleep(2 * time.Millisecond)
+	task, err := svc.SyncTable(ctx, table.ID, &SyncRequest{Type: SyncTypeIncremental})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"incrementalField":"created","rowCount":3,"watermark":"2024-01-02 00:00:00"}`, task.Info)
+	assert.Greater(t, table.UpdateTime, firstUpdate)
+
+	preview, err := svc.PreviewData(ctx, table.ID, 100)
+	require.NoError(t, err)
+	assert.Len(t, preview.Data, 5)
+}
+
+func TestSyncTable_PagedReads(t *testing.T) {
+	batchSize := syncBatchSize
+	syncBatchSize = 2
+	t.Cleanup(func() { syncBatchSize = batchSize })
+
+	path := filepath.Join(t.TempDir(), "source.db")
+	db, err := sql.Open("sqlite3", path)
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec(`CREATE TABLE events (name TEXT, day INTEGER)`)
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO events VALUES ('e', 3), ('a', 1), ('a', 1), ('c', 2), ('b', 1)`)
+	require.NoError(t, err)
+
+	svc, repo := newUploadTestService(t)
+	svc.datasourceRepo = &stubDatasourceRepo{items: map[string]*model.Datasource{
+		"ds1": {ID: "ds1", Type: "sqlite", Configuration: fmt.Sprintf(`{"path":%q}`, path)},
+	}}
+	table := &model.DatasetTable{ID: "t4", Name: "events", DatasourceID: "ds1", Type: DatasetTypeDB, PhysicalTableName: "events"}
+	repo.tables[table.ID] = table
+	repo.fields[table.ID] = []*model.DatasetTableField{
+		{ID: "f1", OriginName: "name"},
+		{ID: "f2", OriginName: "day", DeType: 2},
+	}
+	ctx := context.Background()
+
+	// 每页两行,重复行和跨页的相同水位不会遗漏或重复
+	task, err := svc.SyncTable(ctx, table.ID, &SyncRequest{Type: SyncTypeFull, IncrementalField: "day"})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"incrementalField":"day","rowCount":5,"watermark":3}`, task.Info)
+
+	_, err = db.Exec(`INSERT INTO events VALUES ('f', 3), ('g', 4), ('h', 4), ('i', 5)`)
+	require.NoError(t, err)
+	task, err = svc.SyncTable(ctx, table.ID, &SyncRequest{Type: SyncTypeIncremental})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"incrementalField":"day","rowCount":4,"watermark":5}`, task.Info)
+
+	preview, err := svc.PreviewData(ctx, table.ID, 100)
+	require.NoError(t, err)
+	assert.Len(t, preview.Data, 9)
+}
+
+func TestSyncTable_IncrementalSQL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "source.db")
+	db, err := sql.Open("sqlite3", path)
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec(`CREATE TABLE events (name TEXT, created TEXT)`)
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO events VALUES ('a', '2000-01-01 00:00:00')`)
+	require.NoError(t, err)
+
+	svc, repo := newUploadTestService(t)
+	svc.datasourceRepo = &stubDatasourceRepo{items: map[string]*model.Datasource{
+		"ds1": {ID: "ds1", Type: "sqlite", Configuration: fmt.Sprintf(`{"path":%q}`, path)},
+	}}
+	table := &model.DatasetTable{ID: "t2", Name: "events", DatasourceID: "ds1", Type: DatasetTypeSQL, Info: `{"sql":"SELECT * FROM events"}`}
+	repo.tables[table.ID] = table
+	repo.fields[table.ID] = []*model.DatasetTableField{
+		{ID: "f1", OriginName: "name"},
+		{ID: "f2", OriginName: "created", DeType: 1},
+	}
+	ctx := context.Background()
+
+	_, err = svc.SyncTable(ctx, table.ID, nil)
+	require.NoError(t, err)
+
+	_, err = db.Exec(`INSERT INTO events VALUES ('b', '2999-01-01 00:00:00')`)
+	require.NoError(t, err)
+	task, err := svc.SyncTable(ctx, table.ID, &SyncRequest{
+		Type:           SyncTypeIncremental,
+		IncrementalSQL: "SELECT * FROM events WHERE created > ${__last_update_time__}",
+	})
+	require.NoError(t, err)
+	assert.Contains(t, task.Info, `"rowCount":1`)
+
+	_, err = svc.SyncTable(ctx, "missing", nil)
+	assert.Error(t, err)
+}
+
+func TestMaxWatermark(t *testing.T) {
+	assert.Equal(t, int64(10), maxWatermark(int64(9), int64(10)))
+	assert.Equal(t, int64(10), maxWatermark(int64(10), nil))
+	assert.Equal(t, "10", maxWatermark("9", "10"))
+	assert.Equal(t, "2024-02-01 00:00:00", maxWatermark("2024-02-01 00:00:00", "2024-01-31 23:59:59"))
+	assert.Equal(t, int64(3), watermarkValue(json.Number("3")))
+	assert.Equal(t, 1.5, watermarkValue(json.Number("1.5")))
+}
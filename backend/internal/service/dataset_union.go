@@ -0,0 +1,242 @@
+package service
+
+import (
+	"context"
+	"cozy-insight-backend/internal/engine"
+	"cozy-insight-backend/internal/model"
+	"cozy-insight-backend/internal/repository"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// unionJoinTypes 关联类型到 SQL JOIN 类型的映射
+var unionJoinTypes = map[string]string{
+	"left":  engine.JoinLeft,
+	"right": engine.JoinRight,
+	"inner": engine.JoinInner,
+	"full":  engine.JoinFull,
+}
+
+// GetUnions 获取关联数据集的关联关系
+func (s *datasetService) GetUnions(ctx context.Context, id string) ([]*model.DatasetTableUnion, error) {
+	return s.repo.ListUnions(ctx, id)
+}
+
+// SaveUnions 替换关联数据集的关联关系并同步字段
+// 成员数据集须属于同一数据源,关联数据集绑定到该数据源
+func (s *datasetService) SaveUnions(ctx context.Context, id string, unions []*model.DatasetTableUnion) error {
+	table, err := s.repo.GetTable(ctx, id)
+	if err != nil {
+		return fmt.Errorf("table not found: %w", err)
+	}
+	if table.Type != DatasetTypeUnion {
+		return fmt.Errorf("dataset %s is not a union dataset", table.ID)
+	}
+
+	now := time.Now().UnixMilli()
+	for _, union := range unions {
+		if union.ID == "" {
+			union.ID = uuid.New().String()
+		}
+		union.DatasetTableID = id
+		union.CreateTime = now
+	}
+
+	graph, err := loadUnionGraph(ctx, s.repo, unions, nil)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.SaveUnions(ctx, id, unions); err != nil {
+		return fmt.Errorf("failed to save unions: %w", err)
+	}
+
+	table.DatasourceID = graph.datasourceID
+	table.UpdateTime = now
+	if err := s.repo.UpdateTable(ctx, table); err != nil {
+		return fmt.Errorf("failed to save dataset: %w", err)
+	}
+	_, err = s.SyncFields(ctx, id)
+	return err
+}
+
+// loadDatasetSource 构建数据集查询来源,关联数据集从关联关系生成查询,已抽取的数据集读取抽取表
+// values 为 SQL 变量值,关联数据集的 SQL 成员使用同一组变量值
+func loadDatasetSource(ctx context.Context, repo repository.DatasetRepository, table *model.DatasetTable, values map[string]interface{}) (engine.QuerySource, error) {
+	if isSyncedDataset(table) {
+		return engine.QuerySource{Table: syncTableName(table)}, nil
+	}
+	return loadOriginSource(ctx, repo, table, values)
+}
+
+// loadOriginSource 数据集原始数据的查询来源,忽略抽取模式
+func loadOriginSource(ctx context.Context, repo repository.DatasetRepository, table *model.DatasetTable, values map[string]interface{}) (engine.QuerySource, error) {
+	if table.Type != DatasetTypeUnion {
+		return buildDatasetSource(table, values)
+	}
+	if repo == nil {
+		return engine.QuerySource{}, fmt.Errorf("dataset repository not initialized")
+	}
+
+	unions, err := repo.ListUnions(ctx, table.ID)
+	if err != nil {
+		return engine.QuerySource{}, fmt.Errorf("failed to get unions: %w", err)
+	}
+	if len(unions) == 0 {
+		return engine.QuerySource{}, fmt.Errorf("union dataset %s has no joins", table.ID)
+	}
+	graph, err := loadUnionGraph(ctx, repo, unions, values)
+	if err != nil {
+		return engine.QuerySource{}, err
+	}
+	return engine.QuerySource{Join: graph.join}, nil
+}
+
+// unionGraph 由关联关系解析出的关联查询
+type unionGraph struct {
+	join         *engine.JoinSource
+	datasourceID string
+}
+
+// loadUnionGraph 读取成员数据集及字段,将关联关系转换为关联查询
+// 关联关系须构成以唯一主表为根的树: 每个成员表只关联到一个父表,同一对表的多条关系合并为多个关联条件
+func loadUnionGraph(ctx context.Context, repo repository.DatasetRepository, unions []*model.DatasetTableUnion, values map[string]interface{}) (*unionGraph, error) {
+	if len(unions) == 0 {
+		return nil, fmt.Errorf("at least one join is required")
+	}
+
+	// 每个成员表的父表和关联关系,保持定义顺序
+	parents := make(map[string]string)
+	edges := make(map[string][]*model.DatasetTableUnion)
+	var order []string
+	for _, union := range unions {
+		if union.ParentTableID == "" || union.CurrentTableID == "" {
+			return nil, fmt.Errorf("join tables are required")
+		}
+		if union.ParentTableID == union.CurrentTableID {
+			return nil, fmt.Errorf("dataset %s cannot be joined to itself", union.CurrentTableID)
+		}
+		if _, ok := unionJoinTypes[strings.ToLower(union.UnionType)]; !ok {
+			return nil, fmt.Errorf("unsupported union type: %s", union.UnionType)
+		}
+		if parent, ok := parents[union.CurrentTableID]; ok {
+			if parent != union.ParentTableID {
+				return nil, fmt.Errorf("dataset %s is joined to more than one parent", union.CurrentTableID)
+			}
+			if !strings.EqualFold(edges[union.CurrentTableID][0].UnionType, union.UnionType) {
+				return nil, fmt.Errorf("conflicting union types for dataset %s", union.CurrentTableID)
+			}
+		} else {
+			parents[union.CurrentTableID] = union.ParentTableID
+			order = append(order, union.CurrentTableID)
+		}
+		edges[union.CurrentTableID] = append(edges[union.CurrentTableID], union)
+	}
+
+	var roots []string
+	for _, union := range unions {
+		if _, ok := parents[union.ParentTableID]; !ok && !containsString(roots, union.ParentTableID) {
+			roots = append(roots, union.ParentTableID)
+		}
+	}
+	if len(roots) != 1 {
+		return nil, fmt.Errorf("joins must have exactly one root dataset, found %d", len(roots))
+	}
+
+	// 从主表开始按广度优先排列,保证关联条件引用的表已出现
+	tables := []string{roots[0]}
+	for i := 0; i < len(tables); i++ {
+		for _, id := range order {
+			if parents[id] == tables[i] {
+				tables = append(tables, id)
+			}
+		}
+	}
+	if len(tables) != len(order)+1 {
+		return nil, fmt.Errorf("joins contain a cycle")
+	}
+
+	graph := &unionGraph{join: &engine.JoinSource{}}
+	aliases := make(map[string]string, len(tables))
+	resolvers := make(map[string]*fieldResolver, len(tables))
+	columnNames := make(map[string]bool)
+	for i, id := range tables {
+		member, err := repo.GetTable(ctx, id)
+		if err != nil {
+			return nil, fmt.Errorf("dataset %s not found: %w", id, err)
+		}
+		if member.Type != DatasetTypeDB && member.Type != DatasetTypeSQL {
+			return nil, fmt.Errorf("dataset %s of type %s cannot be joined", member.Name, member.Type)
+		}
+		if i == 0 {
+			graph.datasourceID = member.DatasourceID
+		} else if member.DatasourceID != graph.datasourceID {
+			return nil, fmt.Errorf("joined datasets must share a datasource, %s does not", member.Name)
+		}
+		source, err := buildDatasetSource(member, values)
+		if err != nil {
+			return nil, err
+		}
+		fields, err := repo.GetFields(ctx, id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get fields of dataset %s: %w", member.Name, err)
+		}
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("dataset %s has no synced fields", member.Name)
+		}
+
+		alias := fmt.Sprintf("t%d", i)
+		aliases[id] = alias
+		resolvers[id] = newFieldResolver(fields)
+		joinTable := engine.JoinTable{Alias: alias, Source: source}
+		if i > 0 {
+			for _, union := range edges[id] {
+				parentField, err := resolvers[union.ParentTableID].resolve(union.ParentFieldID)
+				if err != nil {
+					return nil, fmt.Errorf("invalid join field: %w", err)
+				}
+				currentField, err := resolvers[id].resolve(union.CurrentFieldID)
+				if err != nil {
+					return nil, fmt.Errorf("invalid join field: %w", err)
+				}
+				joinTable.Type = unionJoinTypes[strings.ToLower(union.UnionType)]
+				joinTable.On = append(joinTable.On, engine.JoinCondition{Table: aliases[union.ParentTableID], Field: parentField, CurrentField: currentField})
+			}
+		}
+		graph.join.Tables = append(graph.join.Tables, joinTable)
+
+		for _, field := range fields {
+			if !field.Checked || field.Missing {
+				continue
+			}
+			name := uniqueColumnName(columnNames, field.OriginName, member.Name)
+			graph.join.Columns = append(graph.join.Columns, engine.JoinColumn{Table: alias, Field: field.OriginName, Alias: name})
+		}
+	}
+	return graph, nil
+}
+
+// uniqueColumnName 关联结果中的列名,与已有列重名(不区分大小写)时加上数据集名前缀,仍重名时追加序号
+func uniqueColumnName(used map[string]bool, name, tableName string) string {
+	candidate := name
+	if used[strings.ToLower(candidate)] {
+		candidate = tableName + "_" + name
+	}
+	base := candidate
+	for n := 2; used[strings.ToLower(candidate)]; n++ {
+		candidate = fmt.Sprintf("%s_%d", base, n)
+	}
+	used[strings.ToLower(candidate)] = true
+	return candidate
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
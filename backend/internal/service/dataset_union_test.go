@@ -0,0 +1,167 @@
+package service
+
+import (
+	"context"
+	"cozy-insight-backend/internal/engine"
+	"cozy-insight-backend/internal/model"
+	"cozy-insight-backend/pkg/logger"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newUnionTestService 创建包含 orders、customers、regions 三个成员数据集的 SQLite 测试环境
+func newUnionTestService(t *testing.T) (*datasetService, *memDatasetRepo, *stubDatasourceRepo) {
+	logger.InitLogger("error")
+
+	path := filepath.Join(t.TempDir(), "shop.db")
+	db, err := sql.Open("sqlite3", path)
+	require.NoError(t, err)
+	for _, stmt := range []string{
+		`CREATE TABLE orders (id INTEGER, customer_id INTEGER, amount REAL)`,
+		`CREATE TABLE customers (id INTEGER, name TEXT, region_id INTEGER)`,
+		`CREATE TABLE regions (id INTEGER, name TEXT)`,
+		`INSERT INTO orders VALUES (1, 10, 5), (2, 10, 7), (3, 20, 1), (4, 99, 2)`,
+		`INSERT INTO customers VALUES (10, 'alice', 1), (20, 'bob', 2)`,
+		`INSERT INTO regions VALUES (1, 'east'), (2, 'west')`,
+	} {
+		_, err = db.Exec(stmt)
+		require.NoError(t, err)
+	}
+	db.Close()
+
+	repo := newMemDatasetRepo()
+	dsRepo := &stubDatasourceRepo{items: map[string]*model.Datasource{
+		"ds1": {ID: "ds1", Type: "sqlite", Configuration: fmt.Sprintf(`{"path":%q}`, path)},
+	}}
+	router := engine.NewQueryRouter(engine.NewNativeExecutor(engine.NewConnectionManager(nil)))
+	svc := NewDatasetService(repo, dsRepo, router, nil, nil).(*datasetService)
+
+	ctx := context.Background()
+	for _, name := range []string{"orders", "customers", "regions"} {
+		require.NoError(t, svc.CreateTable(ctx, &model.DatasetTable{ID: name, Name: name, DatasourceID: "ds1", Type: DatasetTypeDB, PhysicalTableName: name}))
+		_, err := svc.SyncFields(ctx, name)
+		require.NoError(t, err)
+	}
+	require.NoError(t, svc.CreateTable(ctx, &model.DatasetTable{ID: "sales", Name: "sales", Type: DatasetTypeUnion}))
+	return svc, repo, dsRepo
+}
+
+// fieldID 按原始列名查找成员数据集字段ID
+func fieldID(t *testing.T, repo *memDatasetRepo, tableID, origin string) string {
+	for _, f := range repo.fields[tableID] {
+		if f.OriginName == origin {
+			return f.ID
+		}
+	}
+	t.Fatalf("field %s.%s not found", tableID, origin)
+	return ""
+}
+
+func TestDatasetUnion_PreviewAndFields(t *testing.T) {
+	svc, repo, _ := newUnionTestService(t)
+	ctx := context.Background()
+
+	err := svc.SaveUnions(ctx, "sales", []*model.DatasetTableUnion{
+		{ParentTableID: "orders", ParentFieldID: fieldID(t, repo, "orders", "customer_id"), CurrentTableID: "customers", CurrentFieldID: fieldID(t, repo, "customers", "id"), UnionType: "left"},
+		{ParentTableID: "customers", ParentFieldID: "region_id", CurrentTableID: "regions", CurrentFieldID: "id", UnionType: "inner"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "ds1", repo.tables["sales"].DatasourceID)
+
+	var names []string
+	for _, f := range repo.fields["sales"] {
+		names = append(names, f.OriginName)
+	}
+	assert.ElementsMatch(t, []string{"id", "customer_id", "amount", "customers_id", "name", "region_id", "regions_id", "regions_name"}, names)
+
+	result, err := svc.PreviewData(ctx, "sales", 10)
+	require.NoError(t, err)
+	require.Len(t, result.Data, 3) // 内连接 regions 过滤掉了没有客户的订单
+	byOrder := make(map[int64]map[string]interface{})
+	for _, row := range result.Data {
+		byOrder[row["id"].(int64)] = row
+	}
+	assert.Equal(t, "alice", byOrder[1]["name"])
+	assert.Equal(t, "east", byOrder[1]["regions_name"])
+	assert.Equal(t, "west", byOrder[3]["regions_name"])
+	assert.Equal(t, int64(20), byOrder[3]["customers_id"])
+
+	chartSvc := &chartDataService{datasetRepo: repo}
+	chart := &model.ChartView{
+		XAxis: `{"fields":[{"name":"regions_name"}]}`,
+		YAxis: `{"fields":[{"name":"amount","aggregate":"SUM","sort":"DESC"}]}`,
+	}
+	config, err := ParseChartConfig(chart)
+	require.NoError(t, err)
+	calc, err := loadCalculatedFields(ctx, nil, repo.tables["sales"].ID, repo.fields["sales"])
+	require.NoError(t, err)
+	query, err := chartSvc.buildChartQuery(ctx, config, calc, repo.tables["sales"], repo.fields["sales"], nil)
+	require.NoError(t, err)
+	target, err := resolveQueryTarget(ctx, svc.datasourceRepo, nil, repo.tables["sales"])
+	require.NoError(t, err)
+	rows, err := svc.router.Execute(ctx, target, query)
+	require.NoError(t, err)
+	require.Len(t, rows.Rows, 2)
+	assert.Equal(t, "east", rows.Rows[0]["regions_name"])
+	assert.Equal(t, 12.0, rows.Rows[0]["amount"])
+}
+
+func TestDatasetUnion_Validation(t *testing.T) {
+	svc, repo, dsRepo := newUnionTestService(t)
+	ctx := context.Background()
+	join := func(parent, parentField, current, currentField, unionType string) *model.DatasetTableUnion {
+		return &model.DatasetTableUnion{ParentTableID: parent, ParentFieldID: parentField, CurrentTableID: current, CurrentFieldID: currentField, UnionType: unionType}
+	}
+
+	tests := []struct {
+		name   string
+		unions []*model.DatasetTableUnion
+		errMsg string
+	}{
+		{"empty", nil, "at least one join"},
+		{"unknown type", []*model.DatasetTableUnion{join("orders", "customer_id", "customers", "id", "cross")}, "unsupported union type"},
+		{"self join", []*model.DatasetTableUnion{join("orders", "id", "orders", "id", "left")}, "itself"},
+		{"two parents", []*model.DatasetTableUnion{
+			join("orders", "customer_id", "customers", "id", "left"),
+			join("regions", "id", "customers", "region_id", "left"),
+		}, "more than one parent"},
+		{"cycle", []*model.DatasetTableUnion{
+			join("customers", "region_id", "regions", "id", "left"),
+			join("regions", "id", "customers", "region_id", "left"),
+		}, "exactly one root"},
+		{"unknown field", []*model.DatasetTableUnion{join("orders", "missing", "customers", "id", "left")}, "unknown field: missing"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := svc.SaveUnions(ctx, "sales", tt.unions)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.errMsg)
+		})
+	}
+
+	// 成员数据集须属于同一数据源
+	dsRepo.items["ds2"] = &model.Datasource{ID: "ds2", Type: "sqlite", Configuration: dsRepo.items["ds1"].Configuration}
+	repo.tables["regions"].DatasourceID = "ds2"
+	err := svc.SaveUnions(ctx, "sales", []*model.DatasetTableUnion{join("customers", "region_id", "regions", "id", "left")})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "share a datasource")
+
+	err = svc.SaveUnions(ctx, "orders", []*model.DatasetTableUnion{join("customers", "region_id", "regions", "id", "left")})
+	assert.Error(t, err)
+
+	_, err = svc.PreviewData(ctx, "sales", 10)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no joins")
+}
+
+func TestUniqueColumnName(t *testing.T) {
+	used := make(map[string]bool)
+	assert.Equal(t, "id", uniqueColumnName(used, "id", "orders"))
+	assert.Equal(t, "customers_ID", uniqueColumnName(used, "ID", "customers"))
+	assert.Equal(t, "customers_id_2", uniqueColumnName(used, "id", "customers"))
+}
@@ -0,0 +1,313 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"cozy-insight-backend/internal/engine"
+	"cozy-insight-backend/internal/model"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/xuri/excelize/v2"
+)
+
+// UploadRequest 文件上传请求
+type UploadRequest struct {
+	TableID        string    // 为空时新建数据集,否则重新上传到已有数据集
+	Name           string    // 数据集名称,默认取文件名
+	DatasetGroupID string    // 所属分组
+	FileName       string    // 原始文件名,用于识别格式
+	Sheet          string    // Excel 工作表,默认第一个
+	EditType       int       // 0: 替换, 1: 追加 (与 Datasource.EditType 一致)
+	Reader         io.Reader // 文件内容
+}
+
+// uploadInfo 上传数据集的 Info 配置
+type uploadInfo struct {
+	FileName   string                 `json:"fileName"`
+	Sheet      string                 `json:"sheet,omitempty"`
+	RowCount   int                    `json:"rowCount"`
+	Columns    []engine.ExtractColumn `json:"columns"`
+	UploadTime int64                  `json:"uploadTime"`
+}
+
+// uploadTimeFormats 可识别的时间格式
+var uploadTimeFormats = []string{
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05Z07:00",
+	"2006/01/02 15:04:05",
+	"2006-01-02",
+	"2006/01/02",
+}
+
+// UploadTable 上传 CSV/Excel 文件,推断列类型后物化到抽取库并同步字段
+func (s *datasetService) UploadTable(ctx context.Context, req *UploadRequest) (*model.DatasetTable, error) {
+	if s.extract == nil {
+		return nil, fmt.Errorf("extract store not initialized")
+	}
+	if req.EditType != engine.WriteModeReplace && req.EditType != engine.WriteModeAppend {
+		return nil, fmt.Errorf("invalid edit type: %d", req.EditType)
+	}
+
+	header, records, sheet, err := parseUploadFile(req.FileName, req.Sheet, req.Reader)
+	if err != nil {
+		return nil, err
+	}
+	columns := inferUploadColumns(header, records)
+	rows := convertUploadRows(columns, records)
+
+	var table *model.DatasetTable
+	if req.TableID != "" {
+		table, err = s.repo.GetTable(ctx, req.TableID)
+		if err != nil {
+			return nil, fmt.Errorf("table not found: %w", err)
+		}
+		if table.Type != DatasetTypeExcel {
+			return nil, fmt.Errorf("dataset %s is not an uploaded dataset", table.ID)
+		}
+	} else {
+		if req.EditType == engine.WriteModeAppend {
+			return nil, fmt.Errorf("append requires an existing dataset")
+		}
+		name := req.Name
+		if name == "" {
+			name = strings.TrimSuffix(filepath.Base(req.FileName), filepath.Ext(req.FileName))
+		}
+		id := uuid.New().String()
+		table = &model.DatasetTable{
+			ID:                id,
+			Name:              name,
+			PhysicalTableName: "excel_" + strings.ReplaceAll(id, "-", ""),
+			DatasetGroupID:    req.DatasetGroupID,
+			Type:              DatasetTypeExcel,
+		}
+	}
+
+	if err := s.extract.Write(ctx, table.PhysicalTableName, columns, rows, req.EditType); err != nil {
+		return nil, fmt.Errorf("failed to store uploaded data: %w", err)
+	}
+
+	// 追加模式下行数累加
+	info := uploadInfo{FileName: req.FileName, Sheet: sheet, RowCount: len(rows), Columns: columns, UploadTime: time.Now().UnixMilli()}
+	if req.EditType == engine.WriteModeAppend && table.Info != "" {
+		var previous uploadInfo
+		if err := json.Unmarshal([]byte(table.Info), &previous); err == nil {
+			info.RowCount += previous.RowCount
+		}
+	}
+	infoJSON, err := json.Marshal(info)
+	if err != nil {
+		return nil, err
+	}
+	table.Info = string(infoJSON)
+	table.UpdateTime = time.Now().UnixMilli()
+
+	if req.TableID != "" {
+		err = s.repo.UpdateTable(ctx, table)
+	} else {
+		table.CreateTime = table.UpdateTime
+		err = s.repo.CreateTable(ctx, table)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to save dataset: %w", err)
+	}
+
+	if _, err := s.SyncFields(ctx, table.ID); err != nil {
+		return nil, fmt.Errorf("failed to sync fields: %w", err)
+	}
+
+	return table, nil
+}
+
+// parseUploadFile 按扩展名解析 CSV 或 Excel 文件,返回表头、数据行和实际读取的工作表
+func parseUploadFile(fileName, sheet string, r io.Reader) ([]string, [][]string, string, error) {
+	var (
+		records [][]string
+		err     error
+	)
+
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".csv":
+		records, err = readCSV(r)
+	case ".xlsx", ".xlsm":
+		records, sheet, err = readExcel(r, sheet)
+	default:
+		return nil, nil, "", fmt.Errorf("unsupported file type: %s", fileName)
+	}
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	if len(records) == 0 {
+		return nil, nil, "", fmt.Errorf("file is empty")
+	}
+	return normalizeHeader(records[0]), records[1:], sheet, nil
+}
+
+// readCSV 读取 CSV,去除 UTF-8 BOM,允许行字段数不一致
+func readCSV(r io.Reader) ([][]string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("invalid csv: %w", err)
+	}
+	return records, nil
+}
+
+// readExcel 读取 Excel 工作表
+func readExcel(r io.Reader, sheet string) ([][]string, string, error) {
+	f, err := excelize.OpenReader(r)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid excel file: %w", err)
+	}
+	defer f.Close()
+
+	if sheet == "" {
+		sheets := f.GetSheetList()
+		if len(sheets) == 0 {
+			return nil, "", fmt.Errorf("excel file has no sheets")
+		}
+		sheet = sheets[0]
+	}
+
+	records, err := f.GetRows(sheet)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read sheet %s: %w", sheet, err)
+	}
+	return records, sheet, nil
+}
+
+// normalizeHeader 规范化表头: 去除空白,为空列补名称,重名列追加序号
+func normalizeHeader(header []string) []string {
+	result := make([]string, len(header))
+	seen := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			name = fmt.Sprintf("column_%d", i+1)
+		}
+		if n := seen[name]; n > 0 {
+			seen[name] = n + 1
+			name = fmt.Sprintf("%s_%d", name, n+1)
+		}
+		seen[name]++
+		result[i] = name
+	}
+	return result
+}
+
+// inferUploadColumns 根据全部非空值推断列类型
+func inferUploadColumns(header []string, records [][]string) []engine.ExtractColumn {
+	columns := make([]engine.ExtractColumn, len(header))
+	for i, name := range header {
+		isInt, isFloat, isTime, hasValue := true, true, true, false
+		for _, record := range records {
+			if i >= len(record) {
+				continue
+			}
+			value := strings.TrimSpace(record[i])
+			if value == "" {
+				continue
+			}
+			hasValue = true
+			if isInt {
+				if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+					isInt = false
+				}
+			}
+			if isFloat {
+				if _, err := strconv.ParseFloat(value, 64); err != nil {
+					isFloat = false
+				}
+			}
+			if isTime {
+				if _, ok := parseUploadTime(value); !ok {
+					isTime = false
+				}
+			}
+			if !isInt && !isFloat && !isTime {
+				break
+			}
+		}
+
+		colType := engine.ExtractTypeText
+		switch {
+		case !hasValue:
+		case isInt:
+			colType = engine.ExtractTypeInteger
+		case isFloat:
+			colType = engine.ExtractTypeReal
+		case isTime:
+			colType = engine.ExtractTypeTimestamp
+		}
+		columns[i] = engine.ExtractColumn{Name: name, Type: colType}
+	}
+	return columns
+}
+
+// convertUploadRows 按推断的列类型转换数据行,空值写入 NULL,缺失的列补 NULL
+func convertUploadRows(columns []engine.ExtractColumn, records [][]string) [][]interface{} {
+	rows := make([][]interface{}, 0, len(records))
+	for _, record := range records {
+		if isBlankRecord(record) {
+			continue
+		}
+		row := make([]interface{}, len(columns))
+		for i, col := range columns {
+			if i >= len(record) {
+				continue
+			}
+			value := strings.TrimSpace(record[i])
+			if value == "" {
+				continue
+			}
+			switch col.Type {
+			case engine.ExtractTypeInteger:
+				row[i], _ = strconv.ParseInt(value, 10, 64)
+			case engine.ExtractTypeReal:
+				row[i], _ = strconv.ParseFloat(value, 64)
+			case engine.ExtractTypeTimestamp:
+				t, _ := parseUploadTime(value)
+				row[i] = t.Format("2006-01-02 15:04:05")
+			default:
+				row[i] = record[i]
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// parseUploadTime 按支持的格式解析时间
+func parseUploadTime(value string) (time.Time, bool) {
+	for _, layout := range uploadTimeFormats {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// isBlankRecord 是否为全空行
+func isBlankRecord(record []string) bool {
+	for _, v := range record {
+		if strings.TrimSpace(v) != "" {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,203 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"cozy-insight-backend/internal/engine"
+	"cozy-insight-backend/internal/model"
+	"cozy-insight-backend/internal/repository"
+	"cozy-insight-backend/pkg/logger"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xuri/excelize/v2"
+)
+
+// memDatasetRepo 内存数据集仓库
+type memDatasetRepo struct {
+	repository.DatasetRepository
+	tables map[string]*model.DatasetTable
+	fields map[string][]*model.DatasetTableField
+	unions map[string][]*model.DatasetTableUnion
+	tasks  map[string][]*model.DatasetTableTask
+}
+
+func newMemDatasetRepo() *memDatasetRepo {
+	return &memDatasetRepo{
+		tables: make(map[string]*model.DatasetTable),
+		fields: make(map[string][]*model.DatasetTableField),
+		unions: make(map[string][]*model.DatasetTableUnion),
+		tasks:  make(map[string][]*model.DatasetTableTask),
+	}
+}
+
+func (r *memDatasetRepo) CreateTable(ctx context.Context, table *model.DatasetTable) error {
+	r.tables[table.ID] = table
+	return nil
+}
+
+func (r *memDatasetRepo) UpdateTable(ctx context.Context, table *model.DatasetTable) error {
+	r.tables[table.ID] = table
+	return nil
+}
+
+func (r *memDatasetRepo) GetTable(ctx context.Context, id string) (*model.DatasetTable, error) {
+	table, ok := r.tables[id]
+	if !ok {
+		return nil, fmt.Errorf("table %s not found", id)
+	}
+	return table, nil
+}
+
+func (r *memDatasetRepo) GetFields(ctx context.Context, tableID string) ([]*model.DatasetTableField, error) {
+	return r.fields[tableID], nil
+}
+
+func (r *memDatasetRepo) SaveFields(ctx context.Context, fields []*model.DatasetTableField) error {
+	if len(fields) > 0 {
+		r.fields[fields[0].DatasetTableID] = fields
+	}
+	return nil
+}
+
+func (r *memDatasetRepo) DeleteFieldsByTableID(ctx context.Context, tableID string) error {
+	delete(r.fields, tableID)
+	return nil
+}
+
+func (r *memDatasetRepo) BatchCreateFields(ctx context.Context, fields []*model.DatasetTableField) error {
+	for _, f := range fields {
+		r.fields[f.DatasetTableID] = append(r.fields[f.DatasetTableID], f)
+	}
+	return nil
+}
+
+func (r *memDatasetRepo) ListUnions(ctx context.Context, tableID string) ([]*model.DatasetTableUnion, error) {
+	return r.unions[tableID], nil
+}
+
+func (r *memDatasetRepo) SaveUnions(ctx context.Context, tableID string, unions []*model.DatasetTableUnion) error {
+	r.unions[tableID] = unions
+	return nil
+}
+
+func (r *memDatasetRepo) CreateTask(ctx context.Context, task *model.DatasetTableTask) error {
+	r.tasks[task.TableID] = append([]*model.DatasetTableTask{task}, r.tasks[task.TableID]...)
+	return nil
+}
+
+func (r *memDatasetRepo) UpdateTask(ctx context.Context, task *model.DatasetTableTask) error {
+	return nil
+}
+
+func (r *memDatasetRepo) ListTasks(ctx context.Context, tableID string) ([]*model.DatasetTableTask, error) {
+	return r.tasks[tableID], nil
+}
+
+func newUploadTestService(t *testing.T) (*datasetService, *memDatasetRepo) {
+	logger.InitLogger("error")
+	store, err := engine.NewExtractStore(filepath.Join(t.TempDir(), "extract.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { store.Close() })
+
+	repo := newMemDatasetRepo()
+	router := engine.NewQueryRouter(engine.NewNativeExecutor(engine.NewConnectionManager(nil)))
+	return NewDatasetService(repo, nil, router, store, nil).(*datasetService), repo
+}
+
+func TestInferUploadColumns(t *testing.T) {
+	header := []string{"id", "price", "day", "name", "empty"}
+	records := [][]string{
+		{"1", "1.5", "2024-01-02", "a", ""},
+		{"2", "3", "2024/01/03", "b"},
+		{"", "", "", "c", ""},
+	}
+
+	columns := inferUploadColumns(header, records)
+	assert.Equal(t, []engine.ExtractColumn{
+		{Name: "id", Type: engine.ExtractTypeInteger},
+		{Name: "price", Type: engine.ExtractTypeReal},
+		{Name: "day", Type: engine.ExtractTypeTimestamp},
+		{Name: "name", Type: engine.ExtractTypeText},
+		{Name: "empty", Type: engine.ExtractTypeText},
+	}, columns)
+
+	rows := convertUploadRows(columns, records)
+	assert.Equal(t, []interface{}{int64(1), 1.5, "2024-01-02 00:00:00", "a", nil}, rows[0])
+	assert.Equal(t, []interface{}{int64(2), 3.0, "2024-01-03 00:00:00", "b", nil}, rows[1])
+}
+
+func TestNormalizeHeader(t *testing.T) {
+	assert.Equal(t, []string{"a", "column_2", "a_2", "b"}, normalizeHeader([]string{" a ", "", "a", "b"}))
+}
+
+func TestParseUploadFile_Excel(t *testing.T) {
+	f := excelize.NewFile()
+	require.NoError(t, f.SetSheetRow("Sheet1", "A1", &[]interface{}{"city", "sales"}))
+	require.NoError(t, f.SetSheetRow("Sheet1", "A2", &[]interface{}{"sh", 12}))
+	var buf bytes.Buffer
+	require.NoError(t, f.Write(&buf))
+
+	header, records, sheet, err := parseUploadFile("report.xlsx", "", &buf)
+	require.NoError(t, err)
+	assert.Equal(t, "Sheet1", sheet)
+	assert.Equal(t, []string{"city", "sales"}, header)
+	assert.Equal(t, [][]string{{"sh", "12"}}, records)
+
+	_, _, _, err = parseUploadFile("report.pdf", "", strings.NewReader("x"))
+	assert.Error(t, err)
+}
+
+func TestUploadTable_ReplaceAndAppend(t *testing.T) {
+	svc, repo := newUploadTestService(t)
+	ctx := context.Background()
+
+	table, err := svc.UploadTable(ctx, &UploadRequest{
+		FileName: "orders.csv",
+		Reader:   strings.NewReader("\xef\xbb\xbfregion,amount\neast,10\nwest,5\n"),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, DatasetTypeExcel, table.Type)
+	assert.Equal(t, "orders", table.Name)
+	assert.Len(t, repo.fields[table.ID], 2)
+
+	_, err = svc.UploadTable(ctx, &UploadRequest{
+		TableID:  table.ID,
+		FileName: "orders.csv",
+		EditType: engine.WriteModeAppend,
+		Reader:   strings.NewReader("region,amount\nnorth,7\n"),
+	})
+	require.NoError(t, err)
+
+	preview, err := svc.PreviewData(ctx, table.ID, 10)
+	require.NoError(t, err)
+	assert.Equal(t, 3, preview.Total)
+	assert.Equal(t, engine.ExecPathNative, preview.Engine)
+	assert.Contains(t, repo.tables[table.ID].Info, `"rowCount":3`)
+
+	_, err = svc.UploadTable(ctx, &UploadRequest{
+		TableID:  table.ID,
+		FileName: "orders.csv",
+		Reader:   strings.NewReader("city\nsh\n"),
+	})
+	require.NoError(t, err)
+
+	preview, err = svc.PreviewData(ctx, table.ID, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []map[string]interface{}{{"city": "sh"}}, preview.Data)
+}
+
+func TestUploadTable_AppendRequiresDataset(t *testing.T) {
+	svc, _ := newUploadTestService(t)
+
+	_, err := svc.UploadTable(context.Background(), &UploadRequest{
+		FileName: "orders.csv",
+		EditType: engine.WriteModeAppend,
+		Reader:   strings.NewReader("a\n1\n"),
+	})
+	assert.Error(t, err)
+}
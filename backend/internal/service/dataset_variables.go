@@ -0,0 +1,256 @@
+package service
+
+import (
+	"cozy-insight-backend/internal/engine"
+	"cozy-insight-backend/internal/model"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SQL 数据集变量类型
+const (
+	VariableTypeText     = "text"
+	VariableTypeNumber   = "number"
+	VariableTypeDate     = "date"     // 绑定为 2006-01-02
+	VariableTypeDatetime = "datetime" // 绑定为 2006-01-02 15:04:05
+)
+
+// variableNamePattern 变量名规则,与 SQL 中 ${name} 引用一致
+var variableNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// SQLVariable SQL 数据集声明的变量,在 SQL 中以 ${name} 引用,执行时作为绑定参数传入
+type SQLVariable struct {
+	Name         string      `json:"name"`
+	Type         string      `json:"type"`         // text, number, date, datetime
+	DefaultValue interface{} `json:"defaultValue"` // 未提供值时使用,多值变量可为数组
+	Required     bool        `json:"required"`
+	Multiple     bool        `json:"multiple"` // 多值变量,在 SQL 中展开为 IN 列表,查询时须有值或默认值
+}
+
+// sqlDatasetInfo SQL 数据集的 Info 配置
+type sqlDatasetInfo struct {
+	SQL       string        `json:"sql"`
+	Variables []SQLVariable `json:"variables"`
+}
+
+// parseSQLDatasetInfo 解析并校验 SQL 数据集的语句和变量声明
+// SQL 中引用的变量必须已声明,声明的默认值须符合变量类型
+func parseSQLDatasetInfo(table *model.DatasetTable) (*sqlDatasetInfo, error) {
+	var info sqlDatasetInfo
+	if err := json.Unmarshal([]byte(table.Info), &info); err != nil {
+		return nil, fmt.Errorf("invalid table info: %w", err)
+	}
+	if info.SQL == "" {
+		return nil, fmt.Errorf("sql not found in table info")
+	}
+
+	declared := make(map[string]bool, len(info.Variables))
+	for i := range info.Variables {
+		v := &info.Variables[i]
+		if !variableNamePattern.MatchString(v.Name) {
+			return nil, fmt.Errorf("invalid variable name: %q", v.Name)
+		}
+		if declared[v.Name] {
+			return nil, fmt.Errorf("duplicate variable: %s", v.Name)
+		}
+		declared[v.Name] = true
+		if v.Type == "" {
+			v.Type = VariableTypeText
+		}
+		if _, err := convertVariable(v, v.DefaultValue); err != nil {
+			return nil, fmt.Errorf("invalid default value: %w", err)
+		}
+	}
+	for _, name := range engine.SQLVariableNames(info.SQL) {
+		if !declared[name] {
+			return nil, fmt.Errorf("sql references undeclared variable: %s", name)
+		}
+	}
+	return &info, nil
+}
+
+// resolveVariables 按变量声明校验并转换提供的值,未提供时使用默认值
+// values 为 nil 表示预览或字段同步: 缺少值的必填变量以 NULL 绑定,只用于获取结果列
+// 缺少值的可选单值变量以 NULL 绑定; 多值变量缺少值时报错,因为 IN (NULL) 不匹配任何行
+func resolveVariables(vars []SQLVariable, values map[string]interface{}) (map[string]interface{}, error) {
+	bound := make(map[string]interface{}, len(vars))
+	for i := range vars {
+		v := &vars[i]
+		value, ok := values[v.Name]
+		if !ok || isEmptyVariableValue(value) {
+			value = v.DefaultValue
+		}
+		if isEmptyVariableValue(value) {
+			if v.Required && values != nil {
+				return nil, fmt.Errorf("variable %s is required", v.Name)
+			}
+			if v.Multiple && values != nil {
+				return nil, fmt.Errorf("variable %s accepts multiple values and needs at least one value or a default value", v.Name)
+			}
+			bound[v.Name] = nil
+			continue
+		}
+		converted, err := convertVariable(v, value)
+		if err != nil {
+			return nil, err
+		}
+		bound[v.Name] = converted
+	}
+	return bound, nil
+}
+
+// convertVariable 将变量值转换为绑定参数,多值变量返回切片
+func convertVariable(v *SQLVariable, value interface{}) (interface{}, error) {
+	if isEmptyVariableValue(value) {
+		return nil, nil
+	}
+	if !v.Multiple {
+		// 单值变量不按逗号分隔,文本中的逗号原样保留
+		if s, ok := value.(string); ok {
+			return convertVariableItem(v, s)
+		}
+		items := variableItems(value)
+		if len(items) != 1 {
+			return nil, fmt.Errorf("variable %s accepts a single value", v.Name)
+		}
+		return convertVariableItem(v, items[0])
+	}
+
+	items := variableItems(value)
+	converted := make([]interface{}, 0, len(items))
+	for _, item := range items {
+		c, err := convertVariableItem(v, item)
+		if err != nil {
+			return nil, err
+		}
+		converted = append(converted, c)
+	}
+	return converted, nil
+}
+
+// convertVariableItem 按变量类型转换单个值
+func convertVariableItem(v *SQLVariable, value interface{}) (interface{}, error) {
+	text := strings.TrimSpace(fmt.Sprint(value))
+	switch v.Type {
+	case VariableTypeText:
+		return fmt.Sprint(value), nil
+	case VariableTypeNumber:
+		switch n := value.(type) {
+		case int, int32, int64, float32, float64:
+			return n, nil
+		case json.Number:
+			value = n.String()
+		}
+		if i, err := strconv.ParseInt(text, 10, 64); err == nil {
+			return i, nil
+		}
+		f, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("variable %s expects a number, got %q", v.Name, text)
+		}
+		return f, nil
+	case VariableTypeDate, VariableTypeDatetime:
+		t, err := parseVariableTime(text)
+		if err != nil {
+			return nil, fmt.Errorf("variable %s expects a %s, got %q", v.Name, v.Type, text)
+		}
+		if v.Type == VariableTypeDate {
+			return t.Format("2006-01-02"), nil
+		}
+		return t.Format("2006-01-02 15:04:05"), nil
+	default:
+		return nil, fmt.Errorf("unsupported variable type: %s", v.Type)
+	}
+}
+
+// parseVariableTime 解析日期或时间,支持常见格式和毫秒时间戳
+func parseVariableTime(text string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02T15:04:05", "2006-01-02", "2006/01/02"} {
+		if t, err := time.Parse(layout, text); err == nil {
+			return t, nil
+		}
+	}
+	if ms, err := strconv.ParseInt(text, 10, 64); err == nil {
+		return time.UnixMilli(ms), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time: %s", text)
+}
+
+// variableItems 将多值变量展开为列表,字符串按逗号分隔以支持查询串和下拉多选的默认值
+func variableItems(value interface{}) []interface{} {
+	if s, ok := value.(string); ok {
+		parts := strings.Split(s, ",")
+		items := make([]interface{}, 0, len(parts))
+		for _, p := range parts {
+			if p = strings.TrimSpace(p); p != "" {
+				items = append(items, p)
+			}
+		}
+		return items
+	}
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return []interface{}{value}
+	}
+	items := make([]interface{}, rv.Len())
+	for i := range items {
+		items[i] = rv.Index(i).Interface()
+	}
+	return items
+}
+
+// isEmptyVariableValue 值为 nil、空字符串或空列表时视为未提供
+func isEmptyVariableValue(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+	if s, ok := value.(string); ok {
+		return strings.TrimSpace(s) == ""
+	}
+	rv := reflect.ValueOf(value)
+	return (rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array) && rv.Len() == 0
+}
+
+// datasetVariables 数据集声明的 SQL 变量,非 SQL 数据集返回空
+func datasetVariables(table *model.DatasetTable) []SQLVariable {
+	if table.Type != DatasetTypeSQL {
+		return nil
+	}
+	info, err := parseSQLDatasetInfo(table)
+	if err != nil {
+		return nil
+	}
+	return info.Variables
+}
+
+// DashboardParameterValues 将仪表板参数的取值转换为 SQL 变量值,参数名即变量名
+// 未提供值时使用参数默认值,多选参数按逗号分隔为列表
+func DashboardParameterValues(params []*model.DashboardParameter, supplied map[string]string) (map[string]interface{}, error) {
+	values := make(map[string]interface{}, len(params))
+	for _, p := range params {
+		if !p.Enable {
+			continue
+		}
+		value, ok := supplied[p.Name]
+		if !ok || strings.TrimSpace(value) == "" {
+			value = p.DefaultValue
+		}
+		if strings.TrimSpace(value) == "" {
+			if p.Required {
+				return nil, fmt.Errorf("parameter %s is required", p.Name)
+			}
+			continue
+		}
+		if p.ParamType == ParameterTypeMultiSelect {
+			values[p.Name] = variableItems(value)
+		} else {
+			values[p.Name] = value
+		}
+	}
+	return values, nil
+}
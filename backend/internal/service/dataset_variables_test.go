@@ -0,0 +1,172 @@
+package service
+
+import (
+	"context"
+	"cozy-insight-backend/internal/engine"
+	"cozy-insight-backend/internal/model"
+	"cozy-insight-backend/pkg/logger"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSQLDatasetInfo(t *testing.T) {
+	table := func(info string) *model.DatasetTable {
+		return &model.DatasetTable{Type: DatasetTypeSQL, Info: info}
+	}
+
+	info, err := parseSQLDatasetInfo(table(`{"sql":"SELECT * FROM t WHERE d >= ${start}","variables":[{"name":"start","type":"date","defaultValue":"2024-01-01"}]}`))
+	require.NoError(t, err)
+	assert.Equal(t, "start", info.Variables[0].Name)
+
+	info, err = parseSQLDatasetInfo(table(`{"sql":"SELECT * FROM t WHERE r = ${region}","variables":[{"name":"region"}]}`))
+	require.NoError(t, err)
+	assert.Equal(t, VariableTypeText, info.Variables[0].Type)
+
+	tests := []struct {
+		name   string
+		info   string
+		errMsg string
+	}{
+		{"undeclared", `{"sql":"SELECT * FROM t WHERE d >= ${start}"}`, "undeclared variable: start"},
+		{"bad name", `{"sql":"SELECT 1","variables":[{"name":"1x"}]}`, "invalid variable name"},
+		{"duplicate", `{"sql":"SELECT 1","variables":[{"name":"a"},{"name":"a"}]}`, "duplicate variable"},
+		{"bad type", `{"sql":"SELECT 1","variables":[{"name":"a","type":"uuid","defaultValue":"x"}]}`, "unsupported variable type"},
+		{"bad default", `{"sql":"SELECT 1","variables":[{"name":"a","type":"number","defaultValue":"ten"}]}`, "expects a number"},
+		{"no sql", `{"variables":[]}`, "sql not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseSQLDatasetInfo(table(tt.info))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.errMsg)
+		})
+	}
+}
+
+func TestResolveVariables(t *testing.T) {
+	vars := []SQLVariable{
+		{Name: "start", Type: VariableTypeDate, Required: true},
+		{Name: "min", Type: VariableTypeNumber, DefaultValue: "10"},
+		{Name: "regions", Type: VariableTypeText, Multiple: true},
+		{Name: "at", Type: VariableTypeDatetime},
+		{Name: "company", Type: VariableTypeText},
+	}
+
+	values, err := resolveVariables(vars, map[string]interface{}{
+		"start":   "2024-03-05T10:00:00Z",
+		"regions": "east, west",
+		"at":      "2024-03-05T10:30:00",
+		"company": "Acme, Inc.",
+		"unused":  "ignored",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"start":   "2024-03-05",
+		"min":     int64(10),
+		"regions": []interface{}{"east", "west"},
+		"at":      "2024-03-05 10:30:00",
+		"company": "Acme, Inc.",
+	}, values)
+
+	_, err = resolveVariables(vars, map[string]interface{}{})
+	assert.ErrorContains(t, err, "variable start is required")
+
+	_, err = resolveVariables(vars, map[string]interface{}{"start": "2024-01-01", "min": []string{"1", "2"}})
+	assert.ErrorContains(t, err, "single value")
+
+	// 可选多值变量没有值时报错,而不是绑定只匹配不到任何行的 IN (NULL)
+	values, err = resolveVariables(vars, map[string]interface{}{"start": "2024-01-01", "regions": []string{}})
+	assert.ErrorContains(t, err, "variable regions accepts multiple values")
+	assert.Nil(t, values)
+
+	// 可选单值变量没有值时以 NULL 绑定
+	values, err = resolveVariables(vars, map[string]interface{}{"start": "2024-01-01", "regions": "east"})
+	require.NoError(t, err)
+	assert.Contains(t, values, "company")
+	assert.Nil(t, values["company"])
+
+	// 预览时缺少的必填变量和多值变量以 NULL 绑定
+	values, err = resolveVariables(vars, nil)
+	require.NoError(t, err)
+	assert.Nil(t, values["start"])
+	assert.Contains(t, values, "start")
+	assert.Nil(t, values["regions"])
+}
+
+func TestDashboardParameterValues(t *testing.T) {
+	params := []*model.DashboardParameter{
+		{Name: "region", ParamType: "multiselect", DefaultValue: "east,west", Enable: true},
+		{Name: "start", ParamType: "date", Required: true, Enable: true},
+		{Name: "off", ParamType: "text", DefaultValue: "x", Enable: false},
+	}
+
+	values, err := DashboardParameterValues(params, map[string]string{"start": "2024-01-01"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"region": []interface{}{"east", "west"}, "start": "2024-01-01"}, values)
+
+	_, err = DashboardParameterValues(params, nil)
+	assert.ErrorContains(t, err, "parameter start is required")
+}
+
+func TestGetChartData_SQLVariables(t *testing.T) {
+	logger.InitLogger("error")
+
+	path := filepath.Join(t.TempDir(), "sales.db")
+	db, err := sql.Open("sqlite3", path)
+	require.NoError(t, err)
+	_, err = db.Exec(`CREATE TABLE sales (day TEXT, region TEXT, amount REAL)`)
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO sales VALUES ('2024-01-01', 'east', 1), ('2024-02-01', 'east', 2), ('2024-02-01', 'west', 10), ('2024-03-01', 'north', 100)`)
+	require.NoError(t, err)
+	db.Close()
+
+	table := &model.DatasetTable{ID: "table1", DatasourceID: "ds1", Type: DatasetTypeSQL,
+		Info: `{"sql":"SELECT * FROM sales WHERE day >= ${start} AND region IN (${regions})","variables":[` +
+			`{"name":"start","type":"date","required":true},` +
+			`{"name":"regions","type":"text","multiple":true,"defaultValue":["east","west","north"]}]}`}
+	chart := &model.ChartView{
+		ID:      "chart1",
+		TableID: "table1",
+		XAxis:   `{"fields":[{"name":"region"}]}`,
+		YAxis:   `{"fields":[{"name":"amount","aggregate":"SUM","sort":"DESC"}]}`,
+	}
+
+	chartRepo := new(MockChartRepository)
+	chartRepo.On("Get", mock.Anything, "chart1").Return(chart, nil)
+	datasetRepo := &stubDatasetRepo{table: table, fields: []*model.DatasetTableField{
+		{ID: "f1", OriginName: "day", Name: "day"},
+		{ID: "f2", OriginName: "region", Name: "region"},
+		{ID: "f3", OriginName: "amount", Name: "amount"},
+	}}
+	dsRepo := &stubDatasourceRepo{items: map[string]*model.Datasource{
+		"ds1": {ID: "ds1", Type: "sqlite", Configuration: fmt.Sprintf(`{"path":%q}`, path)},
+	}}
+	router := engine.NewQueryRouter(engine.NewNativeExecutor(engine.NewConnectionManager(nil)))
+	svc := NewChartDataService(chartRepo, datasetRepo, dsRepo, nil, nil, router, nil)
+	ctx := context.Background()
+
+	_, err = svc.GetChartData(ctx, "chart1")
+	assert.ErrorContains(t, err, "variable start is required")
+
+	result, err := svc.GetChartDataWithFilter(ctx, "chart1", &QueryFilter{Variables: map[string]interface{}{"start": "2024-02-01"}})
+	require.NoError(t, err)
+	require.Len(t, result.Data, 3)
+	assert.Equal(t, "north", result.Data[0]["region"])
+
+	// 字段名为变量名的过滤条件作为变量值,其余条件照常过滤
+	result, err = svc.GetChartDataWithFilter(ctx, "chart1", &QueryFilter{Filters: []FilterCondition{
+		{Field: "start", Operator: "=", Value: "2024-01-01"},
+		{Field: "regions", Operator: "IN", Value: []string{"east"}},
+		{Field: "amount", Operator: ">", Value: 1},
+	}})
+	require.NoError(t, err)
+	require.Len(t, result.Data, 1)
+	assert.Equal(t, "east", result.Data[0]["region"])
+	assert.Equal(t, 2.0, result.Data[0]["amount"])
+}
@@ -0,0 +1,254 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"cozy-insight-backend/internal/model"
+	"cozy-insight-backend/pkg/logger"
+	"cozy-insight-backend/pkg/secret"
+
+	"go.uber.org/zap"
+)
+
+// MaskedCredential 接口返回中凭据字段的掩码值,更新时提交掩码表示保留原值
+const MaskedCredential = "******"
+
+// credentialFields 数据源配置中视为凭据的字段名,任意嵌套层级均生效
+var credentialFields = map[string]bool{
+	"password":   true,
+	"authToken":  true,
+	"apiKey":     true,
+	"privateKey": true,
+	"passphrase": true,
+	"clientKey":  true,
+}
+
+// sensitiveHeaders 接口数据源请求头中视为凭据的头部名称(小写),
+// 此外名称中含 token、key、secret 的头部也视为凭据
+var sensitiveHeaders = map[string]bool{
+	"authorization":       true,
+	"proxy-authorization": true,
+	"cookie":              true,
+}
+
+// isCredential 字段是否为凭据,headers 下的字段按请求头名称判断
+func isCredential(path, key string) bool {
+	if credentialFields[key] {
+		return true
+	}
+	if path != "headers" && !strings.HasSuffix(path, ".headers") {
+		return false
+	}
+	name := strings.ToLower(key)
+	return sensitiveHeaders[name] || strings.Contains(name, "token") || strings.Contains(name, "key") || strings.Contains(name, "secret")
+}
+
+// encryptCredentials 加密配置中的明文凭据,已加密的值保持不变。未配置主密钥时原样返回
+func encryptCredentials(keyring *secret.Keyring, configJSON string) (string, error) {
+	if !keyring.Enabled() || configJSON == "" {
+		return configJSON, nil
+	}
+	return rewriteCredentials(configJSON, func(value string) (string, error) {
+		if value == "" || secret.IsEncrypted(value) {
+			return value, nil
+		}
+		return keyring.Encrypt(value)
+	})
+}
+
+// maskCredentials 将配置中的凭据替换为掩码
+func maskCredentials(configJSON string) string {
+	if configJSON == "" {
+		return configJSON
+	}
+	masked, err := rewriteCredentials(configJSON, func(value string) (string, error) {
+		if value == "" {
+			return value, nil
+		}
+		return MaskedCredential, nil
+	})
+	if err != nil {
+		// 无法解析的配置不返回原文,避免泄露凭据
+		return ""
+	}
+	return masked
+}
+
+// restoreMaskedCredentials 将更新请求中仍为掩码的凭据替换为已保存的值
+func restoreMaskedCredentials(configJSON, storedJSON string) (string, error) {
+	if !strings.Contains(configJSON, MaskedCredential) {
+		return configJSON, nil
+	}
+
+	stored := make(map[string]string)
+	if storedJSON != "" {
+		var storedConfig interface{}
+		if err := decodeConfig(storedJSON, &storedConfig); err != nil {
+			return "", err
+		}
+		collectCredentials("", storedConfig, stored)
+	}
+
+	var config interface{}
+	if err := decodeConfig(configJSON, &config); err != nil {
+		return "", err
+	}
+	config, err := walkCredentials("", config, func(path, value string) (string, error) {
+		if value != MaskedCredential {
+			return value, nil
+		}
+		original, ok := stored[path]
+		if !ok {
+			return "", fmt.Errorf("credential %s is masked but no stored value exists", path)
+		}
+		return original, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return encodeConfig(config)
+}
+
+// maskedDatasource 返回凭据已掩码的数据源副本
+func maskedDatasource(ds *model.Datasource) *model.Datasource {
+	if ds == nil {
+		return nil
+	}
+	masked := *ds
+	masked.Configuration = maskCredentials(ds.Configuration)
+	return &masked
+}
+
+// RotateCredentials 使用当前主密钥重新加密所有数据源凭据,包括历史明文凭据,返回更新的数据源数
+func (s *datasourceService) RotateCredentials(ctx context.Context) (int, error) {
+	if !s.keyring.Enabled() {
+		return 0, secret.ErrNoKey
+	}
+
+	list, err := s.repo.List(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	rotated := 0
+	for _, ds := range list {
+		changed := false
+		config, err := rewriteCredentials(ds.Configuration, func(value string) (string, error) {
+			if value == "" || !s.keyring.NeedsRotation(value) {
+				return value, nil
+			}
+			plain, err := s.keyring.Decrypt(value)
+			if err != nil {
+				return "", err
+			}
+			changed = true
+			return s.keyring.Encrypt(plain)
+		})
+		if err != nil {
+			return rotated, fmt.Errorf("failed to rotate credentials of datasource %s: %w", ds.ID, err)
+		}
+		if !changed {
+			continue
+		}
+
+		ds.Configuration = config
+		if err := s.repo.Update(ctx, ds); err != nil {
+			return rotated, fmt.Errorf("failed to save datasource %s: %w", ds.ID, err)
+		}
+		s.connector.Invalidate(ds.ID)
+		rotated++
+	}
+
+	logger.Log.Info("datasource credentials rotated",
+		zap.String("activeKey", s.keyring.ActiveKeyID()),
+		zap.Int("rotated", rotated))
+	return rotated, nil
+}
+
+// rewriteCredentials 对配置中每个凭据字段的字符串值应用 fn
+func rewriteCredentials(configJSON string, fn func(value string) (string, error)) (string, error) {
+	if configJSON == "" {
+		return configJSON, nil
+	}
+	var config interface{}
+	if err := decodeConfig(configJSON, &config); err != nil {
+		return "", err
+	}
+	config, err := walkCredentials("", config, func(path, value string) (string, error) {
+		return fn(value)
+	})
+	if err != nil {
+		return "", err
+	}
+	return encodeConfig(config)
+}
+
+// walkCredentials 递归遍历配置,对凭据字段调用 fn,path 为点号分隔的字段路径
+func walkCredentials(path string, value interface{}, fn func(path, value string) (string, error)) (interface{}, error) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			childPath := joinPath(path, key)
+			if str, ok := child.(string); ok && isCredential(path, key) {
+				rewritten, err := fn(childPath, str)
+				if err != nil {
+					return nil, err
+				}
+				v[key] = rewritten
+				continue
+			}
+			rewritten, err := walkCredentials(childPath, child, fn)
+			if err != nil {
+				return nil, err
+			}
+			v[key] = rewritten
+		}
+	case []interface{}:
+		for i, child := range v {
+			rewritten, err := walkCredentials(fmt.Sprintf("%s[%d]", path, i), child, fn)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = rewritten
+		}
+	}
+	return value, nil
+}
+
+// collectCredentials 收集配置中的凭据值,键为字段路径
+func collectCredentials(path string, value interface{}, out map[string]string) {
+	walkCredentials(path, value, func(path, value string) (string, error) {
+		out[path] = value
+		return value, nil
+	})
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func decodeConfig(configJSON string, v interface{}) error {
+	decoder := json.NewDecoder(strings.NewReader(configJSON))
+	decoder.UseNumber()
+	if err := decoder.Decode(v); err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+	return nil
+}
+
+func encodeConfig(v interface{}) (string, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(v); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
@@ -0,0 +1,152 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"cozy-insight-backend/internal/engine"
+	"cozy-insight-backend/internal/model"
+	"cozy-insight-backend/pkg/logger"
+	"cozy-insight-backend/pkg/secret"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testKeyring(t *testing.T, active string) *secret.Keyring {
+	keys := map[string]string{
+		"k1": base64.StdEncoding.EncodeToString([]byte(strings.Repeat("a", 32))),
+		"k2": base64.StdEncoding.EncodeToString([]byte(strings.Repeat("b", 32))),
+	}
+	keyring, err := secret.NewKeyring(keys, active)
+	require.NoError(t, err)
+	return keyring
+}
+
+func TestDatasourceService_EncryptsAndMasksCredentials(t *testing.T) {
+	logger.InitLogger("error")
+	ctx := context.Background()
+	repo := &stubDatasourceRepo{items: map[string]*model.Datasource{}}
+	keyring := testKeyring(t, "k1")
+	svc := NewDatasourceService(repo, engine.NewDatasourceConnector(nil, nil), keyring)
+
+	ds := &model.Datasource{
+		ID:            "ds1",
+		Type:          "mysql",
+		Configuration: `{"host":"db","password":"s3cret","ssh":{"host":"jump","privateKey":"KEY"}}`,
+	}
+	require.NoError(t, svc.Create(ctx, ds))
+	assert.Equal(t, `{"host":"db","password":"******","ssh":{"host":"jump","privateKey":"******"}}`, ds.Configuration)
+
+	// 存储的配置已加密,解密后还原
+	stored := repo.items["ds1"].Configuration
+	assert.NotContains(t, stored, "s3cret")
+	assert.NotContains(t, stored, "KEY")
+	engine.SetCredentialDecrypter(keyring)
+	defer engine.SetCredentialDecrypter(nil)
+	plain, err := engine.DecryptConfig(stored)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"host":"db","password":"s3cret","ssh":{"host":"jump","privateKey":"KEY"}}`, plain)
+
+	// 读取接口只返回掩码
+	got, err := svc.GetByID(ctx, "ds1")
+	require.NoError(t, err)
+	assert.NotContains(t, got.Configuration, "enc:v1:")
+	assert.Contains(t, got.Configuration, MaskedCredential)
+	list, err := svc.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, got.Configuration, list[0].Configuration)
+	assert.Equal(t, stored, repo.items["ds1"].Configuration)
+
+	// 更新时掩码保留原值,新值重新加密
+	update := &model.Datasource{
+		ID:            "ds1",
+		Type:          "mysql",
+		Configuration: `{"host":"db2","password":"******","ssh":{"host":"jump","privateKey":"NEWKEY"}}`,
+	}
+	require.NoError(t, svc.Update(ctx, update))
+	plain, err = engine.DecryptConfig(repo.items["ds1"].Configuration)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"host":"db2","password":"s3cret","ssh":{"host":"jump","privateKey":"NEWKEY"}}`, plain)
+
+	// 原配置中不存在的凭据不能以掩码提交
+	update.Configuration = `{"host":"db2","apiKey":"******"}`
+	assert.Error(t, svc.Update(ctx, update))
+}
+
+func TestDatasourceService_MasksAPIHeaders(t *testing.T) {
+	logger.InitLogger("error")
+	ctx := context.Background()
+	repo := &stubDatasourceRepo{items: map[string]*model.Datasource{}}
+	keyring := testKeyring(t, "k1")
+	svc := NewDatasourceService(repo, engine.NewDatasourceConnector(nil, nil), keyring)
+
+	config := `{"url":"https://api.example.com","headers":{"Accept":"application/json","Authorization":"Bearer abc","Cookie":"sid=1","X-Api-Key":"k1","X-Access-Token":"t1"}}`
+	ds := &model.Datasource{ID: "api1", Type: "api", Configuration: config}
+	require.NoError(t, svc.Create(ctx, ds))
+	assert.JSONEq(t, `{"url":"https://api.example.com","headers":{"Accept":"application/json","Authorization":"******","Cookie":"******","X-Api-Key":"******","X-Access-Token":"******"}}`, ds.Configuration)
+
+	stored := repo.items["api1"].Configuration
+	for _, value := range []string{"Bearer abc", "sid=1", `"k1"`, "t1"} {
+		assert.NotContains(t, stored, value)
+	}
+	assert.Contains(t, stored, "application/json")
+	engine.SetCredentialDecrypter(keyring)
+	defer engine.SetCredentialDecrypter(nil)
+	cfg, err := engine.ParseAPIConfig(stored)
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer abc", cfg.Headers["Authorization"])
+	assert.Equal(t, "t1", cfg.Headers["X-Access-Token"])
+
+	got, err := svc.GetByID(ctx, "api1")
+	require.NoError(t, err)
+	assert.NotContains(t, got.Configuration, "Bearer")
+
+	// 更新时掩码的请求头保留原值
+	update := &model.Datasource{ID: "api1", Type: "api", Configuration: `{"url":"https://api.example.com","headers":{"Authorization":"******","X-Api-Key":"k2"}}`}
+	require.NoError(t, svc.Update(ctx, update))
+	cfg, err = engine.ParseAPIConfig(repo.items["api1"].Configuration)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"Authorization": "Bearer abc", "X-Api-Key": "k2"}, cfg.Headers)
+}
+
+func TestDatasourceService_RotateCredentials(t *testing.T) {
+	logger.InitLogger("error")
+	ctx := context.Background()
+	old := testKeyring(t, "k1")
+	encrypted, err := old.Encrypt("old-secret")
+	require.NoError(t, err)
+
+	repo := &stubDatasourceRepo{items: map[string]*model.Datasource{
+		"enc":   {ID: "enc", Configuration: `{"host":"a","password":"` + encrypted + `"}`},
+		"plain": {ID: "plain", Configuration: `{"host":"b","authToken":"legacy"}`},
+		"none":  {ID: "none", Configuration: `{"path":"data.db"}`},
+	}}
+	keyring := testKeyring(t, "k2")
+	svc := NewDatasourceService(repo, engine.NewDatasourceConnector(nil, nil), keyring)
+
+	rotated, err := svc.RotateCredentials(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, rotated)
+	assert.Contains(t, repo.items["enc"].Configuration, "enc:v1:k2:")
+	assert.Contains(t, repo.items["plain"].Configuration, "enc:v1:k2:")
+	assert.Equal(t, `{"path":"data.db"}`, repo.items["none"].Configuration)
+
+	engine.SetCredentialDecrypter(keyring)
+	defer engine.SetCredentialDecrypter(nil)
+	plain, err := engine.DecryptConfig(repo.items["enc"].Configuration)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"host":"a","password":"old-secret"}`, plain)
+
+	// 再次轮换无需更新
+	rotated, err = svc.RotateCredentials(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, rotated)
+
+	// 未配置主密钥时无法轮换
+	_, err = NewDatasourceService(repo, engine.NewDatasourceConnector(nil, nil), nil).RotateCredentials(ctx)
+	assert.ErrorIs(t, err, secret.ErrNoKey)
+}
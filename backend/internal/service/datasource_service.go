@@ -5,6 +5,7 @@ import (
 	"cozy-insight-backend/internal/engine"
 	"cozy-insight-backend/internal/model"
 	"cozy-insight-backend/internal/repository"
+	"cozy-insight-backend/pkg/secret"
 	"fmt"
 	"time"
 
@@ -23,18 +24,26 @@ type DatasourceService interface {
 	TestConnectionByConfig(ctx context.Context, config string) (*engine.ConnectionTestResult, error)
 	GetDatabases(ctx context.Context, id string) ([]string, error)
 	GetTables(ctx context.Context, id string, database string) ([]string, error)
-	GetTableSchema(ctx context.Context, id string, database, table string) ([]map[string]interface{}, error)
+	GetTableSchema(ctx context.Context, id string, database, table string) (*engine.TableInfo, error)
+
+	// 连接池状态
+	PoolStats(ctx context.Context) []engine.PoolStats
+
+	// 凭据密钥轮换
+	RotateCredentials(ctx context.Context) (int, error)
 }
 
 type datasourceService struct {
 	repo      repository.DatasourceRepository
 	connector *engine.DatasourceConnector
+	keyring   *secret.Keyring // 为空时凭据不加密存储
 }
 
-func NewDatasourceService(repo repository.DatasourceRepository, connector *engine.DatasourceConnector) DatasourceService {
+func NewDatasourceService(repo repository.DatasourceRepository, connector *engine.DatasourceConnector, keyring *secret.Keyring) DatasourceService {
 	return &datasourceService{
 		repo:      repo,
 		connector: connector,
+		keyring:   keyring,
 	}
 }
 
@@ -44,24 +53,71 @@ func (s *datasourceService) Create(ctx context.Context, ds *model.Datasource) er
 	}
 	ds.CreateTime = time.Now().UnixMilli()
 	ds.UpdateTime = time.Now().UnixMilli()
-	return s.repo.Create(ctx, ds)
+
+	config, err := encryptCredentials(s.keyring, ds.Configuration)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt credentials: %w", err)
+	}
+	ds.Configuration = config
+	if err := s.repo.Create(ctx, ds); err != nil {
+		return err
+	}
+	ds.Configuration = maskCredentials(ds.Configuration)
+	return nil
 }
 
 func (s *datasourceService) Update(ctx context.Context, ds *model.Datasource) error {
 	ds.UpdateTime = time.Now().UnixMilli()
-	return s.repo.Update(ctx, ds)
+
+	// 未修改的凭据以掩码提交,沿用已保存的值
+	var stored string
+	if existing, err := s.repo.GetByID(ctx, ds.ID); err == nil {
+		stored = existing.Configuration
+	}
+	config, err := restoreMaskedCredentials(ds.Configuration, stored)
+	if err != nil {
+		return err
+	}
+	if config, err = encryptCredentials(s.keyring, config); err != nil {
+		return fmt.Errorf("failed to encrypt credentials: %w", err)
+	}
+	ds.Configuration = config
+
+	if err := s.repo.Update(ctx, ds); err != nil {
+		return err
+	}
+	// 配置可能已变更,关闭旧连接池
+	s.connector.Invalidate(ds.ID)
+	ds.Configuration = maskCredentials(ds.Configuration)
+	return nil
 }
 
 func (s *datasourceService) Delete(ctx context.Context, id string) error {
-	return s.repo.Delete(ctx, id)
+	if err := s.repo.Delete(ctx, id); err != nil {
+		return err
+	}
+	s.connector.Invalidate(id)
+	return nil
 }
 
 func (s *datasourceService) GetByID(ctx context.Context, id string) (*model.Datasource, error) {
-	return s.repo.GetByID(ctx, id)
+	ds, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return maskedDatasource(ds), nil
 }
 
 func (s *datasourceService) List(ctx context.Context) ([]*model.Datasource, error) {
-	return s.repo.List(ctx)
+	list, err := s.repo.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	masked := make([]*model.Datasource, len(list))
+	for i, ds := range list {
+		masked[i] = maskedDatasource(ds)
+	}
+	return masked, nil
 }
 
 // TestConnection 测试数据源连接（通过 ID）
@@ -73,12 +129,12 @@ func (s *datasourceService) TestConnection(ctx context.Context, id string) (*eng
 	}
 
 	// 使用连接器测试连接
-	return s.connector.TestConnection(ctx, ds.Configuration)
+	return s.connector.TestConnection(ctx, datasourceTarget(ds))
 }
 
 // TestConnectionByConfig 测试数据源连接（通过配置）
 func (s *datasourceService) TestConnectionByConfig(ctx context.Context, config string) (*engine.ConnectionTestResult, error) {
-	return s.connector.TestConnection(ctx, config)
+	return s.connector.TestConnection(ctx, &engine.QueryTarget{Configuration: config})
 }
 
 // GetDatabases 获取数据源的数据库列表
@@ -88,7 +144,7 @@ func (s *datasourceService) GetDatabases(ctx context.Context, id string) ([]stri
 		return nil, fmt.Errorf("datasource not found: %w", err)
 	}
 
-	return s.connector.GetDatabaseList(ctx, ds.Configuration)
+	return s.connector.GetDatabaseList(ctx, datasourceTarget(ds))
 }
 
 // GetTables 获取数据源的表列表
@@ -98,15 +154,29 @@ func (s *datasourceService) GetTables(ctx context.Context, id string, database s
 		return nil, fmt.Errorf("datasource not found: %w", err)
 	}
 
-	return s.connector.GetTableList(ctx, ds.Configuration, database)
+	return s.connector.GetTableList(ctx, datasourceTarget(ds), database)
 }
 
 // GetTableSchema 获取表结构
-func (s *datasourceService) GetTableSchema(ctx context.Context, id string, database, table string) ([]map[string]interface{}, error) {
+func (s *datasourceService) GetTableSchema(ctx context.Context, id string, database, table string) (*engine.TableInfo, error) {
 	ds, err := s.repo.GetByID(ctx, id)
 	if err != nil {
 		return nil, fmt.Errorf("datasource not found: %w", err)
 	}
 
-	return s.connector.GetTableSchema(ctx, ds.Configuration, database, table)
+	return s.connector.GetTableSchema(ctx, datasourceTarget(ds), database, table)
+}
+
+// PoolStats 获取数据源连接池的健康状态和统计信息
+func (s *datasourceService) PoolStats(ctx context.Context) []engine.PoolStats {
+	return s.connector.PoolStats(ctx)
+}
+
+// datasourceTarget 已保存数据源对应的连接目标
+func datasourceTarget(ds *model.Datasource) *engine.QueryTarget {
+	return &engine.QueryTarget{
+		DatasourceID:   ds.ID,
+		DatasourceType: ds.Type,
+		Configuration:  ds.Configuration,
+	}
 }
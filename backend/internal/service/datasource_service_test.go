@@ -76,7 +76,7 @@ func (m *MockDatasourceConnector) GetTableSchema(ctx context.Context, configJSON
 func TestDatasourceService_Create(t *testing.T) {
 	mockRepo := new(MockDatasourceRepo)
 	mockConnector := new(MockDatasourceConnector)
-	service := NewDatasourceService(mockRepo, mockConnector)
+	service := NewDatasourceService(mockRepo, mockConnector, nil)
 
 	ds := &model.Datasource{
 		Name:          "MySQL Test",
@@ -99,7 +99,7 @@ func TestDatasourceService_Create(t *testing.T) {
 func TestDatasourceService_Update(t *testing.T) {
 	mockRepo := new(MockDatasourceRepo)
 	mockConnector := new(MockDatasourceConnector)
-	service := NewDatasourceService(mockRepo, mockConnector)
+	service := NewDatasourceService(mockRepo, mockConnector, nil)
 
 	ds := &model.Datasource{
 		ID:            "ds123",
@@ -123,7 +123,7 @@ func TestDatasourceService_Update(t *testing.T) {
 func TestDatasourceService_Delete(t *testing.T) {
 	mockRepo := new(MockDatasourceRepo)
 	mockConnector := new(MockDatasourceConnector)
-	service := NewDatasourceService(mockRepo, mockConnector)
+	service := NewDatasourceService(mockRepo, mockConnector, nil)
 
 	mockRepo.On("Delete", mock.Anything, "ds123").Return(nil)
 
@@ -136,7 +136,7 @@ func TestDatasourceService_Delete(t *testing.T) {
 func TestDatasourceService_GetByID(t *testing.T) {
 	mockRepo := new(MockDatasourceRepo)
 	mockConnector := new(MockDatasourceConnector)
-	service := NewDatasourceService(mockRepo, mockConnector)
+	service := NewDatasourceService(mockRepo, mockConnector, nil)
 
 	expectedDS := &model.Datasource{
 		ID:   "ds123",
@@ -156,7 +156,7 @@ func TestDatasourceService_GetByID(t *testing.T) {
 func TestDatasourceService_List(t *testing.T) {
 	mockRepo := new(MockDatasourceRepo)
 	mockConnector := new(MockDatasourceConnector)
-	service := NewDatasourceService(mockRepo, mockConnector)
+	service := NewDatasourceService(mockRepo, mockConnector, nil)
 
 	expectedList := []*model.Datasource{
 		{ID: "ds1", Name: "MySQL", Type: "mysql"},
@@ -175,7 +175,7 @@ func TestDatasourceService_List(t *testing.T) {
 func TestDatasourceService_TestConnection(t *testing.T) {
 	mockRepo := new(MockDatasourceRepo)
 	mockConnector := new(MockDatasourceConnector)
-	service := NewDatasourceService(mockRepo, mockConnector)
+	service := NewDatasourceService(mockRepo, mockConnector, nil)
 
 	ds := &model.Datasource{
 		ID:            "ds123",
@@ -203,7 +203,7 @@ func TestDatasourceService_TestConnection(t *testing.T) {
 func TestDatasourceService_TestConnectionByConfig(t *testing.T) {
 	mockRepo := new(MockDatasourceRepo)
 	mockConnector := new(MockDatasourceConnector)
-	service := NewDatasourceService(mockRepo, mockConnector)
+	service := NewDatasourceService(mockRepo, mockConnector, nil)
 
 	config := `{"host":"localhost","port":3306,"username":"root"}`
 
@@ -225,7 +225,7 @@ func TestDatasourceService_TestConnectionByConfig(t *testing.T) {
 func TestDatasourceService_GetDatabases(t *testing.T) {
 	mockRepo := new(MockDatasourceRepo)
 	mockConnector := new(MockDatasourceConnector)
-	service := NewDatasourceService(mockRepo, mockConnector)
+	service := NewDatasourceService(mockRepo, mockConnector, nil)
 
 	ds := &model.Datasource{
 		ID:            "ds123",
@@ -249,7 +249,7 @@ func TestDatasourceService_GetDatabases(t *testing.T) {
 func TestDatasourceService_GetTables(t *testing.T) {
 	mockRepo := new(MockDatasourceRepo)
 	mockConnector := new(MockDatasourceConnector)
-	service := NewDatasourceService(mockRepo, mockConnector)
+	service := NewDatasourceService(mockRepo, mockConnector, nil)
 
 	ds := &model.Datasource{
 		ID:            "ds123",
@@ -273,7 +273,7 @@ func TestDatasourceService_GetTables(t *testing.T) {
 func TestDatasourceService_GetTableSchema(t *testing.T) {
 	mockRepo := new(MockDatasourceRepo)
 	mockConnector := new(MockDatasourceConnector)
-	service := NewDatasourceService(mockRepo, mockConnector)
+	service := NewDatasourceService(mockRepo, mockConnector, nil)
 
 	ds := &model.Datasource{
 		ID:            "ds123",
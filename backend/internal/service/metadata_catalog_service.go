@@ -0,0 +1,438 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"cozy-insight-backend/internal/engine"
+	"cozy-insight-backend/internal/model"
+	"cozy-insight-backend/internal/repository"
+	"cozy-insight-backend/pkg/logger"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// 快照状态
+const (
+	SnapshotStatusSuccess = "success"
+	SnapshotStatusFailed  = "failed"
+)
+
+// 元数据变更类型
+const (
+	ChangeTableAdded        = "table_added"
+	ChangeTableRemoved      = "table_removed"
+	ChangeColumnAdded       = "column_added"
+	ChangeColumnRemoved     = "column_removed"
+	ChangeColumnTypeChanged = "column_type_changed"
+)
+
+// Catalog 快照中保存的数据源元数据
+type Catalog struct {
+	Databases []string       `json:"databases"`
+	Tables    []CatalogTable `json:"tables"`
+}
+
+// CatalogTable 表及其字段
+type CatalogTable struct {
+	Name    string          `json:"name"`
+	Columns []CatalogColumn `json:"columns"`
+}
+
+// CatalogColumn 字段名和原始类型
+type CatalogColumn struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// ChangeImpact 元数据变更及受影响的数据集和图表
+type ChangeImpact struct {
+	*model.MetadataChange
+	Datasets []ImpactedDataset `json:"datasets"`
+	Charts   []ImpactedChart   `json:"charts"`
+}
+
+// ImpactedDataset 引用了变更字段的数据集
+type ImpactedDataset struct {
+	ID     string   `json:"id"`
+	Name   string   `json:"name"`
+	Fields []string `json:"fields"` // 受影响的数据集字段名
+}
+
+// ImpactedChart 引用了变更字段的图表
+type ImpactedChart struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	TableID string `json:"tableId"`
+}
+
+// CatalogRefreshResult 刷新结果
+type CatalogRefreshResult struct {
+	Snapshot *model.MetadataSnapshot `json:"snapshot"`
+	Changes  []*ChangeImpact         `json:"changes"`
+}
+
+type MetadataCatalogService interface {
+	// Refresh 采集数据源元数据生成快照,并与上一次成功的快照比较
+	Refresh(ctx context.Context, datasourceID string) (*CatalogRefreshResult, error)
+	// RefreshAll 刷新所有支持元数据采集的数据源
+	RefreshAll(ctx context.Context) error
+	// GetCatalog 数据源最近一次成功的快照
+	GetCatalog(ctx context.Context, datasourceID string) (*model.MetadataSnapshot, error)
+	ListSnapshots(ctx context.Context, datasourceID string, limit int) ([]*model.MetadataSnapshot, error)
+	// GetChanges 快照的变更及受影响的数据集和图表
+	GetChanges(ctx context.Context, snapshotID string) ([]*ChangeImpact, error)
+}
+
+type metadataCatalogService struct {
+	repo           repository.MetadataRepository
+	datasourceRepo repository.DatasourceRepository
+	datasetRepo    repository.DatasetRepository
+	chartRepo      repository.ChartRepository
+	connector      *engine.DatasourceConnector
+}
+
+func NewMetadataCatalogService(repo repository.MetadataRepository, datasourceRepo repository.DatasourceRepository, datasetRepo repository.DatasetRepository, chartRepo repository.ChartRepository, connector *engine.DatasourceConnector) MetadataCatalogService {
+	return &metadataCatalogService{
+		repo:           repo,
+		datasourceRepo: datasourceRepo,
+		datasetRepo:    datasetRepo,
+		chartRepo:      chartRepo,
+		connector:      connector,
+	}
+}
+
+func (s *metadataCatalogService) Refresh(ctx context.Context, datasourceID string) (*CatalogRefreshResult, error) {
+	ds, err := s.datasourceRepo.GetByID(ctx, datasourceID)
+	if err != nil {
+		return nil, fmt.Errorf("datasource not found: %w", err)
+	}
+	if !supportsCatalog(ds.Type) {
+		return nil, fmt.Errorf("metadata catalog is not supported for %s datasources", ds.Type)
+	}
+
+	snapshot := &model.MetadataSnapshot{ID: uuid.New().String(), DatasourceID: ds.ID}
+	catalog, err := s.collect(ctx, ds)
+	if err != nil {
+		// 采集失败也记录快照,便于排查
+		snapshot.Status = SnapshotStatusFailed
+		snapshot.Error = err.Error()
+		if saveErr := s.repo.CreateSnapshot(ctx, snapshot, nil); saveErr != nil {
+			logger.Log.Error("failed to save metadata snapshot", zap.String("datasourceId", ds.ID), zap.Error(saveErr))
+		}
+		return nil, fmt.Errorf("failed to collect metadata: %w", err)
+	}
+
+	previous, err := s.repo.LatestSnapshot(ctx, ds.ID)
+	if err != nil {
+		return nil, err
+	}
+	var changes []*model.MetadataChange
+	if previous != nil {
+		var old Catalog
+		if err := json.Unmarshal([]byte(previous.Catalog), &old); err != nil {
+			return nil, fmt.Errorf("invalid previous snapshot %s: %w", previous.ID, err)
+		}
+		changes = diffCatalog(&old, catalog)
+	}
+	for _, change := range changes {
+		change.ID = uuid.New().String()
+		change.SnapshotID = snapshot.ID
+		change.DatasourceID = ds.ID
+	}
+
+	data, err := json.Marshal(catalog)
+	if err != nil {
+		return nil, err
+	}
+	snapshot.Status = SnapshotStatusSuccess
+	snapshot.Catalog = string(data)
+	snapshot.TableCount = len(catalog.Tables)
+	for _, table := range catalog.Tables {
+		snapshot.ColumnCount += len(table.Columns)
+	}
+	snapshot.ChangeCount = len(changes)
+	if err := s.repo.CreateSnapshot(ctx, snapshot, changes); err != nil {
+		return nil, fmt.Errorf("failed to save metadata snapshot: %w", err)
+	}
+
+	impacts, err := s.analyzeImpact(ctx, ds.ID, changes)
+	if err != nil {
+		return nil, err
+	}
+	if len(changes) > 0 {
+		logger.Log.Info("metadata changes detected",
+			zap.String("datasourceId", ds.ID),
+			zap.Int("changes", len(changes)))
+	}
+	return &CatalogRefreshResult{Snapshot: snapshot, Changes: impacts}, nil
+}
+
+func (s *metadataCatalogService) RefreshAll(ctx context.Context) error {
+	list, err := s.datasourceRepo.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, ds := range list {
+		if !supportsCatalog(ds.Type) {
+			continue
+		}
+		if _, err := s.Refresh(ctx, ds.ID); err != nil {
+			logger.Log.Warn("metadata refresh failed", zap.String("datasourceId", ds.ID), zap.Error(err))
+			errs = append(errs, fmt.Errorf("datasource %s: %w", ds.ID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (s *metadataCatalogService) GetCatalog(ctx context.Context, datasourceID string) (*model.MetadataSnapshot, error) {
+	snapshot, err := s.repo.LatestSnapshot(ctx, datasourceID)
+	if err != nil {
+		return nil, err
+	}
+	if snapshot == nil {
+		return nil, fmt.Errorf("no metadata snapshot for datasource %s", datasourceID)
+	}
+	return snapshot, nil
+}
+
+func (s *metadataCatalogService) ListSnapshots(ctx context.Context, datasourceID string, limit int) ([]*model.MetadataSnapshot, error) {
+	return s.repo.ListSnapshots(ctx, datasourceID, limit)
+}
+
+func (s *metadataCatalogService) GetChanges(ctx context.Context, snapshotID string) ([]*ChangeImpact, error) {
+	snapshot, err := s.repo.GetSnapshot(ctx, snapshotID)
+	if err != nil {
+		return nil, fmt.Errorf("snapshot not found: %w", err)
+	}
+	changes, err := s.repo.ListChanges(ctx, snapshotID)
+	if err != nil {
+		return nil, err
+	}
+	return s.analyzeImpact(ctx, snapshot.DatasourceID, changes)
+}
+
+// collect 采集数据源默认数据库的表和字段
+func (s *metadataCatalogService) collect(ctx context.Context, ds *model.Datasource) (*Catalog, error) {
+	target := datasourceTarget(ds)
+
+	databases, err := s.connector.GetDatabaseList(ctx, target)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list databases: %w", err)
+	}
+	tables, err := s.connector.GetTableList(ctx, target, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tables: %w", err)
+	}
+
+	catalog := &Catalog{Databases: databases, Tables: make([]CatalogTable, 0, len(tables))}
+	for _, name := range tables {
+		schema, err := s.connector.GetTableSchema(ctx, target, "", name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get schema of table %s: %w", name, err)
+		}
+		table := CatalogTable{Name: name, Columns: make([]CatalogColumn, len(schema.Columns))}
+		for i, column := range schema.Columns {
+			table.Columns[i] = CatalogColumn{Name: column.Name, Type: column.NativeType}
+		}
+		catalog.Tables = append(catalog.Tables, table)
+	}
+	sort.Strings(catalog.Databases)
+	sort.Slice(catalog.Tables, func(i, j int) bool { return catalog.Tables[i].Name < catalog.Tables[j].Name })
+	return catalog, nil
+}
+
+// diffCatalog 比较两次快照,返回按表名、字段名排序的变更
+func diffCatalog(old, current *Catalog) []*model.MetadataChange {
+	oldTables := catalogIndex(old)
+	currentTables := catalogIndex(current)
+
+	var changes []*model.MetadataChange
+	for name, oldColumns := range oldTables {
+		columns, ok := currentTables[name]
+		if !ok {
+			changes = append(changes, &model.MetadataChange{ChangeType: ChangeTableRemoved, SourceTable: name})
+			continue
+		}
+		for column, oldType := range oldColumns {
+			newType, ok := columns[column]
+			switch {
+			case !ok:
+				changes = append(changes, &model.MetadataChange{ChangeType: ChangeColumnRemoved, SourceTable: name, ColumnName: column, OldType: oldType})
+			case !strings.EqualFold(newType, oldType):
+				changes = append(changes, &model.MetadataChange{ChangeType: ChangeColumnTypeChanged, SourceTable: name, ColumnName: column, OldType: oldType, NewType: newType})
+			}
+		}
+		for column, newType := range columns {
+			if _, ok := oldColumns[column]; !ok {
+				changes = append(changes, &model.MetadataChange{ChangeType: ChangeColumnAdded, SourceTable: name, ColumnName: column, NewType: newType})
+			}
+		}
+	}
+	for name := range currentTables {
+		if _, ok := oldTables[name]; !ok {
+			changes = append(changes, &model.MetadataChange{ChangeType: ChangeTableAdded, SourceTable: name})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].SourceTable != changes[j].SourceTable {
+			return changes[i].SourceTable < changes[j].SourceTable
+		}
+		return changes[i].ColumnName < changes[j].ColumnName
+	})
+	return changes
+}
+
+// catalogIndex 表名 -> 字段名 -> 类型
+func catalogIndex(catalog *Catalog) map[string]map[string]string {
+	index := make(map[string]map[string]string, len(catalog.Tables))
+	for _, table := range catalog.Tables {
+		columns := make(map[string]string, len(table.Columns))
+		for _, column := range table.Columns {
+			columns[column.Name] = column.Type
+		}
+		index[table.Name] = columns
+	}
+	return index
+}
+
+// breakingChange 是否为会导致数据集或图表失效的变更
+func breakingChange(changeType string) bool {
+	return changeType == ChangeTableRemoved || changeType == ChangeColumnRemoved || changeType == ChangeColumnTypeChanged
+}
+
+// analyzeImpact 找出引用被删除或类型变更的表、字段的数据集和图表
+func (s *metadataCatalogService) analyzeImpact(ctx context.Context, datasourceID string, changes []*model.MetadataChange) ([]*ChangeImpact, error) {
+	impacts := make([]*ChangeImpact, len(changes))
+	breaking := false
+	for i, change := range changes {
+		impacts[i] = &ChangeImpact{MetadataChange: change, Datasets: []ImpactedDataset{}, Charts: []ImpactedChart{}}
+		breaking = breaking || breakingChange(change.ChangeType)
+	}
+	if !breaking {
+		return impacts, nil
+	}
+
+	tables, err := s.datasetRepo.ListTables(ctx, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list datasets: %w", err)
+	}
+	charts, err := s.chartRepo.List(ctx, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list charts: %w", err)
+	}
+	chartsByTable := make(map[string][]*model.ChartView)
+	for _, chart := range charts {
+		chartsByTable[chart.TableID] = append(chartsByTable[chart.TableID], chart)
+	}
+
+	fieldCache := make(map[string][]*model.DatasetTableField)
+	for _, impact := range impacts {
+		if !breakingChange(impact.ChangeType) {
+			continue
+		}
+		for _, table := range tables {
+			if table.DatasourceID != datasourceID || !referencesTable(table, impact.SourceTable) {
+				continue
+			}
+
+			fields, ok := fieldCache[table.ID]
+			if !ok {
+				if fields, err = s.datasetRepo.GetFields(ctx, table.ID); err != nil {
+					return nil, fmt.Errorf("failed to get fields of dataset %s: %w", table.ID, err)
+				}
+				fieldCache[table.ID] = fields
+			}
+
+			// 删除表影响数据集的全部字段,字段变更只影响对应字段
+			var affected []*model.DatasetTableField
+			for _, field := range fields {
+				if impact.ChangeType == ChangeTableRemoved || field.OriginName == impact.ColumnName {
+					affected = append(affected, field)
+				}
+			}
+			if impact.ChangeType != ChangeTableRemoved && len(affected) == 0 {
+				continue
+			}
+
+			dataset := ImpactedDataset{ID: table.ID, Name: table.Name, Fields: []string{}}
+			for _, field := range affected {
+				dataset.Fields = append(dataset.Fields, field.Name)
+			}
+			impact.Datasets = append(impact.Datasets, dataset)
+
+			for _, chart := range chartsByTable[table.ID] {
+				if impact.ChangeType == ChangeTableRemoved || chartReferences(chart, affected) {
+					impact.Charts = append(impact.Charts, ImpactedChart{ID: chart.ID, Name: chart.Name, TableID: chart.TableID})
+				}
+			}
+		}
+	}
+	return impacts, nil
+}
+
+// referencesTable 数据集是否读取了指定的表,SQL 数据集按语句中出现的表名判断
+func referencesTable(table *model.DatasetTable, name string) bool {
+	if isExtractType(table) {
+		return false
+	}
+	source, err := buildDatasetSource(table, nil)
+	if err != nil {
+		return false
+	}
+	if source.SQL == "" {
+		return source.Table == name
+	}
+	pattern := `(?i)(^|[^\w$])["` + "`" + `]?` + regexp.QuoteMeta(name) + `["` + "`" + `]?($|[^\w$])`
+	matched, _ := regexp.MatchString(pattern, source.SQL)
+	return matched
+}
+
+// chartReferences 图表坐标轴是否引用了任一字段,引用方式与字段解析一致: 显示名、字段ID或原始列名
+func chartReferences(chart *model.ChartView, fields []*model.DatasetTableField) bool {
+	config, err := ParseChartConfig(chart)
+	if err != nil {
+		return false
+	}
+	for _, ref := range append(config.XAxis.Fields, config.YAxis.Fields...) {
+		for _, field := range fields {
+			if ref.Name == field.Name || ref.Name == field.ID || ref.Name == field.OriginName {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// supportsCatalog 是否支持采集元数据,API 数据源没有表结构
+func supportsCatalog(dsType string) bool {
+	return dsType != model.DatasourceTypeAPI
+}
+
+// NewMetadataRefreshHandler 定时刷新元数据目录,任务配置 {"datasourceId": "..."} 为空时刷新全部数据源
+func NewMetadataRefreshHandler(catalog MetadataCatalogService) TaskHandler {
+	return func(ctx context.Context, task *model.ScheduleTask) error {
+		var config struct {
+			DatasourceID string `json:"datasourceId"`
+		}
+		if task.Config != "" {
+			if err := json.Unmarshal([]byte(task.Config), &config); err != nil {
+				return fmt.Errorf("invalid task config: %w", err)
+			}
+		}
+		if config.DatasourceID == "" {
+			return catalog.RefreshAll(ctx)
+		}
+		_, err := catalog.Refresh(ctx, config.DatasourceID)
+		return err
+	}
+}
@@ -0,0 +1,178 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"cozy-insight-backend/internal/engine"
+	"cozy-insight-backend/internal/model"
+	"cozy-insight-backend/internal/repository"
+	"cozy-insight-backend/pkg/logger"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryMetadataRepo 内存元数据快照仓库
+type memoryMetadataRepo struct {
+	repository.MetadataRepository
+	snapshots []*model.MetadataSnapshot
+	changes   []*model.MetadataChange
+}
+
+func (r *memoryMetadataRepo) CreateSnapshot(ctx context.Context, snapshot *model.MetadataSnapshot, changes []*model.MetadataChange) error {
+	r.snapshots = append(r.snapshots, snapshot)
+	r.changes = append(r.changes, changes...)
+	return nil
+}
+
+func (r *memoryMetadataRepo) GetSnapshot(ctx context.Context, id string) (*model.MetadataSnapshot, error) {
+	for _, s := range r.snapshots {
+		if s.ID == id {
+			return s, nil
+		}
+	}
+	return nil, fmt.Errorf("snapshot %s not found", id)
+}
+
+func (r *memoryMetadataRepo) LatestSnapshot(ctx context.Context, datasourceID string) (*model.MetadataSnapshot, error) {
+	for i := len(r.snapshots) - 1; i >= 0; i-- {
+		if s := r.snapshots[i]; s.DatasourceID == datasourceID && s.Status == SnapshotStatusSuccess {
+			return s, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *memoryMetadataRepo) ListChanges(ctx context.Context, snapshotID string) ([]*model.MetadataChange, error) {
+	var list []*model.MetadataChange
+	for _, c := range r.changes {
+		if c.SnapshotID == snapshotID {
+			list = append(list, c)
+		}
+	}
+	return list, nil
+}
+
+func TestMetadataCatalog_DetectsBreakingChanges(t *testing.T) {
+	logger.InitLogger("error")
+	ctx := context.Background()
+
+	path := filepath.Join(t.TempDir(), "shop.db")
+	db, err := sql.Open("sqlite3", path)
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec(`CREATE TABLE sales (category TEXT, amount REAL, region TEXT); CREATE TABLE legacy (id INTEGER)`)
+	require.NoError(t, err)
+
+	table := &model.DatasetTable{ID: "table1", Name: "Sales", DatasourceID: "ds1", Type: DatasetTypeDB, PhysicalTableName: "sales"}
+	datasetRepo := &stubDatasetRepo{table: table, fields: []*model.DatasetTableField{
+		{ID: "f1", Name: "category", OriginName: "category"},
+		{ID: "f2", Name: "Amount", OriginName: "amount"},
+		{ID: "f3", Name: "region", OriginName: "region"},
+	}}
+	chartRepo := new(MockChartRepository)
+	chartRepo.On("List", mock.Anything, "").Return([]*model.ChartView{
+		{ID: "c1", Name: "By category", TableID: "table1", XAxis: `{"fields":[{"name":"category"}]}`, YAxis: `{"fields":[{"name":"Amount","aggregate":"SUM"}]}`},
+		{ID: "c2", Name: "By region", TableID: "table1", XAxis: `{"fields":[{"name":"f3"}]}`, YAxis: `{"fields":[{"name":"*","aggregate":"COUNT"}]}`},
+	}, nil)
+	dsRepo := &stubDatasourceRepo{items: map[string]*model.Datasource{
+		"ds1": {ID: "ds1", Type: "sqlite", Configuration: fmt.Sprintf(`{"path":%q}`, path)},
+	}}
+	metaRepo := &memoryMetadataRepo{}
+	svc := NewMetadataCatalogService(metaRepo, dsRepo, datasetRepo, chartRepo, engine.NewDatasourceConnector(nil, nil))
+
+	// 首次快照没有变更
+	first, err := svc.Refresh(ctx, "ds1")
+	require.NoError(t, err)
+	assert.Equal(t, SnapshotStatusSuccess, first.Snapshot.Status)
+	assert.Equal(t, 2, first.Snapshot.TableCount)
+	assert.Equal(t, 4, first.Snapshot.ColumnCount)
+	assert.Empty(t, first.Changes)
+
+	_, err = db.Exec(`ALTER TABLE sales DROP COLUMN region;
+		ALTER TABLE sales RENAME COLUMN amount TO amount_old;
+		ALTER TABLE sales ADD COLUMN amount INTEGER;
+		DROP TABLE legacy;
+		CREATE TABLE returns (id INTEGER)`)
+	require.NoError(t, err)
+
+	second, err := svc.Refresh(ctx, "ds1")
+	require.NoError(t, err)
+	assert.Equal(t, 5, second.Snapshot.ChangeCount)
+
+	byKey := make(map[string]*ChangeImpact)
+	for _, c := range second.Changes {
+		byKey[c.ChangeType+":"+c.SourceTable+"."+c.ColumnName] = c
+	}
+	require.Contains(t, byKey, ChangeTableRemoved+":legacy.")
+	require.Contains(t, byKey, ChangeTableAdded+":returns.")
+	require.Contains(t, byKey, ChangeColumnAdded+":sales.amount_old")
+
+	retyped := byKey[ChangeColumnTypeChanged+":sales.amount"]
+	require.NotNil(t, retyped)
+	assert.Equal(t, "REAL", retyped.OldType)
+	assert.Equal(t, "INTEGER", retyped.NewType)
+	require.Len(t, retyped.Datasets, 1)
+	assert.Equal(t, []string{"Amount"}, retyped.Datasets[0].Fields)
+	require.Len(t, retyped.Charts, 1)
+	assert.Equal(t, "c1", retyped.Charts[0].ID)
+
+	removed := byKey[ChangeColumnRemoved+":sales.region"]
+	require.NotNil(t, removed)
+	require.Len(t, removed.Charts, 1)
+	assert.Equal(t, "c2", removed.Charts[0].ID, "charts referencing the field by id are flagged")
+
+	// 未被引用的表删除不影响数据集
+	assert.Empty(t, byKey[ChangeTableRemoved+":legacy."].Datasets)
+
+	// 通过快照 ID 读取变更时重新分析影响
+	changes, err := svc.GetChanges(ctx, second.Snapshot.ID)
+	require.NoError(t, err)
+	assert.Len(t, changes, 5)
+
+	latest, err := svc.GetCatalog(ctx, "ds1")
+	require.NoError(t, err)
+	assert.Equal(t, second.Snapshot.ID, latest.ID)
+}
+
+func TestMetadataCatalog_FailedRefreshKeepsBaseline(t *testing.T) {
+	logger.InitLogger("error")
+	ctx := context.Background()
+	dsRepo := &stubDatasourceRepo{items: map[string]*model.Datasource{
+		"ds1": {ID: "ds1", Type: "sqlite", Configuration: `{"path":"/nonexistent/shop.db"}`},
+		"api": {ID: "api", Type: model.DatasourceTypeAPI, Configuration: `{"url":"http://example.com"}`},
+	}}
+	metaRepo := &memoryMetadataRepo{}
+	svc := NewMetadataCatalogService(metaRepo, dsRepo, &stubDatasetRepo{}, new(MockChartRepository), engine.NewDatasourceConnector(nil, nil))
+
+	_, err := svc.Refresh(ctx, "ds1")
+	assert.Error(t, err)
+	require.Len(t, metaRepo.snapshots, 1)
+	assert.Equal(t, SnapshotStatusFailed, metaRepo.snapshots[0].Status)
+	assert.NotEmpty(t, metaRepo.snapshots[0].Error)
+
+	_, err = svc.GetCatalog(ctx, "ds1")
+	assert.Error(t, err)
+
+	_, err = svc.Refresh(ctx, "api")
+	assert.Error(t, err)
+}
+
+func TestDiffCatalog_TypeComparisonIgnoresCase(t *testing.T) {
+	old := &Catalog{Tables: []CatalogTable{{Name: "t", Columns: []CatalogColumn{{Name: "a", Type: "int"}}}}}
+	current := &Catalog{Tables: []CatalogTable{{Name: "t", Columns: []CatalogColumn{{Name: "a", Type: "INT"}}}}}
+	assert.Empty(t, diffCatalog(old, current))
+}
+
+func TestReferencesTable_SQLDataset(t *testing.T) {
+	sqlTable := &model.DatasetTable{Type: DatasetTypeSQL, Info: `{"sql":"SELECT * FROM \"orders\" o JOIN order_items i ON o.id = i.order_id"}`}
+	assert.True(t, referencesTable(sqlTable, "orders"))
+	assert.True(t, referencesTable(sqlTable, "order_items"))
+	assert.False(t, referencesTable(sqlTable, "order"))
+	assert.False(t, referencesTable(&model.DatasetTable{Type: DatasetTypeExcel, PhysicalTableName: "orders"}, "orders"))
+}
@@ -10,6 +10,9 @@ import (
 	"github.com/google/uuid"
 )
 
+// AdminRoleName 系统管理员角色名,与 init.sql 中预置的角色一致
+const AdminRoleName = "Admin"
+
 type PermissionService interface {
 	Create(ctx context.Context, permission *model.Permission) error
 	Delete(ctx context.Context, id string) error
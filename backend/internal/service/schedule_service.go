@@ -4,13 +4,27 @@ import (
 	"context"
 	"cozy-insight-backend/internal/model"
 	"cozy-insight-backend/internal/repository"
+	"cozy-insight-backend/pkg/logger"
+	"encoding/json"
 	"fmt"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/robfig/cron/v3"
+	"go.uber.org/zap"
 )
 
+// 定时任务类型
+const (
+	TaskTypeEmailReport     = "email_report"
+	TaskTypeSnapshot        = "snapshot"
+	TaskTypeDataSync        = "data_sync"
+	TaskTypeMetadataRefresh = "metadata_refresh" // 刷新数据源元数据目录
+)
+
+// TaskHandler 定时任务执行函数
+type TaskHandler func(ctx context.Context, task *model.ScheduleTask) error
+
 type ScheduleService interface {
 	CreateTask(ctx context.Context, task *model.ScheduleTask) error
 	UpdateTask(ctx context.Context, task *model.ScheduleTask) error
@@ -21,22 +35,27 @@ type ScheduleService interface {
 	EnableTask(ctx context.Context, id string) error
 	DisableTask(ctx context.Context, id string) error
 	ExecuteTask(ctx context.Context, id string) error
+
+	// RegisterHandler 注册某类任务的执行函数
+	RegisterHandler(taskType string, handler TaskHandler)
 	
 	Start() error
 	Stop()
 }
 
 type scheduleService struct {
-	repo   repository.ScheduleRepository
-	cron   *cron.Cron
-	jobs   map[string]cron.EntryID
+	repo     repository.ScheduleRepository
+	cron     *cron.Cron
+	jobs     map[string]cron.EntryID
+	handlers map[string]TaskHandler
 }
 
 func NewScheduleService(repo repository.ScheduleRepository) ScheduleService {
 	return &scheduleService{
-		repo:   repo,
-		cron:   cron.New(),
-		jobs:   make(map[string]cron.EntryID),
+		repo:     repo,
+		cron:     cron.New(),
+		jobs:     make(map[string]cron.EntryID),
+		handlers: make(map[string]TaskHandler),
 	}
 }
 
@@ -163,11 +182,61 @@ func (s *scheduleService) ExecuteTask(ctx context.Context, id string) error {
 	task.Status = "running"
 	s.repo.Update(ctx, task)
 
-	// TODO: 根据task.Type执行不同的任务
-	// 例如: 发送邮件报告、生成快照等
+	// 根据task.Type执行已注册的任务
+	var runErr error
+	if handler, ok := s.handlers[task.Type]; ok {
+		runErr = handler(ctx, task)
+	} else {
+		logger.Log.Warn("no handler registered for schedule task type", zap.String("task", task.ID), zap.String("type", task.Type))
+	}
+	if runErr != nil {
+		logger.Log.Error("schedule task failed", zap.String("task", task.ID), zap.String("type", task.Type), zap.Error(runErr))
+	}
 
 	task.Status = "active"
-	return s.repo.Update(ctx, task)
+	if err := s.repo.Update(ctx, task); err != nil {
+		return err
+	}
+	return runErr
+}
+
+func (s *scheduleService) RegisterHandler(taskType string, handler TaskHandler) {
+	s.handlers[taskType] = handler
+}
+
+// dataSyncConfig 数据同步任务配置
+type dataSyncConfig struct {
+	DatasetTableID   string `json:"datasetTableId"`
+	SyncType         string `json:"syncType"` // all_scope, incremental,API 数据集忽略
+	IncrementalField string `json:"incrementalField"`
+	IncrementalSQL   string `json:"incrementalSql"`
+}
+
+// NewDataSyncHandler 数据同步任务: API 数据集重新抽取,其余数据集同步到抽取库
+func NewDataSyncHandler(datasets DatasetService) TaskHandler {
+	return func(ctx context.Context, task *model.ScheduleTask) error {
+		var config dataSyncConfig
+		if err := json.Unmarshal([]byte(task.Config), &config); err != nil {
+			return fmt.Errorf("invalid task config: %w", err)
+		}
+		if config.DatasetTableID == "" {
+			return fmt.Errorf("datasetTableId is required")
+		}
+		table, err := datasets.GetTable(ctx, config.DatasetTableID)
+		if err != nil {
+			return fmt.Errorf("table not found: %w", err)
+		}
+		if table.Type == DatasetTypeAPI {
+			_, err := datasets.ExtractTable(ctx, config.DatasetTableID)
+			return err
+		}
+		_, err = datasets.SyncTable(ctx, config.DatasetTableID, &SyncRequest{
+			Type:             config.SyncType,
+			IncrementalField: config.IncrementalField,
+			IncrementalSQL:   config.IncrementalSQL,
+		})
+		return err
+	}
 }
 
 func (s *scheduleService) Start() error {
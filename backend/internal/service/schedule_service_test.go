@@ -0,0 +1,116 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"cozy-insight-backend/internal/model"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memScheduleRepo 内存中的定时任务仓库
+type memScheduleRepo struct {
+	mu    sync.Mutex
+	tasks map[string]*model.ScheduleTask
+}
+
+func (r *memScheduleRepo) Create(ctx context.Context, task *model.ScheduleTask) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	copied := *task
+	r.tasks[task.ID] = &copied
+	return nil
+}
+
+func (r *memScheduleRepo) Update(ctx context.Context, task *model.ScheduleTask) error {
+	return r.Create(ctx, task)
+}
+
+func (r *memScheduleRepo) Delete(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.tasks, id)
+	return nil
+}
+
+func (r *memScheduleRepo) Get(ctx context.Context, id string) (*model.ScheduleTask, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	task, ok := r.tasks[id]
+	if !ok {
+		return nil, fmt.Errorf("task %s not found", id)
+	}
+	copied := *task
+	return &copied, nil
+}
+
+func (r *memScheduleRepo) List(ctx context.Context) ([]*model.ScheduleTask, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var tasks []*model.ScheduleTask
+	for _, task := range r.tasks {
+		copied := *task
+		tasks = append(tasks, &copied)
+	}
+	return tasks, nil
+}
+
+func TestScheduleService_RunsDataSyncTask(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "source.db")
+	db, err := sql.Open("sqlite3", path)
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec(`CREATE TABLE orders (id INTEGER, region TEXT)`)
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO orders VALUES (1, 'east'), (2, 'west')`)
+	require.NoError(t, err)
+
+	datasets, repo := newUploadTestService(t)
+	datasets.datasourceRepo = &stubDatasourceRepo{items: map[string]*model.Datasource{
+		"ds1": {ID: "ds1", Type: "sqlite", Configuration: fmt.Sprintf(`{"path":%q}`, path)},
+	}}
+	table := &model.DatasetTable{ID: "t-1", Name: "orders", DatasourceID: "ds1", Type: DatasetTypeDB, PhysicalTableName: "orders"}
+	repo.tables[table.ID] = table
+	repo.fields[table.ID] = []*model.DatasetTableField{
+		{ID: "f1", OriginName: "id", DeType: 2},
+		{ID: "f2", OriginName: "region", DeType: 0},
+	}
+
+	// 由调度器按 cron 触发已注册的 data_sync 任务
+	scheduler := NewScheduleService(&memScheduleRepo{tasks: map[string]*model.ScheduleTask{
+		"s1": {ID: "s1", Name: "sync orders", Type: TaskTypeDataSync, CronExpr: "@every 1s", Enabled: true,
+			Config: `{"datasetTableId":"t-1","syncType":"all_scope"}`},
+	}})
+	runs := make(chan error, 1)
+	dataSync := NewDataSyncHandler(datasets)
+	scheduler.RegisterHandler(TaskTypeDataSync, func(ctx context.Context, task *model.ScheduleTask) error {
+		err := dataSync(ctx, task)
+		select {
+		case runs <- err:
+		default:
+		}
+		return err
+	})
+	require.NoError(t, scheduler.Start())
+	defer scheduler.Stop()
+
+	select {
+	case err := <-runs:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("data_sync task did not run")
+	}
+	scheduler.Stop()
+
+	tasks, err := datasets.ListSyncTasks(context.Background(), table.ID)
+	require.NoError(t, err)
+	require.NotEmpty(t, tasks)
+	assert.Equal(t, SyncStatusSuccess, tasks[0].Status)
+}
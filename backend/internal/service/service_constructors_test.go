@@ -62,13 +62,14 @@ func TestServiceConstructors(t *testing.T) {
 			MaxOpenConns: 10,
 		}
 		calciteClient, _ := engine.NewCalciteClient(cfg, nil)
-		svc := service.NewDatasetService(datasetRepo, calciteClient)
+		router := engine.NewQueryRouter(engine.NewCalciteExecutor(calciteClient))
+		svc := service.NewDatasetService(datasetRepo, datasourceRepo, router, nil, nil)
 		assert.NotNil(t, svc)
 	})
 
 	t.Run("DatasourceService", func(t *testing.T) {
-		connector := engine.NewDatasourceConnector()
-		svc := service.NewDatasourceService(datasourceRepo, connector)
+		connector := engine.NewDatasourceConnector(nil, nil)
+		svc := service.NewDatasourceService(datasourceRepo, connector, nil)
 		assert.NotNil(t, svc)
 	})
 
@@ -0,0 +1,93 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// MemoryCache 进程内缓存,未部署 Redis 时使用
+// 条目数达到上限时先清理过期条目,仍然已满则淘汰最早过期的条目
+type MemoryCache struct {
+	mu         sync.Mutex
+	items      map[string]memoryItem
+	maxEntries int
+}
+
+type memoryItem struct {
+	value    interface{}
+	expireAt time.Time // 零值表示不过期
+}
+
+// NewMemoryCache 创建进程内缓存,maxEntries 不大于0时不限制条目数
+func NewMemoryCache(maxEntries int) *MemoryCache {
+	return &MemoryCache{
+		items:      make(map[string]memoryItem),
+		maxEntries: maxEntries,
+	}
+}
+
+// Get 获取缓存
+func (c *MemoryCache) Get(ctx context.Context, key string) (interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	item, ok := c.items[key]
+	if !ok {
+		return nil, fmt.Errorf("key not found: %s", key)
+	}
+	if item.expired(time.Now()) {
+		delete(c.items, key)
+		return nil, fmt.Errorf("key not found: %s", key)
+	}
+	return item.value, nil
+}
+
+// Set 设置缓存,ttl 不大于0时不过期
+func (c *MemoryCache) Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	item := memoryItem{value: value}
+	if ttl > 0 {
+		item.expireAt = time.Now().Add(ttl)
+	}
+	if _, ok := c.items[key]; !ok && c.maxEntries > 0 && len(c.items) >= c.maxEntries {
+		c.evict()
+	}
+	c.items[key] = item
+	return nil
+}
+
+// Delete 删除缓存
+func (c *MemoryCache) Delete(ctx context.Context, key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.items, key)
+	return nil
+}
+
+// evict 清理过期条目,没有过期条目时淘汰最早过期的一条
+func (c *MemoryCache) evict() {
+	now := time.Now()
+	var oldest string
+	var oldestAt time.Time
+	for key, item := range c.items {
+		if item.expired(now) {
+			delete(c.items, key)
+			continue
+		}
+		if oldest == "" || (!item.expireAt.IsZero() && (oldestAt.IsZero() || item.expireAt.Before(oldestAt))) {
+			oldest, oldestAt = key, item.expireAt
+		}
+	}
+	if len(c.items) >= c.maxEntries {
+		delete(c.items, oldest)
+	}
+}
+
+func (i memoryItem) expired(now time.Time) bool {
+	return !i.expireAt.IsZero() && now.After(i.expireAt)
+}
@@ -0,0 +1,42 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryCache(t *testing.T) {
+	cache := NewMemoryCache(2)
+	ctx := context.Background()
+
+	require.NoError(t, cache.Set(ctx, "a", "1", time.Minute))
+	val, err := cache.Get(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, "1", val)
+
+	// 过期后读取不到
+	require.NoError(t, cache.Set(ctx, "b", "2", time.Millisecond))
+	time.Sleep(5 * time.Millisecond)
+	_, err = cache.Get(ctx, "b")
+	assert.Error(t, err)
+
+	// 已满时先清理过期条目,再淘汰最早过期的条目
+	require.NoError(t, cache.Set(ctx, "b", "2", time.Millisecond))
+	time.Sleep(5 * time.Millisecond)
+	require.NoError(t, cache.Set(ctx, "c", "3", time.Hour))
+	_, err = cache.Get(ctx, "a")
+	assert.NoError(t, err)
+	require.NoError(t, cache.Set(ctx, "d", "4", time.Hour))
+	_, err = cache.Get(ctx, "a")
+	assert.Error(t, err)
+	_, err = cache.Get(ctx, "c")
+	assert.NoError(t, err)
+
+	require.NoError(t, cache.Delete(ctx, "c"))
+	_, err = cache.Get(ctx, "c")
+	assert.Error(t, err)
+}
@@ -8,12 +8,17 @@ import (
 )
 
 type Config struct {
-	Server   ServerConfig   `mapstructure:"server"`
-	Database DatabaseConfig `mapstructure:"database"`
-	Calcite  CalciteConfig  `mapstructure:"calcite"`
-	Redis    RedisConfig    `mapstructure:"redis"`
-	Logger   LoggerConfig   `mapstructure:"logger"`
-	JWT      JWTConfig      `mapstructure:"jwt"`
+	Server    ServerConfig    `mapstructure:"server"`
+	Database  DatabaseConfig  `mapstructure:"database"`
+	Calcite   CalciteConfig   `mapstructure:"calcite"`
+	Pool      PoolConfig      `mapstructure:"datasource_pool"`
+	Extract   ExtractConfig   `mapstructure:"extract"`
+	SQLite    SQLiteConfig    `mapstructure:"sqlite"`
+	Dashboard DashboardConfig `mapstructure:"dashboard"`
+	Redis     RedisConfig     `mapstructure:"redis"`
+	Logger    LoggerConfig    `mapstructure:"logger"`
+	JWT       JWTConfig       `mapstructure:"jwt"`
+	Security  SecurityConfig  `mapstructure:"security"`
 }
 
 type ServerConfig struct {
@@ -40,6 +45,30 @@ type CalciteConfig struct {
 	ConnMaxLifetime time.Duration `mapstructure:"conn_max_lifetime"`
 }
 
+// PoolConfig 数据源连接池配置
+type PoolConfig struct {
+	MaxOpenConns    int           `mapstructure:"max_open_conns"`
+	MaxIdleConns    int           `mapstructure:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `mapstructure:"conn_max_lifetime"`
+	IdleTimeout     time.Duration `mapstructure:"idle_timeout"`
+}
+
+// ExtractConfig 抽取库配置
+type ExtractConfig struct {
+	Path string `mapstructure:"path"`
+}
+
+// SQLiteConfig SQLite 数据源配置
+type SQLiteConfig struct {
+	DataDir string `mapstructure:"data_dir"` // SQLite 数据源文件只能位于该目录内
+}
+
+// DashboardConfig 仪表板批量查询配置
+type DashboardConfig struct {
+	QueryWorkers int           `mapstructure:"query_workers"` // 同时执行的组件查询数
+	QueryTimeout time.Duration `mapstructure:"query_timeout"` // 单个组件查询的超时时间
+}
+
 type RedisConfig struct {
 	Host     string `mapstructure:"host"`
 	Port     int    `mapstructure:"port"`
@@ -59,6 +88,12 @@ type JWTConfig struct {
 	Secret string `mapstructure:"secret"`
 }
 
+// SecurityConfig 数据源凭据加密配置
+type SecurityConfig struct {
+	MasterKeys map[string]string `mapstructure:"master_keys"` // 主密钥ID -> base64 编码的 32 字节密钥
+	ActiveKey  string            `mapstructure:"active_key"`  // 加密使用的主密钥ID
+}
+
 var GlobalConfig *Config
 
 func LoadConfig(path string) (*Config, error) {
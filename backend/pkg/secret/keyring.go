@@ -0,0 +1,181 @@
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// EncryptedPrefix 加密值前缀, 格式: enc:v1:<主密钥ID>:<加密的数据密钥>:<加密的数据>
+const EncryptedPrefix = "enc:v1:"
+
+// ErrNoKey 未配置主密钥
+var ErrNoKey = errors.New("no master key configured")
+
+// Keyring 主密钥环,使用信封加密: 每个值使用随机数据密钥 AES-256-GCM 加密,
+// 数据密钥再由当前主密钥加密后与密文一起保存。保留旧主密钥用于解密和密钥轮换
+type Keyring struct {
+	active string
+	keys   map[string][]byte
+}
+
+// NewKeyring 创建密钥环, keys 为主密钥ID到 base64 编码的 32 字节密钥, active 为加密使用的主密钥ID
+func NewKeyring(keys map[string]string, active string) (*Keyring, error) {
+	k := &Keyring{active: active, keys: make(map[string][]byte, len(keys))}
+	for id, encoded := range keys {
+		if id == "" || strings.Contains(id, ":") {
+			return nil, fmt.Errorf("invalid master key id: %q", id)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("master key %s is not valid base64: %w", id, err)
+		}
+		if len(key) != 32 {
+			return nil, fmt.Errorf("master key %s must be 32 bytes, got %d", id, len(key))
+		}
+		k.keys[id] = key
+	}
+
+	if active == "" && len(k.keys) > 0 {
+		return nil, fmt.Errorf("active master key is required")
+	}
+	if active != "" {
+		if _, ok := k.keys[active]; !ok {
+			return nil, fmt.Errorf("active master key %s not found", active)
+		}
+	}
+	return k, nil
+}
+
+// Enabled 是否配置了用于加密的主密钥
+func (k *Keyring) Enabled() bool {
+	return k != nil && k.active != ""
+}
+
+// ActiveKeyID 当前主密钥ID
+func (k *Keyring) ActiveKeyID() string {
+	if k == nil {
+		return ""
+	}
+	return k.active
+}
+
+// Encrypt 使用当前主密钥加密
+func (k *Keyring) Encrypt(plaintext string) (string, error) {
+	if !k.Enabled() {
+		return "", ErrNoKey
+	}
+
+	dek := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, dek); err != nil {
+		return "", fmt.Errorf("failed to generate data key: %w", err)
+	}
+	wrapped, err := seal(k.keys[k.active], dek)
+	if err != nil {
+		return "", err
+	}
+	data, err := seal(dek, []byte(plaintext))
+	if err != nil {
+		return "", err
+	}
+
+	return EncryptedPrefix + k.active + ":" +
+		base64.StdEncoding.EncodeToString(wrapped) + ":" +
+		base64.StdEncoding.EncodeToString(data), nil
+}
+
+// Decrypt 解密 Encrypt 的结果,未加密的值原样返回
+func (k *Keyring) Decrypt(value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+
+	keyID, wrapped, data, err := parseEncrypted(value)
+	if err != nil {
+		return "", err
+	}
+	if k == nil {
+		return "", ErrNoKey
+	}
+	master, ok := k.keys[keyID]
+	if !ok {
+		return "", fmt.Errorf("master key %s not found", keyID)
+	}
+
+	dek, err := open(master, wrapped)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt data key: %w", err)
+	}
+	plaintext, err := open(dek, data)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt value: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+// NeedsRotation 值未加密或不是由当前主密钥加密时返回 true
+func (k *Keyring) NeedsRotation(value string) bool {
+	if !IsEncrypted(value) {
+		return true
+	}
+	keyID, _, _, err := parseEncrypted(value)
+	return err != nil || keyID != k.ActiveKeyID()
+}
+
+// IsEncrypted 是否为加密值
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, EncryptedPrefix)
+}
+
+func parseEncrypted(value string) (keyID string, wrapped, data []byte, err error) {
+	parts := strings.Split(strings.TrimPrefix(value, EncryptedPrefix), ":")
+	if len(parts) != 3 {
+		return "", nil, nil, fmt.Errorf("malformed encrypted value")
+	}
+	if wrapped, err = base64.StdEncoding.DecodeString(parts[1]); err != nil {
+		return "", nil, nil, fmt.Errorf("malformed encrypted value: %w", err)
+	}
+	if data, err = base64.StdEncoding.DecodeString(parts[2]); err != nil {
+		return "", nil, nil, fmt.Errorf("malformed encrypted value: %w", err)
+	}
+	return parts[0], wrapped, data, nil
+}
+
+// seal AES-GCM 加密,随机 nonce 置于密文前
+func seal(key, plaintext []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// open AES-GCM 解密
+func open(key, ciphertext []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < gcm.NonceSize() {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+	nonce, data := ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, data, nil)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
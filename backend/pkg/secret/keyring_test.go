@@ -0,0 +1,86 @@
+package secret
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testKey(b byte) string {
+	return base64.StdEncoding.EncodeToString([]byte(strings.Repeat(string(b), 32)))
+}
+
+func TestKeyring_EncryptDecrypt(t *testing.T) {
+	k, err := NewKeyring(map[string]string{"k1": testKey('a')}, "k1")
+	require.NoError(t, err)
+
+	enc, err := k.Encrypt("s3cret")
+	require.NoError(t, err)
+	assert.True(t, IsEncrypted(enc))
+	assert.True(t, strings.HasPrefix(enc, "enc:v1:k1:"))
+	assert.NotContains(t, enc, "s3cret")
+
+	// 每次加密使用新的数据密钥和 nonce
+	enc2, err := k.Encrypt("s3cret")
+	require.NoError(t, err)
+	assert.NotEqual(t, enc, enc2)
+
+	plain, err := k.Decrypt(enc)
+	require.NoError(t, err)
+	assert.Equal(t, "s3cret", plain)
+
+	// 未加密的值原样返回
+	plain, err = k.Decrypt("plain")
+	require.NoError(t, err)
+	assert.Equal(t, "plain", plain)
+}
+
+func TestKeyring_Rotation(t *testing.T) {
+	old, err := NewKeyring(map[string]string{"k1": testKey('a')}, "k1")
+	require.NoError(t, err)
+	enc, err := old.Encrypt("pw")
+	require.NoError(t, err)
+
+	rotated, err := NewKeyring(map[string]string{"k1": testKey('a'), "k2": testKey('b')}, "k2")
+	require.NoError(t, err)
+	assert.True(t, rotated.NeedsRotation(enc))
+	assert.True(t, rotated.NeedsRotation("plain"))
+
+	plain, err := rotated.Decrypt(enc)
+	require.NoError(t, err)
+	reenc, err := rotated.Encrypt(plain)
+	require.NoError(t, err)
+	assert.False(t, rotated.NeedsRotation(reenc))
+
+	// 移除旧密钥后无法解密旧值
+	onlyNew, err := NewKeyring(map[string]string{"k2": testKey('b')}, "k2")
+	require.NoError(t, err)
+	_, err = onlyNew.Decrypt(enc)
+	assert.Error(t, err)
+}
+
+func TestKeyring_Errors(t *testing.T) {
+	_, err := NewKeyring(map[string]string{"k1": "short"}, "k1")
+	assert.Error(t, err)
+
+	_, err = NewKeyring(map[string]string{"k1": testKey('a')}, "missing")
+	assert.Error(t, err)
+
+	_, err = NewKeyring(map[string]string{"a:b": testKey('a')}, "a:b")
+	assert.Error(t, err)
+
+	var empty *Keyring
+	assert.False(t, empty.Enabled())
+	_, err = empty.Encrypt("x")
+	assert.ErrorIs(t, err, ErrNoKey)
+
+	k, err := NewKeyring(map[string]string{"k1": testKey('a')}, "k1")
+	require.NoError(t, err)
+	enc, err := k.Encrypt("x")
+	require.NoError(t, err)
+	_, err = k.Decrypt(enc[:len(enc)-4] + "AAAA")
+	assert.Error(t, err)
+}
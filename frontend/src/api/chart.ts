@@ -1,5 +1,5 @@
 import request from './request';
-import type { ChartView, CreateChartRequest, UpdateChartRequest, ChartListParams } from '../types/chart';
+import type { ChartView, CreateChartRequest, UpdateChartRequest, ChartListParams, ChartDataResult, ChartQueryFilter } from '../types/chart';
 
 /**
  * Chart API 接口封装
@@ -44,7 +44,14 @@ export const chartAPI = {
      * 获取图表数据
      */
     getData: (id: string) => {
-        return request.get<any[]>(`/chart/${id}/data`);
+        return request.get<any, ChartDataResult>(`/chart/${id}/data`);
+    },
+
+    /**
+     * 按过滤条件和 SQL 数据集变量获取图表数据
+     */
+    queryData: (id: string, filter: ChartQueryFilter) => {
+        return request.post<any, ChartDataResult>(`/chart/${id}/data`, filter);
     },
 };
 
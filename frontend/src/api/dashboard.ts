@@ -1,5 +1,5 @@
 import request from './request';
-import type { Dashboard, CreateDashboardRequest, UpdateDashboardRequest, DashboardListParams } from '../types/dashboard';
+import type { Dashboard, CreateDashboardRequest, UpdateDashboardRequest, DashboardListParams, LinkageEvent, LinkageResult, DashboardDataParams, DashboardDataResult, DashboardParameter, SaveDashboardParameterRequest } from '../types/dashboard';
 
 /**
  * Dashboard API 接口封装
@@ -39,6 +39,68 @@ export const dashboardAPI = {
     list: (params?: DashboardListParams) => {
         return request.get<any, Dashboard[]>('/dashboard', { params });
     },
+
+    /**
+     * 批量获取所有图表组件的数据,单个组件失败时在该组件上返回 error
+     */
+    getData: (id: string, data: DashboardDataParams = {}) => {
+        const params: Record<string, any> = {};
+        Object.entries(data.parameters || {}).forEach(([name, value]) => {
+            params[`params[${name}]`] = value;
+        });
+        Object.entries(data.variables || {}).forEach(([name, value]) => {
+            params[`vars[${name}]`] = value;
+        });
+        if (data.filters) {
+            params.filters = JSON.stringify(data.filters);
+        }
+        return request.get<any, DashboardDataResult>(`/dashboard/${id}/data`, {
+            params,
+            paramsSerializer: { indexes: null },
+        });
+    },
+
+    /**
+     * 获取仪表板参数
+     */
+    listParameters: (id: string) => {
+        return request.get<any, DashboardParameter[]>(`/dashboard/${id}/parameters`);
+    },
+
+    /**
+     * 创建仪表板参数
+     */
+    createParameter: (id: string, data: SaveDashboardParameterRequest) => {
+        return request.post<any, DashboardParameter>(`/dashboard/${id}/parameters`, data);
+    },
+
+    /**
+     * 更新仪表板参数
+     */
+    updateParameter: (id: string, paramId: string, data: Partial<SaveDashboardParameterRequest>) => {
+        return request.put<any, DashboardParameter>(`/dashboard/${id}/parameters/${paramId}`, data);
+    },
+
+    /**
+     * 删除仪表板参数
+     */
+    deleteParameter: (id: string, paramId: string) => {
+        return request.delete<any, void>(`/dashboard/${id}/parameters/${paramId}`);
+    },
+
+    /**
+     * 获取下拉参数的可选值
+     */
+    parameterOptions: (id: string, paramId: string) => {
+        return request.get<any, (string | number)[]>(`/dashboard/${id}/parameters/${paramId}/options`);
+    },
+
+    /**
+     * 触发组件联动,返回受影响组件刷新后的数据
+     */
+    linkage: (id: string, event: LinkageEvent) => {
+        return request.post<any, LinkageResult>(`/dashboard/${id}/linkage`, event);
+    },
 };
 
 export default dashboardAPI;
@@ -1,5 +1,5 @@
 import request from './request';
-import type { DatasetGroup, DatasetTable, CreateGroupRequest, CreateTableRequest } from '../types/dataset';
+import type { DatasetGroup, DatasetTable, DatasetTableUnion, DatasetTableTask, SyncRequest, CreateGroupRequest, CreateTableRequest, FieldValuesParams, FieldValuesResult } from '../types/dataset';
 
 export const datasetAPI = {
     listGroups: () => {
@@ -21,6 +21,51 @@ export const datasetAPI = {
     previewTable: (id: string) => {
         return request.post<any, any[]>(`/dataset/table/${id}/preview`);
     },
+
+    /**
+     * 上传 CSV/Excel 文件; 传入 tableId 时重新上传, editType: 0 替换, 1 追加
+     */
+    uploadTable: (file: File, options: { tableId?: string; name?: string; datasetGroupId?: string; sheet?: string; editType?: number } = {}) => {
+        const form = new FormData();
+        form.append('file', file);
+        if (options.name) form.append('name', options.name);
+        if (options.datasetGroupId) form.append('datasetGroupId', options.datasetGroupId);
+        if (options.sheet) form.append('sheet', options.sheet);
+        form.append('editType', String(options.editType ?? 0));
+        const url = options.tableId ? `/dataset/table/${options.tableId}/upload` : '/dataset/table/upload';
+        return request.post<any, DatasetTable>(url, form);
+    },
+
+    // 重新请求 API 数据源并刷新抽取数据
+    extractTable: (id: string) =>
+        request.post<any, { tableId: string; rowCount: number; pages: number; extractTime: number }>(`/dataset/table/${id}/extract`),
+
+    // 同步到抽取库: 全量抽取成功后图表改为读取抽取数据
+    syncTable: (id: string, data: SyncRequest = {}) =>
+        request.post<any, DatasetTableTask>(`/dataset/table/${id}/sync`, data),
+    disableSync: (id: string) =>
+        request.delete<any, { message: string }>(`/dataset/table/${id}/sync`),
+    listSyncTasks: (id: string) =>
+        request.get<any, { tasks: DatasetTableTask[] }>(`/dataset/table/${id}/tasks`),
+
+    // 关联数据集: 保存后后端会重新同步字段
+    getUnions: (id: string) =>
+        request.get<any, { unions: DatasetTableUnion[] }>(`/dataset/table/${id}/unions`),
+    saveUnions: (id: string, unions: DatasetTableUnion[]) =>
+        request.put<any, { unions: DatasetTableUnion[] }>(`/dataset/table/${id}/unions`, { unions }),
+
+    // 字段去重值: 用于过滤组件的下拉选项,支持前缀搜索和分页
+    fieldValues: (id: string, fieldId: string, data: FieldValuesParams = {}) => {
+        const { variables, ...query } = data;
+        const params: Record<string, any> = { ...query };
+        Object.entries(variables || {}).forEach(([name, value]) => {
+            params[`vars[${name}]`] = value;
+        });
+        return request.get<any, FieldValuesResult>(`/dataset/${id}/fields/${fieldId}/values`, {
+            params,
+            paramsSerializer: { indexes: null },
+        });
+    },
 };
 
 // 保留向后兼容的导出
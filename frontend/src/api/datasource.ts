@@ -30,8 +30,72 @@ export const datasourceAPI = {
     testConnectionByConfig: (config: string) => request.post<ConnectionTestResult>('/datasource/test-config', { configuration: config }),
     getDatabases: (id: string) => request.get<string[]>(`/datasource/${id}/databases`),
     getTables: (id: string, database: string) => request.get<string[]>(`/datasource/${id}/tables?database=${database}`),
+    getTableSchema: (id: string, database: string, table: string) =>
+        request.get<TableInfo>(`/datasource/${id}/schema`, { params: { database, table } }),
+    // 元数据目录
+    getCatalog: (id: string) => request.get<MetadataSnapshot>(`/datasource/${id}/catalog`),
+    refreshCatalog: (id: string) => request.post<CatalogRefreshResult>(`/datasource/${id}/catalog/refresh`, {}),
+    listSnapshots: (id: string, limit = 20) => request.get<MetadataSnapshot[]>(`/datasource/${id}/catalog/snapshots`, { params: { limit } }),
+    getSnapshotChanges: (id: string, snapshotId: string) =>
+        request.get<{ changes: MetadataChange[] }>(`/datasource/${id}/catalog/snapshots/${snapshotId}/changes`),
 };
 
+// 表结构,各类型数据源字段一致
+export interface ColumnInfo {
+    name: string;
+    nativeType: string;
+    logicalType: number; // DeType: 0:text, 1:time, 2:int, 3:float, 4:bool, 5:geo
+    nullable: boolean;
+    primaryKey: boolean;
+    default: string | null;
+    comment: string;
+    ordinal: number;
+}
+
+export interface IndexInfo {
+    name: string;
+    columns: string[];
+    unique: boolean;
+    primary: boolean;
+}
+
+export interface TableInfo {
+    name: string;
+    comment: string;
+    rowEstimate: number; // -1 表示未知
+    columns: ColumnInfo[];
+    indexes: IndexInfo[];
+}
+
+export interface MetadataSnapshot {
+    id: string;
+    datasourceId: string;
+    status: 'success' | 'failed';
+    error?: string;
+    tableCount: number;
+    columnCount: number;
+    changeCount: number;
+    catalog?: string;
+    createTime: number;
+}
+
+export interface MetadataChange {
+    id: string;
+    snapshotId: string;
+    changeType: 'table_added' | 'table_removed' | 'column_added' | 'column_removed' | 'column_type_changed';
+    tableName: string;
+    columnName: string;
+    oldType: string;
+    newType: string;
+    datasets: { id: string; name: string; fields: string[] }[];
+    charts: { id: string; name: string; tableId: string }[];
+}
+
+export interface CatalogRefreshResult {
+    snapshot: MetadataSnapshot;
+    changes: MetadataChange[];
+}
+
 export const updateDatasource = (id: string, data: UpdateDatasourceRequest) => {
     return request.put<any, Datasource>(`/datasource/${id}`, data);
 };
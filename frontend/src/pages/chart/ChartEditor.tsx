@@ -80,8 +80,8 @@ const ChartEditor = () => {
     // 加载图表真实数据
     const loadChartData = async (chartId: string) => {
         try {
-            const data = await chartAPI.getData(chartId);
-            setPreviewData(data);
+            const result = await chartAPI.getData(chartId);
+            setPreviewData(result.data);
         } catch (error: any) {
             console.error('Failed to load chart data:', error);
             // 如果加载失败，使用 Mock 数据
@@ -66,6 +66,10 @@ const DatasourceList: React.FC = () => {
                     clickhouse: 'purple',
                     oracle: 'orange',
                     sqlserver: 'red',
+                    sqlite: 'cyan',
+                    api: 'gold',
+                    mongodb: 'lime',
+                    elasticsearch: 'geekblue',
                 };
                 return <Tag color={colorMap[type] || 'default'}>{type.toUpperCase()}</Tag>;
             },
@@ -85,6 +85,10 @@ const DatasourceModal: React.FC<DatasourceModalProps> = ({
                         <Select.Option value="postgresql">PostgreSQL</Select.Option>
                         <Select.Option value="oracle">Oracle</Select.Option>
                         <Select.Option value="sqlserver">SQL Server</Select.Option>
+                        <Select.Option value="sqlite">SQLite</Select.Option>
+                        <Select.Option value="mongodb">MongoDB</Select.Option>
+                        <Select.Option value="elasticsearch">Elasticsearch</Select.Option>
+                        <Select.Option value="api">REST API</Select.Option>
                     </Select>
                 </Form.Item>
                 <Form.Item name="description" label="描述">
@@ -1,5 +1,7 @@
 import axios from 'axios';
-import type { ChartView, CreateChartRequest, UpdateChartRequest } from '../types/chart';
+import type { TableInfo } from '../api/datasource';
+import type { ChartView, CreateChartRequest, UpdateChartRequest, ChartDataResult } from '../types/chart';
+import type { FieldSyncReport, CalculatedField, ExpressionCheck } from '../types/dataset';
 
 const API_BASE_URL = '/api/v1';
 
@@ -82,7 +84,8 @@ export const chartApi = {
      * 获取图表数据
      */
     getData: async (id: string): Promise<any[]> => {
-        return apiClient.get(`/chart/${id}/data`);
+        const result: ChartDataResult = await apiClient.get(`/chart/${id}/data`);
+        return result.data;
     },
 };
 
@@ -112,11 +115,46 @@ export const datasetApi = {
     },
 
     /**
-     * 同步字段
+     * 同步字段,返回新增、类型变化、缺失和恢复的字段
      */
-    syncFields: async (id: string): Promise<void> => {
+    syncFields: async (id: string): Promise<FieldSyncReport> => {
         return apiClient.post(`/dataset/table/${id}/fields/sync`);
     },
+
+    /**
+     * 获取计算字段列表
+     */
+    listCalculatedFields: async (tableId: string): Promise<CalculatedField[]> => {
+        return apiClient.get(`/dataset/calculated-field/table/${tableId}`);
+    },
+
+    /**
+     * 创建计算字段
+     */
+    createCalculatedField: async (data: Pick<CalculatedField, 'datasetTableId' | 'fieldName' | 'displayName' | 'expression'>): Promise<CalculatedField> => {
+        return apiClient.post('/dataset/calculated-field', data);
+    },
+
+    /**
+     * 更新计算字段
+     */
+    updateCalculatedField: async (id: string, data: Partial<Pick<CalculatedField, 'fieldName' | 'displayName' | 'expression'>>): Promise<CalculatedField> => {
+        return apiClient.put(`/dataset/calculated-field/${id}`, data);
+    },
+
+    /**
+     * 删除计算字段
+     */
+    deleteCalculatedField: async (id: string): Promise<void> => {
+        return apiClient.delete(`/dataset/calculated-field/${id}`);
+    },
+
+    /**
+     * 校验计算字段表达式,返回带位置的语法和类型错误
+     */
+    validateExpression: async (data: { datasetTableId: string; id?: string; fieldName?: string; expression: string }): Promise<ExpressionCheck> => {
+        return apiClient.post('/dataset/calculated-field/validate', data);
+    },
 };
 
 /**
@@ -155,7 +193,7 @@ export const datasourceApi = {
     /**
      * 获取表结构
      */
-    getTableSchema: async (id: string, database: string, table: string): Promise<any> => {
+    getTableSchema: async (id: string, database: string, table: string): Promise<TableInfo> => {
         return apiClient.get(`/datasource/${id}/schema?database=${database}&table=${table}`);
     },
 };
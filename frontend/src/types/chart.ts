@@ -69,12 +69,44 @@ export interface ChartAxisConfig {
     fields: ChartFieldConfig[];
 }
 
+export type ChartAggregate =
+    | 'SUM' | 'AVG' | 'COUNT' | 'MAX' | 'MIN'
+    | 'COUNT_DISTINCT' | 'APPROX_COUNT_DISTINCT'
+    | 'MEDIAN' | 'P90' | 'P95' | 'P99'
+    | 'STDDEV' | 'VARIANCE'
+    | 'FIRST' | 'LAST';
+
+// 指标展示格式,未设置的项由后端按聚合方式补全默认值
+export interface MeasureFormat {
+    type?: 'number' | 'percent' | 'currency';
+    decimals?: number;
+    thousandsSeparator?: boolean;
+    unit?: '' | 'K' | 'M' | 'B' | '万' | '亿';
+    prefix?: string;
+    suffix?: string;
+}
+
+export interface MeasureMeta {
+    name: string; // 结果中的列名
+    field: string;
+    aggregate?: ChartAggregate;
+    dataType: 'number' | 'text' | 'time';
+    format?: MeasureFormat;
+}
+
 export interface ChartFieldConfig {
     id: string;
     name: string;
     dataType?: string;
-    aggregate?: 'sum' | 'avg' | 'count' | 'max' | 'min';
+    aggregate?: ChartAggregate;
     sort?: 'asc' | 'desc';
+    orderBy?: string; // FIRST、LAST 的排序字段,默认为第一个时间字段
+    format?: MeasureFormat;
+    // 时间维度配置
+    granularity?: 'year' | 'quarter' | 'month' | 'week' | 'day' | 'hour' | 'minute';
+    weekStart?: 'sunday' | 'monday' | 'tuesday' | 'wednesday' | 'thursday' | 'friday' | 'saturday';
+    timeZone?: string;
+    gapFill?: 'null' | 'zero';
 }
 
 // 自定义属性结构（简化版）
@@ -129,3 +161,42 @@ export interface ChartConfig {
     smooth?: boolean;
     [key: string]: any; // 允许其他自定义配置
 }
+
+// 图表数据查询结果
+export interface ChartQueryFilter {
+    filters?: { field: string; operator: string; value: any }[];
+    limit?: number;
+    offset?: number;
+    variables?: Record<string, string | number | (string | number)[]>; // SQL 数据集变量
+    drill?: DrillStep[]; // 钻取路径,按层级依次为点击的字段和值
+}
+
+export interface DrillStep {
+    field: string;
+    value: string | number;
+}
+
+// 面包屑,返回该层级时钻取路径保留前 level 级
+export interface DrillCrumb {
+    level: number;
+    field: string;
+    label: string;
+    value?: string | number; // 该层级点击的值,当前层级为空
+}
+
+export interface DrillState {
+    drillId: string;
+    hierarchy: string[];
+    level: number;
+    field: string; // 当前层级的维度字段,也是结果中的列名
+    canDrillDown: boolean;
+    breadcrumbs: DrillCrumb[];
+}
+
+export interface ChartDataResult {
+    data: any[];
+    engine: 'native' | 'calcite'; // 实际执行路径
+    fallback: boolean; // 是否由备用路径执行
+    measures: MeasureMeta[]; // 指标列的数据类型和展示格式
+    drill?: DrillState;
+}
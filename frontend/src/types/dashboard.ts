@@ -1,5 +1,7 @@
 // Dashboard 仪表板类型定义
 
+import type { ChartDataResult } from './chart';
+
 export interface Dashboard {
     id: string;
     name: string;
@@ -40,3 +42,68 @@ export interface UpdateDashboardRequest {
 export interface DashboardListParams {
     pid?: string;
 }
+
+// 联动过滤条件
+export interface LinkageFilter {
+    field: string;
+    operator: string;
+    value: any;
+}
+
+// 组件联动事件
+export interface LinkageEvent {
+    sourceComponentId: string;
+    field: string;                // 源图表上被点击的字段
+    value: any;                   // 为空时清除联动条件,数组按 IN 过滤
+    linkageType?: 'click' | 'hover' | 'select';
+    filters?: Record<string, LinkageFilter[]>; // 各组件当前生效的过滤条件
+}
+
+// 受联动影响的组件
+export interface LinkedComponent {
+    componentId: string;
+    chartId: string;
+    filters: LinkageFilter[];     // 联动后生效的过滤条件,后续事件原样回传
+    data?: ChartDataResult;
+    error?: string;
+}
+
+export interface LinkageResult {
+    components: LinkedComponent[];
+}
+
+// 仪表板参数,值按 fieldMapping 作为各组件的过滤条件,同时作为同名 SQL 变量
+export interface DashboardParameter {
+    id: string;
+    dashboardId: string;
+    name: string;
+    paramType: 'text' | 'date' | 'select' | 'multiselect'; // date 可用逗号分隔起止日期
+    defaultValue?: string;        // 多选以逗号分隔
+    options?: string;             // JSON数组,为空时从映射字段查询可选值
+    fieldMapping?: string;        // JSON对象,组件ID -> 字段ID
+    required: boolean;
+    enable: boolean;
+    createTime?: number;
+    updateTime?: number;
+}
+
+export type SaveDashboardParameterRequest = Omit<DashboardParameter, 'id' | 'dashboardId' | 'createTime' | 'updateTime'>;
+
+// 仪表板批量数据查询参数
+export interface DashboardDataParams {
+    parameters?: Record<string, string | string[]>; // 仪表板参数取值,按参数名提供
+    variables?: Record<string, string | number | (string | number)[]>; // 仪表板参数,作为 SQL 数据集变量
+    filters?: Record<string, LinkageFilter[]>; // 各组件的过滤条件,按组件ID提供
+}
+
+// 单个图表组件的数据,失败或超时时只有 error
+export interface DashboardComponentData {
+    componentId: string;
+    chartId: string;
+    data?: ChartDataResult;
+    error?: string;
+}
+
+export interface DashboardDataResult {
+    components: DashboardComponentData[];
+}
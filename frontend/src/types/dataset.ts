@@ -1,3 +1,5 @@
+export type DatasetType = 'db' | 'sql' | 'excel' | 'api' | 'union';
+
 export interface DatasetGroup {
     id: string;
     name: string;
@@ -16,8 +18,9 @@ export interface DatasetTable {
     tableName?: string;
     datasourceId: string;
     datasetGroupId: string;
-    type: 'db' | 'sql';
+    type: DatasetType;
     info: string; // JSON string
+    mode?: number; // 0 直连, 1 抽取到本地抽取库
     createTime?: number;
     updateTime?: number;
     createBy?: string;
@@ -35,6 +38,42 @@ export interface DatasetTableField {
     groupType: 'd' | 'q'; // dimension | measure
     checked: boolean;
     columnIndex: number;
+    missing?: boolean; // 源中已不存在的列,保留字段ID和用户设置
+}
+
+// 字段同步的变更报告
+export interface FieldSyncReport {
+    added: DatasetTableField[];
+    changed: { field: DatasetTableField; oldType: string; newType: string }[];
+    missing: DatasetTableField[];
+    restored: DatasetTableField[];
+    unchanged: number;
+}
+
+// 计算字段,表达式中以 [字段名] 引用数据集字段或其他计算字段
+export interface CalculatedField {
+    id: string;
+    datasetTableId: string;
+    fieldName: string;
+    displayName?: string;
+    expression: string;
+    dataType: 'string' | 'double' | 'date' | 'boolean';
+    createTime?: number;
+    updateTime?: number;
+}
+
+// 表达式错误,pos 为从 1 开始的字符位置
+export interface ExpressionError {
+    pos: number;
+    message: string;
+}
+
+// 表达式校验结果
+export interface ExpressionCheck {
+    valid: boolean;
+    dataType?: CalculatedField['dataType'];
+    aggregated: boolean;
+    errors: ExpressionError[];
 }
 
 export interface CreateGroupRequest {
@@ -50,6 +89,63 @@ export interface CreateTableRequest {
     tableName?: string;
     datasourceId: string;
     datasetGroupId: string;
-    type: 'db' | 'sql';
+    type: DatasetType;
+    info: string;
+}
+
+// 关联数据集的关联关系,表和字段均为成员数据集的ID
+export interface DatasetTableUnion {
+    id?: string;
+    datasetTableId?: string;
+    parentTableId: string;
+    parentFieldId: string;
+    currentTableId: string;
+    currentFieldId: string;
+    unionType: 'left' | 'right' | 'inner' | 'full';
+}
+
+// 数据集抽取任务, info 为 JSON: incrementalField、incrementalSql、rowCount、watermark、error
+export interface DatasetTableTask {
+    id: string;
+    tableId: string;
+    type: 'all_scope' | 'incremental';
+    status: 'pending' | 'running' | 'success' | 'failed';
+    startTime: number;
+    endTime: number;
     info: string;
+    lastExecStatus?: string;
+    createTime?: number;
+    updateTime?: number;
+}
+
+export interface SyncRequest {
+    type?: 'all_scope' | 'incremental';
+    incrementalField?: string; // 水位列
+    incrementalSql?: string; // 可引用 ${__last_update_time__} 和 ${__current_update_time__}
+}
+
+// SQL 数据集变量,在 SQL 中以 ${name} 引用,随 info.variables 保存
+export interface SQLVariable {
+    name: string;
+    type: 'text' | 'number' | 'date' | 'datetime';
+    defaultValue?: string | number | (string | number)[];
+    required?: boolean;
+    multiple?: boolean; // 多值,用于 IN (${name})
+}
+
+// 字段去重值查询条件,search 为不区分大小写的前缀搜索
+export interface FieldValuesParams {
+    search?: string;
+    limit?: number; // 默认 100,最大 1000
+    offset?: number;
+    counts?: boolean; // 返回每个值的行数
+    variables?: Record<string, string | number | (string | number)[]>; // SQL 数据集变量
+}
+
+// 一页字段去重值,结果已按当前用户的行权限过滤
+export interface FieldValuesResult {
+    values: any[];
+    counts?: number[]; // 与 values 一一对应
+    hasMore: boolean;
+    capped: boolean; // 超过可翻页的去重值上限,其余值需要通过搜索获得
 }